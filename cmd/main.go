@@ -1,15 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"expvar"
 	"fmt"
 	"log"
 	"log/slog"
 	"os"
+	"time"
 
 	"example.com/authorization/internal/controller"
 	"example.com/authorization/internal/grpcserver"
 	"example.com/authorization/internal/repository"
 	"example.com/authorization/internal/service"
+	"example.com/authorization/migration"
 	"example.com/authorization/pkg"
 	_ "github.com/go-sql-driver/mysql"
 )
@@ -24,13 +29,29 @@ func main() {
 
 	initLogger(cfg.LogLevel)
 
-	ctrl, postSrv, err := buildController(cfg)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err := runMigrate(cfg, os.Args[2:])
+		if errors.Is(err, errMigrateUsage) {
+			fmt.Fprintf(os.Stderr, migrateUsage, os.Args[0])
+			os.Exit(2)
+		}
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	ctrl, postSrv, authSrv, err := buildController(cfg)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	go postSrv.RefreshHotScores(context.Background(), cfg.HotScoreRefreshInterval)
+
 	go func() {
-		if err := grpcserver.ListenAndServe(cfg.GrpcAddr, postSrv); err != nil {
+		if err := grpcserver.ListenAndServe(cfg.GrpcAddr, postSrv, authSrv); err != nil {
 			log.Fatal(err)
 		}
 	}()
@@ -46,25 +67,78 @@ func initLogger(level slog.Level) {
 	})))
 }
 
-func buildController(cfg pkg.Config) (controller.Controller, service.PostService, error) {
+func buildController(cfg pkg.Config) (controller.Controller, service.PostService, service.AuthService, error) {
 	sqldb, err := pkg.NewSQLRepository(cfg.DBConnectionURI)
 	if err != nil {
-		return controller.Controller{}, service.PostService{}, fmt.Errorf("database connection failed: %w", err)
+		return controller.Controller{}, service.PostService{}, service.AuthService{}, fmt.Errorf("database connection failed: %w", err)
+	}
+
+	if cfg.AutoMigrate {
+		migrator, err := pkg.NewMigrator(sqldb, migration.FS)
+		if err != nil {
+			return controller.Controller{}, service.PostService{}, service.AuthService{}, err
+		}
+
+		err = migrator.Up(context.Background())
+		if err != nil {
+			return controller.Controller{}, service.PostService{}, service.AuthService{}, fmt.Errorf("migrating the database failed: %w", err)
+		}
 	}
 
-	cache := pkg.NewCache(cfg.RedisAddr)
+	cache := pkg.NewCache(cfg.RedisAddr, pkg.CacheOptions{
+		Timeout:          cfg.CacheTimeout,
+		BreakerThreshold: cfg.CacheBreakerThreshold,
+		BreakerCooldown:  cfg.CacheBreakerCooldown,
+	})
+	expvar.Publish("cache", expvar.Func(func() any {
+		return cache.Stats()
+	}))
 
 	commentRepo := repository.NewCommentRepo(sqldb, cache)
-	postRepo := repository.NewPostRepository(sqldb, cache)
-	userRepo := repository.NewUserRepository(sqldb)
+	postRepo := repository.NewPostRepository(sqldb, cache, cfg.FeedCacheTTL)
+	userRepo := repository.NewUserRepository(sqldb, cache)
+	tokenRepo := repository.NewTokenRepository(cache)
+	auditRepo := repository.NewAuditRepository(sqldb)
+	flagRepo := repository.NewFlagRepository(sqldb, cache)
+	searchRepo := repository.NewSearchRepository(sqldb)
+
+	var keys *service.KeySet
+	if cfg.JwtSigningKeysDir != "" {
+		keys, err = service.NewKeySet(cfg.JwtSigningKeysDir, cfg.JwtActiveKeyID, cfg.JwtKeyPublishLead)
+		if err != nil {
+			return controller.Controller{}, service.PostService{}, service.AuthService{}, fmt.Errorf("loading signing keys failed: %w", err)
+		}
+
+		go keys.ReloadEvery(context.Background(), cfg.JwtKeyReloadInterval)
+	}
+
+	analyticsSrv := service.NewAnalyticsService(cache, cfg.AnalyticsBufferSize, cfg.AnalyticsRetention, cfg.PostViewWindow)
+	expvar.Publish("analyticsDropped", expvar.Func(func() any {
+		return analyticsSrv.Dropped()
+	}))
+
+	go analyticsSrv.Run(context.Background(), time.Second)
+	go analyticsSrv.DecayTrending(context.Background(), cfg.TrendingDecayInterval, cfg.TrendingHalfLife)
+	passwordPolicy, err := pkg.LoadPasswordPolicy(cfg)
+	if err != nil {
+		return controller.Controller{}, service.PostService{}, service.AuthService{}, err
+	}
+
+	authSrv := service.NewAuthorizationService(cfg, keys, userRepo, tokenRepo)
+	loginGuard := service.NewLoginGuard(cfg, repository.NewLoginAttemptRepository(cache))
+	expvar.Publish("loginGuard", expvar.Func(func() any {
+		return loginGuard.Stats()
+	}))
 
-	analyticsSrv := service.NewAnalyticsService(cache)
-	authSrv := service.NewAuthorizationService(cfg.JwtSecret, userRepo)
-	userSrv := service.NewUserService(userRepo, authSrv)
-	postSrv := service.NewPostService(postRepo)
-	commentSrv := service.NewCommentService(commentRepo)
+	userSrv := service.NewUserService(cfg, userRepo, tokenRepo, authSrv, pkg.NewMailer(cfg), passwordPolicy, loginGuard)
+	postSrv := service.NewPostService(postRepo, commentRepo, analyticsSrv, cfg.PostEditWindow)
+	commentSrv := service.NewCommentService(commentRepo, cfg.CommentEditWindow)
+	auditSrv := service.NewAuditService(auditRepo)
+	moderationSrv := service.NewModerationService(flagRepo, cfg.FlagHideThreshold)
+	searchSrv := service.NewSearchService(searchRepo)
+	oauthSrv := service.NewOAuthService(cfg, repository.NewIdentityRepository(sqldb), userRepo, tokenRepo, authSrv, userSrv)
 
-	ctrl := controller.NewController(cfg, authSrv, userSrv, postSrv, commentSrv, analyticsSrv)
+	ctrl := controller.NewController(cfg, authSrv, userSrv, postSrv, commentSrv, analyticsSrv, auditSrv, moderationSrv, searchSrv, oauthSrv)
 
-	return ctrl, postSrv, nil
+	return ctrl, postSrv, authSrv, nil
 }
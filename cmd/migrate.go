@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"example.com/authorization/migration"
+	"example.com/authorization/pkg"
+)
+
+const migrateUsage = `usage: %s migrate <command>
+
+commands:
+  up              apply every pending migration
+  down [steps]    revert the last applied migration, or the last steps ones
+  status          list migrations and whether they are applied
+  to <version>    apply or revert migrations until version is the last one applied
+  force <version> mark migrations up to version as applied without running them
+`
+
+var errMigrateUsage = errors.New("invalid migrate command")
+
+func newMigrator(cfg pkg.Config) (pkg.Migrator, error) {
+	sqldb, err := pkg.NewSQLRepository(cfg.DBConnectionURI)
+	if err != nil {
+		return pkg.Migrator{}, fmt.Errorf("database connection failed: %w", err)
+	}
+
+	return pkg.NewMigrator(sqldb, migration.FS)
+}
+
+// runMigrate is the migrate subcommand, args are the arguments following "migrate"
+func runMigrate(cfg pkg.Config, args []string) error {
+	if len(args) == 0 {
+		return errMigrateUsage
+	}
+
+	migrator, err := newMigrator(cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		return migrator.Up(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return errMigrateUsage
+			}
+		}
+
+		return migrator.Down(ctx, steps)
+	case "to", "force":
+		if len(args) < 2 {
+			return errMigrateUsage
+		}
+
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || version < 0 {
+			return errMigrateUsage
+		}
+
+		if args[0] == "force" {
+			return migrator.Force(ctx, version)
+		}
+
+		return migrator.To(ctx, version)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		printMigrationStatus(statuses)
+
+		return nil
+	default:
+		return errMigrateUsage
+	}
+}
+
+func printMigrationStatus(statuses []pkg.MigrationStatus) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+
+	for _, s := range statuses {
+		state := "pending"
+		switch {
+		case s.Dirty:
+			state = "dirty"
+		case s.Changed:
+			state = "changed"
+		case s.Applied:
+			state = "applied"
+		}
+
+		var appliedAt string
+		if s.Applied {
+			appliedAt = s.AppliedAt.Format(time.DateTime)
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.Version, s.Name, state, appliedAt)
+	}
+
+	w.Flush()
+}
@@ -3,3 +3,5 @@ package constants
 type UserIDContextKey string
 
 var UsrIDContextKey UserIDContextKey = "userID"
+
+var UsrRoleContextKey UserIDContextKey = "userRole"
@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"errors"
+
+	"example.com/authorization/internal/constants"
+	"example.com/authorization/internal/controller/dto"
+	"example.com/authorization/internal/service"
+	"example.com/authorization/pkg"
+	"github.com/gofiber/fiber/v3"
+)
+
+func (ctrl Controller) HandleVerifyEmail(c fiber.Ctx) error {
+	var request dto.VerifyEmailRequest
+
+	err := c.Bind().Body(&request)
+	if err != nil || len(request.Token) == 0 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	err = ctrl.userSrv.VerifyEmail(c.Context(), request.Token)
+	if err != nil {
+		return accountErrorResponse(c, err)
+	}
+
+	return c.JSON(dto.Response{
+		Message: "ok",
+	})
+}
+
+func (ctrl Controller) HandleResendEmailVerification(c fiber.Ctx) error {
+	userID, ok := c.Context().Value(constants.UsrIDContextKey).(int64)
+	if !ok {
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+
+	err := ctrl.userSrv.ResendEmailVerification(c.Context(), userID)
+	if err != nil {
+		return accountErrorResponse(c, err)
+	}
+
+	return c.JSON(dto.Response{
+		Message: "ok",
+	})
+}
+
+// HandleForgotPassword answers the same whether an account uses the email or not
+func (ctrl Controller) HandleForgotPassword(c fiber.Ctx) error {
+	var request dto.ForgotPasswordRequest
+
+	err := c.Bind().Body(&request)
+	if err != nil {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	err = ctrl.userSrv.ForgotPassword(c.Context(), request.Email)
+	if err != nil {
+		return accountErrorResponse(c, err)
+	}
+
+	return c.JSON(dto.Response{
+		Message: "if an account uses this email a password reset link was sent to it",
+	})
+}
+
+func (ctrl Controller) HandleResetPassword(c fiber.Ctx) error {
+	var request dto.ResetPasswordRequest
+
+	err := c.Bind().Body(&request)
+	if err != nil || len(request.Token) == 0 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	err = ctrl.userSrv.ResetPassword(c.Context(), request.Token, request.Password)
+	if err != nil {
+		return accountErrorResponse(c, err)
+	}
+
+	return c.JSON(dto.Response{
+		Message: "ok",
+	})
+}
+
+func accountErrorResponse(c fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidToken):
+		return c.Status(fiber.StatusBadRequest).JSON(dto.Response{
+			Message: "invalid or expired token",
+		})
+	case errors.Is(err, service.ErrInvalidEmail):
+		return c.Status(fiber.StatusBadRequest).JSON(dto.Response{
+			Message: "invalid email",
+		})
+	case errors.Is(err, pkg.ErrPasswordTooShort):
+		return c.Status(fiber.StatusBadRequest).JSON(dto.Response{
+			Message: "password too short",
+		})
+	case errors.Is(err, pkg.ErrPasswordTooLong):
+		return c.Status(fiber.StatusBadRequest).JSON(dto.Response{
+			Message: "password too long",
+		})
+	case errors.Is(err, pkg.ErrPasswordBreached):
+		return c.Status(fiber.StatusBadRequest).JSON(dto.Response{
+			Message: "password is known from a data breach, pick another one",
+		})
+	case errors.Is(err, service.ErrInvalidPassword):
+		return c.Status(fiber.StatusBadRequest).JSON(dto.Response{
+			Message: "invalid password",
+		})
+	case errors.Is(err, service.ErrEmailAlreadyVerified):
+		return c.Status(fiber.StatusConflict).JSON(dto.Response{
+			Message: "email already verified",
+		})
+	case errors.Is(err, service.ErrEmailAlreadyRegistered):
+		return c.Status(fiber.StatusConflict).JSON(dto.Response{
+			Message: "email already registered",
+		})
+	case errors.Is(err, service.ErrUserAlreadyRegistered):
+		return c.Status(fiber.StatusConflict).JSON(dto.Response{
+			Message: "username already registered",
+		})
+	default:
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+}
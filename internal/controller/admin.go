@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"errors"
+	"strconv"
+
+	"example.com/authorization/internal/controller/dto"
+	"example.com/authorization/internal/domain"
+	"example.com/authorization/internal/repository"
+	"example.com/authorization/internal/service"
+	"github.com/gofiber/fiber/v3"
+)
+
+func (ctrl Controller) HandleUpdateUserRole(c fiber.Ctx) error {
+	var request dto.UpdateUserRoleRequest
+
+	err := c.Bind().Body(&request)
+	if err != nil {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	userIDStr := c.Params("userId")
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil || len(userIDStr) == 0 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	err = ctrl.userSrv.UpdateRole(c.Context(), actor, userID, domain.Role(request.Role))
+	if err != nil {
+		return adminErrorResponse(c, err)
+	}
+
+	return c.JSON(dto.Response{
+		Message: "ok",
+	})
+}
+
+func (ctrl Controller) HandleDeleteUser(c fiber.Ctx) error {
+	userIDStr := c.Params("userId")
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil || len(userIDStr) == 0 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	err = ctrl.userSrv.Delete(c.Context(), actor, userID)
+	if err != nil {
+		return adminErrorResponse(c, err)
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (ctrl Controller) HandleSuspendUser(c fiber.Ctx) error {
+	return ctrl.setUserSuspended(c, true)
+}
+
+func (ctrl Controller) HandleUnsuspendUser(c fiber.Ctx) error {
+	return ctrl.setUserSuspended(c, false)
+}
+
+func (ctrl Controller) setUserSuspended(c fiber.Ctx, suspended bool) error {
+	userIDStr := c.Params("userId")
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil || len(userIDStr) == 0 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	err = ctrl.userSrv.SetSuspended(c.Context(), actor, userID, suspended)
+	if err != nil {
+		return adminErrorResponse(c, err)
+	}
+
+	return c.JSON(dto.Response{
+		Message: "ok",
+	})
+}
+
+func (ctrl Controller) HandleListAuditLog(c fiber.Ctx) error {
+	var req dto.ListAuditLogRequest
+	var response dto.ListAuditLogResponse
+
+	err := c.Bind().Query(&req)
+	if err != nil {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	req.Sanitize()
+
+	logs, err := ctrl.auditSrv.List(c.Context(), req.Size, req.Page)
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	response.Entries = make([]dto.AuditLog, 0, len(logs))
+	for _, l := range logs {
+		response.Entries = append(response.Entries, l.ToDTO())
+	}
+
+	return c.JSON(response)
+}
+
+func adminErrorResponse(c fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, repository.ErrUserNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(dto.Response{
+			Message: "user not found",
+		})
+	case errors.Is(err, service.ErrInvalidRole):
+		return c.Status(fiber.StatusBadRequest).JSON(dto.Response{
+			Message: "invalid role",
+		})
+	case errors.Is(err, service.ErrSuspendSelf):
+		return c.Status(fiber.StatusBadRequest).JSON(dto.Response{
+			Message: "cannot suspend yourself",
+		})
+	case errors.Is(err, service.ErrPermissionDenied):
+		return c.Status(fiber.StatusForbidden).JSON(dto.Response{
+			Message: "permission denied",
+		})
+	default:
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"errors"
+	"time"
+
+	"example.com/authorization/internal/controller/dto"
+	"example.com/authorization/internal/domain"
+	"example.com/authorization/internal/service"
+	"example.com/authorization/pkg"
+	"github.com/gofiber/fiber/v3"
+)
+
+// defaultAnalyticsDays is how many days are reported when no range is asked for
+const defaultAnalyticsDays = 7
+
+func (ctrl Controller) HandleAnalytics(c fiber.Ctx) error {
+	var req dto.AnalyticsRequest
+
+	err := c.Bind().Query(&req)
+	if err != nil {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	req.Sanitize()
+
+	to := time.Now().UTC()
+	if req.To != "" {
+		to, err = time.Parse(domain.AnalyticsDateLayout, req.To)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(dto.Response{
+				Message: "to must be a date formatted as " + domain.AnalyticsDateLayout,
+			})
+		}
+	}
+
+	from := to.AddDate(0, 0, 1-defaultAnalyticsDays)
+	if req.From != "" {
+		from, err = time.Parse(domain.AnalyticsDateLayout, req.From)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(dto.Response{
+				Message: "from must be a date formatted as " + domain.AnalyticsDateLayout,
+			})
+		}
+	}
+
+	report, err := ctrl.analyticsSrv.Report(c.Context(), from, to, req.Top)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidDateRange) {
+			return c.Status(fiber.StatusBadRequest).JSON(dto.Response{
+				Message: "from has to be before to and within the analytics retention",
+			})
+		}
+
+		if errors.Is(err, pkg.ErrCircuitOpen) {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(dto.Response{
+				Message: "analytics are unavailable right now",
+			})
+		}
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(report.ToDTO())
+}
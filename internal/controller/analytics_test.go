@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"example.com/authorization/internal/controller/dto"
+	"example.com/authorization/internal/domain"
+)
+
+func TestAnalyticsAreOnlyShownToAdmins(t *testing.T) {
+	t.Parallel()
+
+	ta := newTestApp(t)
+	_, userToken := ta.newUser(t, "alice", domain.RoleUser)
+	_, moderatorToken := ta.newUser(t, "bob", domain.RoleModerator)
+	_, adminToken := ta.newUser(t, "carol", domain.RoleAdmin)
+
+	cases := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{name: "anonymous", status: http.StatusUnauthorized},
+		{name: "user", token: userToken, status: http.StatusForbidden},
+		{name: "moderator", token: moderatorToken, status: http.StatusForbidden},
+		{name: "admin", token: adminToken, status: http.StatusOK},
+	}
+
+	for _, tc := range cases {
+		status := ta.get(t, "/api/v1/admin/analytics", tc.token, nil)
+		if status != tc.status {
+			t.Errorf("%s: expected status %d, got %d", tc.name, tc.status, status)
+		}
+	}
+}
+
+func TestAnalyticsReportTheLastWeekByDefault(t *testing.T) {
+	t.Parallel()
+
+	ta := newTestApp(t)
+	_, token := ta.newUser(t, "carol", domain.RoleAdmin)
+
+	var response dto.AnalyticsResponse
+	status := ta.get(t, "/api/v1/admin/analytics", token, &response)
+	if status != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", status)
+	}
+
+	to := time.Now().UTC()
+	from := to.AddDate(0, 0, -6)
+	if response.From != from.Format(domain.AnalyticsDateLayout) || response.To != to.Format(domain.AnalyticsDateLayout) {
+		t.Errorf("expected %s to %s, got %s to %s",
+			from.Format(domain.AnalyticsDateLayout), to.Format(domain.AnalyticsDateLayout), response.From, response.To)
+	}
+
+	if len(response.Days) != 7 {
+		t.Errorf("expected 7 days, got %d", len(response.Days))
+	}
+}
+
+func TestAnalyticsRefuseInvalidDateRanges(t *testing.T) {
+	t.Parallel()
+
+	ta := newTestApp(t)
+	_, token := ta.newUser(t, "carol", domain.RoleAdmin)
+
+	// the test app keeps a week of analytics
+	for _, query := range []string{
+		"?from=yesterday",
+		"?to=2024-13-01",
+		"?from=2024-03-02&to=2024-03-01",
+		"?from=2024-03-01&to=2024-03-08",
+	} {
+		status := ta.get(t, "/api/v1/admin/analytics"+query, token, nil)
+		if status != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, status)
+		}
+	}
+
+	status := ta.get(t, "/api/v1/admin/analytics?from=2024-03-01&to=2024-03-07", token, nil)
+	if status != http.StatusOK {
+		t.Errorf("expected status 200, got %d", status)
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"example.com/authorization/internal/controller/dto"
 	"example.com/authorization/internal/domain"
 	"example.com/authorization/internal/repository"
+	"example.com/authorization/internal/service"
+	"example.com/authorization/pkg"
 	"github.com/gofiber/fiber/v3"
 )
 
@@ -29,11 +31,28 @@ func (ctrl Controller) HandleListComments(c fiber.Ctx) error {
 		return c.SendStatus(fiber.StatusBadRequest)
 	}
 
-	cs, err := ctrl.commentSrv.ListPostComments(c.Context(), postID, domain.CommentFilters{
-		Page: req.Page,
-		Size: req.Size,
-	})
+	filters := domain.CommentFilters{
+		Page:   req.Page,
+		Size:   req.Size,
+		Depth:  req.Depth,
+		Cursor: req.Cursor,
+	}
+
+	viewer, _ := actorFromContext(c)
+
+	var cs []domain.Comment
+	if req.Mode == dto.CommentsModeTree {
+		cs, response.NextCursor, err = ctrl.commentSrv.ListPostCommentTree(c.Context(), viewer, postID, filters)
+	} else {
+		cs, response.NextCursor, err = ctrl.commentSrv.ListPostComments(c.Context(), viewer, postID, filters)
+	}
 	if err != nil {
+		if errors.Is(err, pkg.ErrInvalidCursor) {
+			return c.Status(fiber.StatusBadRequest).JSON(dto.Response{
+				Message: "invalid cursor",
+			})
+		}
+
 		return c.SendStatus(fiber.StatusInternalServerError)
 	}
 
@@ -78,6 +97,52 @@ func (ctrl Controller) HandleCreateComment(c fiber.Ctx) error {
 	})
 }
 
+func (ctrl Controller) HandleCreateReply(c fiber.Ctx) error {
+	var request dto.CreateCommentRequest
+
+	err := c.Bind().Body(&request)
+	if err != nil {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	postIDStr := c.Params("postId")
+	postID, err := strconv.ParseInt(postIDStr, 10, 64)
+	if err != nil || len(postIDStr) == 0 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	commentIdStr := c.Params("commentId")
+	parentID, err := strconv.ParseInt(commentIdStr, 10, 64)
+	if err != nil || len(commentIdStr) == 0 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	userID, ok := c.Context().Value(constants.UsrIDContextKey).(int64)
+	if !ok {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	commentID, err := ctrl.commentSrv.Reply(c.Context(), domain.Comment{
+		UserID:   userID,
+		Content:  request.Content,
+		PostID:   postID,
+		ParentID: &parentID,
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrCommentNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(dto.Response{
+				Message: "cannot reply to non-existing comment",
+			})
+		}
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(dto.Response{
+		Message: fmt.Sprintf("reply created with id %d", commentID),
+	})
+}
+
 func (ctrl Controller) HandleUpvoteComment(c fiber.Ctx) error {
 	commentIdStr := c.Params("commentId")
 	commentID, err := strconv.ParseInt(commentIdStr, 10, 64)
@@ -113,12 +178,12 @@ func (ctrl Controller) HandleDeleteComment(c fiber.Ctx) error {
 		return c.SendStatus(fiber.StatusBadRequest)
 	}
 
-	userID, ok := c.Context().Value(constants.UsrIDContextKey).(int64)
+	actor, ok := actorFromContext(c)
 	if !ok {
 		return c.SendStatus(fiber.StatusInternalServerError)
 	}
 
-	err = ctrl.commentSrv.Delete(c.Context(), userID, commentID)
+	err = ctrl.commentSrv.Delete(c.Context(), actor, commentID)
 	if err != nil {
 		if errors.Is(err, repository.ErrCommentNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(dto.Response{
@@ -126,8 +191,99 @@ func (ctrl Controller) HandleDeleteComment(c fiber.Ctx) error {
 			})
 		}
 
+		if errors.Is(err, service.ErrPermissionDenied) {
+			return c.Status(fiber.StatusForbidden).JSON(dto.Response{
+				Message: "cannot delete someone else's comment",
+			})
+		}
+
 		return c.SendStatus(fiber.StatusInternalServerError)
 	}
 
 	return c.SendStatus(fiber.StatusOK)
 }
+
+func (ctrl Controller) HandleEditComment(c fiber.Ctx) error {
+	var request dto.EditCommentRequest
+
+	err := c.Bind().Body(&request)
+	if err != nil {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	commentIdStr := c.Params("commentId")
+	commentID, err := strconv.ParseInt(commentIdStr, 10, 64)
+	if err != nil || len(commentIdStr) == 0 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	userID, ok := c.Context().Value(constants.UsrIDContextKey).(int64)
+	if !ok {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	dc, err := ctrl.commentSrv.Edit(c.Context(), userID, commentID, request.Content)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrCommentNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(dto.Response{
+				Message: "comment not found",
+			})
+		case errors.Is(err, service.ErrPermissionDenied):
+			return c.Status(fiber.StatusForbidden).JSON(dto.Response{
+				Message: "cannot edit someone else's comment",
+			})
+		case errors.Is(err, service.ErrEditWindowClosed):
+			return c.Status(fiber.StatusForbidden).JSON(dto.Response{
+				Message: "comment can no longer be edited",
+			})
+		case errors.Is(err, service.ErrInvalidEdit):
+			return c.Status(fiber.StatusBadRequest).JSON(dto.Response{
+				Message: "content cannot be empty",
+			})
+		default:
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+	}
+
+	return c.JSON(dc.ToDTO())
+}
+
+func (ctrl Controller) HandleListCommentRevisions(c fiber.Ctx) error {
+	var response dto.ListCommentRevisionsResponse
+
+	commentIdStr := c.Params("commentId")
+	commentID, err := strconv.ParseInt(commentIdStr, 10, 64)
+	if err != nil || len(commentIdStr) == 0 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	dc, revisions, err := ctrl.commentSrv.ListRevisions(c.Context(), actor, commentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrCommentNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(dto.Response{
+				Message: "comment not found",
+			})
+		case errors.Is(err, service.ErrPermissionDenied):
+			return c.Status(fiber.StatusForbidden).JSON(dto.Response{
+				Message: "permission denied",
+			})
+		default:
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+	}
+
+	response.Comment = dc.ToDTO()
+	response.Revisions = make([]dto.CommentRevision, 0, len(revisions))
+	for _, r := range revisions {
+		response.Revisions = append(response.Revisions, r.ToDTO())
+	}
+
+	return c.JSON(response)
+}
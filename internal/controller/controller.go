@@ -2,11 +2,13 @@ package controller
 
 import (
 	"context"
-	"fmt"
-	"strconv"
+	"errors"
+	"strings"
 	"time"
 
 	"example.com/authorization/internal/constants"
+	"example.com/authorization/internal/controller/dto"
+	"example.com/authorization/internal/domain"
 	"example.com/authorization/internal/service"
 	"example.com/authorization/pkg"
 	"github.com/gofiber/fiber/v3"
@@ -17,27 +19,25 @@ import (
 )
 
 type Controller struct {
-	app          *fiber.App
-	authSrv      service.AuthService
-	userSrv      service.UserService
-	postSrv      service.PostService
-	commentSrv   service.CommentService
-	analyticsSrv service.AnalyticsService
+	app            *fiber.App
+	trustedProxies pkg.TrustedProxies
+	authSrv        service.AuthService
+	userSrv        service.UserService
+	postSrv        service.PostService
+	commentSrv     service.CommentService
+	analyticsSrv   service.AnalyticsService
+	auditSrv       service.AuditService
+	moderationSrv  service.ModerationService
+	searchSrv      service.SearchService
+	oauthSrv       service.OAuthService
+	// secureCookies is set when the app is served over https
+	secureCookies bool
 }
 
 func (ctrl Controller) ListenAndServe(addr string) {
 	ctrl.app.Listen(addr)
 }
 
-// seperation of concerns using this method
-func (ctrl Controller) excludedPostsAuthorizationHandler(c fiber.Ctx) error {
-	if c.Route().Path == "/api/v1/posts" && c.Method() == "GET" {
-		return c.Next()
-	}
-
-	return ctrl.authorizationHandler(c)
-}
-
 // Authorization middleware
 func (ctrl Controller) authorizationHandler(c fiber.Ctx) error {
 	headers := c.GetReqHeaders()
@@ -51,35 +51,110 @@ func (ctrl Controller) authorizationHandler(c fiber.Ctx) error {
 		return c.SendStatus(fiber.StatusForbidden)
 	}
 
-	token, err := ctrl.authSrv.ValidateToken(jwtToken)
+	actor, err := ctrl.authSrv.Authorize(c.Context(), jwtToken)
 	if err != nil {
-		return c.SendStatus(fiber.StatusInternalServerError)
-	}
+		if errors.Is(err, service.ErrUserSuspended) {
+			return suspendedResponse(c)
+		}
+
+		if errors.Is(err, service.ErrInvalidToken) {
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
 
-	userIDStr, err := token.Claims.GetSubject()
-	if err != nil {
 		return c.SendStatus(fiber.StatusInternalServerError)
 	}
 
-	userID, _ := strconv.ParseInt(userIDStr, 10, 64)
-
-	contextWithUserID := context.WithValue(c.Context(), constants.UsrIDContextKey, userID)
+	contextWithUserID := context.WithValue(c.Context(), constants.UsrIDContextKey, actor.UserID)
+	contextWithUserID = context.WithValue(contextWithUserID, constants.UsrRoleContextKey, actor.Role)
 
 	c.SetContext(contextWithUserID)
 
 	return c.Next()
 }
 
-func NewController(cfg pkg.Config, authSrv service.AuthService, userSrv service.UserService, postSrv service.PostService, commentSrv service.CommentService, analyticsSrv service.AnalyticsService) Controller {
+// optionalAuthorizationHandler authorizes the request like authorizationHandler when it carries a
+// token and lets anonymous requests through, routes readable by everyone use it to show more to
+// the users allowed to see more
+func (ctrl Controller) optionalAuthorizationHandler(c fiber.Ctx) error {
+	if len(c.Get(fiber.HeaderAuthorization)) == 0 {
+		return c.Next()
+	}
+
+	return ctrl.authorizationHandler(c)
+}
+
+// requirePermission is the policy middleware, it has to run after authorizationHandler
+func (ctrl Controller) requirePermission(p domain.Permission) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		actor, ok := actorFromContext(c)
+		if !ok {
+			return c.SendStatus(fiber.StatusForbidden)
+		}
+
+		if !actor.Role.Can(p) {
+			return c.Status(fiber.StatusForbidden).JSON(dto.Response{
+				Message: "permission denied",
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// clientIP is the address of the client, X-Forwarded-For is only believed when set by a trusted proxy
+func (ctrl Controller) clientIP(c fiber.Ctx) string {
+	return ctrl.trustedProxies.ClientIP(c.IP(), c.Get(fiber.HeaderXForwardedFor))
+}
+
+// analyticsHandler counts the visitor and, once the request is routed, the route it hit
+func (ctrl Controller) analyticsHandler(c fiber.Ctx) error {
+	own := c.Route()
+	err := c.Next()
+
+	// requests no route matched end on this handler, they are not worth a counter each
+	var route string
+	if r := c.Route(); r != own {
+		route = r.Method + " " + r.Path
+	}
+
+	ctrl.analyticsSrv.RegisterVisit(c.Context(), ctrl.clientIP(c), route)
+
+	return err
+}
+
+func actorFromContext(c fiber.Ctx) (domain.Actor, bool) {
+	userID, ok := c.Context().Value(constants.UsrIDContextKey).(int64)
+	if !ok {
+		return domain.Actor{}, false
+	}
+
+	role, ok := c.Context().Value(constants.UsrRoleContextKey).(domain.Role)
+	if !ok {
+		role = domain.RoleUser
+	}
+
+	return domain.Actor{
+		UserID: userID,
+		Role:   role,
+	}, true
+}
+
+func NewController(cfg pkg.Config, authSrv service.AuthService, userSrv service.UserService, postSrv service.PostService, commentSrv service.CommentService, analyticsSrv service.AnalyticsService, auditSrv service.AuditService, moderationSrv service.ModerationService, searchSrv service.SearchService, oauthSrv service.OAuthService) Controller {
 	app := fiber.New()
 
 	ctrl := Controller{
-		app:          app,
-		authSrv:      authSrv,
-		userSrv:      userSrv,
-		postSrv:      postSrv,
-		commentSrv:   commentSrv,
-		analyticsSrv: analyticsSrv,
+		app:            app,
+		trustedProxies: cfg.TrustedProxies,
+		secureCookies:  strings.HasPrefix(cfg.PublicURL, "https://"),
+		authSrv:        authSrv,
+		userSrv:        userSrv,
+		postSrv:        postSrv,
+		commentSrv:     commentSrv,
+		analyticsSrv:   analyticsSrv,
+		auditSrv:       auditSrv,
+		moderationSrv:  moderationSrv,
+		searchSrv:      searchSrv,
+		oauthSrv:       oauthSrv,
 	}
 
 	app.Use(logger.New(logger.Config{
@@ -91,11 +166,7 @@ func NewController(cfg pkg.Config, authSrv service.AuthService, userSrv service.
 		AllowHeaders: []string{"Origin", "Content-Type", "Accept"},
 	}))
 
-	app.All("/*", func(c fiber.Ctx) error {
-		err := ctrl.analyticsSrv.RegisterIP(c.Context(), c.Host())
-		fmt.Println(err)
-		return c.Next()
-	})
+	app.All("/*", ctrl.analyticsHandler)
 
 	api := ctrl.app.Group("/api", func(c fiber.Ctx) error {
 		return c.Next()
@@ -109,49 +180,96 @@ func NewController(cfg pkg.Config, authSrv service.AuthService, userSrv service.
 	v1profileAuthorized := v1.Group("/profile", ctrl.authorizationHandler)
 
 	ctrl.app.Get("/", ctrl.HandleHello)
+	ctrl.app.Get("/.well-known/jwks.json", ctrl.HandleJWKS)
 
 	app.Get("/web", static.New("../public/index.html"))
 
 	// Authenticatoion
 	v1.Post("/register", ctrl.HandleRegister)
 	v1.Post("/login", ctrl.HandleLogin)
-
-	v1.Get("/users/", ctrl.HandleListUsers)
-
-	v1posts := v1.Group("/posts", ctrl.excludedPostsAuthorizationHandler)
-
-	v1posts.Get("/:postId/comments", ctrl.HandleListComments)
-	v1posts.Post("/:postId/comments", ctrl.HandleCreateComment)
-	v1posts.Post("/:postId/comments/:commentId/upvote", ctrl.HandleUpvoteComment)
-	v1posts.Delete("/:postId/comments/:commentId", ctrl.HandleDeleteComment)
-	v1posts.Delete("/:postId", ctrl.HandleDeletePost)
+	v1.Post("/login/mfa", ctrl.HandleLoginMFA)
+	v1.Post("/token/refresh", ctrl.HandleRefreshToken)
+	v1.Post("/logout", ctrl.authorizationHandler, ctrl.HandleLogout)
+	v1.Post("/email/verify", ctrl.HandleVerifyEmail)
+	v1.Post("/email/verify/resend", ctrl.authorizationHandler, ctrl.HandleResendEmailVerification)
+	v1.Post("/password/forgot", ctrl.HandleForgotPassword)
+	v1.Post("/password/reset", ctrl.HandleResetPassword)
+	v1.Get("/oauth/:provider/start", ctrl.HandleOAuthStart)
+	v1.Get("/oauth/:provider/callback", ctrl.HandleOAuthCallback)
+
+	v1.Get("/users/:username", ctrl.HandleGetUserProfile)
+
+	v1.Get("/search", ctrl.HandleSearch)
+
+	// reading posts is open to everyone, owners and moderators are recognized to show them hidden
+	// items. The other routes are authorized one by one since a group middleware only ever sees the
+	// path of the group and can not tell the routes apart
+	v1posts := v1.Group("/posts")
+
+	v1posts.Get("/:postId/comments", ctrl.optionalAuthorizationHandler, ctrl.HandleListComments)
+	v1posts.Post("/:postId/comments", ctrl.authorizationHandler, ctrl.HandleCreateComment)
+	v1posts.Post("/:postId/comments/:commentId/replies", ctrl.authorizationHandler, ctrl.HandleCreateReply)
+	v1posts.Post("/:postId/comments/:commentId/upvote", ctrl.authorizationHandler, ctrl.HandleUpvoteComment)
+	v1posts.Post("/:postId/comments/:commentId/flag", ctrl.authorizationHandler, ctrl.HandleFlagComment)
+	v1posts.Patch("/:postId/comments/:commentId", ctrl.authorizationHandler, ctrl.HandleEditComment)
+	v1posts.Get("/:postId/comments/:commentId/revisions", ctrl.authorizationHandler, ctrl.HandleListCommentRevisions)
+	v1posts.Delete("/:postId/comments/:commentId", ctrl.authorizationHandler, ctrl.HandleDeleteComment)
+	v1posts.Delete("/:postId", ctrl.authorizationHandler, ctrl.HandleDeletePost)
+	v1posts.Post("/:postId/upvote", ctrl.authorizationHandler, ctrl.HandleUpvotePost)
+	v1posts.Post("/:postId/flag", ctrl.authorizationHandler, ctrl.HandleFlagPost)
 
 	// TODO: fetch comments for each post when returning them
 	// TALK ABOUT: N + 1 problem
 	v1posts.Get("/", ctrl.HandleGetAllPosts)
 
-	// GET /posts/:postId
+	// has to come before /:postId or it would be taken for a post id
+	v1posts.Get("/trending", ctrl.HandleGetTrendingPosts)
+
+	v1posts.Get("/:postId", ctrl.optionalAuthorizationHandler, ctrl.HandleGetPost)
+
+	v1admin := v1.Group("/admin", ctrl.authorizationHandler)
+
+	v1admin.Get("/users", ctrl.requirePermission(domain.PermissionManageUsers), ctrl.HandleListUsers)
+	v1admin.Patch("/users/:userId/role", ctrl.requirePermission(domain.PermissionManageUsers), ctrl.HandleUpdateUserRole)
+	v1admin.Delete("/users/:userId", ctrl.requirePermission(domain.PermissionManageUsers), ctrl.HandleDeleteUser)
+	v1admin.Post("/users/:userId/suspend", ctrl.requirePermission(domain.PermissionManageUsers), ctrl.HandleSuspendUser)
+	v1admin.Post("/users/:userId/unsuspend", ctrl.requirePermission(domain.PermissionManageUsers), ctrl.HandleUnsuspendUser)
+	v1admin.Get("/audit-log", ctrl.requirePermission(domain.PermissionViewAuditLog), ctrl.HandleListAuditLog)
+	v1admin.Get("/flags", ctrl.requirePermission(domain.PermissionModerateFlags), ctrl.HandleListFlags)
+	v1admin.Post("/flags/:targetType/:targetId/resolve", ctrl.requirePermission(domain.PermissionModerateFlags), ctrl.HandleResolveFlags)
+	v1admin.Get("/metrics", ctrl.requirePermission(domain.PermissionViewMetrics), ctrl.HandleMetrics)
+	v1admin.Get("/analytics", ctrl.requirePermission(domain.PermissionViewAnalytics), ctrl.HandleAnalytics)
 
 	v1profileAuthorized.Get("/self", ctrl.HandleSelf)
+	v1profileAuthorized.Patch("/self", ctrl.HandleUpdateSelf)
+
+	v1profileAuthorized.Get("/mfa", ctrl.HandleMFAStatus)
+	v1profileAuthorized.Post("/mfa/totp", ctrl.HandleEnrollTOTP)
+	v1profileAuthorized.Post("/mfa/totp/enable", ctrl.HandleEnableTOTP)
+	v1profileAuthorized.Post("/mfa/totp/disable", ctrl.HandleDisableTOTP)
+	v1profileAuthorized.Post("/mfa/recovery-codes", ctrl.HandleRegenerateRecoveryCodes)
+
+	v1profileAuthorized.Post("/oauth/:provider/link", ctrl.HandleOAuthLink)
 
 	v1profileAuthorized.Get("/posts", ctrl.HandleListProfilePosts)
 
 	v1profileAuthorized.Post("/posts", limiter.New(limiter.Config{
 		Next: func(c fiber.Ctx) bool {
-			return c.IP() == "127.0.0.1"
+			return ctrl.clientIP(c) == "127.0.0.1"
 		},
 		Max: 20,
 		MaxFunc: func(c fiber.Ctx) int {
 			return 20
 		},
-		Expiration: 30 * time.Second,
-		KeyGenerator: func(c fiber.Ctx) string {
-			return c.Get("x-forwarded-for")
-		},
+		Expiration:   30 * time.Second,
+		KeyGenerator: ctrl.clientIP,
 		LimitReached: func(c fiber.Ctx) error {
 			return c.SendStatus(fiber.StatusTooManyRequests)
 		},
 	}), ctrl.HandleCreateProfilePost)
 
+	v1profileAuthorized.Patch("/posts/:postId", ctrl.HandleEditProfilePost)
+	v1profileAuthorized.Get("/posts/:postId/revisions", ctrl.HandleListProfilePostRevisions)
+
 	return ctrl
 }
@@ -0,0 +1,452 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"example.com/authorization/internal/controller/dto"
+	"example.com/authorization/internal/domain"
+	"example.com/authorization/internal/repository"
+	"example.com/authorization/internal/repository/entity"
+	"example.com/authorization/internal/service"
+	"example.com/authorization/internal/testutil"
+	"example.com/authorization/pkg"
+	"github.com/alicebob/miniredis/v2"
+)
+
+// testApp is the whole application on an in-memory redis and a database of its own
+type testApp struct {
+	ctrl        Controller
+	redis       *miniredis.Miniredis
+	sqlRepo     pkg.SQLRepository
+	userRepo    repository.UserRepository
+	postRepo    repository.PostRepository
+	commentRepo repository.CommentRepo
+	// oidc is the provider users log in at as stub
+	oidc *testutil.OIDCProvider
+}
+
+func newTestApp(t *testing.T) testApp {
+	t.Helper()
+
+	cfg := pkg.Config{
+		CorsAllowedOrigins: "http://localhost",
+		JwtSecret:          "secret",
+		AccessTokenTTL:     time.Minute,
+		RefreshTokenTTL:    time.Hour,
+		MailDir:            t.TempDir(),
+		PostEditWindow:     time.Hour,
+		CommentEditWindow:  time.Hour,
+		PublicURL:          "http://localhost:3030",
+		OAuthStateTTL:      time.Minute,
+		// the login tests lock accounts out after a few failures
+		LoginMaxAccountFailures: 3,
+		LoginMaxIPFailures:      100,
+		LoginFailureWindow:      time.Hour,
+		LoginLockoutBase:        time.Minute,
+		LoginLockoutMax:         time.Hour,
+	}
+
+	oidc := testutil.NewOIDCProvider(t)
+	cfg.OIDCProviders = []pkg.OIDCProviderConfig{oidc.Config("stub")}
+
+	cache, mr := testutil.NewCache(t)
+	sqlRepo := testutil.NewDB(t)
+
+	userRepo := repository.NewUserRepository(sqlRepo, cache)
+	tokenRepo := repository.NewTokenRepository(cache)
+	postRepo := repository.NewPostRepository(sqlRepo, cache, 0)
+	commentRepo := repository.NewCommentRepo(sqlRepo, cache)
+
+	policy, err := pkg.LoadPasswordPolicy(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	analyticsSrv := service.NewAnalyticsService(cache, 16, 7*24*time.Hour, time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go analyticsSrv.Run(ctx, 10*time.Millisecond)
+
+	authSrv := service.NewAuthorizationService(cfg, nil, userRepo, tokenRepo)
+	loginGuard := service.NewLoginGuard(cfg, repository.NewLoginAttemptRepository(cache))
+	userSrv := service.NewUserService(cfg, userRepo, tokenRepo, authSrv, pkg.NewMailer(cfg), policy, loginGuard)
+
+	ctrl := NewController(cfg,
+		authSrv,
+		userSrv,
+		service.NewPostService(postRepo, commentRepo, analyticsSrv, cfg.PostEditWindow),
+		service.NewCommentService(commentRepo, cfg.CommentEditWindow),
+		analyticsSrv,
+		service.NewAuditService(repository.NewAuditRepository(sqlRepo)),
+		service.NewModerationService(repository.NewFlagRepository(sqlRepo, cache), 3),
+		service.NewSearchService(repository.NewSearchRepository(sqlRepo)),
+		service.NewOAuthService(cfg, repository.NewIdentityRepository(sqlRepo), userRepo, tokenRepo, authSrv, userSrv),
+	)
+
+	return testApp{
+		ctrl:        ctrl,
+		redis:       mr,
+		sqlRepo:     sqlRepo,
+		userRepo:    userRepo,
+		postRepo:    postRepo,
+		commentRepo: commentRepo,
+		oidc:        oidc,
+	}
+}
+
+// newUser creates a user with the role and returns their id with an access token
+func (ta testApp) newUser(t *testing.T, username string, role domain.Role) (int64, string) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	userID, err := ta.userRepo.Insert(ctx, username, username+"@example.com", "hash")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the token carries the role, the user has it too for the tokens it refreshes into
+	if role != domain.RoleUser {
+		err = ta.userRepo.UpdateRole(ctx, userID, string(role), entity.AuditLog{
+			ActorID:    userID,
+			Action:     string(domain.AuditActionUpdateUserRole),
+			TargetType: string(domain.AuditTargetUser),
+			TargetID:   userID,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	token, err := ta.ctrl.authSrv.GenerateToken(userID, role)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return userID, string(token)
+}
+
+func (ta testApp) newPost(t *testing.T, userID int64) int64 {
+	t.Helper()
+
+	postID, err := ta.postRepo.Insert(context.Background(), entity.Post{
+		UserID:      userID,
+		Description: "a post",
+		URL:         "https://example.com",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return postID
+}
+
+func (ta testApp) newComment(t *testing.T, userID int64, postID int64) int64 {
+	t.Helper()
+
+	commentID, err := ta.commentRepo.Insert(context.Background(), entity.Comment{
+		UserID:  userID,
+		PostID:  postID,
+		Content: "a comment",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return commentID
+}
+
+// get requests the path, with the access token when one is given, decodes the response into out
+// unless it is nil and returns the status
+func (ta testApp) get(t *testing.T, path string, token string, out any) int {
+	t.Helper()
+
+	return ta.send(t, http.MethodGet, path, token, nil, out)
+}
+
+// send is get for any method, body is sent as JSON unless it is nil
+func (ta testApp) send(t *testing.T, method string, path string, token string, body any, out any) int {
+	t.Helper()
+
+	resp := ta.do(t, method, path, token, body)
+	defer resp.Body.Close()
+
+	if out != nil && resp.StatusCode == http.StatusOK {
+		err := json.NewDecoder(resp.Body).Decode(out)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	return resp.StatusCode
+}
+
+// do is send returning the whole response, for the tests looking at its headers
+func (ta testApp) do(t *testing.T, method string, path string, token string, body any) *http.Response {
+	t.Helper()
+
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		reqBody = bytes.NewReader(b)
+	}
+
+	req := httptest.NewRequest(method, path, reqBody)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+
+	resp, err := ta.ctrl.app.Test(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return resp
+}
+
+func TestCommentRevisionsRequireTheAuthorOrAModerator(t *testing.T) {
+	t.Parallel()
+
+	ta := newTestApp(t)
+	authorID, authorToken := ta.newUser(t, "alice", domain.RoleUser)
+	_, otherToken := ta.newUser(t, "bob", domain.RoleUser)
+	_, moderatorToken := ta.newUser(t, "carol", domain.RoleModerator)
+
+	postID := ta.newPost(t, authorID)
+	commentID := ta.newComment(t, authorID, postID)
+	path := "/api/v1/posts/" + strconv.FormatInt(postID, 10) + "/comments/" + strconv.FormatInt(commentID, 10) + "/revisions"
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"anonymous", "", http.StatusForbidden},
+		{"invalid token", "not a token", http.StatusUnauthorized},
+		{"someone else", otherToken, http.StatusForbidden},
+		{"author", authorToken, http.StatusOK},
+		{"moderator", moderatorToken, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		status := ta.get(t, path, tt.token, nil)
+		if status != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, status)
+		}
+	}
+}
+
+func TestHiddenPostsAreShownToTheirOwnerAndModerators(t *testing.T) {
+	t.Parallel()
+
+	ta := newTestApp(t)
+	ownerID, ownerToken := ta.newUser(t, "alice", domain.RoleUser)
+	_, otherToken := ta.newUser(t, "bob", domain.RoleUser)
+	_, moderatorToken := ta.newUser(t, "carol", domain.RoleModerator)
+
+	postID := ta.newPost(t, ownerID)
+	ta.sqlRepo.DB.MustExec("UPDATE post SET hidden_at = CURRENT_TIMESTAMP WHERE id = ?", postID)
+	path := "/api/v1/posts/" + strconv.FormatInt(postID, 10)
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"anonymous", "", http.StatusNotFound},
+		{"invalid token", "not a token", http.StatusUnauthorized},
+		{"someone else", otherToken, http.StatusNotFound},
+		{"owner", ownerToken, http.StatusOK},
+		{"moderator", moderatorToken, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		var response dto.GetPostResponse
+		status := ta.get(t, path, tt.token, &response)
+		if status != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, status)
+		}
+
+		if status == http.StatusOK && int64(response.Post.Id) != postID {
+			t.Errorf("%s: expected post %d, got %+v", tt.name, postID, response.Post)
+		}
+	}
+}
+
+func TestHiddenCommentsAreListedForTheirAuthorAndModerators(t *testing.T) {
+	t.Parallel()
+
+	ta := newTestApp(t)
+	authorID, authorToken := ta.newUser(t, "alice", domain.RoleUser)
+	_, otherToken := ta.newUser(t, "bob", domain.RoleUser)
+	_, moderatorToken := ta.newUser(t, "carol", domain.RoleModerator)
+
+	postID := ta.newPost(t, authorID)
+	ta.newComment(t, authorID, postID)
+	hiddenID := ta.newComment(t, authorID, postID)
+	ta.sqlRepo.DB.MustExec("UPDATE comment SET hidden_at = CURRENT_TIMESTAMP WHERE id = ?", hiddenID)
+
+	postPath := "/api/v1/posts/" + strconv.FormatInt(postID, 10)
+
+	tests := []struct {
+		name     string
+		token    string
+		comments int
+	}{
+		{"anonymous", "", 1},
+		{"someone else", otherToken, 1},
+		{"author", authorToken, 2},
+		{"moderator", moderatorToken, 2},
+	}
+
+	for _, tt := range tests {
+		var list dto.ListCommentsResponse
+		status := ta.get(t, postPath+"/comments", tt.token, &list)
+		if status != http.StatusOK || len(list.Comments) != tt.comments {
+			t.Errorf("%s: expected %d listed comments, got status %d and %+v", tt.name, tt.comments, status, list.Comments)
+		}
+
+		var post dto.GetPostResponse
+		status = ta.get(t, postPath, tt.token, &post)
+		if status != http.StatusOK || len(post.Comments) != tt.comments {
+			t.Errorf("%s: expected %d comments on the post, got status %d and %+v", tt.name, tt.comments, status, post.Comments)
+		}
+	}
+}
+
+func TestCommentsOfHiddenPostsAreListedForTheirOwnerAndModerators(t *testing.T) {
+	t.Parallel()
+
+	ta := newTestApp(t)
+	ownerID, ownerToken := ta.newUser(t, "alice", domain.RoleUser)
+	commenterID, commenterToken := ta.newUser(t, "bob", domain.RoleUser)
+	_, moderatorToken := ta.newUser(t, "carol", domain.RoleModerator)
+
+	postID := ta.newPost(t, ownerID)
+	ta.newComment(t, commenterID, postID)
+	ta.newComment(t, ownerID, postID)
+	ta.sqlRepo.DB.MustExec("UPDATE post SET hidden_at = CURRENT_TIMESTAMP WHERE id = ?", postID)
+
+	path := "/api/v1/posts/" + strconv.FormatInt(postID, 10) + "/comments"
+
+	tests := []struct {
+		name     string
+		token    string
+		comments int
+	}{
+		{"anonymous", "", 0},
+		{"commenter", commenterToken, 0},
+		{"owner", ownerToken, 2},
+		{"moderator", moderatorToken, 2},
+	}
+
+	for _, tt := range tests {
+		for _, query := range []string{"", "?mode=tree"} {
+			var list dto.ListCommentsResponse
+			status := ta.get(t, path+query, tt.token, &list)
+			if status != http.StatusOK || len(list.Comments) != tt.comments {
+				t.Errorf("%s%s: expected %d listed comments, got status %d and %+v", tt.name, query, tt.comments, status, list.Comments)
+			}
+		}
+	}
+}
+
+// waitForKey waits for the analytics writes, they are flushed in the background
+func (ta testApp) waitForKey(t *testing.T, key string) bool {
+	t.Helper()
+
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if ta.redis.Exists(key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestPostViewsOfSignedInUsersAreCountedPerUser(t *testing.T) {
+	t.Parallel()
+
+	ta := newTestApp(t)
+	userID, token := ta.newUser(t, "alice", domain.RoleUser)
+	postID := ta.newPost(t, userID)
+	path := "/api/v1/posts/" + strconv.FormatInt(postID, 10)
+	viewerKeyPrefix := "post_viewer:" + strconv.FormatInt(postID, 10) + ":"
+
+	status := ta.get(t, path, token, nil)
+	if status != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", status)
+	}
+
+	if !ta.waitForKey(t, viewerKeyPrefix+"user:"+strconv.FormatInt(userID, 10)) {
+		t.Fatalf("expected the view to be counted for the user, got keys %v", ta.redis.Keys())
+	}
+
+	status = ta.get(t, path, "", nil)
+	if status != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", status)
+	}
+
+	// app.Test requests come from 0.0.0.0
+	if !ta.waitForKey(t, viewerKeyPrefix+"ip:0.0.0.0") {
+		t.Fatalf("expected the anonymous view to be counted for the IP, got keys %v", ta.redis.Keys())
+	}
+}
+
+func TestSuspendedUsersAreToldSo(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ta := newTestApp(t)
+	userID, token := ta.newUser(t, "alice", domain.RoleUser)
+
+	err := ta.userRepo.UpdateSuspended(ctx, userID, true, entity.AuditLog{
+		ActorID:    userID,
+		Action:     string(domain.AuditActionSuspendUser),
+		TargetType: string(domain.AuditTargetUser),
+		TargetID:   userID,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = ta.ctrl.authSrv.RevokeUserAccess(ctx, userID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// 403 with the reason instead of the 401 asking to log in again
+	status := ta.get(t, "/api/v1/profile/self", token, nil)
+	if status != http.StatusForbidden {
+		t.Fatalf("expected status 403, got %d", status)
+	}
+}
+
+func TestMalformedPostListingsAreRefused(t *testing.T) {
+	t.Parallel()
+
+	ta := newTestApp(t)
+	_, token := ta.newUser(t, "alice", domain.RoleUser)
+
+	for _, path := range []string{"/api/v1/posts?size=many", "/api/v1/profile/posts?size=many"} {
+		var response dto.ListPostsResponse
+		status := ta.get(t, path, token, &response)
+		if status != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", path, status)
+		}
+	}
+}
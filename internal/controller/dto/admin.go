@@ -0,0 +1,40 @@
+package dto
+
+import "time"
+
+type UpdateUserRoleRequest struct {
+	Role string `json:"role"`
+}
+
+type ListAuditLogRequest struct {
+	Page uint64 `query:"page"`
+	Size uint64 `query:"size"`
+}
+
+func (lar *ListAuditLogRequest) Sanitize() {
+	if lar.Page == 0 {
+		lar.Page = 1
+	}
+
+	if lar.Size > 100 {
+		lar.Size = 100
+	}
+
+	if lar.Size == 0 {
+		lar.Size = 20
+	}
+}
+
+type ListAuditLogResponse struct {
+	Entries []AuditLog `json:"entries"`
+}
+
+type AuditLog struct {
+	Id         int64          `json:"id"`
+	ActorID    int64          `json:"actorId"`
+	Action     string         `json:"action"`
+	TargetType string         `json:"targetType"`
+	TargetID   int64          `json:"targetId"`
+	Details    map[string]any `json:"details"`
+	CreatedAt  time.Time      `json:"createdAt"`
+}
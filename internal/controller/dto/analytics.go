@@ -0,0 +1,43 @@
+package dto
+
+type AnalyticsRequest struct {
+	// From and To are days formatted as 2006-01-02, both included. The last week is reported by default
+	From string `query:"from"`
+	To   string `query:"to"`
+	// Top is how many of the most viewed posts are listed
+	Top int64 `query:"top"`
+}
+
+func (ar *AnalyticsRequest) Sanitize() {
+	if ar.Top <= 0 {
+		ar.Top = 10
+	}
+
+	if ar.Top > 100 {
+		ar.Top = 100
+	}
+}
+
+type AnalyticsResponse struct {
+	From           string          `json:"from"`
+	To             string          `json:"to"`
+	UniqueVisitors int64           `json:"uniqueVisitors"`
+	Days           []DailyVisitors `json:"days"`
+	Routes         []RouteHits     `json:"routes"`
+	TopPosts       []PostViews     `json:"topPosts"`
+}
+
+type DailyVisitors struct {
+	Date           string `json:"date"`
+	UniqueVisitors int64  `json:"uniqueVisitors"`
+}
+
+type RouteHits struct {
+	Route string `json:"route"`
+	Hits  int64  `json:"hits"`
+}
+
+type PostViews struct {
+	PostID int64 `json:"postId"`
+	Views  int64 `json:"views"`
+}
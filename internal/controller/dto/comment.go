@@ -2,9 +2,19 @@ package dto
 
 import "time"
 
+const (
+	CommentsModeFlat = "flat"
+	CommentsModeTree = "tree"
+)
+
 type ListCommentsRequest struct {
-	Page uint64 `query:"page"`
-	Size uint64 `query:"size"`
+	// Deprecated: use Cursor, page numbers shift while people comment
+	Page  uint64 `query:"page"`
+	Size  uint64 `query:"size"`
+	Mode  string `query:"mode"`
+	Depth uint64 `query:"depth"`
+	// nextCursor of the previous page
+	Cursor string `query:"cursor"`
 }
 
 func (lcr *ListCommentsRequest) Sanitize() {
@@ -13,24 +23,43 @@ func (lcr *ListCommentsRequest) Sanitize() {
 	}
 
 	if lcr.Size > 100 {
-		lcr.Page = 100
+		lcr.Size = 100
 	}
 
 	if lcr.Size == 0 {
 		lcr.Size = 4
 	}
+
+	if lcr.Mode != CommentsModeTree {
+		lcr.Mode = CommentsModeFlat
+	}
+
+	if lcr.Depth > 10 {
+		lcr.Depth = 10
+	}
+
+	if lcr.Depth == 0 {
+		lcr.Depth = 5
+	}
 }
 
 type ListCommentsResponse struct {
-	Comments []Comment `json:"comments"`
+	Comments   []Comment `json:"comments"`
+	NextCursor string    `json:"nextCursor,omitempty"`
 }
 
 type Comment struct {
 	Id        int        `json:"id"`
 	UserID    int64      `json:"userId"`
 	PostID    int64      `json:"postId"`
+	ParentID  *int64     `json:"parentId"`
 	Content   string     `json:"content"`
 	VoteCount uint64     `json:"voteCount"`
+	Deleted   bool       `json:"deleted"`
+	Hidden    bool       `json:"hidden,omitempty"`
+	Edited    bool       `json:"edited"`
+	EditedAt  *time.Time `json:"editedAt,omitempty"`
+	Replies   []Comment  `json:"replies,omitempty"`
 	CreatedAt time.Time  `json:"createdAt"`
 	UpdatedAt *time.Time `json:"updatedAt"`
 }
@@ -38,3 +67,7 @@ type Comment struct {
 type CreateCommentRequest struct {
 	Content string `json:"content"`
 }
+
+type EditCommentRequest struct {
+	Content string `json:"content"`
+}
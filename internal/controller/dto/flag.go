@@ -0,0 +1,45 @@
+package dto
+
+import "time"
+
+type FlagRequest struct {
+	// one of spam, abuse, off_topic and other
+	Reason string `json:"reason"`
+}
+
+type ListFlagsRequest struct {
+	Page uint64 `query:"page"`
+	Size uint64 `query:"size"`
+}
+
+func (lfr *ListFlagsRequest) Sanitize() {
+	if lfr.Page == 0 {
+		lfr.Page = 1
+	}
+
+	if lfr.Size > 100 {
+		lfr.Size = 100
+	}
+
+	if lfr.Size == 0 {
+		lfr.Size = 20
+	}
+}
+
+type ListFlagsResponse struct {
+	Items []FlaggedItem `json:"items"`
+}
+
+type FlaggedItem struct {
+	TargetType     string    `json:"targetType"`
+	TargetID       int64     `json:"targetId"`
+	FlagCount      uint64    `json:"flagCount"`
+	Reasons        []string  `json:"reasons"`
+	FirstFlaggedAt time.Time `json:"firstFlaggedAt"`
+	LastFlaggedAt  time.Time `json:"lastFlaggedAt"`
+}
+
+type ResolveFlagsRequest struct {
+	// dismiss restores the item, hide keeps it hidden
+	Resolution string `json:"resolution"`
+}
@@ -1,5 +1,79 @@
 package dto
 
+import "time"
+
+const (
+	UsersSortNew      = "new"
+	UsersSortOld      = "old"
+	UsersSortUsername = "username"
+	UsersSortKarma    = "karma"
+)
+
+const (
+	UsersStatusAll       = "all"
+	UsersStatusActive    = "active"
+	UsersStatusSuspended = "suspended"
+)
+
+type ListUsersRequest struct {
+	Page uint64 `query:"page"`
+	Size uint64 `query:"size"`
+	// Query is matched against the start of usernames and emails
+	Query string `query:"q"`
+	// one of new, old, username and karma
+	Sort string `query:"sort"`
+	// one of all, active and suspended
+	Status string `query:"status"`
+}
+
+func (lur *ListUsersRequest) Sanitize() {
+	if lur.Page == 0 {
+		lur.Page = 1
+	}
+
+	if lur.Size > 100 {
+		lur.Size = 100
+	}
+
+	if lur.Size == 0 {
+		lur.Size = 20
+	}
+
+	switch lur.Sort {
+	case UsersSortNew, UsersSortOld, UsersSortUsername, UsersSortKarma:
+	default:
+		lur.Sort = UsersSortNew
+	}
+
+	switch lur.Status {
+	case UsersStatusActive, UsersStatusSuspended:
+	default:
+		lur.Status = UsersStatusAll
+	}
+}
+
+// Suspended is the status filter, nil when users of every status are listed
+func (lur *ListUsersRequest) Suspended() *bool {
+	if lur.Status == UsersStatusAll {
+		return nil
+	}
+
+	suspended := lur.Status == UsersStatusSuspended
+
+	return &suspended
+}
+
 type ListUsersResponse struct {
-	Users []User `json:"user"`
+	Users []AdminUser `json:"users"`
+}
+
+type AdminUser struct {
+	Id          int64      `json:"id"`
+	Username    string     `json:"username"`
+	Email       string     `json:"email"`
+	Role        string     `json:"role"`
+	Karma       int64      `json:"karma"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	Suspended   bool       `json:"suspended"`
+	SuspendedAt *time.Time `json:"suspendedAt,omitempty"`
 }
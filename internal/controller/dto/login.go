@@ -7,5 +7,32 @@ type LoginRequest struct {
 
 type LoginResponse struct {
 	Response
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	// lifetime of the access token in seconds
+	ExpiresIn int64 `json:"expiresIn"`
+}
+
+// MFAChallengeResponse answers a login with the right password when the user enabled a second
+// factor, the login is finished by sending MFAToken and a code to /login/mfa
+type MFAChallengeResponse struct {
+	Response
+	MFARequired bool   `json:"mfaRequired"`
+	MFAToken    string `json:"mfaToken"`
+	// lifetime of the MFA token in seconds
+	ExpiresIn int64 `json:"expiresIn"`
+}
+
+type LoginMFARequest struct {
+	MFAToken string `json:"mfaToken"`
+	// Code is a code of the authenticator app or a recovery code
+	Code string `json:"code"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refreshToken"`
 }
@@ -0,0 +1,24 @@
+package dto
+
+type MFAStatusResponse struct {
+	Enabled           bool  `json:"enabled"`
+	Enrolling         bool  `json:"enrolling"`
+	RecoveryCodesLeft int64 `json:"recoveryCodesLeft"`
+}
+
+// TOTPEnrollmentResponse is loaded into an authenticator app, URI is the payload of the QR code
+type TOTPEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type MFACodeRequest struct {
+	// Code is a code of the authenticator app, or a recovery code where it is accepted
+	Code string `json:"code"`
+}
+
+// RecoveryCodesResponse is the only time the recovery codes are shown
+type RecoveryCodesResponse struct {
+	Response
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
@@ -0,0 +1,7 @@
+package dto
+
+// OAuthLinkResponse is where to send the user to confirm the link at the provider
+type OAuthLinkResponse struct {
+	Response
+	URL string `json:"url"`
+}
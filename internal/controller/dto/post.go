@@ -2,9 +2,31 @@ package dto
 
 import "time"
 
+const (
+	PostsSortNew  = "new"
+	PostsSortTop  = "top"
+	PostsSortBest = "best"
+	PostsSortHot  = "hot"
+)
+
+var postsSortWindows = map[string]time.Duration{
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+	"year":  365 * 24 * time.Hour,
+	"all":   0,
+}
+
 type ListPostsRequest struct {
+	// Deprecated: use Cursor, page numbers shift while people post
 	Page uint64 `query:"page"`
 	Size uint64 `query:"size"`
+	// nextCursor of the previous page
+	Cursor string `query:"cursor"`
+	// one of new, top, best and hot
+	Sort string `query:"sort"`
+	// time window of the top sort, one of day, week, month, year and all
+	Window string `query:"window"`
 }
 
 func (lpr *ListPostsRequest) Sanitize() {
@@ -13,16 +35,56 @@ func (lpr *ListPostsRequest) Sanitize() {
 	}
 
 	if lpr.Size > 100 {
-		lpr.Page = 100
+		lpr.Size = 100
 	}
 
 	if lpr.Size == 0 {
 		lpr.Size = 4
 	}
+
+	switch lpr.Sort {
+	case PostsSortNew, PostsSortTop, PostsSortBest, PostsSortHot:
+	default:
+		lpr.Sort = PostsSortHot
+	}
+
+	if _, ok := postsSortWindows[lpr.Window]; !ok {
+		lpr.Window = "day"
+	}
+}
+
+// Since returns the start of the requested window, zero for all time
+func (lpr *ListPostsRequest) Since(now time.Time) time.Time {
+	window := postsSortWindows[lpr.Window]
+	if window == 0 {
+		return time.Time{}
+	}
+
+	return now.Add(-window)
+}
+
+type ListTrendingPostsRequest struct {
+	Page uint64 `query:"page"`
+	Size uint64 `query:"size"`
+}
+
+func (ltr *ListTrendingPostsRequest) Sanitize() {
+	if ltr.Page == 0 {
+		ltr.Page = 1
+	}
+
+	if ltr.Size > 100 {
+		ltr.Size = 100
+	}
+
+	if ltr.Size == 0 {
+		ltr.Size = 30
+	}
 }
 
 type ListPostsResponse struct {
-	Posts []Post `json:"posts"`
+	Posts      []Post `json:"posts"`
+	NextCursor string `json:"nextCursor,omitempty"`
 }
 
 type Post struct {
@@ -31,8 +93,41 @@ type Post struct {
 	UpdatedAt        *time.Time `json:"updatedAt"`
 	URL              string     `json:"url"`
 	Description      string     `json:"description"`
+	Author           string     `json:"author,omitempty"`
 	NumberOfComments uint64     `json:"numberOfComments"`
 	NumberOfUpvotes  uint64     `json:"numberOfUpvotes"`
+	NumberOfViews    uint64     `json:"numberOfViews"`
+	Hidden           bool       `json:"hidden,omitempty"`
+	Edited           bool       `json:"edited"`
+	EditedAt         *time.Time `json:"editedAt,omitempty"`
+}
+
+type GetPostRequest struct {
+	CommentsSize  uint64 `query:"commentsSize"`
+	CommentsDepth uint64 `query:"commentsDepth"`
+}
+
+func (gpr *GetPostRequest) Sanitize() {
+	if gpr.CommentsSize > 100 {
+		gpr.CommentsSize = 100
+	}
+
+	if gpr.CommentsSize == 0 {
+		gpr.CommentsSize = 10
+	}
+
+	if gpr.CommentsDepth > 10 {
+		gpr.CommentsDepth = 10
+	}
+
+	if gpr.CommentsDepth == 0 {
+		gpr.CommentsDepth = 5
+	}
+}
+
+type GetPostResponse struct {
+	Post     Post      `json:"post"`
+	Comments []Comment `json:"comments"`
 }
 
 type ProfilePostResponse struct {
@@ -43,3 +138,9 @@ type CreateProfilePostRequest struct {
 	URL         string `json:"url"`
 	Description string `json:"description"`
 }
+
+// EditProfilePostRequest changes the fields that are set and leaves the others as they are
+type EditProfilePostRequest struct {
+	URL         *string `json:"url"`
+	Description *string `json:"description"`
+}
@@ -0,0 +1,30 @@
+package dto
+
+import "time"
+
+type ListPostRevisionsResponse struct {
+	Post      Post           `json:"post"`
+	Revisions []PostRevision `json:"revisions"`
+}
+
+type PostRevision struct {
+	Id          int64     `json:"id"`
+	PostID      int64     `json:"postId"`
+	EditorID    int64     `json:"editorId"`
+	Description string    `json:"description"`
+	URL         string    `json:"url"`
+	ReplacedAt  time.Time `json:"replacedAt"`
+}
+
+type ListCommentRevisionsResponse struct {
+	Comment   Comment           `json:"comment"`
+	Revisions []CommentRevision `json:"revisions"`
+}
+
+type CommentRevision struct {
+	Id         int64     `json:"id"`
+	CommentID  int64     `json:"commentId"`
+	EditorID   int64     `json:"editorId"`
+	Content    string    `json:"content"`
+	ReplacedAt time.Time `json:"replacedAt"`
+}
@@ -0,0 +1,67 @@
+package dto
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	SearchTypeAll      = "all"
+	SearchTypePosts    = "posts"
+	SearchTypeComments = "comments"
+)
+
+// longer queries do not make results better, they only make MATCH slower
+const maxSearchQueryLength = 256
+
+type SearchRequest struct {
+	Q string `query:"q"`
+	// one of all, posts and comments
+	Type string `query:"type"`
+	Page uint64 `query:"page"`
+	Size uint64 `query:"size"`
+}
+
+func (sr *SearchRequest) Sanitize() {
+	sr.Q = strings.TrimSpace(sr.Q)
+	if r := []rune(sr.Q); len(r) > maxSearchQueryLength {
+		sr.Q = string(r[:maxSearchQueryLength])
+	}
+
+	switch sr.Type {
+	case SearchTypePosts, SearchTypeComments:
+	default:
+		sr.Type = SearchTypeAll
+	}
+
+	if sr.Page == 0 {
+		sr.Page = 1
+	}
+
+	if sr.Size > 100 {
+		sr.Size = 100
+	}
+
+	if sr.Size == 0 {
+		sr.Size = 10
+	}
+}
+
+type SearchResponse struct {
+	Results []SearchResult `json:"results"`
+	// NextPage is empty when there are no more results
+	NextPage uint64 `json:"nextPage,omitempty"`
+}
+
+type SearchResult struct {
+	// post or comment
+	Type   string `json:"type"`
+	Id     int64  `json:"id"`
+	PostID int64  `json:"postId"`
+	Author string `json:"author"`
+	URL    string `json:"url,omitempty"`
+	// Snippet is HTML escaped content around the first match, matches are wrapped in <mark>
+	Snippet   string     `json:"snippet"`
+	Score     float64    `json:"score"`
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+}
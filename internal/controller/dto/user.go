@@ -1,6 +1,28 @@
 package dto
 
+import "time"
+
 type User struct {
-	Username string `json:"username"`
-	Email    string `json:"email"`
+	Username      string `json:"username"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"emailVerified"`
+	MFAEnabled    bool   `json:"mfaEnabled"`
+	Role          string `json:"role"`
+}
+
+type UserProfile struct {
+	Username  string    `json:"username"`
+	About     string    `json:"about"`
+	Karma     int64     `json:"karma"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type UserProfileResponse struct {
+	User     UserProfile `json:"user"`
+	Posts    []Post      `json:"posts"`
+	Comments []Comment   `json:"comments"`
+}
+
+type UpdateSelfRequest struct {
+	About *string `json:"about"`
 }
@@ -0,0 +1,158 @@
+package controller
+
+import (
+	"errors"
+	"strconv"
+
+	"example.com/authorization/internal/controller/dto"
+	"example.com/authorization/internal/domain"
+	"example.com/authorization/internal/repository"
+	"example.com/authorization/internal/service"
+	"github.com/gofiber/fiber/v3"
+)
+
+func (ctrl Controller) HandleFlagPost(c fiber.Ctx) error {
+	var request dto.FlagRequest
+
+	err := c.Bind().Body(&request)
+	if err != nil {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	postIDStr := c.Params("postId")
+	postID, err := strconv.ParseInt(postIDStr, 10, 64)
+	if err != nil || len(postIDStr) == 0 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	err = ctrl.moderationSrv.FlagPost(c.Context(), actor.UserID, postID, domain.FlagReason(request.Reason))
+	if err != nil {
+		return flagErrorResponse(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(dto.Response{
+		Message: "flagged",
+	})
+}
+
+func (ctrl Controller) HandleFlagComment(c fiber.Ctx) error {
+	var request dto.FlagRequest
+
+	err := c.Bind().Body(&request)
+	if err != nil {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	commentIDStr := c.Params("commentId")
+	commentID, err := strconv.ParseInt(commentIDStr, 10, 64)
+	if err != nil || len(commentIDStr) == 0 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	err = ctrl.moderationSrv.FlagComment(c.Context(), actor.UserID, commentID, domain.FlagReason(request.Reason))
+	if err != nil {
+		return flagErrorResponse(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(dto.Response{
+		Message: "flagged",
+	})
+}
+
+func (ctrl Controller) HandleListFlags(c fiber.Ctx) error {
+	var req dto.ListFlagsRequest
+	var response dto.ListFlagsResponse
+
+	err := c.Bind().Query(&req)
+	if err != nil {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	req.Sanitize()
+
+	items, err := ctrl.moderationSrv.ListQueue(c.Context(), req.Size, req.Page)
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	response.Items = make([]dto.FlaggedItem, 0, len(items))
+	for _, item := range items {
+		response.Items = append(response.Items, item.ToDTO())
+	}
+
+	return c.JSON(response)
+}
+
+func (ctrl Controller) HandleResolveFlags(c fiber.Ctx) error {
+	var request dto.ResolveFlagsRequest
+
+	err := c.Bind().Body(&request)
+	if err != nil {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	targetIDStr := c.Params("targetId")
+	targetID, err := strconv.ParseInt(targetIDStr, 10, 64)
+	if err != nil || len(targetIDStr) == 0 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	err = ctrl.moderationSrv.Resolve(c.Context(), actor, c.Params("targetType"), targetID, domain.FlagResolution(request.Resolution))
+	if err != nil {
+		return flagErrorResponse(c, err)
+	}
+
+	return c.JSON(dto.Response{
+		Message: "ok",
+	})
+}
+
+func flagErrorResponse(c fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidFlagReason):
+		return c.Status(fiber.StatusBadRequest).JSON(dto.Response{
+			Message: "reason has to be one of spam, abuse, off_topic and other",
+		})
+	case errors.Is(err, service.ErrInvalidFlagResolution):
+		return c.Status(fiber.StatusBadRequest).JSON(dto.Response{
+			Message: "resolution has to be one of dismiss and hide",
+		})
+	case errors.Is(err, repository.ErrAlreadyFlagged):
+		return c.Status(fiber.StatusConflict).JSON(dto.Response{
+			Message: "already flagged",
+		})
+	case errors.Is(err, repository.ErrPostNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(dto.Response{
+			Message: "post not found",
+		})
+	case errors.Is(err, repository.ErrCommentNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(dto.Response{
+			Message: "comment not found",
+		})
+	case errors.Is(err, repository.ErrFlagNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(dto.Response{
+			Message: "no open flags",
+		})
+	case errors.Is(err, service.ErrPermissionDenied):
+		return c.Status(fiber.StatusForbidden).JSON(dto.Response{
+			Message: "permission denied",
+		})
+	default:
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+}
@@ -2,19 +2,40 @@ package controller
 
 import (
 	"example.com/authorization/internal/controller/dto"
+	"example.com/authorization/internal/domain"
 	"github.com/gofiber/fiber/v3"
 )
 
 func (ctrl Controller) HandleListUsers(c fiber.Ctx) error {
+	var req dto.ListUsersRequest
 	var response dto.ListUsersResponse
 
-	dusers, err := ctrl.userSrv.List(c.Context())
+	err := c.Bind().Query(&req)
 	if err != nil {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	req.Sanitize()
+
+	actor, ok := actorFromContext(c)
+	if !ok {
 		return c.SendStatus(fiber.StatusInternalServerError)
 	}
 
+	dusers, err := ctrl.userSrv.List(c.Context(), actor, domain.UserFilters{
+		Search:    req.Query,
+		Suspended: req.Suspended(),
+		Sort:      domain.UserSort(req.Sort),
+		Page:      req.Page,
+		Size:      req.Size,
+	})
+	if err != nil {
+		return adminErrorResponse(c, err)
+	}
+
+	response.Users = make([]dto.AdminUser, 0, len(dusers))
 	for _, du := range dusers {
-		response.Users = append(response.Users, du.ToDTO())
+		response.Users = append(response.Users, du.ToAdminDTO())
 	}
 
 	return c.JSON(response)
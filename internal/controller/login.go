@@ -2,6 +2,9 @@ package controller
 
 import (
 	"errors"
+	"math"
+	"strconv"
+	"time"
 
 	"example.com/authorization/internal/controller/dto"
 	"example.com/authorization/internal/service"
@@ -9,30 +12,174 @@ import (
 )
 
 func (ctrl Controller) HandleLogin(c fiber.Ctx) error {
-	var response dto.LoginResponse
 	var request dto.LoginRequest
 
 	err := c.Bind().Body(&request)
 	if err != nil {
-		c.SendStatus(fiber.StatusBadRequest)
+		return c.SendStatus(fiber.StatusBadRequest)
 	}
 
-	token, err := ctrl.userSrv.Login(c.Context(), request.Username, request.Password)
+	result, err := ctrl.userSrv.Login(c.Context(), request.Username, request.Password, ctrl.clientIP(c))
 	if err != nil {
-		if errors.Is(err, service.ErrUserNotFound) {
-			return c.SendStatus(fiber.StatusNotFound)
+		var locked service.LoginLockedError
+		if errors.As(err, &locked) {
+			return lockedResponse(c, locked.RetryAfter)
+		}
+
+		if errors.Is(err, service.ErrWrongCredentials) {
+			return c.Status(fiber.StatusUnauthorized).JSON(dto.Response{
+				Message: "invalid username or password",
+			})
+		}
+
+		if errors.Is(err, service.ErrUserSuspended) {
+			return suspendedResponse(c)
 		}
 
 		return c.SendStatus(fiber.StatusInternalServerError)
 	}
 
-	response = dto.LoginResponse{
-		Token: string(token),
+	return loginResponse(c, result)
+}
+
+// loginResponse hands out the tokens of the login, or the MFA token to finish it with
+func loginResponse(c fiber.Ctx, result service.LoginResult) error {
+	if result.MFARequired() {
+		return c.JSON(dto.MFAChallengeResponse{
+			MFARequired: true,
+			MFAToken:    result.MFAToken,
+			ExpiresIn:   int64(result.MFATokenExpiresIn.Seconds()),
+			Response: dto.Response{
+				Message: "two-factor code required",
+			},
+		})
+	}
+
+	return c.JSON(dto.LoginResponse{
+		Token:        string(result.Tokens.AccessToken),
+		RefreshToken: string(result.Tokens.RefreshToken),
+		ExpiresIn:    int64(result.Tokens.ExpiresIn.Seconds()),
 		Response: dto.Response{
 			Message: "ok",
 			Error:   "",
 		},
+	})
+}
+
+// HandleLoginMFA finishes a login of a user with a second factor
+func (ctrl Controller) HandleLoginMFA(c fiber.Ctx) error {
+	var request dto.LoginMFARequest
+
+	err := c.Bind().Body(&request)
+	if err != nil || len(request.MFAToken) == 0 || len(request.Code) == 0 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	tokens, err := ctrl.userSrv.CompleteMFALogin(c.Context(), request.MFAToken, request.Code, ctrl.clientIP(c))
+	if err != nil {
+		if errors.Is(err, service.ErrUserSuspended) {
+			return suspendedResponse(c)
+		}
+
+		if errors.Is(err, service.ErrInvalidToken) {
+			return c.Status(fiber.StatusUnauthorized).JSON(dto.Response{
+				Message: "invalid or expired mfa token, log in again",
+			})
+		}
+
+		return mfaErrorResponse(c, err)
+	}
+
+	return c.JSON(dto.LoginResponse{
+		Token:        string(tokens.AccessToken),
+		RefreshToken: string(tokens.RefreshToken),
+		ExpiresIn:    int64(tokens.ExpiresIn.Seconds()),
+		Response: dto.Response{
+			Message: "ok",
+		},
+	})
+}
+
+func (ctrl Controller) HandleRefreshToken(c fiber.Ctx) error {
+	var request dto.RefreshTokenRequest
+
+	err := c.Bind().Body(&request)
+	if err != nil || len(request.RefreshToken) == 0 {
+		return c.SendStatus(fiber.StatusBadRequest)
 	}
 
+	tokens, err := ctrl.authSrv.RefreshTokens(c.Context(), request.RefreshToken)
+	if err != nil {
+		if errors.Is(err, service.ErrUserSuspended) {
+			return suspendedResponse(c)
+		}
+
+		if errors.Is(err, service.ErrInvalidToken) {
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(dto.LoginResponse{
+		Token:        string(tokens.AccessToken),
+		RefreshToken: string(tokens.RefreshToken),
+		ExpiresIn:    int64(tokens.ExpiresIn.Seconds()),
+		Response: dto.Response{
+			Message: "ok",
+		},
+	})
+}
+
+func (ctrl Controller) HandleLogout(c fiber.Ctx) error {
+	var request dto.LogoutRequest
+
+	if len(c.Body()) > 0 {
+		err := c.Bind().Body(&request)
+		if err != nil {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+	}
+
+	err := ctrl.authSrv.Logout(c.Context(), c.Get(fiber.HeaderAuthorization), request.RefreshToken)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidToken) {
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func suspendedResponse(c fiber.Ctx) error {
+	return c.Status(fiber.StatusForbidden).JSON(dto.Response{
+		Message: "account suspended",
+	})
+}
+
+// lockedResponse tells the client when to try again, rounded up to whole seconds
+func lockedResponse(c fiber.Ctx, retryAfter time.Duration) error {
+	c.Set(fiber.HeaderRetryAfter, strconv.FormatInt(int64(math.Ceil(retryAfter.Seconds())), 10))
+
+	return c.Status(fiber.StatusTooManyRequests).JSON(dto.Response{
+		Message: "too many failed logins",
+	})
+}
+
+// HandleJWKS publishes the token verification keys so other services can
+// check our tokens without being able to sign them
+func (ctrl Controller) HandleJWKS(c fiber.Ctx) error {
+	response := dto.JWKSResponse{
+		Keys: make([]dto.JSONWebKey, 0),
+	}
+
+	for _, pk := range ctrl.authSrv.PublicKeys() {
+		response.Keys = append(response.Keys, pk.ToDTO())
+	}
+
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+
 	return c.JSON(response)
 }
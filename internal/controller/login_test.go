@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"example.com/authorization/internal/controller/dto"
+	"example.com/authorization/internal/domain"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newUserWithPassword creates a user who can log in with password
+func (ta testApp) newUserWithPassword(t *testing.T, username string, password string) int64 {
+	t.Helper()
+
+	userID, _ := ta.newUser(t, username, domain.RoleUser)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = ta.userRepo.UpdatePassword(context.Background(), userID, string(hash))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return userID
+}
+
+// login tries to log in and returns the response with its body read
+func (ta testApp) login(t *testing.T, username string, password string) (*http.Response, string) {
+	t.Helper()
+
+	resp := ta.do(t, http.MethodPost, "/api/v1/login", "", dto.LoginRequest{
+		Username: username,
+		Password: password,
+	})
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return resp, string(body)
+}
+
+func TestFailedLoginsOfUnknownUsersLookLikeWrongPasswords(t *testing.T) {
+	t.Parallel()
+
+	ta := newTestApp(t)
+	ta.newUserWithPassword(t, "alice", "correct horse battery staple")
+
+	wrongPassword, wrongPasswordBody := ta.login(t, "alice", "battery staple")
+	unknownUser, unknownUserBody := ta.login(t, "nobody", "battery staple")
+
+	if wrongPassword.StatusCode != http.StatusUnauthorized || unknownUser.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected status 401 for both, got %d and %d", wrongPassword.StatusCode, unknownUser.StatusCode)
+	}
+
+	if wrongPasswordBody != unknownUserBody {
+		t.Errorf("expected the same body, got %q and %q", wrongPasswordBody, unknownUserBody)
+	}
+
+	if wrongPassword.Header.Get("Content-Type") != unknownUser.Header.Get("Content-Type") {
+		t.Errorf("expected the same content type, got %q and %q",
+			wrongPassword.Header.Get("Content-Type"), unknownUser.Header.Get("Content-Type"))
+	}
+}
+
+func TestLockedOutLoginsAreToldWhenToRetry(t *testing.T) {
+	t.Parallel()
+
+	ta := newTestApp(t)
+	ta.newUserWithPassword(t, "alice", "correct horse battery staple")
+
+	// the test app locks an account out for a minute on the third failure
+	for i := range 2 {
+		resp, _ := ta.login(t, "alice", "battery staple")
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected status 401, got %d", i+1, resp.StatusCode)
+		}
+	}
+
+	attempts := []struct {
+		name     string
+		password string
+	}{
+		{"locking failure", "battery staple"},
+		{"right password while locked out", "correct horse battery staple"},
+	}
+
+	for _, a := range attempts {
+		resp, _ := ta.login(t, "alice", a.password)
+		if resp.StatusCode != http.StatusTooManyRequests {
+			t.Fatalf("%s: expected status 429, got %d", a.name, resp.StatusCode)
+		}
+
+		retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+		if err != nil || retryAfter <= 0 || time.Duration(retryAfter)*time.Second > time.Minute {
+			t.Errorf("%s: expected Retry-After within a minute, got %q", a.name, resp.Header.Get("Retry-After"))
+		}
+	}
+}
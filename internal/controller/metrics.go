@@ -0,0 +1,18 @@
+package controller
+
+import (
+	"encoding/json"
+	"expvar"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// HandleMetrics serves every published expvar variable, the same document net/http serves on /debug/vars
+func (ctrl Controller) HandleMetrics(c fiber.Ctx) error {
+	vars := map[string]json.RawMessage{}
+	expvar.Do(func(kv expvar.KeyValue) {
+		vars[kv.Key] = json.RawMessage(kv.Value.String())
+	})
+
+	return c.JSON(vars)
+}
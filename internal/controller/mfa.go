@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"errors"
+
+	"example.com/authorization/internal/constants"
+	"example.com/authorization/internal/controller/dto"
+	"example.com/authorization/internal/service"
+	"github.com/gofiber/fiber/v3"
+)
+
+func (ctrl Controller) HandleMFAStatus(c fiber.Ctx) error {
+	userID, ok := c.Context().Value(constants.UsrIDContextKey).(int64)
+	if !ok {
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+
+	status, err := ctrl.userSrv.MFAStatus(c.Context(), userID)
+	if err != nil {
+		return mfaErrorResponse(c, err)
+	}
+
+	return c.JSON(dto.MFAStatusResponse{
+		Enabled:           status.Enabled,
+		Enrolling:         status.Enrolling,
+		RecoveryCodesLeft: status.RecoveryCodesLeft,
+	})
+}
+
+// HandleEnrollTOTP hands out a new secret for an authenticator app, it has to be confirmed
+// with a code before logins ask for one
+func (ctrl Controller) HandleEnrollTOTP(c fiber.Ctx) error {
+	userID, ok := c.Context().Value(constants.UsrIDContextKey).(int64)
+	if !ok {
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+
+	enrollment, err := ctrl.userSrv.EnrollTOTP(c.Context(), userID)
+	if err != nil {
+		return mfaErrorResponse(c, err)
+	}
+
+	// the secret must not end up in a shared cache
+	c.Set(fiber.HeaderCacheControl, "no-store")
+
+	return c.JSON(dto.TOTPEnrollmentResponse{
+		Secret: enrollment.Secret,
+		URI:    enrollment.URI,
+	})
+}
+
+func (ctrl Controller) HandleEnableTOTP(c fiber.Ctx) error {
+	var request dto.MFACodeRequest
+
+	err := c.Bind().Body(&request)
+	if err != nil || len(request.Code) == 0 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	userID, ok := c.Context().Value(constants.UsrIDContextKey).(int64)
+	if !ok {
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+
+	codes, err := ctrl.userSrv.EnableTOTP(c.Context(), userID, request.Code)
+	if err != nil {
+		return mfaErrorResponse(c, err)
+	}
+
+	return recoveryCodesResponse(c, codes)
+}
+
+func (ctrl Controller) HandleDisableTOTP(c fiber.Ctx) error {
+	var request dto.MFACodeRequest
+
+	err := c.Bind().Body(&request)
+	if err != nil || len(request.Code) == 0 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	userID, ok := c.Context().Value(constants.UsrIDContextKey).(int64)
+	if !ok {
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+
+	err = ctrl.userSrv.DisableTOTP(c.Context(), userID, request.Code, ctrl.clientIP(c))
+	if err != nil {
+		return mfaErrorResponse(c, err)
+	}
+
+	return c.JSON(dto.Response{
+		Message: "ok",
+	})
+}
+
+func (ctrl Controller) HandleRegenerateRecoveryCodes(c fiber.Ctx) error {
+	var request dto.MFACodeRequest
+
+	err := c.Bind().Body(&request)
+	if err != nil || len(request.Code) == 0 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	userID, ok := c.Context().Value(constants.UsrIDContextKey).(int64)
+	if !ok {
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+
+	codes, err := ctrl.userSrv.RegenerateRecoveryCodes(c.Context(), userID, request.Code, ctrl.clientIP(c))
+	if err != nil {
+		return mfaErrorResponse(c, err)
+	}
+
+	return recoveryCodesResponse(c, codes)
+}
+
+func recoveryCodesResponse(c fiber.Ctx, codes []string) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+
+	return c.JSON(dto.RecoveryCodesResponse{
+		RecoveryCodes: codes,
+		Response: dto.Response{
+			Message: "store the recovery codes somewhere safe, they are not shown again",
+		},
+	})
+}
+
+func mfaErrorResponse(c fiber.Ctx, err error) error {
+	var locked service.LoginLockedError
+
+	switch {
+	case errors.As(err, &locked):
+		return lockedResponse(c, locked.RetryAfter)
+	case errors.Is(err, service.ErrInvalidMFACode):
+		return c.Status(fiber.StatusUnauthorized).JSON(dto.Response{
+			Message: "invalid two-factor code",
+		})
+	case errors.Is(err, service.ErrMFAAlreadyEnabled):
+		return c.Status(fiber.StatusConflict).JSON(dto.Response{
+			Message: "two-factor authentication already enabled",
+		})
+	case errors.Is(err, service.ErrMFANotEnabled):
+		return c.Status(fiber.StatusConflict).JSON(dto.Response{
+			Message: "two-factor authentication not enabled",
+		})
+	case errors.Is(err, service.ErrMFANotEnrolled):
+		return c.Status(fiber.StatusConflict).JSON(dto.Response{
+			Message: "no authenticator enrollment to confirm, enroll first",
+		})
+	default:
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+}
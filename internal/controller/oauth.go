@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"errors"
+	"time"
+
+	"example.com/authorization/internal/constants"
+	"example.com/authorization/internal/controller/dto"
+	"example.com/authorization/internal/service"
+	"github.com/gofiber/fiber/v3"
+)
+
+const (
+	// oauthStateCookie binds a login at a provider to the browser that started it, a callback
+	// URL handed to someone else can not log them into the attacker's account
+	oauthStateCookie = "oauth_state"
+	oauthCookiePath  = "/api/v1/oauth"
+)
+
+// HandleOAuthStart sends the browser to log in at the provider
+func (ctrl Controller) HandleOAuthStart(c fiber.Ctx) error {
+	start, err := ctrl.oauthSrv.Start(c.Context(), c.Params("provider"), 0)
+	if err != nil {
+		return oauthErrorResponse(c, err)
+	}
+
+	ctrl.setOAuthStateCookie(c, start)
+
+	return c.Redirect().Status(fiber.StatusFound).To(start.URL)
+}
+
+// HandleOAuthLink starts linking an identity at the provider to the logged in user, the
+// client sends the browser to the returned URL
+func (ctrl Controller) HandleOAuthLink(c fiber.Ctx) error {
+	userID, ok := c.Context().Value(constants.UsrIDContextKey).(int64)
+	if !ok {
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+
+	start, err := ctrl.oauthSrv.Start(c.Context(), c.Params("provider"), userID)
+	if err != nil {
+		return oauthErrorResponse(c, err)
+	}
+
+	ctrl.setOAuthStateCookie(c, start)
+
+	return c.JSON(dto.OAuthLinkResponse{
+		URL: start.URL,
+		Response: dto.Response{
+			Message: "ok",
+		},
+	})
+}
+
+// HandleOAuthCallback is where the provider sends the browser back to, it logs the user in
+// or finishes linking the identity
+func (ctrl Controller) HandleOAuthCallback(c fiber.Ctx) error {
+	if c.Query("error") != "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(dto.Response{
+			Message: "login at the provider was not completed",
+			Error:   c.Query("error"),
+		})
+	}
+
+	state, code := c.Query("state"), c.Query("code")
+	if state == "" || code == "" {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	cookie := c.Cookies(oauthStateCookie)
+	ctrl.clearOAuthStateCookie(c)
+
+	if subtle.ConstantTimeCompare([]byte(cookie), []byte(state)) != 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(dto.Response{
+			Message: "the login was started in another browser",
+		})
+	}
+
+	result, err := ctrl.oauthSrv.Callback(c.Context(), c.Params("provider"), state, code)
+	if err != nil {
+		return oauthErrorResponse(c, err)
+	}
+
+	if result.Linked {
+		return c.JSON(dto.Response{
+			Message: "linked",
+		})
+	}
+
+	return loginResponse(c, result.LoginResult)
+}
+
+func (ctrl Controller) setOAuthStateCookie(c fiber.Ctx, start service.OAuthStart) {
+	c.Cookie(&fiber.Cookie{
+		Name:     oauthStateCookie,
+		Value:    start.State,
+		Path:     oauthCookiePath,
+		MaxAge:   int(start.ExpiresIn.Seconds()),
+		Secure:   ctrl.secureCookies,
+		HTTPOnly: true,
+		// the provider redirects back with a top level navigation, Strict would leave the cookie out
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+}
+
+func (ctrl Controller) clearOAuthStateCookie(c fiber.Ctx) {
+	c.Cookie(&fiber.Cookie{
+		Name:     oauthStateCookie,
+		Path:     oauthCookiePath,
+		Expires:  time.Unix(0, 0),
+		Secure:   ctrl.secureCookies,
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+}
+
+func oauthErrorResponse(c fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrUnknownOAuthProvider):
+		return c.Status(fiber.StatusNotFound).JSON(dto.Response{
+			Message: "unknown provider",
+		})
+	case errors.Is(err, service.ErrInvalidOAuthState):
+		return c.Status(fiber.StatusBadRequest).JSON(dto.Response{
+			Message: "invalid or expired login, start again",
+		})
+	case errors.Is(err, service.ErrOAuthProviderUnavailable):
+		return c.Status(fiber.StatusBadGateway).JSON(dto.Response{
+			Message: "the provider can not be reached",
+		})
+	case errors.Is(err, service.ErrOAuthFailed):
+		return c.Status(fiber.StatusUnauthorized).JSON(dto.Response{
+			Message: "the login at the provider could not be verified",
+		})
+	case errors.Is(err, service.ErrIdentityLinkedElsewhere):
+		return c.Status(fiber.StatusConflict).JSON(dto.Response{
+			Message: "the identity is linked to another account",
+		})
+	case errors.Is(err, service.ErrEmailAlreadyRegistered):
+		return c.Status(fiber.StatusConflict).JSON(dto.Response{
+			Message: "an account uses this email, log in and link the provider from your profile",
+		})
+	case errors.Is(err, service.ErrUserAlreadyRegistered):
+		return c.Status(fiber.StatusConflict).JSON(dto.Response{
+			Message: "no free username was found for the account",
+		})
+	case errors.Is(err, service.ErrUserSuspended):
+		return suspendedResponse(c)
+	default:
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,139 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"example.com/authorization/internal/controller/dto"
+	"example.com/authorization/pkg"
+)
+
+// startOAuth starts a login at the stub provider and returns the URL the browser is sent to
+// and the state cookie it gets
+func (ta testApp) startOAuth(t *testing.T) (*url.URL, *http.Cookie) {
+	t.Helper()
+
+	resp, err := ta.ctrl.app.Test(httptest.NewRequest(http.MethodGet, "/api/v1/oauth/stub/start", nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("expected status %d, got %d", http.StatusFound, resp.StatusCode)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == oauthStateCookie {
+			return location, cookie
+		}
+	}
+
+	t.Fatalf("expected the %s cookie to be set", oauthStateCookie)
+	return nil, nil
+}
+
+// oauthCallback requests the callback the provider redirects back to, with the state cookie
+// when one is given
+func (ta testApp) oauthCallback(t *testing.T, state string, code string, cookie *http.Cookie) *http.Response {
+	t.Helper()
+
+	query := url.Values{"state": {state}, "code": {code}}
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/oauth/stub/callback?"+query.Encode(), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+
+	resp, err := ta.ctrl.app.Test(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	return resp
+}
+
+func TestOAuthStartSendsTheBrowserToTheProvider(t *testing.T) {
+	t.Parallel()
+
+	ta := newTestApp(t)
+	location, cookie := ta.startOAuth(t)
+
+	if !strings.HasPrefix(location.String(), ta.oidc.Server.URL+"/authorize?") {
+		t.Fatalf("expected to be sent to the provider, got %s", location)
+	}
+
+	if cookie.Value != location.Query().Get("state") || !cookie.HttpOnly || cookie.Path != oauthCookiePath || cookie.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("unexpected state cookie %+v", cookie)
+	}
+
+	status := ta.get(t, "/api/v1/oauth/other/start", "", nil)
+	if status != http.StatusNotFound {
+		t.Fatalf("expected status %d for an unknown provider, got %d", http.StatusNotFound, status)
+	}
+}
+
+func TestOAuthCallbackRequiresTheBrowserThatStartedTheLogin(t *testing.T) {
+	t.Parallel()
+
+	ta := newTestApp(t)
+	location, cookie := ta.startOAuth(t)
+	state := location.Query().Get("state")
+	code := ta.oidc.Authorize(t, location.String(), pkg.OIDCIdentity{Subject: "1", PreferredUsername: "alice"})
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+	}{
+		{"without the cookie", nil},
+		{"with the cookie of another login", &http.Cookie{Name: oauthStateCookie, Value: "another state"}},
+	}
+
+	for _, tt := range tests {
+		resp := ta.oauthCallback(t, state, code, tt.cookie)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", tt.name, http.StatusBadRequest, resp.StatusCode)
+		}
+	}
+
+	resp := ta.oauthCallback(t, state, code, cookie)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	var response dto.LoginResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	actor, err := ta.ctrl.authSrv.Authorize(context.Background(), response.Token)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	user, err := ta.userRepo.GetOneByID(context.Background(), actor.UserID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if user.Username != "alice" {
+		t.Fatalf("expected alice to be logged in, got %s", user.Username)
+	}
+
+	// the state finished its login
+	resp = ta.oauthCallback(t, state, code, cookie)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status %d for a used state, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+}
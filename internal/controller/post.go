@@ -1,12 +1,16 @@
 package controller
 
 import (
+	"errors"
 	"strconv"
+	"time"
 
 	"example.com/authorization/internal/constants"
 	"example.com/authorization/internal/controller/dto"
 	"example.com/authorization/internal/domain"
 	"example.com/authorization/internal/repository"
+	"example.com/authorization/internal/service"
+	"example.com/authorization/pkg"
 	"github.com/gofiber/fiber/v3"
 )
 
@@ -16,17 +20,26 @@ func (ctrl Controller) HandleGetAllPosts(c fiber.Ctx) error {
 
 	err := c.Bind().Query(&req)
 	if err != nil {
-		c.SendStatus(fiber.StatusBadRequest)
+		return c.SendStatus(fiber.StatusBadRequest)
 	}
 
 	req.Sanitize()
 
-	dps, err := ctrl.postSrv.ListPosts(c.Context(), domain.PostFilters{
-		Page: req.Page,
-		Size: req.Size,
+	dps, nextCursor, err := ctrl.postSrv.ListPosts(c.Context(), domain.PostFilters{
+		Page:   req.Page,
+		Size:   req.Size,
+		Sort:   domain.PostSort(req.Sort),
+		Since:  req.Since(time.Now()),
+		Cursor: req.Cursor,
 	})
 
 	if err != nil {
+		if errors.Is(err, pkg.ErrInvalidCursor) {
+			return c.Status(fiber.StatusBadRequest).JSON(dto.Response{
+				Message: "invalid cursor",
+			})
+		}
+
 		return c.SendStatus(fiber.StatusInternalServerError)
 	}
 
@@ -34,6 +47,86 @@ func (ctrl Controller) HandleGetAllPosts(c fiber.Ctx) error {
 		response.Posts = append(response.Posts, dp.ToDTO())
 	}
 
+	response.NextCursor = nextCursor
+
+	return c.JSON(response)
+}
+
+func (ctrl Controller) HandleGetTrendingPosts(c fiber.Ctx) error {
+	var req dto.ListTrendingPostsRequest
+	var response dto.ListPostsResponse
+
+	err := c.Bind().Query(&req)
+	if err != nil {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	req.Sanitize()
+
+	dps, err := ctrl.postSrv.ListTrendingPosts(c.Context(), req.Size, req.Page)
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	response.Posts = make([]dto.Post, 0, len(dps))
+	for _, dp := range dps {
+		response.Posts = append(response.Posts, dp.ToDTO())
+	}
+
+	return c.JSON(response)
+}
+
+// viewerKey identifies who is viewing a post so repeated views are counted once, signed in users
+// are counted as themselves wherever they come from and everyone else by IP
+func (ctrl Controller) viewerKey(c fiber.Ctx) string {
+	if actor, ok := actorFromContext(c); ok {
+		return "user:" + strconv.FormatInt(actor.UserID, 10)
+	}
+
+	return "ip:" + ctrl.clientIP(c)
+}
+
+func (ctrl Controller) HandleGetPost(c fiber.Ctx) error {
+	var req dto.GetPostRequest
+
+	err := c.Bind().Query(&req)
+	if err != nil {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	req.Sanitize()
+
+	postIDStr := c.Params("postId")
+	postID, err := strconv.ParseInt(postIDStr, 10, 64)
+	if err != nil || len(postIDStr) == 0 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	viewer, _ := actorFromContext(c)
+
+	dp, err := ctrl.postSrv.GetPost(c.Context(), viewer, ctrl.viewerKey(c), postID, domain.CommentFilters{
+		Page:  1,
+		Size:  req.CommentsSize,
+		Depth: req.CommentsDepth,
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrPostNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(dto.Response{
+				Message: "post not found",
+			})
+		}
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	response := dto.GetPostResponse{
+		Post:     dp.ToDTO(),
+		Comments: make([]dto.Comment, 0, len(dp.Comments)),
+	}
+	for _, dc := range dp.Comments {
+		response.Comments = append(response.Comments, dc.ToDTO())
+	}
+
 	return c.JSON(response)
 }
 
@@ -45,12 +138,12 @@ func (ctrl Controller) HandleDeletePost(c fiber.Ctx) error {
 		return c.SendStatus(fiber.StatusBadRequest)
 	}
 
-	userID, ok := c.Context().Value(constants.UsrIDContextKey).(int64)
+	actor, ok := actorFromContext(c)
 	if !ok {
 		return c.SendStatus(fiber.StatusInternalServerError)
 	}
 
-	err = ctrl.postSrv.DeletePost(c.Context(), userID, postID)
+	err = ctrl.postSrv.DeletePost(c.Context(), actor, postID)
 	if err != nil {
 		if err == repository.ErrPostNotFound {
 			return c.Status(fiber.StatusNotFound).JSON(dto.Response{
@@ -59,6 +152,13 @@ func (ctrl Controller) HandleDeletePost(c fiber.Ctx) error {
 			})
 		}
 
+		if err == service.ErrPermissionDenied {
+			return c.Status(fiber.StatusForbidden).JSON(dto.Response{
+				Error:   err.Error(),
+				Message: "cannot delete someone else's post",
+			})
+		}
+
 		return c.Status(fiber.StatusInternalServerError).JSON(dto.Response{
 			Error:   err.Error(),
 			Message: "could not delete post",
@@ -67,3 +167,31 @@ func (ctrl Controller) HandleDeletePost(c fiber.Ctx) error {
 
 	return c.SendStatus(fiber.StatusOK)
 }
+
+func (ctrl Controller) HandleUpvotePost(c fiber.Ctx) error {
+	postIDStr := c.Params("postId")
+	postID, err := strconv.ParseInt(postIDStr, 10, 64)
+	if err != nil || len(postIDStr) == 0 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	userID, ok := c.Context().Value(constants.UsrIDContextKey).(int64)
+	if !ok {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	upvoteState, err := ctrl.postSrv.Upvote(c.Context(), userID, postID)
+	if err != nil {
+		if errors.Is(err, repository.ErrPostNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(dto.Response{
+				Message: "cannot upvote non-existing post",
+			})
+		}
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(dto.Response{
+		Message: strconv.FormatBool(upvoteState),
+	})
+}
@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"example.com/authorization/internal/controller/dto"
+	"example.com/authorization/internal/domain"
+)
+
+func profilePostPath(postID int64) string {
+	return "/api/v1/profile/posts/" + strconv.FormatInt(postID, 10)
+}
+
+func TestEditPostIsLimitedToTheOwner(t *testing.T) {
+	t.Parallel()
+
+	ta := newTestApp(t)
+	ownerID, ownerToken := ta.newUser(t, "alice", domain.RoleUser)
+	_, otherToken := ta.newUser(t, "bob", domain.RoleUser)
+	_, moderatorToken := ta.newUser(t, "carol", domain.RoleModerator)
+
+	postID := ta.newPost(t, ownerID)
+	description := "edited"
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"someone else", otherToken, http.StatusForbidden},
+		{"moderator", moderatorToken, http.StatusForbidden},
+		{"owner", ownerToken, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		status := ta.send(t, http.MethodPatch, profilePostPath(postID), tt.token, dto.EditProfilePostRequest{Description: &description}, nil)
+		if status != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, status)
+		}
+	}
+}
+
+func TestEditPostIsRefusedOnceTheEditWindowClosed(t *testing.T) {
+	t.Parallel()
+
+	ta := newTestApp(t)
+	ownerID, ownerToken := ta.newUser(t, "alice", domain.RoleUser)
+
+	postID := ta.newPost(t, ownerID)
+	// the window of the test app is an hour
+	ta.sqlRepo.DB.MustExec("UPDATE post SET created_at = CURRENT_TIMESTAMP - INTERVAL 2 HOUR WHERE id = ?", postID)
+
+	description := "edited"
+	status := ta.send(t, http.MethodPatch, profilePostPath(postID), ownerToken, dto.EditProfilePostRequest{Description: &description}, nil)
+	if status != http.StatusForbidden {
+		t.Fatalf("expected status 403, got %d", status)
+	}
+
+	var revisions dto.ListPostRevisionsResponse
+	ta.get(t, profilePostPath(postID)+"/revisions", ownerToken, &revisions)
+	if revisions.Post.Description != "a post" || len(revisions.Revisions) != 0 {
+		t.Fatalf("expected the post to be left as it was, got %+v", revisions)
+	}
+}
+
+func TestEditPostKeepsThePreviousContentAsARevision(t *testing.T) {
+	t.Parallel()
+
+	ta := newTestApp(t)
+	ownerID, ownerToken := ta.newUser(t, "alice", domain.RoleUser)
+
+	postID := ta.newPost(t, ownerID)
+
+	var listed dto.GetPostResponse
+	ta.get(t, "/api/v1/posts/"+strconv.FormatInt(postID, 10), "", &listed)
+	if listed.Post.Edited || listed.Post.EditedAt != nil {
+		t.Fatalf("expected a new post not to be marked as edited, got %+v", listed.Post)
+	}
+
+	description := "edited"
+	var edited dto.Post
+	status := ta.send(t, http.MethodPatch, profilePostPath(postID), ownerToken, dto.EditProfilePostRequest{Description: &description}, &edited)
+	if status != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", status)
+	}
+
+	if edited.Description != "edited" || edited.URL != "https://example.com" || !edited.Edited || edited.EditedAt == nil {
+		t.Fatalf("expected the edited post marked as edited, got %+v", edited)
+	}
+
+	var revisions dto.ListPostRevisionsResponse
+	status = ta.get(t, profilePostPath(postID)+"/revisions", ownerToken, &revisions)
+	if status != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", status)
+	}
+
+	if len(revisions.Revisions) != 1 {
+		t.Fatalf("expected 1 revision, got %+v", revisions.Revisions)
+	}
+
+	revision := revisions.Revisions[0]
+	if revision.Description != "a post" || revision.URL != "https://example.com" || revision.EditorID != ownerID {
+		t.Fatalf("expected the content from before the edit, got %+v", revision)
+	}
+}
+
+func TestEditPostWithoutChangesWritesNoRevision(t *testing.T) {
+	t.Parallel()
+
+	ta := newTestApp(t)
+	ownerID, ownerToken := ta.newUser(t, "alice", domain.RoleUser)
+
+	postID := ta.newPost(t, ownerID)
+
+	description := "a post"
+	var edited dto.Post
+	status := ta.send(t, http.MethodPatch, profilePostPath(postID), ownerToken, dto.EditProfilePostRequest{Description: &description}, &edited)
+	if status != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", status)
+	}
+
+	if edited.Edited {
+		t.Fatalf("expected the post not to be marked as edited, got %+v", edited)
+	}
+
+	var revisions dto.ListPostRevisionsResponse
+	ta.get(t, profilePostPath(postID)+"/revisions", ownerToken, &revisions)
+	if len(revisions.Revisions) != 0 {
+		t.Fatalf("expected no revision, got %+v", revisions.Revisions)
+	}
+}
@@ -1,11 +1,17 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
 	"example.com/authorization/internal/constants"
 	"example.com/authorization/internal/controller/dto"
 	"example.com/authorization/internal/domain"
+	"example.com/authorization/internal/repository"
+	"example.com/authorization/internal/service"
+	"example.com/authorization/pkg"
 	"github.com/gofiber/fiber/v3"
 )
 
@@ -15,7 +21,12 @@ func (ctrl Controller) HandleListProfilePosts(c fiber.Ctx) error {
 
 	err := c.Bind().Query(&req)
 	if err != nil {
-		c.SendStatus(fiber.StatusBadRequest)
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	// a profile lists its own submissions newest first unless asked otherwise
+	if req.Sort == "" {
+		req.Sort = dto.PostsSortNew
 	}
 
 	req.Sanitize()
@@ -25,12 +36,21 @@ func (ctrl Controller) HandleListProfilePosts(c fiber.Ctx) error {
 		return c.SendStatus(fiber.StatusInternalServerError)
 	}
 
-	dps, err := ctrl.postSrv.ListProfilePosts(c.Context(), userID, domain.PostFilters{
-		Page: req.Page,
-		Size: req.Size,
+	dps, nextCursor, err := ctrl.postSrv.ListProfilePosts(c.Context(), userID, domain.PostFilters{
+		Page:   req.Page,
+		Size:   req.Size,
+		Sort:   domain.PostSort(req.Sort),
+		Since:  req.Since(time.Now()),
+		Cursor: req.Cursor,
 	})
 
 	if err != nil {
+		if errors.Is(err, pkg.ErrInvalidCursor) {
+			return c.Status(fiber.StatusBadRequest).JSON(dto.Response{
+				Message: "invalid cursor",
+			})
+		}
+
 		return c.SendStatus(fiber.StatusInternalServerError)
 	}
 
@@ -38,6 +58,8 @@ func (ctrl Controller) HandleListProfilePosts(c fiber.Ctx) error {
 		response.Posts = append(response.Posts, dp.ToDTO())
 	}
 
+	response.NextCursor = nextCursor
+
 	return c.JSON(response)
 }
 
@@ -68,3 +90,88 @@ func (ctrl Controller) HandleCreateProfilePost(c fiber.Ctx) error {
 		Message: fmt.Sprintf("post created with Id %d", postID),
 	})
 }
+
+func (ctrl Controller) HandleEditProfilePost(c fiber.Ctx) error {
+	var request dto.EditProfilePostRequest
+
+	err := c.Bind().Body(&request)
+	if err != nil {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	postIDStr := c.Params("postId")
+	postID, err := strconv.ParseInt(postIDStr, 10, 64)
+	if err != nil || len(postIDStr) == 0 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	userID, ok := c.Context().Value(constants.UsrIDContextKey).(int64)
+	if !ok {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	dp, err := ctrl.postSrv.EditPost(c.Context(), userID, postID, request.Description, request.URL)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrPostNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(dto.Response{
+				Message: "post not found",
+			})
+		case errors.Is(err, service.ErrPermissionDenied):
+			return c.Status(fiber.StatusForbidden).JSON(dto.Response{
+				Message: "cannot edit someone else's post",
+			})
+		case errors.Is(err, service.ErrEditWindowClosed):
+			return c.Status(fiber.StatusForbidden).JSON(dto.Response{
+				Message: "post can no longer be edited",
+			})
+		case errors.Is(err, service.ErrInvalidEdit):
+			return c.Status(fiber.StatusBadRequest).JSON(dto.Response{
+				Message: "set a description or a non empty url",
+			})
+		default:
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+	}
+
+	return c.JSON(dp.ToDTO())
+}
+
+func (ctrl Controller) HandleListProfilePostRevisions(c fiber.Ctx) error {
+	var response dto.ListPostRevisionsResponse
+
+	postIDStr := c.Params("postId")
+	postID, err := strconv.ParseInt(postIDStr, 10, 64)
+	if err != nil || len(postIDStr) == 0 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	dp, revisions, err := ctrl.postSrv.ListPostRevisions(c.Context(), actor, postID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrPostNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(dto.Response{
+				Message: "post not found",
+			})
+		case errors.Is(err, service.ErrPermissionDenied):
+			return c.Status(fiber.StatusForbidden).JSON(dto.Response{
+				Message: "permission denied",
+			})
+		default:
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+	}
+
+	response.Post = dp.ToDTO()
+	response.Revisions = make([]dto.PostRevision, 0, len(revisions))
+	for _, r := range revisions {
+		response.Revisions = append(response.Revisions, r.ToDTO())
+	}
+
+	return c.JSON(response)
+}
@@ -14,9 +14,9 @@ func (ctrl Controller) HandleRegister(c fiber.Ctx) error {
 		return c.SendStatus(fiber.StatusBadRequest)
 	}
 
-	err = ctrl.userSrv.Register(c.Context(), req.Username, req.Password)
+	err = ctrl.userSrv.Register(c.Context(), req.Username, req.Email, req.Password)
 	if err != nil {
-		return c.SendStatus(fiber.StatusInternalServerError)
+		return accountErrorResponse(c, err)
 	}
 
 	response = dto.Response{
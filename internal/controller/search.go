@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"errors"
+
+	"example.com/authorization/internal/controller/dto"
+	"example.com/authorization/internal/domain"
+	"example.com/authorization/internal/service"
+	"github.com/gofiber/fiber/v3"
+)
+
+var searchRequestTypes = map[string][]string{
+	dto.SearchTypeAll:      nil,
+	dto.SearchTypePosts:    {domain.SearchTypePost},
+	dto.SearchTypeComments: {domain.SearchTypeComment},
+}
+
+func (ctrl Controller) HandleSearch(c fiber.Ctx) error {
+	var req dto.SearchRequest
+	var response dto.SearchResponse
+
+	err := c.Bind().Query(&req)
+	if err != nil {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	req.Sanitize()
+
+	results, nextPage, err := ctrl.searchSrv.Search(c.Context(), req.Q, domain.SearchFilters{
+		Types: searchRequestTypes[req.Type],
+		Page:  req.Page,
+		Size:  req.Size,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrEmptySearchQuery) {
+			return c.Status(fiber.StatusBadRequest).JSON(dto.Response{
+				Message: "q cannot be empty",
+			})
+		}
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	response.NextPage = nextPage
+	response.Results = make([]dto.SearchResult, 0, len(results))
+	for _, r := range results {
+		response.Results = append(response.Results, r.ToDTO())
+	}
+
+	return c.JSON(response)
+}
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"errors"
+
+	"example.com/authorization/internal/constants"
+	"example.com/authorization/internal/controller/dto"
+	"example.com/authorization/internal/repository"
+	"example.com/authorization/internal/service"
+	"github.com/gofiber/fiber/v3"
+)
+
+// how many of the latest posts and comments a profile shows
+const profileActivitySize = 10
+
+func (ctrl Controller) HandleGetUserProfile(c fiber.Ctx) error {
+	var response dto.UserProfileResponse
+
+	username := c.Params("username")
+	if len(username) == 0 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	user, err := ctrl.userSrv.GetUserByUsername(c.Context(), username)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(dto.Response{
+				Message: "user not found",
+			})
+		}
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	dps, err := ctrl.postSrv.ListUserPosts(c.Context(), user.Id, profileActivitySize)
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	dcs, err := ctrl.commentSrv.ListUserComments(c.Context(), user.Id, profileActivitySize)
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	response.User = user.ToProfileDTO()
+
+	response.Posts = make([]dto.Post, 0, len(dps))
+	for _, dp := range dps {
+		response.Posts = append(response.Posts, dp.ToDTO())
+	}
+
+	response.Comments = make([]dto.Comment, 0, len(dcs))
+	for _, dc := range dcs {
+		response.Comments = append(response.Comments, dc.ToDTO())
+	}
+
+	return c.JSON(response)
+}
+
+func (ctrl Controller) HandleUpdateSelf(c fiber.Ctx) error {
+	var request dto.UpdateSelfRequest
+
+	err := c.Bind().Body(&request)
+	if err != nil || request.About == nil {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	userID, ok := c.Context().Value(constants.UsrIDContextKey).(int64)
+	if !ok {
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+
+	err = ctrl.userSrv.UpdateAbout(c.Context(), userID, *request.About)
+	if err != nil {
+		if errors.Is(err, service.ErrAboutTooLong) {
+			return c.Status(fiber.StatusBadRequest).JSON(dto.Response{
+				Message: err.Error(),
+			})
+		}
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(dto.Response{
+		Message: "ok",
+	})
+}
@@ -0,0 +1,207 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"example.com/authorization/internal/controller/dto"
+	"example.com/authorization/internal/domain"
+)
+
+// karma returns the karma on the profile of username
+func (ta testApp) karma(t *testing.T, username string) int64 {
+	t.Helper()
+
+	var response dto.UserProfileResponse
+	status := ta.get(t, "/api/v1/users/"+username, "", &response)
+	if status != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", status)
+	}
+
+	return response.User.Karma
+}
+
+// upvote toggles the upvote of the post, or of the comment when commentID is not 0
+func (ta testApp) upvote(t *testing.T, token string, postID int64, commentID int64) {
+	t.Helper()
+
+	path := "/api/v1/posts/" + strconv.FormatInt(postID, 10)
+	if commentID != 0 {
+		path += "/comments/" + strconv.FormatInt(commentID, 10)
+	}
+
+	status := ta.send(t, http.MethodPost, path+"/upvote", token, nil, nil)
+	if status != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", status)
+	}
+}
+
+func TestUpvotesMoveTheKarmaOfTheAuthor(t *testing.T) {
+	t.Parallel()
+
+	ta := newTestApp(t)
+	authorID, authorToken := ta.newUser(t, "alice", domain.RoleUser)
+	_, voterToken := ta.newUser(t, "bob", domain.RoleUser)
+	postID := ta.newPost(t, authorID)
+	commentID := ta.newComment(t, authorID, postID)
+
+	steps := []struct {
+		name      string
+		token     string
+		commentID int64
+		karma     int64
+	}{
+		{"post upvoted", voterToken, 0, 1},
+		{"comment upvoted", voterToken, commentID, 2},
+		{"post upvote taken back", voterToken, 0, 1},
+		{"own post upvoted", authorToken, 0, 1},
+		{"own comment upvoted", authorToken, commentID, 1},
+		{"comment upvote taken back", voterToken, commentID, 0},
+		{"own comment upvote taken back", authorToken, commentID, 0},
+	}
+
+	for _, s := range steps {
+		ta.upvote(t, s.token, postID, s.commentID)
+
+		if karma := ta.karma(t, "alice"); karma != s.karma {
+			t.Fatalf("%s: expected karma %d, got %d", s.name, s.karma, karma)
+		}
+	}
+}
+
+func TestDeletingAPostTakesBackItsKarma(t *testing.T) {
+	t.Parallel()
+
+	ta := newTestApp(t)
+	authorID, authorToken := ta.newUser(t, "alice", domain.RoleUser)
+	commenterID, commenterToken := ta.newUser(t, "bob", domain.RoleUser)
+	_, voterToken := ta.newUser(t, "carol", domain.RoleUser)
+
+	postID := ta.newPost(t, authorID)
+	keptPostID := ta.newPost(t, authorID)
+	commentID := ta.newComment(t, commenterID, postID)
+
+	ta.upvote(t, commenterToken, postID, 0)
+	ta.upvote(t, voterToken, postID, 0)
+	ta.upvote(t, voterToken, keptPostID, 0)
+	ta.upvote(t, authorToken, postID, commentID)
+	ta.upvote(t, voterToken, postID, commentID)
+
+	status := ta.send(t, http.MethodDelete, "/api/v1/posts/"+strconv.FormatInt(postID, 10), authorToken, nil, nil)
+	if status != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", status)
+	}
+
+	// only the upvote of the post that is still there counts
+	if karma := ta.karma(t, "alice"); karma != 1 {
+		t.Errorf("expected karma 1 for the author, got %d", karma)
+	}
+
+	// the comment went with the post
+	if karma := ta.karma(t, "bob"); karma != 0 {
+		t.Errorf("expected karma 0 for the commenter, got %d", karma)
+	}
+}
+
+func TestDeletingAUserTakesBackTheKarmaOfTheirUpvotes(t *testing.T) {
+	t.Parallel()
+
+	ta := newTestApp(t)
+	authorID, _ := ta.newUser(t, "alice", domain.RoleUser)
+	deletedID, deletedToken := ta.newUser(t, "bob", domain.RoleUser)
+	_, voterToken := ta.newUser(t, "carol", domain.RoleUser)
+	_, adminToken := ta.newUser(t, "dave", domain.RoleAdmin)
+
+	postID := ta.newPost(t, authorID)
+	deletedPostID := ta.newPost(t, deletedID)
+	// alice replies on the post of bob, the reply goes with bob
+	replyID := ta.newComment(t, authorID, deletedPostID)
+
+	ta.upvote(t, deletedToken, postID, 0)
+	ta.upvote(t, voterToken, postID, 0)
+	ta.upvote(t, deletedToken, deletedPostID, replyID)
+	ta.upvote(t, voterToken, deletedPostID, replyID)
+
+	if karma := ta.karma(t, "alice"); karma != 4 {
+		t.Fatalf("expected karma 4, got %d", karma)
+	}
+
+	status := ta.send(t, http.MethodDelete, "/api/v1/admin/users/"+strconv.FormatInt(deletedID, 10), adminToken, nil, nil)
+	if status != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", status)
+	}
+
+	if karma := ta.karma(t, "alice"); karma != 1 {
+		t.Errorf("expected karma 1, got %d", karma)
+	}
+}
+
+func TestProfilesLeaveOutHiddenAndDeletedActivity(t *testing.T) {
+	t.Parallel()
+
+	ta := newTestApp(t)
+	userID, _ := ta.newUser(t, "alice", domain.RoleUser)
+
+	postID := ta.newPost(t, userID)
+	hiddenPostID := ta.newPost(t, userID)
+	ta.sqlRepo.DB.MustExec("UPDATE post SET hidden_at = CURRENT_TIMESTAMP WHERE id = ?", hiddenPostID)
+
+	commentID := ta.newComment(t, userID, postID)
+	hiddenCommentID := ta.newComment(t, userID, postID)
+	ta.sqlRepo.DB.MustExec("UPDATE comment SET hidden_at = CURRENT_TIMESTAMP WHERE id = ?", hiddenCommentID)
+	deletedCommentID := ta.newComment(t, userID, postID)
+	ta.sqlRepo.DB.MustExec("UPDATE comment SET deleted_at = CURRENT_TIMESTAMP WHERE id = ?", deletedCommentID)
+	ta.newComment(t, userID, hiddenPostID)
+
+	var response dto.UserProfileResponse
+	status := ta.get(t, "/api/v1/users/alice", "", &response)
+	if status != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", status)
+	}
+
+	if len(response.Posts) != 1 || int64(response.Posts[0].Id) != postID {
+		t.Errorf("expected only post %d, got %+v", postID, response.Posts)
+	}
+
+	if len(response.Comments) != 1 || int64(response.Comments[0].Id) != commentID {
+		t.Errorf("expected only comment %d, got %+v", commentID, response.Comments)
+	}
+}
+
+func TestAboutTextsAreLimitedInLength(t *testing.T) {
+	t.Parallel()
+
+	ta := newTestApp(t)
+	_, token := ta.newUser(t, "alice", domain.RoleUser)
+
+	cases := []struct {
+		name   string
+		about  string
+		status int
+	}{
+		// the limit counts characters, not bytes
+		{"longest", strings.Repeat("é", domain.MaxAboutLength), http.StatusOK},
+		{"too long", strings.Repeat("a", domain.MaxAboutLength+1), http.StatusBadRequest},
+		// surrounding spaces are trimmed before counting
+		{"padded", " " + strings.Repeat("a", domain.MaxAboutLength) + " ", http.StatusOK},
+	}
+
+	for _, tc := range cases {
+		status := ta.send(t, http.MethodPatch, "/api/v1/profile/self", token, dto.UpdateSelfRequest{About: &tc.about}, nil)
+		if status != tc.status {
+			t.Errorf("%s: expected status %d, got %d", tc.name, tc.status, status)
+		}
+	}
+
+	var response dto.UserProfileResponse
+	status := ta.get(t, "/api/v1/users/alice", "", &response)
+	if status != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", status)
+	}
+
+	if response.User.About != strings.Repeat("a", domain.MaxAboutLength) {
+		t.Errorf("expected the trimmed about text, got %q", response.User.About)
+	}
+}
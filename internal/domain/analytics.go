@@ -0,0 +1,71 @@
+package domain
+
+import (
+	"time"
+
+	"example.com/authorization/internal/controller/dto"
+)
+
+// AnalyticsDateLayout is how days are written in analytics keys and requests
+const AnalyticsDateLayout = "2006-01-02"
+
+type DailyVisitors struct {
+	Date           time.Time
+	UniqueVisitors int64
+}
+
+type RouteHits struct {
+	// Route is the method and the route pattern, e.g. "GET /api/v1/posts/:postId"
+	Route string
+	Hits  int64
+}
+
+type PostViews struct {
+	PostID int64
+	Views  int64
+}
+
+// AnalyticsReport covers the days from From to To, both included
+type AnalyticsReport struct {
+	From time.Time
+	To   time.Time
+	// UniqueVisitors counts a visitor once over the whole range, unlike the sum of the days
+	UniqueVisitors int64
+	Days           []DailyVisitors
+	Routes         []RouteHits
+	TopPosts       []PostViews
+}
+
+func (ar *AnalyticsReport) ToDTO() dto.AnalyticsResponse {
+	response := dto.AnalyticsResponse{
+		From:           ar.From.Format(AnalyticsDateLayout),
+		To:             ar.To.Format(AnalyticsDateLayout),
+		UniqueVisitors: ar.UniqueVisitors,
+		Days:           make([]dto.DailyVisitors, 0, len(ar.Days)),
+		Routes:         make([]dto.RouteHits, 0, len(ar.Routes)),
+		TopPosts:       make([]dto.PostViews, 0, len(ar.TopPosts)),
+	}
+
+	for _, d := range ar.Days {
+		response.Days = append(response.Days, dto.DailyVisitors{
+			Date:           d.Date.Format(AnalyticsDateLayout),
+			UniqueVisitors: d.UniqueVisitors,
+		})
+	}
+
+	for _, r := range ar.Routes {
+		response.Routes = append(response.Routes, dto.RouteHits{
+			Route: r.Route,
+			Hits:  r.Hits,
+		})
+	}
+
+	for _, p := range ar.TopPosts {
+		response.TopPosts = append(response.TopPosts, dto.PostViews{
+			PostID: p.PostID,
+			Views:  p.Views,
+		})
+	}
+
+	return response
+}
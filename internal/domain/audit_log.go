@@ -0,0 +1,99 @@
+package domain
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"example.com/authorization/internal/controller/dto"
+	"example.com/authorization/internal/repository/entity"
+)
+
+const (
+	AuditActionDeletePost     = "post.delete"
+	AuditActionDeleteComment  = "comment.delete"
+	AuditActionUpdateUserRole = "user.role.update"
+	AuditActionDeleteUser     = "user.delete"
+	AuditActionSuspendUser    = "user.suspend"
+	AuditActionUnsuspendUser  = "user.unsuspend"
+	AuditActionResolveFlags   = "flag.resolve"
+)
+
+const (
+	AuditTargetPost    = "post"
+	AuditTargetComment = "comment"
+	AuditTargetUser    = "user"
+)
+
+type AuditLog struct {
+	Id         int64
+	ActorID    int64
+	Action     string
+	TargetType string
+	TargetID   int64
+	Details    map[string]any
+	CreatedAt  time.Time
+}
+
+func NewAuditLog(actor Actor, action string, targetType string, targetID int64, details map[string]any) AuditLog {
+	return AuditLog{
+		ActorID:    actor.UserID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Details:    details,
+	}
+}
+
+func (al *AuditLog) ToEntity() entity.AuditLog {
+	var details sql.NullString
+	if len(al.Details) > 0 {
+		b, err := json.Marshal(al.Details)
+		if err == nil {
+			details = sql.NullString{String: string(b), Valid: true}
+		}
+	}
+
+	return entity.AuditLog{
+		Id:         al.Id,
+		ActorID:    al.ActorID,
+		Action:     al.Action,
+		TargetType: al.TargetType,
+		TargetID:   al.TargetID,
+		Details:    details,
+	}
+}
+
+func (al *AuditLog) ToDTO() dto.AuditLog {
+	return dto.AuditLog{
+		Id:         al.Id,
+		ActorID:    al.ActorID,
+		Action:     al.Action,
+		TargetType: al.TargetType,
+		TargetID:   al.TargetID,
+		Details:    al.Details,
+		CreatedAt:  al.CreatedAt,
+	}
+}
+
+func NewAuditLogsFromEntities(ales []entity.AuditLog) []AuditLog {
+	var logs []AuditLog
+	for _, ale := range ales {
+		var details map[string]any
+		if ale.Details.Valid {
+			_ = json.Unmarshal([]byte(ale.Details.String), &details)
+		}
+
+		logs = append(logs, AuditLog{
+			Id:         ale.Id,
+			ActorID:    ale.ActorID,
+			Action:     ale.Action,
+			TargetType: ale.TargetType,
+			TargetID:   ale.TargetID,
+			Details:    details,
+			CreatedAt:  ale.CreatedAt.Time,
+		})
+	}
+
+	return logs
+}
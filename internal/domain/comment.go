@@ -2,6 +2,7 @@ package domain
 
 import (
 	"database/sql"
+	"sort"
 	"time"
 
 	"example.com/authorization/internal/controller/dto"
@@ -9,25 +10,41 @@ import (
 )
 
 type CommentFilters struct {
-	Page uint64
-	Size uint64
+	Page  uint64
+	Size  uint64
+	Depth uint64
+	// Cursor is the opaque token of a previous page, Page is ignored when it is set
+	Cursor string
 }
 
 type Comment struct {
 	Id        int64
 	UserID    int64
 	PostID    int64
+	ParentID  *int64
 	Content   string
 	VoteCount uint64
+	Deleted   bool
+	// Hidden comments were flagged by enough users, only moderators can see them
+	Hidden  bool
+	Replies []Comment
+	// EditedAt is zero for comments that were never edited
+	EditedAt  time.Time
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
 
 func (c *Comment) ToEntity() entity.Comment {
+	var parentID sql.NullInt64
+	if c.ParentID != nil {
+		parentID = sql.NullInt64{Int64: *c.ParentID, Valid: true}
+	}
+
 	return entity.Comment{
 		Id:        c.Id,
 		UserID:    c.UserID,
 		PostID:    c.PostID,
+		ParentID:  parentID,
 		Content:   c.Content,
 		VoteCount: c.VoteCount,
 		CreatedAt: sql.NullTime{Time: c.CreatedAt, Valid: true},
@@ -36,24 +53,49 @@ func (c *Comment) ToEntity() entity.Comment {
 }
 
 func (c *Comment) ToDTO() dto.Comment {
+	var replies []dto.Comment
+	for _, r := range c.Replies {
+		replies = append(replies, r.ToDTO())
+	}
+
+	var editedAt *time.Time
+	if !c.EditedAt.IsZero() {
+		editedAt = &c.EditedAt
+	}
+
 	return dto.Comment{
 		Id:        int(c.Id),
 		UserID:    c.UserID,
 		PostID:    c.PostID,
+		ParentID:  c.ParentID,
 		Content:   c.Content,
 		VoteCount: c.VoteCount,
+		Deleted:   c.Deleted,
+		Hidden:    c.Hidden,
+		Edited:    !c.EditedAt.IsZero(),
+		EditedAt:  editedAt,
+		Replies:   replies,
 		CreatedAt: c.CreatedAt,
 		UpdatedAt: &c.UpdatedAt,
 	}
 }
 
 func NewCommentFromEntity(p entity.Comment) Comment {
+	var parentID *int64
+	if p.ParentID.Valid {
+		parentID = &p.ParentID.Int64
+	}
+
 	return Comment{
 		Id:        p.Id,
 		PostID:    p.PostID,
+		ParentID:  parentID,
 		Content:   p.Content,
 		UserID:    p.UserID,
 		VoteCount: p.VoteCount,
+		Deleted:   p.DeletedAt.Valid,
+		Hidden:    p.HiddenAt.Valid,
+		EditedAt:  p.EditedAt.Time,
 		CreatedAt: p.CreatedAt.Time,
 		UpdatedAt: p.UpdatedAt.Time,
 	}
@@ -62,16 +104,48 @@ func NewCommentFromEntity(p entity.Comment) Comment {
 func NewCommentsFromEntities(ces []entity.Comment) []Comment {
 	var comments []Comment
 	for _, ce := range ces {
-		comments = append(comments, Comment{
-			Id:        ce.Id,
-			PostID:    ce.PostID,
-			Content:   ce.Content,
-			UserID:    ce.UserID,
-			VoteCount: ce.VoteCount,
-			CreatedAt: ce.CreatedAt.Time,
-			UpdatedAt: ce.UpdatedAt.Time,
-		})
+		comments = append(comments, NewCommentFromEntity(ce))
 	}
 
 	return comments
 }
+
+// NewCommentTreeFromEntities nests the flat thread rows under their parents, siblings are
+// ordered by score and deleted comments are only kept when they still have replies
+func NewCommentTreeFromEntities(ces []entity.Comment) []Comment {
+	children := make(map[int64][]Comment)
+	var roots []Comment
+	for _, ce := range ces {
+		c := NewCommentFromEntity(ce)
+		if c.ParentID == nil {
+			roots = append(roots, c)
+			continue
+		}
+
+		children[*c.ParentID] = append(children[*c.ParentID], c)
+	}
+
+	return buildCommentTree(roots, children)
+}
+
+func buildCommentTree(level []Comment, children map[int64][]Comment) []Comment {
+	var tree []Comment
+	for _, c := range level {
+		c.Replies = buildCommentTree(children[c.Id], children)
+		if c.Deleted && len(c.Replies) == 0 {
+			continue
+		}
+
+		tree = append(tree, c)
+	}
+
+	sort.SliceStable(tree, func(i, j int) bool {
+		if tree[i].VoteCount != tree[j].VoteCount {
+			return tree[i].VoteCount > tree[j].VoteCount
+		}
+
+		return tree[i].Id < tree[j].Id
+	})
+
+	return tree
+}
@@ -0,0 +1,110 @@
+package domain
+
+import (
+	"strings"
+	"time"
+
+	"example.com/authorization/internal/controller/dto"
+	"example.com/authorization/internal/repository/entity"
+)
+
+const (
+	FlagTargetPost    = AuditTargetPost
+	FlagTargetComment = AuditTargetComment
+)
+
+type FlagReason string
+
+const (
+	FlagReasonSpam     FlagReason = "spam"
+	FlagReasonAbuse    FlagReason = "abuse"
+	FlagReasonOffTopic FlagReason = "off_topic"
+	FlagReasonOther    FlagReason = "other"
+)
+
+func (r FlagReason) IsValid() bool {
+	switch r {
+	case FlagReasonSpam, FlagReasonAbuse, FlagReasonOffTopic, FlagReasonOther:
+		return true
+	default:
+		return false
+	}
+}
+
+type FlagResolution string
+
+const (
+	// FlagResolutionDismiss drops the flags and restores the item if it got hidden
+	FlagResolutionDismiss FlagResolution = "dismiss"
+	// FlagResolutionHide keeps the item hidden, flagged or not
+	FlagResolutionHide FlagResolution = "hide"
+)
+
+func (r FlagResolution) IsValid() bool {
+	return r == FlagResolutionDismiss || r == FlagResolutionHide
+}
+
+type Flag struct {
+	UserID     int64
+	TargetType string
+	TargetID   int64
+	Reason     FlagReason
+}
+
+func (f *Flag) ToEntity() entity.Flag {
+	return entity.Flag{
+		UserID:     f.UserID,
+		TargetType: f.TargetType,
+		TargetID:   f.TargetID,
+		Reason:     string(f.Reason),
+	}
+}
+
+// FlaggedItem is an entry of the moderation queue
+type FlaggedItem struct {
+	TargetType     string
+	TargetID       int64
+	FlagCount      uint64
+	Reasons        []FlagReason
+	FirstFlaggedAt time.Time
+	LastFlaggedAt  time.Time
+}
+
+func (fi *FlaggedItem) ToDTO() dto.FlaggedItem {
+	reasons := make([]string, 0, len(fi.Reasons))
+	for _, r := range fi.Reasons {
+		reasons = append(reasons, string(r))
+	}
+
+	return dto.FlaggedItem{
+		TargetType:     fi.TargetType,
+		TargetID:       fi.TargetID,
+		FlagCount:      fi.FlagCount,
+		Reasons:        reasons,
+		FirstFlaggedAt: fi.FirstFlaggedAt,
+		LastFlaggedAt:  fi.LastFlaggedAt,
+	}
+}
+
+func NewFlaggedItemsFromEntities(fies []entity.FlaggedItem) []FlaggedItem {
+	var items []FlaggedItem
+	for _, fie := range fies {
+		var reasons []FlagReason
+		for _, r := range strings.Split(fie.Reasons, ",") {
+			if r != "" {
+				reasons = append(reasons, FlagReason(r))
+			}
+		}
+
+		items = append(items, FlaggedItem{
+			TargetType:     fie.TargetType,
+			TargetID:       fie.TargetID,
+			FlagCount:      fie.FlagCount,
+			Reasons:        reasons,
+			FirstFlaggedAt: fie.FirstFlaggedAt.Time,
+			LastFlaggedAt:  fie.LastFlaggedAt.Time,
+		})
+	}
+
+	return items
+}
@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+
+	"example.com/authorization/internal/controller/dto"
+)
+
+// PublicKey is a token verification key as published in the JWKS
+type PublicKey struct {
+	Kid       string
+	Algorithm string
+	Key       crypto.PublicKey
+}
+
+func (pk *PublicKey) ToDTO() dto.JSONWebKey {
+	jwk := dto.JSONWebKey{
+		Kid: pk.Kid,
+		Use: "sig",
+		Alg: pk.Algorithm,
+	}
+
+	switch key := pk.Key.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(key)
+	}
+
+	return jwk
+}
@@ -0,0 +1,68 @@
+package domain
+
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+type Permission string
+
+const (
+	PermissionDeleteAnyPost    Permission = "post:delete:any"
+	PermissionDeleteAnyComment Permission = "comment:delete:any"
+	PermissionManageUsers      Permission = "user:manage"
+	PermissionViewAuditLog     Permission = "audit_log:view"
+	// PermissionModerateFlags allows working the moderation queue and seeing hidden posts and comments
+	PermissionModerateFlags Permission = "flag:moderate"
+	// PermissionViewMetrics allows reading the runtime metrics, cache health included
+	PermissionViewMetrics Permission = "metrics:view"
+	// PermissionViewAnalytics allows reading the visitor and traffic analytics
+	PermissionViewAnalytics Permission = "analytics:view"
+)
+
+var moderatorPermissions = []Permission{
+	PermissionDeleteAnyPost,
+	PermissionDeleteAnyComment,
+	PermissionViewAuditLog,
+	PermissionModerateFlags,
+}
+
+var rolePermissions = map[Role][]Permission{
+	RoleUser:      {},
+	RoleModerator: moderatorPermissions,
+	RoleAdmin:     append([]Permission{PermissionManageUsers, PermissionViewMetrics, PermissionViewAnalytics}, moderatorPermissions...),
+}
+
+func (r Role) IsValid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+func (r Role) Can(p Permission) bool {
+	for _, rp := range rolePermissions[r] {
+		if rp == p {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Actor is the authorized user performing an action
+type Actor struct {
+	UserID int64
+	Role   Role
+}
+
+// CanModify allows owners to change their own resources and privileged roles to change anyone's
+func (a Actor) CanModify(ownerID int64, p Permission) bool {
+	return a.UserID == ownerID || a.Role.Can(p)
+}
+
+// IsModerating tells whether acting on a resource of ownerID goes beyond ownership and has to be audited
+func (a Actor) IsModerating(ownerID int64) bool {
+	return a.UserID != ownerID
+}
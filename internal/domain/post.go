@@ -8,9 +8,26 @@ import (
 	"example.com/authorization/internal/repository/entity"
 )
 
+type PostSort string
+
+const (
+	PostSortNew  PostSort = "new"
+	PostSortTop  PostSort = "top"
+	PostSortBest PostSort = "best"
+	PostSortHot  PostSort = "hot"
+)
+
+// best is the same as hacker news, top posts of the last week
+const BestPostsWindow = 7 * 24 * time.Hour
+
 type PostFilters struct {
 	Page uint64
 	Size uint64
+	Sort PostSort
+	// Since limits top posts to the ones created after it, zero means all time
+	Since time.Time
+	// Cursor is the opaque token of a previous page, Page is ignored when it is set
+	Cursor string
 }
 
 type Post struct {
@@ -18,10 +35,18 @@ type Post struct {
 	Description   string
 	URL           string
 	UserID        int64
+	Username      string
 	VoteCount     uint64
 	CommentsCount uint64
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
+	// Views is only known once the post went through PostService, entities do not carry it
+	Views uint64
+	// Hidden posts were flagged by enough users, only their owner and moderators can see them
+	Hidden   bool
+	Comments []Comment
+	// EditedAt is zero for posts that were never edited, UpdatedAt also moves with votes
+	EditedAt  time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
 
 func (p *Post) ToEntity() entity.Post {
@@ -36,6 +61,11 @@ func (p *Post) ToEntity() entity.Post {
 }
 
 func (p *Post) ToDTO() dto.Post {
+	var editedAt *time.Time
+	if !p.EditedAt.IsZero() {
+		editedAt = &p.EditedAt
+	}
+
 	return dto.Post{
 		Id:               int(p.Id),
 		CreatedAt:        p.CreatedAt,
@@ -43,18 +73,28 @@ func (p *Post) ToDTO() dto.Post {
 		URL:              p.URL,
 		NumberOfUpvotes:  p.VoteCount,
 		NumberOfComments: p.CommentsCount,
+		NumberOfViews:    p.Views,
 		Description:      p.Description,
+		Author:           p.Username,
+		Hidden:           p.Hidden,
+		Edited:           !p.EditedAt.IsZero(),
+		EditedAt:         editedAt,
 	}
 }
 
 func NewPostFromEntity(p entity.Post) Post {
 	return Post{
-		Id:          p.Id,
-		Description: p.Description,
-		URL:         p.URL,
-		UserID:      p.UserID,
-		CreatedAt:   p.CreatedAt.Time,
-		UpdatedAt:   p.UpdatedAt.Time,
+		Id:            p.Id,
+		Description:   p.Description,
+		URL:           p.URL,
+		UserID:        p.UserID,
+		Username:      p.Username,
+		VoteCount:     p.UpvoteCount,
+		CommentsCount: p.CommentCount,
+		Hidden:        p.HiddenAt.Valid,
+		EditedAt:      p.EditedAt.Time,
+		CreatedAt:     p.CreatedAt.Time,
+		UpdatedAt:     p.UpdatedAt.Time,
 	}
 }
 
@@ -66,10 +106,13 @@ func NewPostsFromEntities(p []entity.Post) []Post {
 			Description:   pe.Description,
 			URL:           pe.URL,
 			UserID:        pe.UserID,
+			Username:      pe.Username,
 			CreatedAt:     pe.CreatedAt.Time,
 			UpdatedAt:     pe.UpdatedAt.Time,
 			VoteCount:     pe.UpvoteCount,
 			CommentsCount: pe.CommentCount,
+			Hidden:        pe.HiddenAt.Valid,
+			EditedAt:      pe.EditedAt.Time,
 		})
 	}
 
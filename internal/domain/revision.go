@@ -0,0 +1,81 @@
+package domain
+
+import (
+	"time"
+
+	"example.com/authorization/internal/controller/dto"
+	"example.com/authorization/internal/repository/entity"
+)
+
+// PostRevision is the content a post had before one of its edits
+type PostRevision struct {
+	Id          int64
+	PostID      int64
+	EditorID    int64
+	Description string
+	URL         string
+	// ReplacedAt is when this content was replaced by the next revision
+	ReplacedAt time.Time
+}
+
+func (pr *PostRevision) ToDTO() dto.PostRevision {
+	return dto.PostRevision{
+		Id:          pr.Id,
+		PostID:      pr.PostID,
+		EditorID:    pr.EditorID,
+		Description: pr.Description,
+		URL:         pr.URL,
+		ReplacedAt:  pr.ReplacedAt,
+	}
+}
+
+func NewPostRevisionsFromEntities(pres []entity.PostRevision) []PostRevision {
+	var revisions []PostRevision
+	for _, pre := range pres {
+		revisions = append(revisions, PostRevision{
+			Id:          pre.Id,
+			PostID:      pre.PostID,
+			EditorID:    pre.UserID,
+			Description: pre.Description,
+			URL:         pre.URL,
+			ReplacedAt:  pre.CreatedAt.Time,
+		})
+	}
+
+	return revisions
+}
+
+// CommentRevision is the content a comment had before one of its edits
+type CommentRevision struct {
+	Id        int64
+	CommentID int64
+	EditorID  int64
+	Content   string
+	// ReplacedAt is when this content was replaced by the next revision
+	ReplacedAt time.Time
+}
+
+func (cr *CommentRevision) ToDTO() dto.CommentRevision {
+	return dto.CommentRevision{
+		Id:         cr.Id,
+		CommentID:  cr.CommentID,
+		EditorID:   cr.EditorID,
+		Content:    cr.Content,
+		ReplacedAt: cr.ReplacedAt,
+	}
+}
+
+func NewCommentRevisionsFromEntities(cres []entity.CommentRevision) []CommentRevision {
+	var revisions []CommentRevision
+	for _, cre := range cres {
+		revisions = append(revisions, CommentRevision{
+			Id:         cre.Id,
+			CommentID:  cre.CommentID,
+			EditorID:   cre.UserID,
+			Content:    cre.Content,
+			ReplacedAt: cre.CreatedAt.Time,
+		})
+	}
+
+	return revisions
+}
@@ -0,0 +1,166 @@
+package domain
+
+import (
+	"html"
+	"strings"
+	"time"
+	"unicode"
+
+	"example.com/authorization/internal/controller/dto"
+	"example.com/authorization/internal/repository/entity"
+)
+
+const (
+	SearchTypePost    = "post"
+	SearchTypeComment = "comment"
+)
+
+const (
+	// snippetLength is the number of characters of content shown around the first match
+	snippetLength = 200
+	// snippetLead is how many characters are kept before the first match
+	snippetLead = 60
+)
+
+type SearchFilters struct {
+	// Types limits the search to posts or comments, both are searched when it is empty
+	Types []string
+	Page  uint64
+	Size  uint64
+}
+
+type SearchResult struct {
+	Type      string
+	Id        int64
+	PostID    int64
+	UserID    int64
+	Username  string
+	URL       string
+	Snippet   string
+	Score     float64
+	CreatedAt time.Time
+}
+
+func (sr *SearchResult) ToDTO() dto.SearchResult {
+	var createdAt *time.Time
+	if !sr.CreatedAt.IsZero() {
+		createdAt = &sr.CreatedAt
+	}
+
+	return dto.SearchResult{
+		Type:      sr.Type,
+		Id:        sr.Id,
+		PostID:    sr.PostID,
+		Author:    sr.Username,
+		URL:       sr.URL,
+		Snippet:   sr.Snippet,
+		Score:     sr.Score,
+		CreatedAt: createdAt,
+	}
+}
+
+// NewSearchResultsFromEntities turns the matched rows into results with a highlighted snippet of their content
+func NewSearchResultsFromEntities(query string, sres []entity.SearchResult) []SearchResult {
+	terms := searchTerms(query)
+
+	var results []SearchResult
+	for _, sre := range sres {
+		results = append(results, SearchResult{
+			Type:      sre.Type,
+			Id:        sre.Id,
+			PostID:    sre.PostID,
+			UserID:    sre.UserID,
+			Username:  sre.Username,
+			URL:       sre.URL,
+			Snippet:   Snippet(sre.Content, terms),
+			Score:     sre.Score,
+			CreatedAt: sre.CreatedAt.Time,
+		})
+	}
+
+	return results
+}
+
+func searchTerms(query string) [][]rune {
+	var terms [][]rune
+	for _, f := range strings.FieldsFunc(query, isNotWordRune) {
+		terms = append(terms, []rune(strings.ToLower(f)))
+	}
+
+	return terms
+}
+
+func isNotWordRune(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// Snippet cuts the part of content around the first matching term and wraps every match in <mark>,
+// the content itself is HTML escaped so the snippet can be rendered as is
+func Snippet(content string, terms [][]rune) string {
+	text := []rune(content)
+	lower := make([]rune, len(text))
+	for i, r := range text {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	start := 0
+	for i := range lower {
+		if matchTerm(lower, i, terms) > 0 {
+			start = max(i-snippetLead, 0)
+			break
+		}
+	}
+
+	end := min(start+snippetLength, len(text))
+
+	var sb strings.Builder
+	if start > 0 {
+		sb.WriteString("…")
+	}
+
+	plainFrom := start
+	for i := start; i < end; {
+		n := matchTerm(lower, i, terms)
+		if n == 0 {
+			i++
+			continue
+		}
+
+		matchEnd := min(i+n, end)
+		sb.WriteString(html.EscapeString(string(text[plainFrom:i])))
+		sb.WriteString("<mark>")
+		sb.WriteString(html.EscapeString(string(text[i:matchEnd])))
+		sb.WriteString("</mark>")
+		i, plainFrom = matchEnd, matchEnd
+	}
+
+	sb.WriteString(html.EscapeString(string(text[plainFrom:end])))
+	if end < len(text) {
+		sb.WriteString("…")
+	}
+
+	return sb.String()
+}
+
+// matchTerm returns the length of the term found as a whole word at i, the same way FULLTEXT matches it
+func matchTerm(lower []rune, i int, terms [][]rune) int {
+	if i > 0 && !isNotWordRune(lower[i-1]) {
+		return 0
+	}
+
+	for _, t := range terms {
+		if len(t) == 0 || i+len(t) > len(lower) {
+			continue
+		}
+
+		if i+len(t) < len(lower) && !isNotWordRune(lower[i+len(t)]) {
+			continue
+		}
+
+		if string(lower[i:i+len(t)]) == string(t) {
+			return len(t)
+		}
+	}
+
+	return 0
+}
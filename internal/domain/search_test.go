@@ -0,0 +1,97 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSnippet(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		content string
+		query   string
+		want    string
+	}{
+		{
+			name:    "match at the start",
+			content: "gophers are great",
+			query:   "gophers",
+			want:    "<mark>gophers</mark> are great",
+		},
+		{
+			name:    "match at the end",
+			content: "we all love gophers",
+			query:   "gophers",
+			want:    "we all love <mark>gophers</mark>",
+		},
+		{
+			name:    "case insensitive",
+			content: "Gophers are great",
+			query:   "GOPHERS",
+			want:    "<mark>Gophers</mark> are great",
+		},
+		{
+			name:    "multiple terms",
+			content: "go and rust, then go again",
+			query:   "rust go",
+			want:    "<mark>go</mark> and <mark>rust</mark>, then <mark>go</mark> again",
+		},
+		{
+			name:    "whole words only",
+			content: "a gopher going",
+			query:   "go",
+			want:    "a gopher going",
+		},
+		{
+			name:    "html escaped",
+			content: "<script>alert(1)</script> & gophers",
+			query:   "gophers",
+			want:    "&lt;script&gt;alert(1)&lt;/script&gt; &amp; <mark>gophers</mark>",
+		},
+		{
+			name:    "match inside markup",
+			content: "<script>alert(1)</script>",
+			query:   "script",
+			want:    "&lt;<mark>script</mark>&gt;alert(1)&lt;/<mark>script</mark>&gt;",
+		},
+		{
+			name:    "non ascii",
+			content: "un café au lait, سلام دنیا",
+			query:   "CAFÉ دنیا",
+			want:    "un <mark>café</mark> au lait, سلام <mark>دنیا</mark>",
+		},
+		{
+			name:    "no match",
+			content: "nothing to see here",
+			query:   "gophers",
+			want:    "nothing to see here",
+		},
+		{
+			name:    "no match in long content",
+			content: strings.Repeat("é", 250),
+			query:   "gophers",
+			want:    strings.Repeat("é", 200) + "…",
+		},
+		{
+			name:    "late match",
+			content: strings.Repeat("a ", 100) + "gophers",
+			query:   "gophers",
+			want:    "…" + strings.Repeat("a ", 30) + "<mark>gophers</mark>",
+		},
+		{
+			name:    "match cut at the end of the snippet",
+			content: "gophers " + strings.Repeat("é", 190) + " gophers and more",
+			query:   "gophers",
+			want:    "<mark>gophers</mark> " + strings.Repeat("é", 190) + " <mark>g</mark>…",
+		},
+	}
+
+	for _, tt := range tests {
+		got := Snippet(tt.content, searchTerms(tt.query))
+		if got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
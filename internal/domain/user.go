@@ -1,25 +1,108 @@
 package domain
 
 import (
+	"time"
+
 	"example.com/authorization/internal/controller/dto"
 	"example.com/authorization/internal/repository/entity"
 )
 
+type UserSort string
+
+const (
+	UserSortNew      UserSort = "new"
+	UserSortOld      UserSort = "old"
+	UserSortUsername UserSort = "username"
+	UserSortKarma    UserSort = "karma"
+)
+
+type UserFilters struct {
+	// Search is a username or email prefix
+	Search string
+	// Suspended keeps only suspended or only active users when it is set
+	Suspended *bool
+	Sort      UserSort
+	Page      uint64
+	Size      uint64
+}
+
+// MaxAboutLength is the longest about text a user can put on their profile
+const MaxAboutLength = 1000
+
 type User struct {
+	Id       int64
 	Username string
 	Email    string
+	Role     Role
+	About    string
+	// Karma is the number of upvotes the user got from others on their posts and comments that
+	// still exist. Deleting a post or a user takes back the karma of the upvotes that go with them,
+	// a deleted comment keeps its row and so its upvotes
+	Karma     int64
+	CreatedAt time.Time
+	// SuspendedAt is zero unless an admin suspended the user
+	SuspendedAt time.Time
+	// EmailVerified is set once the user followed the link mailed to Email
+	EmailVerified bool
+	// MFAEnabled is set once the user confirmed an authenticator app, logins ask for a code from it
+	MFAEnabled bool
+}
+
+func (u *User) IsSuspended() bool {
+	return !u.SuspendedAt.IsZero()
 }
 
 func (u *User) ToDTO() dto.User {
 	return dto.User{
-		Username: u.Username,
-		Email:    u.Email,
+		Username:      u.Username,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerified,
+		MFAEnabled:    u.MFAEnabled,
+		Role:          string(u.Role),
+	}
+}
+
+// ToProfileDTO is the public side of the user, it leaves out anything only the user should see
+func (u *User) ToProfileDTO() dto.UserProfile {
+	return dto.UserProfile{
+		Username:  u.Username,
+		About:     u.About,
+		Karma:     u.Karma,
+		CreatedAt: u.CreatedAt,
+	}
+}
+
+// ToAdminDTO is what admins see of the user when managing accounts
+func (u *User) ToAdminDTO() dto.AdminUser {
+	var suspendedAt *time.Time
+	if u.IsSuspended() {
+		suspendedAt = &u.SuspendedAt
+	}
+
+	return dto.AdminUser{
+		Id:          u.Id,
+		Username:    u.Username,
+		Email:       u.Email,
+		Role:        string(u.Role),
+		Karma:       u.Karma,
+		CreatedAt:   u.CreatedAt,
+		Suspended:   u.IsSuspended(),
+		SuspendedAt: suspendedAt,
 	}
 }
 
 func NewUserFromEntity(eu entity.User) User {
 	return User{
-		Username: eu.Username,
-		Email:    eu.Email.String,
+		Id:        eu.Id,
+		Username:  eu.Username,
+		Email:     eu.Email.String,
+		Role:      Role(eu.Role),
+		About:     eu.About.String,
+		Karma:     eu.Karma,
+		CreatedAt: eu.CreatedAt.Time,
+		// a NULL suspended_at scans into the zero time
+		SuspendedAt:   eu.SuspendedAt.Time,
+		EmailVerified: eu.EmailVerifiedAt.Valid,
+		MFAEnabled:    eu.TOTPEnabledAt.Valid,
 	}
 }
@@ -0,0 +1,52 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+
+	"example.com/authorization/internal/constants"
+	"example.com/authorization/internal/service"
+	postv1 "example.com/authorization/protos-gen/post/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// methods that can be called without an authorization token
+var publicMethods = map[string]bool{
+	postv1.PostService_ListPosts_FullMethodName: true,
+	postv1.PostService_GetPost_FullMethodName:   true,
+}
+
+// authorizationInterceptor is the grpc counterpart of the http authorization middleware,
+// it reads the token from the "authorization" metadata and puts the user ID and role into the context
+func authorizationInterceptor(authSrv service.AuthService) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if publicMethods[info.FullMethod] {
+			return handler(ctx, req)
+		}
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		authTokens := md.Get("authorization")
+		if len(authTokens) == 0 || len(authTokens[0]) == 0 {
+			return nil, status.Error(codes.Unauthenticated, "missing authorization token")
+		}
+
+		actor, err := authSrv.Authorize(ctx, authTokens[0])
+		if err != nil {
+			if errors.Is(err, service.ErrUserSuspended) {
+				return nil, status.Error(codes.PermissionDenied, "account suspended")
+			}
+
+			if errors.Is(err, service.ErrInvalidToken) {
+				return nil, status.Error(codes.Unauthenticated, "invalid authorization token")
+			}
+
+			return nil, status.Error(codes.Internal, "could not validate authorization token")
+		}
+
+		ctx = context.WithValue(ctx, constants.UsrRoleContextKey, actor.Role)
+		return handler(context.WithValue(ctx, constants.UsrIDContextKey, actor.UserID), req)
+	}
+}
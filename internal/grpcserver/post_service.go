@@ -2,18 +2,28 @@ package grpcserver
 
 import (
 	"context"
+	"errors"
+	"net"
+	"time"
 
+	"example.com/authorization/internal/constants"
 	"example.com/authorization/internal/domain"
+	"example.com/authorization/internal/repository"
 	"example.com/authorization/internal/service"
+	"example.com/authorization/pkg"
 	postv1 "example.com/authorization/protos-gen/post/v1"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 const (
-	defaultPageSize = 4
-	maxPageSize     = 100
+	defaultPageSize         = 4
+	maxPageSize             = 100
+	defaultCommentsPageSize = 10
+	defaultCommentsDepth    = 5
+	maxCommentsDepth        = 10
 )
 
 type PostServiceServer struct {
@@ -24,16 +34,24 @@ type PostServiceServer struct {
 func (s *PostServiceServer) ListPosts(ctx context.Context, req *postv1.ListPostsRequest) (*postv1.ListPostsResponse, error) {
 	page, size := sanitizeListPostsRequest(req)
 
-	posts, err := s.postSrv.ListPosts(ctx, domain.PostFilters{
-		Page: page,
-		Size: size,
+	posts, nextCursor, err := s.postSrv.ListPosts(ctx, domain.PostFilters{
+		Page:   page,
+		Size:   size,
+		Sort:   postSortFromProto(req.GetSort()),
+		Since:  topWindowSince(req.GetWindow(), time.Now()),
+		Cursor: req.GetCursor(),
 	})
 	if err != nil {
+		if errors.Is(err, pkg.ErrInvalidCursor) {
+			return nil, status.Error(codes.InvalidArgument, "invalid cursor")
+		}
+
 		return nil, status.Error(codes.Internal, "could not list posts")
 	}
 
 	response := &postv1.ListPostsResponse{
-		Posts: make([]*postv1.Post, 0, len(posts)),
+		Posts:      make([]*postv1.Post, 0, len(posts)),
+		NextCursor: nextCursor,
 	}
 	for i := range posts {
 		response.Posts = append(response.Posts, postToProto(&posts[i]))
@@ -42,6 +60,94 @@ func (s *PostServiceServer) ListPosts(ctx context.Context, req *postv1.ListPosts
 	return response, nil
 }
 
+func (s *PostServiceServer) GetPost(ctx context.Context, req *postv1.GetPostRequest) (*postv1.GetPostResponse, error) {
+	if req.GetPostId() <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "invalid post id")
+	}
+
+	commentsSize := req.GetCommentsSize()
+	if commentsSize == 0 {
+		commentsSize = defaultCommentsPageSize
+	}
+
+	if commentsSize > maxPageSize {
+		commentsSize = maxPageSize
+	}
+
+	commentsDepth := req.GetCommentsDepth()
+	if commentsDepth == 0 {
+		commentsDepth = defaultCommentsDepth
+	}
+
+	if commentsDepth > maxCommentsDepth {
+		commentsDepth = maxCommentsDepth
+	}
+
+	// GetPost is public, callers are served like anonymous visitors
+	post, err := s.postSrv.GetPost(ctx, domain.Actor{}, viewerKey(ctx), req.GetPostId(), domain.CommentFilters{
+		Page:  1,
+		Size:  commentsSize,
+		Depth: commentsDepth,
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrPostNotFound) {
+			return nil, status.Error(codes.NotFound, "post not found")
+		}
+
+		return nil, status.Error(codes.Internal, "could not get post")
+	}
+
+	response := &postv1.GetPostResponse{
+		Post:     postToProto(&post),
+		Comments: make([]*postv1.Comment, 0, len(post.Comments)),
+	}
+	for i := range post.Comments {
+		response.Comments = append(response.Comments, commentToProto(&post.Comments[i]))
+	}
+
+	return response, nil
+}
+
+// viewerKey identifies the caller of GetPost by IP like the anonymous visitors of the http API,
+// GetPost is public so callers are not signed in
+func viewerKey(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "ip:"
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return "ip:" + p.Addr.String()
+	}
+
+	return "ip:" + host
+}
+
+func (s *PostServiceServer) UpvotePost(ctx context.Context, req *postv1.UpvotePostRequest) (*postv1.UpvotePostResponse, error) {
+	if req.GetPostId() <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "invalid post id")
+	}
+
+	userID, ok := ctx.Value(constants.UsrIDContextKey).(int64)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "missing user")
+	}
+
+	upvoted, err := s.postSrv.Upvote(ctx, userID, req.GetPostId())
+	if err != nil {
+		if errors.Is(err, repository.ErrPostNotFound) {
+			return nil, status.Error(codes.NotFound, "cannot upvote non-existing post")
+		}
+
+		return nil, status.Error(codes.Internal, "could not upvote post")
+	}
+
+	return &postv1.UpvotePostResponse{
+		Upvoted: upvoted,
+	}, nil
+}
+
 func sanitizeListPostsRequest(req *postv1.ListPostsRequest) (uint64, uint64) {
 	var page uint64
 	var size uint64
@@ -65,6 +171,34 @@ func sanitizeListPostsRequest(req *postv1.ListPostsRequest) (uint64, uint64) {
 	return page, size
 }
 
+func postSortFromProto(sort postv1.PostSort) domain.PostSort {
+	switch sort {
+	case postv1.PostSort_POST_SORT_NEW:
+		return domain.PostSortNew
+	case postv1.PostSort_POST_SORT_TOP:
+		return domain.PostSortTop
+	case postv1.PostSort_POST_SORT_BEST:
+		return domain.PostSortBest
+	default:
+		return domain.PostSortHot
+	}
+}
+
+func topWindowSince(window postv1.TopWindow, now time.Time) time.Time {
+	switch window {
+	case postv1.TopWindow_TOP_WINDOW_ALL:
+		return time.Time{}
+	case postv1.TopWindow_TOP_WINDOW_YEAR:
+		return now.AddDate(-1, 0, 0)
+	case postv1.TopWindow_TOP_WINDOW_MONTH:
+		return now.AddDate(0, -1, 0)
+	case postv1.TopWindow_TOP_WINDOW_WEEK:
+		return now.AddDate(0, 0, -7)
+	default:
+		return now.AddDate(0, 0, -1)
+	}
+}
+
 func postToProto(post *domain.Post) *postv1.Post {
 	if post == nil {
 		return nil
@@ -88,5 +222,41 @@ func postToProto(post *domain.Post) *postv1.Post {
 		Description:      post.Description,
 		NumberOfComments: post.CommentsCount,
 		NumberOfUpvotes:  post.VoteCount,
+		Author:           post.Username,
+		NumberOfViews:    post.Views,
+	}
+}
+
+func commentToProto(comment *domain.Comment) *postv1.Comment {
+	if comment == nil {
+		return nil
+	}
+
+	var createdAt *timestamppb.Timestamp
+	if !comment.CreatedAt.IsZero() {
+		createdAt = timestamppb.New(comment.CreatedAt)
+	}
+
+	var updatedAt *timestamppb.Timestamp
+	if !comment.UpdatedAt.IsZero() {
+		updatedAt = timestamppb.New(comment.UpdatedAt)
+	}
+
+	replies := make([]*postv1.Comment, 0, len(comment.Replies))
+	for i := range comment.Replies {
+		replies = append(replies, commentToProto(&comment.Replies[i]))
+	}
+
+	return &postv1.Comment{
+		Id:              comment.Id,
+		UserId:          comment.UserID,
+		PostId:          comment.PostID,
+		ParentId:        comment.ParentID,
+		Content:         comment.Content,
+		NumberOfUpvotes: comment.VoteCount,
+		Deleted:         comment.Deleted,
+		Replies:         replies,
+		CreatedAt:       createdAt,
+		UpdatedAt:       updatedAt,
 	}
 }
@@ -9,13 +9,13 @@ import (
 	"google.golang.org/grpc/reflection"
 )
 
-func ListenAndServe(addr string, postSrv service.PostService) error {
+func ListenAndServe(addr string, postSrv service.PostService, authSrv service.AuthService) error {
 	listener, err := net.Listen("tcp", addr)
 	if err != nil {
 		return err
 	}
 
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(authorizationInterceptor(authSrv)))
 	postv1.RegisterPostServiceServer(grpcServer, &PostServiceServer{postSrv: postSrv})
 	reflection.Register(grpcServer)
 
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+
+	"example.com/authorization/internal/repository/entity"
+	"example.com/authorization/pkg"
+	"github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+)
+
+type AuditRepository struct {
+	sqlRepo pkg.SQLRepository
+}
+
+func NewAuditRepository(sqlRepo pkg.SQLRepository) AuditRepository {
+	return AuditRepository{
+		sqlRepo: sqlRepo,
+	}
+}
+
+func (ar *AuditRepository) List(ctx context.Context, size uint64, page uint64) ([]entity.AuditLog, error) {
+	var logs []entity.AuditLog
+
+	sql, args, err := squirrel.Select("*").
+		From("audit_log").
+		OrderBy("id DESC").
+		Limit(size).
+		Offset((page - 1) * size).
+		ToSql()
+	if err != nil {
+		return logs, err
+	}
+
+	err = ar.sqlRepo.DB.SelectContext(ctx, &logs, sql, args...)
+
+	return logs, err
+}
+
+// insertAuditLog is called by the other repositories inside the transaction of the audited change,
+// so a moderator action can not be applied without leaving a trace
+func insertAuditLog(ctx context.Context, tx *sqlx.Tx, log entity.AuditLog) error {
+	sql, args, err := squirrel.Insert("audit_log").Columns(
+		"actor_id",
+		"action",
+		"target_type",
+		"target_id",
+		"details",
+	).Values(
+		log.ActorID,
+		log.Action,
+		log.TargetType,
+		log.TargetID,
+		log.Details,
+	).ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, sql, args...)
+
+	return err
+}
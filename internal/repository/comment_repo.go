@@ -4,7 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
+	"log/slog"
 	"strconv"
 	"strings"
 	"time"
@@ -13,10 +13,11 @@ import (
 	"example.com/authorization/pkg"
 	"github.com/Masterminds/squirrel"
 	"github.com/go-sql-driver/mysql"
-	"github.com/redis/go-redis/v9"
+	"github.com/jmoiron/sqlx"
 )
 
 const MYSQL_KEY_EXITS uint16 = 1062
+const MYSQL_NO_REFERENCED_ROW uint16 = 1452
 
 type CommentRepo struct {
 	sqlRepo pkg.SQLRepository
@@ -46,64 +47,267 @@ func (ur *CommentRepo) Insert(ctx context.Context, comment entity.Comment) (int6
 		return 0, err
 	}
 
-	res, err := ur.sqlRepo.DB.ExecContext(ctx, sql, args...)
+	tx, err := ur.sqlRepo.DB.BeginTxx(ctx, nil)
 	if err != nil {
 		return 0, err
 	}
+	defer tx.Rollback()
 
-	return res.LastInsertId()
+	res, err := tx.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	err = updatePostCommentCount(ctx, tx, squirrel.Eq{"id": comment.PostID}, 1)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	invalidateCommentPages(ctx, ur.cache, comment.PostID)
+
+	return id, nil
 }
 
-func (ur *CommentRepo) List(ctx context.Context, postID int64, size uint64, page uint64) ([]entity.Comment, error) {
-	var comments []entity.Comment
+// InsertReply inserts a reply under parentID, the parent has to be a live comment of the same post
+func (ur *CommentRepo) InsertReply(ctx context.Context, comment entity.Comment) (int64, error) {
+	parent := squirrel.Select().
+		Column(squirrel.Expr("?", comment.UserID)).
+		Column("post_id").
+		Column(squirrel.Expr("?", comment.Content)).
+		Column("0").
+		Column("id").
+		From("comment").
+		Where(squirrel.Eq{
+			"id":         comment.ParentID.Int64,
+			"post_id":    comment.PostID,
+			"deleted_at": nil,
+		})
+
+	sql, args, err := squirrel.Insert("comment").Columns(
+		"user_id",
+		"post_id",
+		"content",
+		"vote_count",
+		"parent_id",
+	).Select(parent).ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := ur.sqlRepo.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if rowsAffected == 0 {
+		return 0, ErrCommentNotFound
+	}
+
+	err = updatePostCommentCount(ctx, tx, squirrel.Eq{"id": comment.PostID}, 1)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	invalidateCommentPages(ctx, ur.cache, comment.PostID)
+
+	return id, nil
+}
+
+// updatePostCommentCount keeps the denormalized post.comment_count in step with the comment table
+func updatePostCommentCount(ctx context.Context, tx *sqlx.Tx, where squirrel.Sqlizer, delta int) error {
+	sql, args, err := squirrel.Update("post").
+		Set("comment_count", squirrel.Expr("comment_count + ?", delta)).
+		Where(where).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, sql, args...)
+
+	return err
+}
+
+// CommentViewer is who comments are listed for. Hidden comments are only shown to moderators and to
+// their author, the comments under a hidden post only to moderators and to the owner of the post
+type CommentViewer struct {
+	// UserID is zero for anonymous viewers
+	UserID    int64
+	Moderator bool
+}
+
+// cacheKey tells the viewers seeing different pages apart, moderators share theirs and so do
+// anonymous viewers while signed in users may see hidden comments of their own
+func (cv CommentViewer) cacheKey() string {
+	if cv.Moderator {
+		return "moderator"
+	}
+
+	return strconv.FormatInt(cv.UserID, 10)
+}
 
-	cacheKey := strings.Join(
+// commentVisible matches the comments the viewer is not hidden from
+func (cv CommentViewer) commentVisible() squirrel.Sqlizer {
+	return squirrel.Or{
+		squirrel.Eq{"comment.hidden_at": nil},
+		squirrel.Eq{"comment.user_id": cv.UserID},
+	}
+}
+
+// postVisible matches the comments under a post the viewer is not hidden from
+func (cv CommentViewer) postVisible() squirrel.Sqlizer {
+	return squirrel.Expr("EXISTS (SELECT 1 FROM post WHERE post.id = comment.post_id AND (post.hidden_at IS NULL OR post.user_id = ?))", cv.UserID)
+}
+
+// commentPageKey is the cache key of a page of the post comments, it is versioned by the
+// post generation so invalidating the post drops every page at once
+func commentPageKey(ctx context.Context, cache pkg.Cache, postID int64, size uint64, page uint64, afterID int64, viewer CommentViewer) (string, error) {
+	key := strings.Join(
 		[]string{
 			"comments:",
 			strconv.FormatInt(postID, 10),
 			strconv.FormatUint(size, 10),
 			strconv.FormatUint(page, 10),
+			strconv.FormatInt(afterID, 10),
+			viewer.cacheKey(),
 		},
 		"_",
 	)
 
-	cachedBytes, err := ur.cache.Client.Get(ctx, cacheKey).Bytes()
+	return cache.VersionedKey(ctx, key, postCacheTag(postID))
+}
+
+// logCacheError reports a cache failure on key the caller worked around, an open circuit breaker
+// is already reported by the cache itself
+func logCacheError(ctx context.Context, msg string, key string, err error) {
+	if !errors.Is(err, pkg.ErrCircuitOpen) {
+		slog.WarnContext(ctx, msg, "key", key, "err", err)
+	}
+}
+
+// invalidateCommentPages drops every cached page of the post comments, it is called after
+// any change that shows up in a listing. Failing to do so only leaves stale pages until they expire
+func invalidateCommentPages(ctx context.Context, cache pkg.Cache, postID int64) {
+	err := cache.Invalidate(ctx, postCacheTag(postID))
+	if err != nil {
+		logCacheError(ctx, "invalidating the cached comment pages failed", postCacheTag(postID), err)
+	}
+}
+
+// invalidateCommentPagesOf drops the cached pages of the post commentID belongs to
+func invalidateCommentPagesOf(ctx context.Context, sqlRepo pkg.SQLRepository, cache pkg.Cache, commentID int64) {
+	var postID int64
+	err := sqlRepo.DB.GetContext(ctx, &postID, "SELECT post_id FROM comment WHERE id = ?", commentID)
+	if err != nil {
+		slog.ErrorContext(ctx, "looking up the post of a comment to invalidate its pages failed", "commentID", commentID, "err", err)
+		return
+	}
+
+	invalidateCommentPages(ctx, cache, postID)
+}
+
+// List returns comments oldest first, a non zero afterID continues right after that comment and ignores page.
+// Hidden comments are left out unless the viewer may see them. Pages are read through the cache, the database
+// is queried directly when the cache is unavailable
+func (ur *CommentRepo) List(ctx context.Context, postID int64, size uint64, page uint64, afterID int64, viewer CommentViewer) ([]entity.Comment, error) {
+	cacheKey, err := commentPageKey(ctx, ur.cache, postID, size, page, afterID, viewer)
 	if err != nil {
-		fmt.Println(err)
+		logCacheError(ctx, "building the comment page key failed, reading the database", postCacheTag(postID), err)
+		return ur.list(ctx, postID, size, page, afterID, viewer)
 	}
 
-	if !errors.Is(err, redis.Nil) {
-		// cache hit
-		err = json.Unmarshal(cachedBytes, &comments)
+	cached, err := ur.cache.Fetch(ctx, cacheKey, 5*time.Minute, func(ctx context.Context) ([]byte, error) {
+		comments, err := ur.list(ctx, postID, size, page, afterID, viewer)
 		if err != nil {
-			fmt.Println(err)
+			return nil, err
 		}
-	}
 
-	if len(comments) > 0 {
-		return comments, nil
+		return json.Marshal(comments)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// cache miss, then query the db
-	sql, args, err := squirrel.Select(
+	var comments []entity.Comment
+	err = json.Unmarshal(cached, &comments)
+
+	return comments, err
+}
+
+func (ur *CommentRepo) list(ctx context.Context, postID int64, size uint64, page uint64, afterID int64, viewer CommentViewer) ([]entity.Comment, error) {
+	var comments []entity.Comment
+
+	query := squirrel.Select(
 		"comment.id as id",
-		"count(user_comment_upvote.comment_id) as vote_count",
+		"count(user_comment_upvote.user_id) as vote_count",
 		"comment.user_id",
 		"comment.post_id",
+		"comment.parent_id",
 		"comment.content",
+		"comment.deleted_at",
+		"comment.hidden_at",
+		"comment.edited_at",
+		"comment.created_at",
+		"comment.updated_at",
 	).
 		From("comment").
 		Limit(size).
-		Join("user_comment_upvote on comment.id = user_comment_upvote.comment_id").
+		LeftJoin("user_comment_upvote on comment.id = user_comment_upvote.comment_id").
 		GroupBy("comment.id").
-		Offset((page-1)*size).
-		Where("post_id = ?", postID).
-		ToSql()
+		OrderBy("comment.id ASC").
+		Where("comment.post_id = ?", postID)
+
+	if !viewer.Moderator {
+		query = query.Where(viewer.commentVisible()).Where(viewer.postVisible())
+	}
+
+	if afterID > 0 {
+		query = query.Where("comment.id > ?", afterID)
+	} else {
+		query = query.Offset((page - 1) * size)
+	}
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return comments, err
+	}
 
 	rows, err := ur.sqlRepo.DB.QueryxContext(ctx, sql, args...)
 	if err != nil {
 		return comments, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var comment entity.Comment
@@ -115,32 +319,218 @@ func (ur *CommentRepo) List(ctx context.Context, postID int64, size uint64, page
 		comments = append(comments, comment)
 	}
 
-	cms, _ := json.Marshal(comments)
-	cacheSetRes := ur.cache.Client.Set(ctx, cacheKey, cms, time.Minute*5)
-	if cacheSetRes.Err() != nil {
-		fmt.Println(
-			cacheSetRes.Err(),
-		)
+	return comments, nil
+}
+
+// ListByUser returns the latest comments of the user that are neither deleted nor hidden, nor on a
+// hidden post, the newest first
+func (ur *CommentRepo) ListByUser(ctx context.Context, userID int64, size uint64) ([]entity.Comment, error) {
+	var comments []entity.Comment
+
+	sql, args, err := squirrel.Select(
+		"comment.id as id",
+		"count(user_comment_upvote.user_id) as vote_count",
+		"comment.user_id",
+		"comment.post_id",
+		"comment.parent_id",
+		"comment.content",
+		"comment.deleted_at",
+		"comment.hidden_at",
+		"comment.edited_at",
+		"comment.created_at",
+		"comment.updated_at",
+	).
+		From("comment").
+		Join("post on post.id = comment.post_id").
+		LeftJoin("user_comment_upvote on comment.id = user_comment_upvote.comment_id").
+		Where(squirrel.Eq{
+			"comment.user_id":    userID,
+			"comment.deleted_at": nil,
+			"comment.hidden_at":  nil,
+			"post.hidden_at":     nil,
+		}).
+		GroupBy("comment.id").
+		OrderBy("comment.id DESC").
+		Limit(size).
+		ToSql()
+	if err != nil {
+		return comments, err
+	}
+
+	err = ur.sqlRepo.DB.SelectContext(ctx, &comments, sql, args...)
+
+	return comments, err
+}
+
+// CommentThreadQuery selects a page of the top level comments of a post, the highest scored first,
+// alongside their replies
+type CommentThreadQuery struct {
+	PostID int64
+	// MaxDepth is how many levels of replies are read, the top level comments being the first
+	MaxDepth uint64
+	// After continues the listing right after the cursor comment, Page is ignored when it is set
+	After *pkg.Cursor
+	Size  uint64
+	Page  uint64
+	// Viewer gets the hidden comments they may see as they are and tombstones for the others
+	Viewer CommentViewer
+}
+
+// ListThread returns a page of top level comments with their replies in a single query, only the
+// comments of the page are read and the tree itself is assembled by the caller. Hidden comments the
+// viewer may not see come back as tombstones so their replies keep their place in the thread
+func (ur *CommentRepo) ListThread(ctx context.Context, q CommentThreadQuery) ([]entity.Comment, error) {
+	var comments []entity.Comment
+
+	const score = "COUNT(user_comment_upvote.user_id)"
+
+	// tombstones are only shown above their replies, leaving out the ones without any keeps
+	// them from taking up room on the page
+	live := squirrel.And{squirrel.Eq{"comment.deleted_at": nil}}
+	if !q.Viewer.Moderator {
+		live = append(live, q.Viewer.commentVisible())
+	}
+
+	roots := squirrel.Select("comment.id").
+		From("comment").
+		LeftJoin("user_comment_upvote ON comment.id = user_comment_upvote.comment_id").
+		Where(squirrel.Eq{
+			"comment.post_id":   q.PostID,
+			"comment.parent_id": nil,
+		}).
+		Where(squirrel.Or{
+			live,
+			squirrel.Expr("EXISTS (SELECT 1 FROM comment AS reply WHERE reply.parent_id = comment.id)"),
+		}).
+		GroupBy("comment.id").
+		OrderBy(score+" DESC", "comment.id ASC").
+		Limit(q.Size)
+
+	// the replies are all under the roots, so are they under the post
+	if !q.Viewer.Moderator {
+		roots = roots.Where(q.Viewer.postVisible())
+	}
+
+	if q.After != nil {
+		key, err := strconv.ParseUint(q.After.Key, 10, 64)
+		if err != nil {
+			return comments, pkg.ErrInvalidCursor
+		}
+
+		roots = roots.Having(squirrel.Or{
+			squirrel.Expr(score+" < ?", key),
+			squirrel.And{
+				squirrel.Expr(score+" = ?", key),
+				squirrel.Gt{"comment.id": q.After.ID},
+			},
+		})
+	} else {
+		roots = roots.Offset((q.Page - 1) * q.Size)
+	}
+
+	rootsSQL, args, err := roots.ToSql()
+	if err != nil {
+		return comments, err
+	}
+
+	args = append(args, q.MaxDepth)
+
+	content, deletedAt := "comment.content", "comment.deleted_at"
+	if !q.Viewer.Moderator {
+		content = "CASE WHEN comment.hidden_at IS NULL OR comment.user_id = ? THEN comment.content ELSE '' END AS content"
+		deletedAt = "CASE WHEN comment.hidden_at IS NULL OR comment.user_id = ? THEN comment.deleted_at ELSE COALESCE(comment.deleted_at, comment.hidden_at) END AS deleted_at"
+		args = append(args, q.Viewer.UserID, q.Viewer.UserID)
+	}
+
+	query := `WITH RECURSIVE thread (id, depth) AS (
+		SELECT id, 1 FROM (` + rootsSQL + `) AS roots
+		UNION ALL
+		SELECT comment.id, thread.depth + 1 FROM comment JOIN thread ON comment.parent_id = thread.id WHERE thread.depth < ?
+	)
+	SELECT
+		comment.id AS id,
+		COUNT(user_comment_upvote.user_id) AS vote_count,
+		comment.user_id,
+		comment.post_id,
+		comment.parent_id,
+		` + content + `,
+		` + deletedAt + `,
+		comment.hidden_at,
+		comment.edited_at,
+		comment.created_at,
+		comment.updated_at,
+		thread.depth AS depth
+	FROM thread
+	JOIN comment ON comment.id = thread.id
+	LEFT JOIN user_comment_upvote ON comment.id = user_comment_upvote.comment_id
+	GROUP BY comment.id, thread.depth`
+
+	err = ur.sqlRepo.DB.SelectContext(ctx, &comments, query, args...)
+	if err != nil {
+		return comments, err
 	}
 
 	return comments, nil
 }
 
-func (ur *CommentRepo) DeleteByID(ctx context.Context, userID int64, commentID int64) error {
-	query := squirrel.Delete("comment").Where(squirrel.And{
-		squirrel.Eq{
-			"id": commentID,
-		},
-		squirrel.Eq{
-			"user_id": userID,
-		},
-	})
+func (ur *CommentRepo) GetByID(ctx context.Context, commentID int64) (entity.Comment, error) {
+	var comments []entity.Comment
+
+	sql, args, err := squirrel.Select(
+		"id",
+		"user_id",
+		"post_id",
+		"parent_id",
+		"content",
+		"deleted_at",
+		"edited_at",
+		"created_at",
+		"updated_at",
+	).
+		From("comment").
+		Where(squirrel.Eq{
+			"id":         commentID,
+			"deleted_at": nil,
+		}).
+		ToSql()
+	if err != nil {
+		return entity.Comment{}, err
+	}
+
+	err = ur.sqlRepo.DB.SelectContext(ctx, &comments, sql, args...)
+	if err != nil {
+		return entity.Comment{}, err
+	}
+
+	if len(comments) == 0 {
+		return entity.Comment{}, ErrCommentNotFound
+	}
+
+	return comments[0], nil
+}
+
+// DeleteByID tombstones the comment instead of removing the row so its replies stay in the thread,
+// ownership is checked by the caller. A non nil audit entry is written in the same transaction
+func (ur *CommentRepo) DeleteByID(ctx context.Context, commentID int64, audit *entity.AuditLog) error {
+	query := squirrel.Update("comment").
+		Set("content", "").
+		Set("deleted_at", squirrel.Expr("CURRENT_TIMESTAMP")).
+		Where(squirrel.Eq{
+			"id":         commentID,
+			"deleted_at": nil,
+		})
 	sql, args, err := query.ToSql()
 	if err != nil {
 		return err
 	}
 
-	result, err := ur.sqlRepo.DB.ExecContext(ctx, sql, args...)
+	tx, err := ur.sqlRepo.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, sql, args...)
 	if err != nil {
 		return err
 	}
@@ -154,38 +544,187 @@ func (ur *CommentRepo) DeleteByID(ctx context.Context, userID int64, commentID i
 		return ErrCommentNotFound
 	}
 
+	err = updatePostCommentCount(ctx, tx, squirrel.Expr("id = (SELECT post_id FROM comment WHERE id = ?)", commentID), -1)
+	if err != nil {
+		return err
+	}
+
+	// the content is gone so is every earlier version of it
+	_, err = tx.ExecContext(ctx, "DELETE FROM comment_revision WHERE comment_id = ?", commentID)
+	if err != nil {
+		return err
+	}
+
+	if audit != nil {
+		err = insertAuditLog(ctx, tx, *audit)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	invalidateCommentPagesOf(ctx, ur.sqlRepo, ur.cache, commentID)
+
 	return nil
 }
 
+// Update replaces the content of a live comment, the previous content is kept as a revision
+// written in the same transaction. editorID is the user making the change
+func (ur *CommentRepo) Update(ctx context.Context, comment entity.Comment, editorID int64) error {
+	// the revision copies the row as it is right before the update
+	revision := squirrel.Select().
+		Column("id").
+		Column(squirrel.Expr("?", editorID)).
+		Column("content").
+		From("comment").
+		Where(squirrel.Eq{
+			"id":         comment.Id,
+			"deleted_at": nil,
+		})
+
+	rsql, rargs, err := squirrel.Insert("comment_revision").Columns(
+		"comment_id",
+		"user_id",
+		"content",
+	).Select(revision).ToSql()
+	if err != nil {
+		return err
+	}
+
+	usql, uargs, err := squirrel.Update("comment").
+		Set("content", comment.Content).
+		Set("edited_at", squirrel.Expr("CURRENT_TIMESTAMP")).
+		Where(squirrel.Eq{"id": comment.Id}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	tx, err := ur.sqlRepo.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, rsql, rargs...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrCommentNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, usql, uargs...)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	invalidateCommentPages(ctx, ur.cache, comment.PostID)
+
+	return nil
+}
+
+// ListRevisions returns the previous versions of the comment, the most recent first
+func (ur *CommentRepo) ListRevisions(ctx context.Context, commentID int64) ([]entity.CommentRevision, error) {
+	var revisions []entity.CommentRevision
+
+	sql, args, err := squirrel.Select("*").
+		From("comment_revision").
+		Where(squirrel.Eq{"comment_id": commentID}).
+		OrderBy("id DESC").
+		ToSql()
+	if err != nil {
+		return revisions, err
+	}
+
+	err = ur.sqlRepo.DB.SelectContext(ctx, &revisions, sql, args...)
+
+	return revisions, err
+}
+
+// Upvote toggles the upvote of userID on commentID, it returns true when the
+// upvote is registered and false when an existing upvote is taken back
 func (ur *CommentRepo) Upvote(ctx context.Context, userID int64, commentID int64) (bool, error) {
 	state := false
-	sqlstr, args, err := squirrel.Insert("user_comment_upvote").Columns("user_id", "comment_id").Values(
-		userID,
-		commentID,
-	).ToSql()
+
+	tx, err := ur.sqlRepo.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return state, err
+	}
+	defer tx.Rollback()
+
+	// the post id is copied from the comment, inserting nothing means there is no such comment
+	sqlstr, args, err := squirrel.Insert("user_comment_upvote").
+		Columns("user_id", "comment_id", "post_id").
+		Select(squirrel.Select().
+			Column("?", userID).
+			Columns("id", "post_id").
+			From("comment").
+			Where("id = ?", commentID)).
+		ToSql()
 	if err != nil {
 		return state, err
 	}
 
-	_, err = ur.sqlRepo.DB.ExecContext(ctx, sqlstr, args...)
+	delta := 1
+	result, err := tx.ExecContext(ctx, sqlstr, args...)
 	if err == nil {
-		state = true
-		return state, nil
-	}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return state, err
+		}
 
-	mysqlerr, ok := err.(*mysql.MySQLError)
-	if !ok {
-		return state, err
-	}
+		if rowsAffected == 0 {
+			return state, ErrCommentNotFound
+		}
+
+		state = true
+	} else {
+		mysqlerr, ok := err.(*mysql.MySQLError)
+		if !ok || mysqlerr.Number != MYSQL_KEY_EXITS {
+			return state, err
+		}
 
-	if mysqlerr.Number == MYSQL_KEY_EXITS {
 		delsqlstr, delargs, delerr := squirrel.Delete("user_comment_upvote").Where("user_id = ?", userID).Where("comment_id = ?", commentID).ToSql()
-		_, delerr = ur.sqlRepo.DB.ExecContext(ctx, delsqlstr, delargs...)
 		if delerr != nil {
 			return state, delerr
 		}
+
+		_, delerr = tx.ExecContext(ctx, delsqlstr, delargs...)
+		if delerr != nil {
+			return state, delerr
+		}
+
+		delta = -1
 	}
 
+	err = updateAuthorKarma(ctx, tx, "comment", commentID, userID, delta)
+	if err != nil {
+		return state, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return state, err
+	}
+
+	invalidateCommentPagesOf(ctx, ur.sqlRepo, ur.cache, commentID)
+
 	return state, nil
 }
 
@@ -0,0 +1,331 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"testing"
+
+	"example.com/authorization/internal/repository/entity"
+	"example.com/authorization/internal/testutil"
+	"example.com/authorization/pkg"
+)
+
+// insertTestPost creates a user and a post of theirs
+func insertTestPost(t *testing.T, sqlRepo pkg.SQLRepository, cache pkg.Cache, username string) (userID int64, postID int64) {
+	t.Helper()
+
+	ctx := context.Background()
+	userRepo := NewUserRepository(sqlRepo, cache)
+	postRepo := NewPostRepository(sqlRepo, cache, 0)
+
+	userID, err := userRepo.Insert(ctx, username, username+"@example.com", "hash")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	postID, err = postRepo.Insert(ctx, entity.Post{
+		UserID:      userID,
+		Description: "a post of " + username,
+		URL:         "https://example.com/" + username,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return userID, postID
+}
+
+func listTestComments(t *testing.T, cr CommentRepo, postID int64) []entity.Comment {
+	t.Helper()
+
+	comments, err := cr.List(context.Background(), postID, 10, 1, 0, CommentViewer{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return comments
+}
+
+func TestCommentPagesAreServedFromTheCache(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cache, _ := testutil.NewCache(t)
+	sqlRepo := testutil.NewDB(t)
+	cr := NewCommentRepo(sqlRepo, cache)
+
+	userID, postID := insertTestPost(t, sqlRepo, cache, "alice")
+
+	_, err := cr.Insert(ctx, entity.Comment{UserID: userID, PostID: postID, Content: "first"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	listTestComments(t, cr, postID)
+
+	// changed behind the back of the repository, the cached page does not know
+	sqlRepo.DB.MustExec("UPDATE comment SET content = 'changed'")
+
+	comments := listTestComments(t, cr, postID)
+	if len(comments) != 1 || comments[0].Content != "first" {
+		t.Fatalf("expected the cached page, got %+v", comments)
+	}
+}
+
+func TestCommentChangesInvalidateCachedPages(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cache, _ := testutil.NewCache(t)
+	sqlRepo := testutil.NewDB(t)
+	cr := NewCommentRepo(sqlRepo, cache)
+
+	userID, postID := insertTestPost(t, sqlRepo, cache, "alice")
+	voterID, _ := insertTestPost(t, sqlRepo, cache, "bob")
+
+	first, err := cr.Insert(ctx, entity.Comment{UserID: userID, PostID: postID, Content: "first"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if comments := listTestComments(t, cr, postID); len(comments) != 1 {
+		t.Fatalf("expected 1 comment, got %d", len(comments))
+	}
+
+	_, err = cr.Insert(ctx, entity.Comment{UserID: userID, PostID: postID, Content: "second"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if comments := listTestComments(t, cr, postID); len(comments) != 2 {
+		t.Fatalf("expected the inserted comment on the page, got %d comments", len(comments))
+	}
+
+	_, err = cr.Upvote(ctx, voterID, first)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if comments := listTestComments(t, cr, postID); comments[0].VoteCount != 1 {
+		t.Fatalf("expected the upvote on the page, got %d votes", comments[0].VoteCount)
+	}
+
+	err = cr.DeleteByID(ctx, first, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if comments := listTestComments(t, cr, postID); !comments[0].DeletedAt.Valid || comments[0].Content != "" {
+		t.Fatalf("expected the deleted comment as a tombstone, got %+v", comments[0])
+	}
+}
+
+func TestInvalidateCommentPagesDropsEveryPageOfThePost(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cache, _ := testutil.NewCache(t)
+
+	var before []string
+	for page := uint64(1); page <= 3; page++ {
+		key, err := commentPageKey(ctx, cache, 1, 4, page, 0, CommentViewer{})
+		if err != nil {
+			t.Fatalf("comment page key: %v", err)
+		}
+
+		if err := cache.Client.Set(ctx, key, "[]", 0).Err(); err != nil {
+			t.Fatalf("set: %v", err)
+		}
+		before = append(before, key)
+	}
+
+	invalidateCommentPages(ctx, cache, 1)
+
+	for page := uint64(1); page <= 3; page++ {
+		key, err := commentPageKey(ctx, cache, 1, 4, page, 0, CommentViewer{})
+		if err != nil {
+			t.Fatalf("comment page key: %v", err)
+		}
+
+		if key == before[page-1] {
+			t.Fatalf("expected page %d to get a new key after a comment changed, got %q again", page, key)
+		}
+
+		if exists, _ := cache.Client.Exists(ctx, key).Result(); exists != 0 {
+			t.Fatalf("expected page %d to be a cache miss after a comment changed", page)
+		}
+	}
+}
+
+func TestInvalidateCommentPagesKeepsOtherPosts(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cache, _ := testutil.NewCache(t)
+
+	before, err := commentPageKey(ctx, cache, 2, 4, 1, 0, CommentViewer{})
+	if err != nil {
+		t.Fatalf("comment page key: %v", err)
+	}
+
+	invalidateCommentPages(ctx, cache, 1)
+
+	after, err := commentPageKey(ctx, cache, 2, 4, 1, 0, CommentViewer{})
+	if err != nil {
+		t.Fatalf("comment page key: %v", err)
+	}
+	if before != after {
+		t.Fatalf("expected pages of post 2 to stay cached, got %q and %q", before, after)
+	}
+}
+
+func TestCommentPageKeysDifferByViewer(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cache, _ := testutil.NewCache(t)
+
+	viewers := []CommentViewer{
+		{},
+		{UserID: 7},
+		{UserID: 8},
+		{UserID: 7, Moderator: true},
+	}
+
+	keys := map[string]CommentViewer{}
+	for _, viewer := range viewers {
+		key, err := commentPageKey(ctx, cache, 3, 4, 1, 0, viewer)
+		if err != nil {
+			t.Fatalf("comment page key: %v", err)
+		}
+
+		if other, ok := keys[key]; ok {
+			t.Fatalf("expected %+v and %+v to be cached apart, they may see different hidden comments", viewer, other)
+		}
+		keys[key] = viewer
+	}
+
+	// moderators see the same page
+	moderator, err := commentPageKey(ctx, cache, 3, 4, 1, 0, CommentViewer{UserID: 9, Moderator: true})
+	if err != nil {
+		t.Fatalf("comment page key: %v", err)
+	}
+
+	if _, ok := keys[moderator]; !ok {
+		t.Fatalf("expected moderators to share their page")
+	}
+}
+
+func TestListThreadPagesTopLevelCommentsByScore(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cache, _ := testutil.NewCache(t)
+	sqlRepo := testutil.NewDB(t)
+	cr := NewCommentRepo(sqlRepo, cache)
+
+	userID, postID := insertTestPost(t, sqlRepo, cache, "alice")
+	bobID, _ := insertTestPost(t, sqlRepo, cache, "bob")
+	carolID, _ := insertTestPost(t, sqlRepo, cache, "carol")
+
+	var roots []int64
+	for _, content := range []string{"no votes", "two votes", "one vote", "deleted"} {
+		id, err := cr.Insert(ctx, entity.Comment{UserID: userID, PostID: postID, Content: content})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		roots = append(roots, id)
+	}
+
+	for _, vote := range []struct{ userID, commentID int64 }{
+		{bobID, roots[1]},
+		{carolID, roots[1]},
+		{bobID, roots[2]},
+	} {
+		_, err := cr.Upvote(ctx, vote.userID, vote.commentID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	reply, err := cr.InsertReply(ctx, entity.Comment{UserID: bobID, PostID: postID, Content: "reply", ParentID: sql.NullInt64{Int64: roots[0], Valid: true}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = cr.DeleteByID(ctx, roots[3], nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	first, err := cr.ListThread(ctx, CommentThreadQuery{PostID: postID, MaxDepth: 3, Size: 2, Page: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if ids := commentIDs(first); !slices.Equal(ids, []int64{roots[1], roots[2]}) {
+		t.Fatalf("expected the two highest scored comments, got %v", ids)
+	}
+
+	second, err := cr.ListThread(ctx, CommentThreadQuery{PostID: postID, MaxDepth: 3, Size: 2, After: &pkg.Cursor{Key: "1", ID: roots[2]}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the deleted comment has no replies, it is not worth a place on the page
+	if ids := commentIDs(second); !slices.Equal(ids, []int64{roots[0], reply}) {
+		t.Fatalf("expected the last comment with its reply, got %v", ids)
+	}
+
+	offset, err := cr.ListThread(ctx, CommentThreadQuery{PostID: postID, MaxDepth: 1, Size: 2, Page: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if ids := commentIDs(offset); !slices.Equal(ids, []int64{roots[0]}) {
+		t.Fatalf("expected the replies to be cut at the depth, got %v", ids)
+	}
+}
+
+func TestListByUserSkipsCommentsOnHiddenPosts(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cache, _ := testutil.NewCache(t)
+	sqlRepo := testutil.NewDB(t)
+	cr := NewCommentRepo(sqlRepo, cache)
+
+	userID, postID := insertTestPost(t, sqlRepo, cache, "alice")
+	_, hiddenPostID := insertTestPost(t, sqlRepo, cache, "bob")
+
+	visible, err := cr.Insert(ctx, entity.Comment{UserID: userID, PostID: postID, Content: "visible"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = cr.Insert(ctx, entity.Comment{UserID: userID, PostID: hiddenPostID, Content: "under a hidden post"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sqlRepo.DB.MustExec("UPDATE post SET hidden_at = CURRENT_TIMESTAMP WHERE id = ?", hiddenPostID)
+
+	comments, err := cr.ListByUser(ctx, userID, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if ids := commentIDs(comments); !slices.Equal(ids, []int64{visible}) {
+		t.Fatalf("expected the comment on the visible post alone, got %v", ids)
+	}
+}
+
+func commentIDs(comments []entity.Comment) []int64 {
+	ids := make([]int64, 0, len(comments))
+	for _, comment := range comments {
+		ids = append(ids, comment.Id)
+	}
+	slices.Sort(ids)
+
+	return ids
+}
@@ -0,0 +1,15 @@
+package entity
+
+import (
+	"database/sql"
+)
+
+type AuditLog struct {
+	Id         int64          `db:"id"`
+	ActorID    int64          `db:"actor_id"`
+	Action     string         `db:"action"`
+	TargetType string         `db:"target_type"`
+	TargetID   int64          `db:"target_id"`
+	Details    sql.NullString `db:"details"`
+	CreatedAt  sql.NullTime   `db:"created_at"`
+}
@@ -7,13 +7,18 @@ import (
 )
 
 type Comment struct {
-	Id        int64        `db:"id"`
-	UserID    int64        `db:"user_id"`
-	PostID    int64        `db:"post_id"`
-	Content   string       `db:"content"`
-	VoteCount uint64       `db:"vote_count"`
-	CreatedAt sql.NullTime `db:"created_at" redis:"-"`
-	UpdatedAt sql.NullTime `db:"updated_at" redis:"-"`
+	Id        int64         `db:"id"`
+	UserID    int64         `db:"user_id"`
+	PostID    int64         `db:"post_id"`
+	ParentID  sql.NullInt64 `db:"parent_id"`
+	Content   string        `db:"content"`
+	VoteCount uint64        `db:"vote_count"`
+	Depth     uint64        `db:"depth"`
+	CreatedAt sql.NullTime  `db:"created_at" redis:"-"`
+	UpdatedAt sql.NullTime  `db:"updated_at" redis:"-"`
+	DeletedAt sql.NullTime  `db:"deleted_at" redis:"-"`
+	HiddenAt  sql.NullTime  `db:"hidden_at" redis:"-"`
+	EditedAt  sql.NullTime  `db:"edited_at" redis:"-"`
 }
 
 func (c Comment) ToHsetArgs() []string {
@@ -0,0 +1,27 @@
+package entity
+
+import (
+	"database/sql"
+)
+
+type Flag struct {
+	Id         int64          `db:"id"`
+	UserID     int64          `db:"user_id"`
+	TargetType string         `db:"target_type"`
+	TargetID   int64          `db:"target_id"`
+	Reason     string         `db:"reason"`
+	CreatedAt  sql.NullTime   `db:"created_at"`
+	ResolvedAt sql.NullTime   `db:"resolved_at"`
+	ResolvedBy sql.NullInt64  `db:"resolved_by"`
+	Resolution sql.NullString `db:"resolution"`
+}
+
+// FlaggedItem aggregates the open flags of a single post or comment
+type FlaggedItem struct {
+	TargetType     string       `db:"target_type"`
+	TargetID       int64        `db:"target_id"`
+	FlagCount      uint64       `db:"flag_count"`
+	Reasons        string       `db:"reasons"`
+	FirstFlaggedAt sql.NullTime `db:"first_flagged_at"`
+	LastFlaggedAt  sql.NullTime `db:"last_flagged_at"`
+}
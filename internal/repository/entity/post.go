@@ -9,8 +9,13 @@ type Post struct {
 	Description  string       `db:"description"`
 	URL          string       `db:"url"`
 	UserID       int64        `db:"user_id"`
+	Username     string       `db:"username"`
 	UpvoteCount  uint64       `db:"upvote_count"`
 	CommentCount uint64       `db:"comment_count"`
+	HotScore     float64      `db:"hot_score"`
+	FlagCount    uint64       `db:"flag_count"`
+	HiddenAt     sql.NullTime `db:"hidden_at"`
+	EditedAt     sql.NullTime `db:"edited_at"`
 	CreatedAt    sql.NullTime `db:"created_at"`
 	UpdatedAt    sql.NullTime `db:"updated_at"`
 }
@@ -0,0 +1,24 @@
+package entity
+
+import (
+	"database/sql"
+)
+
+// PostRevision is the content a post had before an edit
+type PostRevision struct {
+	Id          int64        `db:"id"`
+	PostID      int64        `db:"post_id"`
+	UserID      int64        `db:"user_id"`
+	Description string       `db:"description"`
+	URL         string       `db:"url"`
+	CreatedAt   sql.NullTime `db:"created_at"`
+}
+
+// CommentRevision is the content a comment had before an edit
+type CommentRevision struct {
+	Id        int64        `db:"id"`
+	CommentID int64        `db:"comment_id"`
+	UserID    int64        `db:"user_id"`
+	Content   string       `db:"content"`
+	CreatedAt sql.NullTime `db:"created_at"`
+}
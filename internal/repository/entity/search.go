@@ -0,0 +1,18 @@
+package entity
+
+import (
+	"database/sql"
+)
+
+// SearchResult is a post or a comment matching a search, PostID is the post itself for posts
+type SearchResult struct {
+	Type      string       `db:"type"`
+	Id        int64        `db:"id"`
+	PostID    int64        `db:"post_id"`
+	UserID    int64        `db:"user_id"`
+	Username  string       `db:"username"`
+	Content   string       `db:"content"`
+	URL       string       `db:"url"`
+	CreatedAt sql.NullTime `db:"created_at"`
+	Score     float64      `db:"score"`
+}
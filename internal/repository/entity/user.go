@@ -10,8 +10,19 @@ type User struct {
 	Password  string         `db:"password"`
 	Email     sql.NullString `db:"email"`
 	FullName  sql.NullString `db:"full_name"`
+	Role      string         `db:"role"`
+	About     sql.NullString `db:"about"`
+	Karma     int64          `db:"karma"`
 	CreatedAt sql.NullTime   `db:"created_at"`
 	UpdatedAt sql.NullTime   `db:"updated_at"`
+	// SuspendedAt is set while an admin keeps the user out
+	SuspendedAt sql.NullTime `db:"suspended_at"`
+	// EmailVerifiedAt is set once the user followed the link mailed to Email
+	EmailVerifiedAt sql.NullTime `db:"email_verified_at"`
+	// TOTPSecret is set once the user started enrolling an authenticator app
+	TOTPSecret sql.NullString `db:"totp_secret"`
+	// TOTPEnabledAt is set once the user confirmed the enrollment with a code, logins ask for one from then on
+	TOTPEnabledAt sql.NullTime `db:"totp_enabled_at"`
 }
 
 type Users []User
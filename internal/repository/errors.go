@@ -4,4 +4,16 @@ import "errors"
 
 var ErrPostNotFound = errors.New("post does not exist")
 var ErrUserNotFound = errors.New("user not found")
+var ErrUserAlreadyExists = errors.New("user already exists")
+var ErrEmailAlreadyExists = errors.New("email already exists")
+var ErrOneTimeTokenNotFound = errors.New("one time token not found")
 var ErrCommentNotFound = errors.New("comment not found")
+var ErrRefreshTokenNotFound = errors.New("refresh token not found")
+var ErrRefreshTokenReused = errors.New("refresh token reused")
+var ErrFlagNotFound = errors.New("flag not found")
+var ErrAlreadyFlagged = errors.New("already flagged")
+var ErrTOTPNotEnrolled = errors.New("totp not enrolled")
+var ErrRecoveryCodeNotFound = errors.New("recovery code not found")
+var ErrIdentityNotFound = errors.New("identity not found")
+var ErrIdentityAlreadyLinked = errors.New("identity already linked")
+var ErrOAuthStateNotFound = errors.New("oauth state not found")
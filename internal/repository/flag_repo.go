@@ -0,0 +1,239 @@
+package repository
+
+import (
+	"context"
+
+	"example.com/authorization/internal/repository/entity"
+	"example.com/authorization/pkg"
+	"github.com/Masterminds/squirrel"
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	FlagTargetPost    = "post"
+	FlagTargetComment = "comment"
+)
+
+// flagTarget returns the table of a flaggable item and the condition matching it while it is live
+func flagTarget(targetType string, targetID int64) (string, squirrel.Sqlizer, error) {
+	switch targetType {
+	case FlagTargetPost:
+		return "post", squirrel.Eq{"id": targetID}, nil
+	case FlagTargetComment:
+		return "comment", squirrel.Eq{"id": targetID, "deleted_at": nil}, nil
+	default:
+		return "", nil, ErrFlagNotFound
+	}
+}
+
+func flagTargetNotFound(targetType string) error {
+	if targetType == FlagTargetComment {
+		return ErrCommentNotFound
+	}
+
+	return ErrPostNotFound
+}
+
+type FlagRepository struct {
+	sqlRepo pkg.SQLRepository
+	cache   pkg.Cache
+}
+
+func NewFlagRepository(sqlRepo pkg.SQLRepository, cache pkg.Cache) FlagRepository {
+	return FlagRepository{
+		sqlRepo: sqlRepo,
+		cache:   cache,
+	}
+}
+
+// invalidateTarget drops the cached feed or comment pages a flagged item may have been hidden from or restored to
+func (fr *FlagRepository) invalidateTarget(ctx context.Context, targetType string, targetID int64) {
+	switch targetType {
+	case FlagTargetPost:
+		invalidateFeed(ctx, fr.cache)
+	case FlagTargetComment:
+		invalidateCommentPagesOf(ctx, fr.sqlRepo, fr.cache, targetID)
+	}
+}
+
+// Insert records the flag and hides the flagged item once hideThreshold distinct users flagged it,
+// every user can flag an item once. A zero hideThreshold never hides anything
+func (fr *FlagRepository) Insert(ctx context.Context, flag entity.Flag, hideThreshold uint64) error {
+	table, target, err := flagTarget(flag.TargetType, flag.TargetID)
+	if err != nil {
+		return err
+	}
+
+	sql, args, err := squirrel.Insert("flag").Columns(
+		"user_id",
+		"target_type",
+		"target_id",
+		"reason",
+	).Values(
+		flag.UserID,
+		flag.TargetType,
+		flag.TargetID,
+		flag.Reason,
+	).ToSql()
+	if err != nil {
+		return err
+	}
+
+	tx, err := fr.sqlRepo.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, sql, args...)
+	if err != nil {
+		mysqlerr, ok := err.(*mysql.MySQLError)
+		if ok && mysqlerr.Number == MYSQL_KEY_EXITS {
+			return ErrAlreadyFlagged
+		}
+
+		return err
+	}
+
+	query := squirrel.Update(table).
+		Set("flag_count", squirrel.Expr("flag_count + 1")).
+		Where(target)
+
+	if hideThreshold > 0 {
+		// assignments are evaluated left to right so hidden_at sees the new flag_count
+		query = query.Set("hidden_at", squirrel.Expr("IF(hidden_at IS NULL AND flag_count >= ?, CURRENT_TIMESTAMP, hidden_at)", hideThreshold))
+	}
+
+	usql, uargs, err := query.ToSql()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, usql, uargs...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return flagTargetNotFound(flag.TargetType)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	fr.invalidateTarget(ctx, flag.TargetType, flag.TargetID)
+
+	return nil
+}
+
+// ListOpen returns the moderation queue, items with the most open flags come first
+func (fr *FlagRepository) ListOpen(ctx context.Context, size uint64, page uint64) ([]entity.FlaggedItem, error) {
+	var items []entity.FlaggedItem
+
+	sql, args, err := squirrel.Select(
+		"target_type",
+		"target_id",
+		"COUNT(*) AS flag_count",
+		"GROUP_CONCAT(DISTINCT reason ORDER BY reason) AS reasons",
+		"MIN(created_at) AS first_flagged_at",
+		"MAX(created_at) AS last_flagged_at",
+	).
+		From("flag").
+		Where(squirrel.Eq{"resolved_at": nil}).
+		GroupBy("target_type", "target_id").
+		OrderBy("flag_count DESC", "first_flagged_at ASC").
+		Limit(size).
+		Offset((page - 1) * size).
+		ToSql()
+	if err != nil {
+		return items, err
+	}
+
+	err = fr.sqlRepo.DB.SelectContext(ctx, &items, sql, args...)
+
+	return items, err
+}
+
+// Resolve closes the open flags of an item and resets its flag count, the item stays hidden when
+// hide is set and is restored otherwise. The audit entry is written in the same transaction
+func (fr *FlagRepository) Resolve(ctx context.Context, targetType string, targetID int64, resolution string, hide bool, audit entity.AuditLog) error {
+	table, target, err := flagTarget(targetType, targetID)
+	if err != nil {
+		return err
+	}
+
+	sql, args, err := squirrel.Update("flag").
+		Set("resolved_at", squirrel.Expr("CURRENT_TIMESTAMP")).
+		Set("resolved_by", audit.ActorID).
+		Set("resolution", resolution).
+		Where(squirrel.Eq{
+			"target_type": targetType,
+			"target_id":   targetID,
+			"resolved_at": nil,
+		}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	tx, err := fr.sqlRepo.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrFlagNotFound
+	}
+
+	query := squirrel.Update(table).
+		Set("flag_count", 0).
+		Where(target)
+
+	if hide {
+		query = query.Set("hidden_at", squirrel.Expr("COALESCE(hidden_at, CURRENT_TIMESTAMP)"))
+	} else {
+		query = query.Set("hidden_at", nil)
+	}
+
+	usql, uargs, err := query.ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, usql, uargs...)
+	if err != nil {
+		return err
+	}
+
+	err = insertAuditLog(ctx, tx, audit)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	fr.invalidateTarget(ctx, targetType, targetID)
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"strings"
+
+	"example.com/authorization/pkg"
+	"github.com/Masterminds/squirrel"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+// IdentityUser is a user created from the identity an OIDC provider vouched for
+type IdentityUser struct {
+	Username string
+	// Email is left empty when the provider did not share one
+	Email          string
+	EmailVerified  bool
+	HashedPassword string
+}
+
+// IdentityRepository links the identities of OIDC providers to users, an identity is the
+// subject the provider knows the user by
+type IdentityRepository struct {
+	sqlRepo pkg.SQLRepository
+}
+
+func NewIdentityRepository(sqlRepo pkg.SQLRepository) IdentityRepository {
+	return IdentityRepository{
+		sqlRepo: sqlRepo,
+	}
+}
+
+// GetUserID returns the user the identity is linked to
+func (ir *IdentityRepository) GetUserID(ctx context.Context, provider string, subject string) (int64, error) {
+	var userIDs []int64
+
+	err := ir.sqlRepo.DB.SelectContext(ctx, &userIDs, "select user_id from user_identity where provider = ? and subject = ?", provider, subject)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(userIDs) == 0 {
+		return 0, ErrIdentityNotFound
+	}
+
+	return userIDs[0], nil
+}
+
+// Link links the identity to the user, an identity linked already fails with ErrIdentityAlreadyLinked
+func (ir *IdentityRepository) Link(ctx context.Context, userID int64, provider string, subject string, email string) error {
+	return insertIdentity(ctx, ir.sqlRepo.DB, userID, provider, subject, email)
+}
+
+// CreateUser creates the user and links the identity to it, a username that is taken fails with
+// ErrUserAlreadyExists, an email that is taken with ErrEmailAlreadyExists and an identity linked
+// meanwhile with ErrIdentityAlreadyLinked
+func (ir *IdentityRepository) CreateUser(ctx context.Context, user IdentityUser, provider string, subject string) (int64, error) {
+	var email, emailVerifiedAt any
+	if user.Email != "" {
+		email = user.Email
+	}
+	if user.EmailVerified {
+		emailVerifiedAt = squirrel.Expr("CURRENT_TIMESTAMP")
+	}
+
+	sql, args, err := squirrel.Insert("user").
+		Columns("username", "email", "password", "email_verified_at").
+		Values(user.Username, email, user.HashedPassword, emailVerifiedAt).
+		ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := ir.sqlRepo.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, sql, args...)
+	if err != nil {
+		if mysqlerr, ok := err.(*mysql.MySQLError); ok && mysqlerr.Number == MYSQL_KEY_EXITS {
+			// the message names the unique index the entry collided on
+			if strings.Contains(mysqlerr.Message, "idx_email") {
+				return 0, ErrEmailAlreadyExists
+			}
+
+			return 0, ErrUserAlreadyExists
+		}
+
+		return 0, err
+	}
+
+	userID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	err = insertIdentity(ctx, tx, userID, provider, subject, user.Email)
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit()
+}
+
+func insertIdentity(ctx context.Context, db sqlx.ExecerContext, userID int64, provider string, subject string, email string) error {
+	var nullableEmail any
+	if email != "" {
+		nullableEmail = email
+	}
+
+	sql, args, err := squirrel.Insert("user_identity").
+		Columns("user_id", "provider", "subject", "email").
+		Values(userID, provider, subject, nullableEmail).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, sql, args...)
+	if mysqlerr, ok := err.(*mysql.MySQLError); ok && mysqlerr.Number == MYSQL_KEY_EXITS {
+		return ErrIdentityAlreadyLinked
+	}
+
+	return err
+}
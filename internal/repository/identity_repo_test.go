@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"example.com/authorization/internal/testutil"
+)
+
+func TestCreatingAUserWithATakenEmailFailsWithErrEmailAlreadyExists(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sqlRepo := testutil.NewDB(t)
+	cache, _ := testutil.NewCache(t)
+	ir := NewIdentityRepository(sqlRepo)
+	userRepo := NewUserRepository(sqlRepo, cache)
+
+	_, err := userRepo.Insert(ctx, "alice", "alice@example.com", "hash")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = ir.CreateUser(ctx, IdentityUser{
+		Username:       "alice2",
+		Email:          "alice@example.com",
+		HashedPassword: "hash",
+	}, "example", "subject")
+	if !errors.Is(err, ErrEmailAlreadyExists) {
+		t.Fatalf("expected ErrEmailAlreadyExists, got %v", err)
+	}
+
+	_, err = ir.CreateUser(ctx, IdentityUser{
+		Username:       "alice",
+		Email:          "bob@example.com",
+		HashedPassword: "hash",
+	}, "example", "subject")
+	if !errors.Is(err, ErrUserAlreadyExists) {
+		t.Fatalf("expected ErrUserAlreadyExists, got %v", err)
+	}
+}
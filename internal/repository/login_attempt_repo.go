@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"example.com/authorization/pkg"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	loginFailuresKeyPrefix = "login_failures:"
+	loginLockKeyPrefix     = "login_lock:"
+)
+
+type LoginAttemptScope string
+
+const (
+	LoginAttemptAccount LoginAttemptScope = "account"
+	LoginAttemptIP      LoginAttemptScope = "ip"
+)
+
+// LoginAttemptKey is what failed logins are counted against, an account or a client IP
+type LoginAttemptKey struct {
+	Scope LoginAttemptScope
+	ID    string
+}
+
+func (k LoginAttemptKey) String() string {
+	return string(k.Scope) + ":" + k.ID
+}
+
+// LockoutPolicy locks a key out once MaxFailures logins failed within Window, the lockout starts
+// at BaseLockout and doubles with every further failure up to MaxLockout
+type LockoutPolicy struct {
+	MaxFailures int
+	Window      time.Duration
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+}
+
+// registerLoginFailureScript counts a failed login and locks the key out past the threshold,
+// the counter is kept for as long as the lockout plus the window so the next failure doubles it
+//
+// KEYS: failures counter, lock
+// ARGV: window in ms, max failures, base lockout in ms, max lockout in ms
+var registerLoginFailureScript = redis.NewScript(`
+local failures = redis.call('INCR', KEYS[1])
+if failures == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+
+local threshold = tonumber(ARGV[2])
+if failures < threshold then
+	return {failures, 0}
+end
+
+local lockout = math.min(tonumber(ARGV[3]) * 2 ^ (failures - threshold), tonumber(ARGV[4]))
+redis.call('SET', KEYS[2], 1, 'PX', lockout)
+
+local keep = lockout + tonumber(ARGV[1])
+if redis.call('PTTL', KEYS[1]) < keep then
+	redis.call('PEXPIRE', KEYS[1], keep)
+end
+
+return {failures, lockout}
+`)
+
+type LoginAttemptRepository struct {
+	cache pkg.Cache
+}
+
+func NewLoginAttemptRepository(cache pkg.Cache) LoginAttemptRepository {
+	return LoginAttemptRepository{
+		cache: cache,
+	}
+}
+
+// LockedFor returns how long until none of the keys is locked out anymore, zero when none is
+func (lr *LoginAttemptRepository) LockedFor(ctx context.Context, keys ...LoginAttemptKey) (time.Duration, error) {
+	cmds := make([]*redis.DurationCmd, len(keys))
+	_, err := lr.cache.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for idx, key := range keys {
+			cmds[idx] = pipe.PTTL(ctx, loginLockKeyPrefix+key.String())
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var lockedFor time.Duration
+	for _, cmd := range cmds {
+		// missing keys come back as negative durations
+		lockedFor = max(lockedFor, cmd.Val())
+	}
+
+	return lockedFor, nil
+}
+
+// RegisterFailure counts a failed login against the key, lockout is how long the key is
+// locked out for from now on, zero while it is under the threshold
+func (lr *LoginAttemptRepository) RegisterFailure(ctx context.Context, key LoginAttemptKey, policy LockoutPolicy) (failures int64, lockout time.Duration, err error) {
+	keys := []string{loginFailuresKeyPrefix + key.String(), loginLockKeyPrefix + key.String()}
+	result, err := registerLoginFailureScript.Run(ctx, lr.cache.Client, keys,
+		policy.Window.Milliseconds(),
+		policy.MaxFailures,
+		policy.BaseLockout.Milliseconds(),
+		policy.MaxLockout.Milliseconds(),
+	).Int64Slice()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return result[0], time.Duration(result[1]) * time.Millisecond, nil
+}
+
+// Reset forgets the failed logins of the key, a running lockout is left to expire
+func (lr *LoginAttemptRepository) Reset(ctx context.Context, key LoginAttemptKey) error {
+	return lr.cache.Client.Del(ctx, loginFailuresKeyPrefix+key.String()).Err()
+}
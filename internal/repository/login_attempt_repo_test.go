@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"example.com/authorization/internal/testutil"
+)
+
+var testLockoutPolicy = LockoutPolicy{
+	MaxFailures: 3,
+	Window:      time.Minute,
+	BaseLockout: time.Second,
+	MaxLockout:  4 * time.Second,
+}
+
+func TestRegisterFailureLocksOutPastTheThresholdWithBackoff(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cache, _ := testutil.NewCache(t)
+	lr := NewLoginAttemptRepository(cache)
+	key := LoginAttemptKey{Scope: LoginAttemptAccount, ID: "bob"}
+
+	want := []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second}
+	for idx, wantLockout := range want {
+		failures, lockout, err := lr.RegisterFailure(ctx, key, testLockoutPolicy)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if failures != int64(idx+1) {
+			t.Fatalf("failure %d was counted as %d", idx+1, failures)
+		}
+		if lockout != wantLockout {
+			t.Fatalf("failure %d locked out for %v, want %v", idx+1, lockout, wantLockout)
+		}
+	}
+
+	lockedFor, err := lr.LockedFor(ctx, LoginAttemptKey{Scope: LoginAttemptIP, ID: "10.0.0.1"}, key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lockedFor <= 0 || lockedFor > 4*time.Second {
+		t.Fatalf("locked for %v, want up to 4s", lockedFor)
+	}
+}
+
+func TestResetForgetsTheFailures(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cache, _ := testutil.NewCache(t)
+	lr := NewLoginAttemptRepository(cache)
+	key := LoginAttemptKey{Scope: LoginAttemptAccount, ID: "bob"}
+
+	for range 2 {
+		_, _, err := lr.RegisterFailure(ctx, key, testLockoutPolicy)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	err := lr.Reset(ctx, key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	failures, lockout, err := lr.RegisterFailure(ctx, key, testLockoutPolicy)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if failures != 1 || lockout != 0 {
+		t.Fatalf("got %d failures and a %v lockout after a reset", failures, lockout)
+	}
+
+	lockedFor, err := lr.LockedFor(ctx, key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lockedFor != 0 {
+		t.Fatalf("locked for %v without reaching the threshold", lockedFor)
+	}
+}
@@ -2,55 +2,254 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
 
 	"example.com/authorization/internal/repository/entity"
 	"example.com/authorization/pkg"
 	"github.com/Masterminds/squirrel"
+	"github.com/go-sql-driver/mysql"
 )
 
+type PostOrder string
+
+const (
+	PostOrderNew PostOrder = "new"
+	PostOrderTop PostOrder = "top"
+	PostOrderHot PostOrder = "hot"
+)
+
+// hacker news ranking, votes divided by the age in hours plus two raised to the gravity
+const hotScoreExpr = "upvote_count / POW(TIMESTAMPDIFF(SECOND, created_at, NOW()) / 3600 + 2, 1.8)"
+
+type PostListQuery struct {
+	UserID *int64
+	Order  PostOrder
+	// only posts created after Since are listed when it is set
+	Since time.Time
+	// After continues the listing right after the cursor row, Page is ignored when it is set
+	After *pkg.Cursor
+	Size  uint64
+	Page  uint64
+	// IncludeHidden lists flagged posts that got hidden too, normal viewers never see them
+	IncludeHidden bool
+}
+
+// NewPostCursor returns the cursor pointing after post in a listing ordered by order
+func NewPostCursor(order PostOrder, post entity.Post) pkg.Cursor {
+	var key string
+	switch order {
+	case PostOrderTop:
+		key = strconv.FormatUint(post.UpvoteCount, 10)
+	case PostOrderHot:
+		key = strconv.FormatFloat(post.HotScore, 'g', -1, 64)
+	default:
+		key = post.CreatedAt.Time.UTC().Format(time.RFC3339Nano)
+	}
+
+	return pkg.Cursor{
+		Sort: string(order),
+		Key:  key,
+		ID:   post.Id,
+	}
+}
+
+// keysetAfter builds the "comes after the cursor row" condition of a descending (column, id) ordering
+func keysetAfter(column string, key any, id int64) squirrel.Sqlizer {
+	return squirrel.Or{
+		squirrel.Lt{column: key},
+		squirrel.And{
+			squirrel.Eq{column: key},
+			squirrel.Lt{"post.id": id},
+		},
+	}
+}
+
+func postCursorCondition(order PostOrder, cursor pkg.Cursor) (squirrel.Sqlizer, error) {
+	switch order {
+	case PostOrderTop:
+		key, err := strconv.ParseUint(cursor.Key, 10, 64)
+		if err != nil {
+			return nil, pkg.ErrInvalidCursor
+		}
+
+		return keysetAfter("post.upvote_count", key, cursor.ID), nil
+	case PostOrderHot:
+		key, err := strconv.ParseFloat(cursor.Key, 64)
+		if err != nil {
+			return nil, pkg.ErrInvalidCursor
+		}
+
+		return keysetAfter("post.hot_score", key, cursor.ID), nil
+	default:
+		key, err := time.Parse(time.RFC3339Nano, cursor.Key)
+		if err != nil {
+			return nil, pkg.ErrInvalidCursor
+		}
+
+		return keysetAfter("post.created_at", key, cursor.ID), nil
+	}
+}
+
+// feedCacheTag tags the cached pages of the public feed, it is invalidated whenever a post shows up in
+// or disappears from the feed. Votes and comment counts are left to expire with the page
+const feedCacheTag = "feed"
+
+// postCacheTag tags the cached data belonging to a single post, comment pages included
+func postCacheTag(postID int64) string {
+	return "post:" + strconv.FormatInt(postID, 10)
+}
+
 type PostRepository struct {
 	Users   []entity.User
 	sqlRepo pkg.SQLRepository
 	cache   pkg.Cache
+	// feedTTL is how long a page of the public feed is cached, zero disables the cache
+	feedTTL time.Duration
 }
 
-func NewPostRepository(sqlRepo pkg.SQLRepository, cache pkg.Cache) PostRepository {
+func NewPostRepository(sqlRepo pkg.SQLRepository, cache pkg.Cache, feedTTL time.Duration) PostRepository {
 	return PostRepository{
 		sqlRepo: sqlRepo,
 		Users:   []entity.User{},
 		cache:   cache,
+		feedTTL: feedTTL,
+	}
+}
+
+// feedPageKey is the cache key of a page of the public feed, it is versioned by the feed generation
+func feedPageKey(ctx context.Context, cache pkg.Cache, q PostListQuery) (string, error) {
+	var since, after string
+	if !q.Since.IsZero() {
+		since = strconv.FormatInt(q.Since.Unix(), 10)
+	}
+	if q.After != nil {
+		after = q.After.Encode()
+	}
+
+	key := strings.Join(
+		[]string{
+			"posts:",
+			string(q.Order),
+			since,
+			after,
+			strconv.FormatUint(q.Size, 10),
+			strconv.FormatUint(q.Page, 10),
+		},
+		"_",
+	)
+
+	return cache.VersionedKey(ctx, key, feedCacheTag)
+}
+
+// invalidateFeed drops every cached page of the public feed
+func invalidateFeed(ctx context.Context, cache pkg.Cache) {
+	err := cache.Invalidate(ctx, feedCacheTag)
+	if err != nil {
+		logCacheError(ctx, "invalidating the cached feed pages failed", feedCacheTag, err)
 	}
 }
 
 func (ur *PostRepository) Insert(ctx context.Context, post entity.Post) (int64, error) {
-	res, err := ur.sqlRepo.DB.ExecContext(ctx, "insert into `post` (`description`, `url`, `user_id`, `vote_count`) values (?, ?, ?, 0)", post.Description, post.URL, post.UserID)
+	res, err := ur.sqlRepo.DB.ExecContext(ctx, "insert into `post` (`description`, `url`, `user_id`) values (?, ?, ?)", post.Description, post.URL, post.UserID)
 	if err != nil {
 		return 0, err
 	}
 
-	// we can add post to our search index here
+	// the FULLTEXT index used by SearchRepository is updated by InnoDB alongside the row
 
-	return res.LastInsertId()
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	invalidateFeed(ctx, ur.cache)
+
+	return id, nil
 }
 
-func (ur *PostRepository) List(ctx context.Context, userID *int64, size uint64, page uint64) ([]entity.Post, error) {
+// List reads the denormalized upvote_count, comment_count and hot_score columns so
+// every ordering is served by an index instead of a GROUP BY over the vote tables.
+// Pages of the public feed, everything but the listings of a user, are read through the cache
+func (ur *PostRepository) List(ctx context.Context, q PostListQuery) ([]entity.Post, error) {
+	if ur.feedTTL <= 0 || q.UserID != nil || q.IncludeHidden {
+		return ur.list(ctx, q)
+	}
+
+	// the window of top posts slides with every request, it is aligned to the minute so
+	// the requests of the same minute share a page
+	if !q.Since.IsZero() {
+		q.Since = q.Since.Truncate(time.Minute)
+	}
+
+	cacheKey, err := feedPageKey(ctx, ur.cache, q)
+	if err != nil {
+		logCacheError(ctx, "building the feed page key failed, reading the database", feedCacheTag, err)
+		return ur.list(ctx, q)
+	}
+
+	cached, err := ur.cache.Fetch(ctx, cacheKey, ur.feedTTL, func(ctx context.Context) ([]byte, error) {
+		posts, err := ur.list(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+
+		return json.Marshal(posts)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var posts []entity.Post
+	err = json.Unmarshal(cached, &posts)
+
+	return posts, err
+}
+
+func (ur *PostRepository) list(ctx context.Context, q PostListQuery) ([]entity.Post, error) {
 	var posts []entity.Post
 
 	query := squirrel.
 		Select(
 			"post.*",
-			"COUNT(DISTINCT user_post_upvote.post_id) AS upvote_count",
-			"COUNT(DISTINCT comment.id) AS comment_count",
+			"user.username AS username",
 		).
 		From("post").
-		LeftJoin("user_post_upvote ON post.id = user_post_upvote.post_id").
-		LeftJoin("comment ON comment.post_id = post.id").
-		GroupBy("post.id").
-		Limit(size).
-		Offset((page - 1) * size)
+		Join("user ON user.id = post.user_id").
+		Limit(q.Size)
+
+	if q.After != nil {
+		cond, err := postCursorCondition(q.Order, *q.After)
+		if err != nil {
+			return posts, err
+		}
 
-	if userID != nil {
-		query = query.Where("post.user_id = ?", *userID)
+		query = query.Where(cond)
+	} else {
+		query = query.Offset((q.Page - 1) * q.Size)
+	}
+
+	if q.UserID != nil {
+		query = query.Where("post.user_id = ?", *q.UserID)
+	}
+
+	if !q.Since.IsZero() {
+		query = query.Where("post.created_at >= ?", q.Since)
+	}
+
+	if !q.IncludeHidden {
+		query = query.Where(squirrel.Eq{"post.hidden_at": nil})
+	}
+
+	switch q.Order {
+	case PostOrderTop:
+		query = query.OrderBy("post.upvote_count DESC", "post.id DESC")
+	case PostOrderHot:
+		query = query.OrderBy("post.hot_score DESC", "post.id DESC")
+	default:
+		query = query.OrderBy("post.created_at DESC", "post.id DESC")
 	}
 
 	sql, args, err := query.ToSql()
@@ -76,21 +275,177 @@ func (ur *PostRepository) List(ctx context.Context, userID *int64, size uint64,
 
 }
 
-func (ur *PostRepository) DeleteByID(ctx context.Context, userID int64, postID int64) error {
-	query := squirrel.Delete("post").Where(squirrel.And{
-		squirrel.Eq{
-			"id": postID,
-		},
-		squirrel.Eq{
-			"user_id": userID,
-		},
+// GetByID loads a single post alongside its author and aggregated counts in one query
+func (ur *PostRepository) GetByID(ctx context.Context, postID int64) (entity.Post, error) {
+	var posts []entity.Post
+
+	sql, args, err := squirrel.
+		Select(
+			"post.*",
+			"user.username AS username",
+		).
+		From("post").
+		Join("user ON user.id = post.user_id").
+		Where("post.id = ?", postID).
+		ToSql()
+	if err != nil {
+		return entity.Post{}, err
+	}
+
+	err = ur.sqlRepo.DB.SelectContext(ctx, &posts, sql, args...)
+	if err != nil {
+		return entity.Post{}, err
+	}
+
+	if len(posts) == 0 {
+		return entity.Post{}, ErrPostNotFound
+	}
+
+	return posts[0], nil
+}
+
+// ListByIDs loads the posts with the given ids in no particular order, hidden and missing posts are left out
+func (ur *PostRepository) ListByIDs(ctx context.Context, postIDs []int64) ([]entity.Post, error) {
+	var posts []entity.Post
+	if len(postIDs) == 0 {
+		return posts, nil
+	}
+
+	sql, args, err := squirrel.
+		Select(
+			"post.*",
+			"user.username AS username",
+		).
+		From("post").
+		Join("user ON user.id = post.user_id").
+		Where(squirrel.Eq{"post.id": postIDs}).
+		Where(squirrel.Eq{"post.hidden_at": nil}).
+		ToSql()
+	if err != nil {
+		return posts, err
+	}
+
+	err = ur.sqlRepo.DB.SelectContext(ctx, &posts, sql, args...)
+
+	return posts, err
+}
+
+// RefreshHotScores recomputes hot_score for posts created after since, older posts
+// have decayed close to zero so their last stored score is good enough
+func (ur *PostRepository) RefreshHotScores(ctx context.Context, since time.Time) error {
+	sql, args, err := squirrel.Update("post").
+		Set("hot_score", squirrel.Expr(hotScoreExpr)).
+		Where("created_at >= ?", since).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = ur.sqlRepo.DB.ExecContext(ctx, sql, args...)
+
+	return err
+}
+
+// DeleteByID removes the post, ownership is checked by the caller. A non nil audit entry
+// is written in the same transaction. The comments and upvotes go with the post, so does the
+// karma their authors earned from those upvotes
+func (ur *PostRepository) DeleteByID(ctx context.Context, postID int64, audit *entity.AuditLog) error {
+	query := squirrel.Delete("post").Where(squirrel.Eq{
+		"id": postID,
 	})
 	sql, args, err := query.ToSql()
 	if err != nil {
 		return err
 	}
 
-	result, err := ur.sqlRepo.DB.ExecContext(ctx, sql, args...)
+	tx, err := ur.sqlRepo.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = takeBackKarma(ctx, tx, "post", squirrel.Eq{"t.id": postID})
+	if err != nil {
+		return err
+	}
+
+	err = takeBackKarma(ctx, tx, "comment", squirrel.Eq{"t.post_id": postID})
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrPostNotFound
+	}
+
+	if audit != nil {
+		err = insertAuditLog(ctx, tx, *audit)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	// the comments went with the post
+	invalidateCommentPages(ctx, ur.cache, postID)
+	invalidateFeed(ctx, ur.cache)
+
+	return nil
+}
+
+// Update replaces the description and URL of the post, the previous ones are kept as a revision
+// written in the same transaction. editorID is the user making the change
+func (ur *PostRepository) Update(ctx context.Context, post entity.Post, editorID int64) error {
+	// the revision copies the row as it is right before the update
+	revision := squirrel.Select().
+		Column("id").
+		Column(squirrel.Expr("?", editorID)).
+		Column("description").
+		Column("url").
+		From("post").
+		Where(squirrel.Eq{"id": post.Id})
+
+	rsql, rargs, err := squirrel.Insert("post_revision").Columns(
+		"post_id",
+		"user_id",
+		"description",
+		"url",
+	).Select(revision).ToSql()
+	if err != nil {
+		return err
+	}
+
+	usql, uargs, err := squirrel.Update("post").
+		Set("description", post.Description).
+		Set("url", post.URL).
+		Set("edited_at", squirrel.Expr("CURRENT_TIMESTAMP")).
+		Where(squirrel.Eq{"id": post.Id}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	tx, err := ur.sqlRepo.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, rsql, rargs...)
 	if err != nil {
 		return err
 	}
@@ -104,5 +459,107 @@ func (ur *PostRepository) DeleteByID(ctx context.Context, userID int64, postID i
 		return ErrPostNotFound
 	}
 
+	_, err = tx.ExecContext(ctx, usql, uargs...)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	invalidateFeed(ctx, ur.cache)
+
 	return nil
 }
+
+// ListRevisions returns the previous versions of the post, the most recent first
+func (ur *PostRepository) ListRevisions(ctx context.Context, postID int64) ([]entity.PostRevision, error) {
+	var revisions []entity.PostRevision
+
+	sql, args, err := squirrel.Select("*").
+		From("post_revision").
+		Where(squirrel.Eq{"post_id": postID}).
+		OrderBy("id DESC").
+		ToSql()
+	if err != nil {
+		return revisions, err
+	}
+
+	err = ur.sqlRepo.DB.SelectContext(ctx, &revisions, sql, args...)
+
+	return revisions, err
+}
+
+// Upvote toggles the upvote of userID on postID, it returns true when the
+// upvote is registered and false when an existing upvote is taken back
+func (ur *PostRepository) Upvote(ctx context.Context, userID int64, postID int64) (bool, error) {
+	state := false
+
+	tx, err := ur.sqlRepo.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return state, err
+	}
+	defer tx.Rollback()
+
+	sqlstr, args, err := squirrel.Insert("user_post_upvote").Columns("user_id", "post_id").Values(
+		userID,
+		postID,
+	).ToSql()
+	if err != nil {
+		return state, err
+	}
+
+	delta := 1
+	_, err = tx.ExecContext(ctx, sqlstr, args...)
+	if err == nil {
+		state = true
+	} else {
+		mysqlerr, ok := err.(*mysql.MySQLError)
+		if !ok {
+			return state, err
+		}
+
+		switch mysqlerr.Number {
+		case MYSQL_KEY_EXITS:
+			delsqlstr, delargs, delerr := squirrel.Delete("user_post_upvote").Where("user_id = ?", userID).Where("post_id = ?", postID).ToSql()
+			if delerr != nil {
+				return state, delerr
+			}
+
+			_, delerr = tx.ExecContext(ctx, delsqlstr, delargs...)
+			if delerr != nil {
+				return state, delerr
+			}
+
+			delta = -1
+		case MYSQL_NO_REFERENCED_ROW:
+			return state, ErrPostNotFound
+		default:
+			return state, err
+		}
+	}
+
+	// assignments are evaluated left to right so hot_score sees the new upvote_count
+	usqlstr, uargs, err := squirrel.Update("post").
+		Set("upvote_count", squirrel.Expr("upvote_count + ?", delta)).
+		Set("hot_score", squirrel.Expr(hotScoreExpr)).
+		Where("id = ?", postID).
+		ToSql()
+	if err != nil {
+		return state, err
+	}
+
+	_, err = tx.ExecContext(ctx, usqlstr, uargs...)
+	if err != nil {
+		return state, err
+	}
+
+	err = updateAuthorKarma(ctx, tx, "post", postID, userID, delta)
+	if err != nil {
+		return state, err
+	}
+
+	return state, tx.Commit()
+}
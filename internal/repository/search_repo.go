@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"strings"
+
+	"example.com/authorization/internal/repository/entity"
+	"example.com/authorization/pkg"
+)
+
+const (
+	SearchTypePost    = "post"
+	SearchTypeComment = "comment"
+)
+
+type SearchQuery struct {
+	Text string
+	// Types limits the search to posts or comments, both are searched when it is empty
+	Types []string
+	Size  uint64
+	Page  uint64
+}
+
+// posts and comments are matched against their FULLTEXT indexes, InnoDB keeps
+// those in sync on every insert, update and delete so there is nothing to reindex
+const (
+	searchPostsQuery = `SELECT
+		'post' AS type,
+		post.id AS id,
+		post.id AS post_id,
+		post.user_id,
+		user.username AS username,
+		post.description AS content,
+		post.url AS url,
+		post.created_at AS created_at,
+		MATCH (post.description, post.url) AGAINST (? IN NATURAL LANGUAGE MODE) AS score
+	FROM post
+	JOIN user ON user.id = post.user_id
+	WHERE MATCH (post.description, post.url) AGAINST (? IN NATURAL LANGUAGE MODE)
+		AND post.hidden_at IS NULL`
+
+	searchCommentsQuery = `SELECT
+		'comment' AS type,
+		comment.id AS id,
+		comment.post_id AS post_id,
+		comment.user_id,
+		user.username AS username,
+		comment.content AS content,
+		'' AS url,
+		comment.created_at AS created_at,
+		MATCH (comment.content) AGAINST (? IN NATURAL LANGUAGE MODE) AS score
+	FROM comment
+	JOIN user ON user.id = comment.user_id
+	JOIN post ON post.id = comment.post_id
+	WHERE MATCH (comment.content) AGAINST (? IN NATURAL LANGUAGE MODE)
+		AND comment.deleted_at IS NULL
+		AND comment.hidden_at IS NULL
+		AND post.hidden_at IS NULL`
+)
+
+type SearchRepository struct {
+	sqlRepo pkg.SQLRepository
+}
+
+func NewSearchRepository(sqlRepo pkg.SQLRepository) SearchRepository {
+	return SearchRepository{
+		sqlRepo: sqlRepo,
+	}
+}
+
+// Search returns the most relevant posts and comments first, hidden and deleted items are never
+// matched and neither are the comments of hidden posts
+func (sr *SearchRepository) Search(ctx context.Context, q SearchQuery) ([]entity.SearchResult, error) {
+	var results []entity.SearchResult
+
+	var parts []string
+	var args []any
+	for _, t := range searchTypes(q.Types) {
+		switch t {
+		case SearchTypePost:
+			parts = append(parts, searchPostsQuery)
+		case SearchTypeComment:
+			parts = append(parts, searchCommentsQuery)
+		default:
+			continue
+		}
+
+		args = append(args, q.Text, q.Text)
+	}
+
+	if len(parts) == 0 {
+		return results, nil
+	}
+
+	query := "SELECT * FROM (" + strings.Join(parts, " UNION ALL ") + ") AS results ORDER BY score DESC, type DESC, id DESC LIMIT ? OFFSET ?"
+	args = append(args, q.Size, (q.Page-1)*q.Size)
+
+	err := sr.sqlRepo.DB.SelectContext(ctx, &results, query, args...)
+
+	return results, err
+}
+
+func searchTypes(types []string) []string {
+	if len(types) == 0 {
+		return []string{SearchTypePost, SearchTypeComment}
+	}
+
+	return types
+}
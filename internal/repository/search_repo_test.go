@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"example.com/authorization/internal/repository/entity"
+	"example.com/authorization/internal/testutil"
+	"example.com/authorization/pkg"
+)
+
+// searchFixture writes posts and comments to search through, alongside a few that never match
+// since InnoDB does not match a word found in every row of a table
+type searchFixture struct {
+	t           *testing.T
+	sqlRepo     pkg.SQLRepository
+	postRepo    PostRepository
+	commentRepo CommentRepo
+	userID      int64
+	postID      int64
+}
+
+func newSearchFixture(t *testing.T) searchFixture {
+	t.Helper()
+
+	cache, _ := testutil.NewCache(t)
+	sqlRepo := testutil.NewDB(t)
+
+	userID, postID := insertTestPost(t, sqlRepo, cache, "alice")
+	insertTestPost(t, sqlRepo, cache, "bob")
+
+	sf := searchFixture{
+		t:           t,
+		sqlRepo:     sqlRepo,
+		postRepo:    NewPostRepository(sqlRepo, cache, 0),
+		commentRepo: NewCommentRepo(sqlRepo, cache),
+		userID:      userID,
+		postID:      postID,
+	}
+
+	sf.comment(postID, "nothing to see here")
+	sf.comment(postID, "move along")
+
+	return sf
+}
+
+func (sf searchFixture) post(description string) int64 {
+	sf.t.Helper()
+
+	postID, err := sf.postRepo.Insert(context.Background(), entity.Post{
+		UserID:      sf.userID,
+		Description: description,
+		URL:         "https://example.com",
+	})
+	if err != nil {
+		sf.t.Fatalf("unexpected error: %v", err)
+	}
+
+	return postID
+}
+
+func (sf searchFixture) comment(postID int64, content string) int64 {
+	sf.t.Helper()
+
+	commentID, err := sf.commentRepo.Insert(context.Background(), entity.Comment{
+		UserID:  sf.userID,
+		PostID:  postID,
+		Content: content,
+	})
+	if err != nil {
+		sf.t.Fatalf("unexpected error: %v", err)
+	}
+
+	return commentID
+}
+
+func (sf searchFixture) search(q SearchQuery) []entity.SearchResult {
+	sf.t.Helper()
+
+	sr := NewSearchRepository(sf.sqlRepo)
+	results, err := sr.Search(context.Background(), q)
+	if err != nil {
+		sf.t.Fatalf("unexpected error: %v", err)
+	}
+
+	return results
+}
+
+func TestSearchSkipsHiddenAndDeletedItems(t *testing.T) {
+	t.Parallel()
+
+	sf := newSearchFixture(t)
+
+	visiblePost := sf.post("gophers everywhere")
+	hiddenPost := sf.post("hidden gophers")
+	sf.sqlRepo.DB.MustExec("UPDATE post SET hidden_at = CURRENT_TIMESTAMP WHERE id = ?", hiddenPost)
+
+	visibleComment := sf.comment(visiblePost, "gophers in the comments")
+	sf.comment(hiddenPost, "gophers under a hidden post")
+	hiddenComment := sf.comment(visiblePost, "hidden gophers in the comments")
+	sf.sqlRepo.DB.MustExec("UPDATE comment SET hidden_at = CURRENT_TIMESTAMP WHERE id = ?", hiddenComment)
+
+	deletedComment := sf.comment(visiblePost, "deleted gophers in the comments")
+	err := sf.commentRepo.DeleteByID(context.Background(), deletedComment, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	results := sf.search(SearchQuery{Text: "gophers", Size: 10, Page: 1})
+	if len(results) != 2 {
+		t.Fatalf("expected the visible post and comment alone, got %+v", results)
+	}
+
+	for _, result := range results {
+		visible := (result.Type == SearchTypePost && result.Id == visiblePost) || (result.Type == SearchTypeComment && result.Id == visibleComment)
+		if !visible {
+			t.Fatalf("expected the visible post and comment alone, got %+v", results)
+		}
+	}
+}
+
+func TestSearchRanksTheMostRelevantFirstAndPages(t *testing.T) {
+	t.Parallel()
+
+	sf := newSearchFixture(t)
+
+	once := sf.post("gophers")
+	thrice := sf.post("gophers, gophers and more gophers")
+	twice := sf.post("gophers meet gophers")
+
+	first := sf.search(SearchQuery{Text: "gophers", Types: []string{SearchTypePost}, Size: 2, Page: 1})
+	if len(first) != 2 || first[0].Id != thrice || first[1].Id != twice {
+		t.Fatalf("expected posts %d and %d, got %+v", thrice, twice, first)
+	}
+
+	if first[0].Score <= first[1].Score {
+		t.Fatalf("expected decreasing scores, got %+v", first)
+	}
+
+	second := sf.search(SearchQuery{Text: "gophers", Types: []string{SearchTypePost}, Size: 2, Page: 2})
+	if len(second) != 1 || second[0].Id != once {
+		t.Fatalf("expected post %d alone on the last page, got %+v", once, second)
+	}
+}
+
+func TestSearchFiltersByType(t *testing.T) {
+	t.Parallel()
+
+	sf := newSearchFixture(t)
+
+	postID := sf.post("gophers everywhere")
+	commentID := sf.comment(postID, "gophers in the comments")
+
+	tests := []struct {
+		types []string
+		want  []entity.SearchResult
+	}{
+		{[]string{SearchTypePost}, []entity.SearchResult{{Type: SearchTypePost, Id: postID}}},
+		{[]string{SearchTypeComment}, []entity.SearchResult{{Type: SearchTypeComment, Id: commentID}}},
+		{nil, []entity.SearchResult{{Type: SearchTypePost, Id: postID}, {Type: SearchTypeComment, Id: commentID}}},
+	}
+
+	for _, tt := range tests {
+		results := sf.search(SearchQuery{Text: "gophers", Types: tt.types, Size: 10, Page: 1})
+		if len(results) != len(tt.want) {
+			t.Errorf("types %v: expected %d results, got %+v", tt.types, len(tt.want), results)
+			continue
+		}
+
+		for _, want := range tt.want {
+			found := false
+			for _, result := range results {
+				found = found || (result.Type == want.Type && result.Id == want.Id)
+			}
+
+			if !found {
+				t.Errorf("types %v: expected %s %d, got %+v", tt.types, want.Type, want.Id, results)
+			}
+		}
+
+		for _, result := range results {
+			if result.Type == SearchTypeComment && result.PostID != postID {
+				t.Errorf("types %v: expected the comment to point at post %d, got %d", tt.types, postID, result.PostID)
+			}
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/authorization/pkg"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	refreshTokenKeyPrefix     = "refresh_token:"
+	usedRefreshTokenKeyPrefix = "refresh_token_used:"
+	refreshFamilyKeyPrefix    = "refresh_family:"
+	revokedTokenKeyPrefix     = "revoked_token:"
+	revokedUserKeyPrefix      = "revoked_user:"
+	usedTOTPKeyPrefix         = "totp_used:"
+	oauthStateKeyPrefix       = "oauth_state:"
+)
+
+// OneTimeTokenPurpose scopes single use tokens, a token issued for one purpose is unknown to the others
+type OneTimeTokenPurpose string
+
+const (
+	OneTimeTokenEmailVerification OneTimeTokenPurpose = "email_verification"
+	OneTimeTokenPasswordReset     OneTimeTokenPurpose = "password_reset"
+	// OneTimeTokenMFAChallenge is handed out by a login that still needs the second factor
+	OneTimeTokenMFAChallenge OneTimeTokenPurpose = "mfa_challenge"
+)
+
+// RefreshToken is what is stored for an issued refresh token, tokens rotated out of
+// each other share the same family so a replayed token can revoke the whole chain
+type RefreshToken struct {
+	UserID int64
+	Family string
+	// IssuedAt is when the family was started, tokens rotated out of each other keep it
+	IssuedAt time.Time
+}
+
+// OAuthState is what a login at an OIDC provider was started with, it is found again by the
+// state the provider redirects back with
+type OAuthState struct {
+	Provider     string `json:"provider"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"codeVerifier"`
+	// LinkUserID is set when a logged in user links the identity instead of logging in with it
+	LinkUserID int64 `json:"linkUserId,omitempty"`
+}
+
+type TokenRepository struct {
+	cache pkg.Cache
+}
+
+func NewTokenRepository(cache pkg.Cache) TokenRepository {
+	return TokenRepository{
+		cache: cache,
+	}
+}
+
+// StoreRefreshToken saves the hash of a refresh token and makes it the live token of its family
+func (tr *TokenRepository) StoreRefreshToken(ctx context.Context, tokenHash string, token RefreshToken, ttl time.Duration) error {
+	value := strconv.FormatInt(token.UserID, 10) + ":" + token.Family + ":" + strconv.FormatInt(token.IssuedAt.Unix(), 10)
+
+	_, err := tr.cache.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, refreshTokenKeyPrefix+tokenHash, value, ttl)
+		pipe.Set(ctx, refreshFamilyKeyPrefix+token.Family, tokenHash, ttl)
+		return nil
+	})
+
+	return err
+}
+
+// consumeRefreshTokenScript deletes the refresh token and marks it used with its family in one go,
+// a replay can never find the token gone without the marker
+//
+// KEYS: refresh token, used marker
+// ARGV: marker TTL in ms
+var consumeRefreshTokenScript = redis.NewScript(`
+local value = redis.call('GET', KEYS[1])
+if not value then
+	return false
+end
+redis.call('DEL', KEYS[1])
+
+-- user id, family and when the family was started
+local family = string.match(value, '^[^:]*:([^:]*):')
+if family then
+	redis.call('SET', KEYS[2], family, 'PX', ARGV[1])
+end
+return value
+`)
+
+// ConsumeRefreshToken deletes the refresh token and returns what it was issued for, a token
+// can only be consumed once and presenting a consumed token again revokes its family
+func (tr *TokenRepository) ConsumeRefreshToken(ctx context.Context, tokenHash string, ttl time.Duration) (RefreshToken, error) {
+	value, err := consumeRefreshTokenScript.Run(ctx, tr.cache.Client,
+		[]string{refreshTokenKeyPrefix + tokenHash, usedRefreshTokenKeyPrefix + tokenHash},
+		ttl.Milliseconds(),
+	).Text()
+	if errors.Is(err, redis.Nil) {
+		family, uerr := tr.cache.Client.Get(ctx, usedRefreshTokenKeyPrefix+tokenHash).Result()
+		if uerr == nil {
+			// the token was already rotated, someone is replaying it
+			return RefreshToken{}, errors.Join(ErrRefreshTokenReused, tr.RevokeRefreshFamily(ctx, family))
+		}
+
+		return RefreshToken{}, ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		return RefreshToken{}, err
+	}
+
+	// user id, family and when the family was started
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return RefreshToken{}, ErrRefreshTokenNotFound
+	}
+
+	userID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return RefreshToken{}, ErrRefreshTokenNotFound
+	}
+
+	family := parts[1]
+
+	issuedAt, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return RefreshToken{}, ErrRefreshTokenNotFound
+	}
+
+	return RefreshToken{
+		UserID:   userID,
+		Family:   family,
+		IssuedAt: time.Unix(issuedAt, 0),
+	}, nil
+}
+
+// RevokeRefreshFamily deletes the live refresh token of the family
+func (tr *TokenRepository) RevokeRefreshFamily(ctx context.Context, family string) error {
+	tokenHash, err := tr.cache.Client.GetDel(ctx, refreshFamilyKeyPrefix+family).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return tr.cache.Client.Del(ctx, refreshTokenKeyPrefix+tokenHash).Err()
+}
+
+// RevokeAccessToken puts the token ID on the denylist until the token would have expired anyway
+func (tr *TokenRepository) RevokeAccessToken(ctx context.Context, tokenID string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+
+	return tr.cache.Client.Set(ctx, revokedTokenKeyPrefix+tokenID, 1, ttl).Err()
+}
+
+func (tr *TokenRepository) IsAccessTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	n, err := tr.cache.Client.Exists(ctx, revokedTokenKeyPrefix+tokenID).Result()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+// RevokeUserTokens denylists every token issued to the user until now, to the second. The mark
+// is kept for ttl which has to be at least the lifetime of the tokens
+func (tr *TokenRepository) RevokeUserTokens(ctx context.Context, userID int64, ttl time.Duration) error {
+	return tr.cache.Client.Set(ctx, revokedUserKeyPrefix+strconv.FormatInt(userID, 10), time.Now().Unix(), ttl).Err()
+}
+
+// UserTokensRevokedAt returns when the tokens of the user were last revoked, zero when they never were
+func (tr *TokenRepository) UserTokensRevokedAt(ctx context.Context, userID int64) (time.Time, error) {
+	revokedAt, err := tr.cache.Client.Get(ctx, revokedUserKeyPrefix+strconv.FormatInt(userID, 10)).Int64()
+	if errors.Is(err, redis.Nil) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(revokedAt, 0), nil
+}
+
+// StoreOneTimeToken saves the hash of a single use token issued to the user, it replaces the
+// token the user was previously issued for the same purpose
+func (tr *TokenRepository) StoreOneTimeToken(ctx context.Context, purpose OneTimeTokenPurpose, tokenHash string, userID int64, ttl time.Duration) error {
+	userKey := string(purpose) + "_user:" + strconv.FormatInt(userID, 10)
+
+	previous, err := tr.cache.Client.Get(ctx, userKey).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+
+	_, err = tr.cache.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if previous != "" {
+			pipe.Del(ctx, string(purpose)+":"+previous)
+		}
+
+		pipe.Set(ctx, string(purpose)+":"+tokenHash, userID, ttl)
+		pipe.Set(ctx, userKey, tokenHash, ttl)
+		return nil
+	})
+
+	return err
+}
+
+// ConsumeOneTimeToken deletes the token and returns the user it was issued to, unknown, expired
+// and already consumed tokens fail with ErrOneTimeTokenNotFound
+func (tr *TokenRepository) ConsumeOneTimeToken(ctx context.Context, purpose OneTimeTokenPurpose, tokenHash string) (int64, error) {
+	userID, err := tr.cache.Client.GetDel(ctx, string(purpose)+":"+tokenHash).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, ErrOneTimeTokenNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// LookupOneTimeToken returns the user the token was issued to without consuming it
+func (tr *TokenRepository) LookupOneTimeToken(ctx context.Context, purpose OneTimeTokenPurpose, tokenHash string) (int64, error) {
+	userID, err := tr.cache.Client.Get(ctx, string(purpose)+":"+tokenHash).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, ErrOneTimeTokenNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// MarkTOTPStepUsed remembers that the user logged in with the code of the step, it returns
+// false when the code was already used. The mark has to outlive the period the code is valid for
+func (tr *TokenRepository) MarkTOTPStepUsed(ctx context.Context, userID int64, step int64, ttl time.Duration) (bool, error) {
+	key := usedTOTPKeyPrefix + strconv.FormatInt(userID, 10) + ":" + strconv.FormatInt(step, 10)
+
+	return tr.cache.Client.SetNX(ctx, key, 1, ttl).Result()
+}
+
+func (tr *TokenRepository) StoreOAuthState(ctx context.Context, stateHash string, state OAuthState, ttl time.Duration) error {
+	value, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return tr.cache.Client.Set(ctx, oauthStateKeyPrefix+stateHash, value, ttl).Err()
+}
+
+// ConsumeOAuthState deletes the state so a login can only be finished once, unknown, expired and
+// already consumed states fail with ErrOAuthStateNotFound
+func (tr *TokenRepository) ConsumeOAuthState(ctx context.Context, stateHash string) (OAuthState, error) {
+	value, err := tr.cache.Client.GetDel(ctx, oauthStateKeyPrefix+stateHash).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return OAuthState{}, ErrOAuthStateNotFound
+	}
+	if err != nil {
+		return OAuthState{}, err
+	}
+
+	var state OAuthState
+	err = json.Unmarshal(value, &state)
+	if err != nil {
+		return OAuthState{}, err
+	}
+
+	return state, nil
+}
@@ -0,0 +1,274 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"example.com/authorization/internal/testutil"
+)
+
+func TestRevokeUserTokensIsPerUser(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cache, _ := testutil.NewCache(t)
+	tr := NewTokenRepository(cache)
+
+	revokedAt, err := tr.UserTokensRevokedAt(ctx, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !revokedAt.IsZero() {
+		t.Fatalf("tokens of a user that was never suspended are revoked at %v", revokedAt)
+	}
+
+	before := time.Now().Truncate(time.Second)
+	err = tr.RevokeUserTokens(ctx, 1, time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	after := time.Now()
+
+	revokedAt, err = tr.UserTokensRevokedAt(ctx, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if revokedAt.Before(before) || revokedAt.After(after) {
+		t.Fatalf("revoked at %v, want between %v and %v", revokedAt, before, after)
+	}
+
+	revokedAt, err = tr.UserTokensRevokedAt(ctx, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !revokedAt.IsZero() {
+		t.Fatalf("revoking a user revoked another one")
+	}
+}
+
+func TestRefreshTokenKeepsWhenItsFamilyWasStarted(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cache, _ := testutil.NewCache(t)
+	tr := NewTokenRepository(cache)
+
+	// to the second, like the revocation marks it is compared with
+	issuedAt := time.Now().Truncate(time.Second)
+	err := tr.StoreRefreshToken(ctx, "hash", RefreshToken{UserID: 1, Family: "family", IssuedAt: issuedAt}, time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rt, err := tr.ConsumeRefreshToken(ctx, "hash", time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if rt.UserID != 1 || rt.Family != "family" || !rt.IssuedAt.Equal(issuedAt) {
+		t.Fatalf("expected the stored token back, got %+v issued at %v", rt, issuedAt)
+	}
+}
+
+func TestRefreshTokensWithoutWhenTheirFamilyWasStartedAreRefused(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cache, mr := testutil.NewCache(t)
+	tr := NewTokenRepository(cache)
+
+	// without the start of its family, a zero start would count as revoked by any revocation
+	mr.Set(refreshTokenKeyPrefix+"hash", "1:family")
+
+	_, err := tr.ConsumeRefreshToken(ctx, "hash", time.Minute)
+	if !errors.Is(err, ErrRefreshTokenNotFound) {
+		t.Fatalf("expected ErrRefreshTokenNotFound, got %v", err)
+	}
+}
+
+func TestOneTimeTokenCanOnlyBeConsumedOnce(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cache, _ := testutil.NewCache(t)
+	tr := NewTokenRepository(cache)
+
+	err := tr.StoreOneTimeToken(ctx, OneTimeTokenPasswordReset, "hash", 7, time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = tr.ConsumeOneTimeToken(ctx, OneTimeTokenEmailVerification, "hash")
+	if !errors.Is(err, ErrOneTimeTokenNotFound) {
+		t.Fatalf("token was consumed for another purpose, err = %v", err)
+	}
+
+	userID, err := tr.ConsumeOneTimeToken(ctx, OneTimeTokenPasswordReset, "hash")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if userID != 7 {
+		t.Fatalf("token was issued to user 7, got %d", userID)
+	}
+
+	_, err = tr.ConsumeOneTimeToken(ctx, OneTimeTokenPasswordReset, "hash")
+	if !errors.Is(err, ErrOneTimeTokenNotFound) {
+		t.Fatalf("token was consumed twice, err = %v", err)
+	}
+}
+
+func TestOneTimeTokenReplacesThePreviousOne(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cache, _ := testutil.NewCache(t)
+	tr := NewTokenRepository(cache)
+
+	for _, hash := range []string{"first", "second"} {
+		err := tr.StoreOneTimeToken(ctx, OneTimeTokenPasswordReset, hash, 7, time.Minute)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	_, err := tr.ConsumeOneTimeToken(ctx, OneTimeTokenPasswordReset, "first")
+	if !errors.Is(err, ErrOneTimeTokenNotFound) {
+		t.Fatalf("replaced token still works, err = %v", err)
+	}
+
+	_, err = tr.ConsumeOneTimeToken(ctx, OneTimeTokenPasswordReset, "second")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestLookupOneTimeTokenLeavesItForConsumption(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cache, _ := testutil.NewCache(t)
+	tr := NewTokenRepository(cache)
+
+	err := tr.StoreOneTimeToken(ctx, OneTimeTokenMFAChallenge, "hash", 7, time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for range 2 {
+		userID, err := tr.LookupOneTimeToken(ctx, OneTimeTokenMFAChallenge, "hash")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if userID != 7 {
+			t.Fatalf("token looked up for user %d, want 7", userID)
+		}
+	}
+
+	_, err = tr.ConsumeOneTimeToken(ctx, OneTimeTokenMFAChallenge, "hash")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = tr.LookupOneTimeToken(ctx, OneTimeTokenMFAChallenge, "hash")
+	if !errors.Is(err, ErrOneTimeTokenNotFound) {
+		t.Fatalf("expected ErrOneTimeTokenNotFound after consumption, got %v", err)
+	}
+}
+
+func TestMarkTOTPStepUsedRefusesTheSameCodeTwice(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cache, _ := testutil.NewCache(t)
+	tr := NewTokenRepository(cache)
+
+	for _, tc := range []struct {
+		userID int64
+		step   int64
+		want   bool
+	}{
+		{1, 100, true},
+		{1, 100, false},
+		{1, 101, true},
+		{2, 100, true},
+	} {
+		fresh, err := tr.MarkTOTPStepUsed(ctx, tc.userID, tc.step, time.Minute)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if fresh != tc.want {
+			t.Fatalf("step %d of user %d marked %v, want %v", tc.step, tc.userID, fresh, tc.want)
+		}
+	}
+}
+
+func TestOAuthStateCanOnlyBeConsumedOnce(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cache, _ := testutil.NewCache(t)
+	tr := NewTokenRepository(cache)
+
+	state := OAuthState{
+		Provider:     "gitlab",
+		Nonce:        "nonce",
+		CodeVerifier: "verifier",
+		LinkUserID:   7,
+	}
+
+	err := tr.StoreOAuthState(ctx, "hash", state, time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := tr.ConsumeOAuthState(ctx, "hash")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != state {
+		t.Fatalf("got state %+v, want %+v", got, state)
+	}
+
+	_, err = tr.ConsumeOAuthState(ctx, "hash")
+	if !errors.Is(err, ErrOAuthStateNotFound) {
+		t.Fatalf("expected ErrOAuthStateNotFound, got %v", err)
+	}
+}
+
+func TestConsumingARefreshTokenMarksItUsedAtOnce(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cache, mr := testutil.NewCache(t)
+	tr := NewTokenRepository(cache)
+
+	err := tr.StoreRefreshToken(ctx, "hash", RefreshToken{UserID: 1, Family: "family", IssuedAt: time.Now()}, time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = tr.ConsumeRefreshToken(ctx, "hash", time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if mr.Exists(refreshTokenKeyPrefix + "hash") {
+		t.Fatalf("expected the token to be gone")
+	}
+
+	family, err := mr.Get(usedRefreshTokenKeyPrefix + "hash")
+	if err != nil || family != "family" {
+		t.Fatalf("expected the token marked used by its family, got %q and %v", family, err)
+	}
+
+	if ttl := mr.TTL(usedRefreshTokenKeyPrefix + "hash"); ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("expected the marker to expire within a minute, got %v", ttl)
+	}
+
+	_, err = tr.ConsumeRefreshToken(ctx, "hash", time.Minute)
+	if !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("expected ErrRefreshTokenReused, got %v", err)
+	}
+}
@@ -2,32 +2,50 @@ package repository
 
 import (
 	"context"
-	"fmt"
+	"strings"
 
 	"example.com/authorization/internal/repository/entity"
 	"example.com/authorization/pkg"
+	"github.com/Masterminds/squirrel"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
 )
 
 type UserRepository struct {
 	Users   []entity.User
 	sqlRepo pkg.SQLRepository
+	// cache holds the feed and comment pages a deleted user drops out of
+	cache pkg.Cache
 }
 
-func NewUserRepository(sqlRepo pkg.SQLRepository) UserRepository {
+func NewUserRepository(sqlRepo pkg.SQLRepository, cache pkg.Cache) UserRepository {
 	return UserRepository{
 		sqlRepo: sqlRepo,
+		cache:   cache,
 		Users:   []entity.User{},
 	}
 }
 
-func (ur *UserRepository) Insert(ctx context.Context, username string, hashedPassword string) error {
-	// THIS IS DANGEROUS
-	query := fmt.Sprintf("insert into `user` (`password`, `username`) values ('%s', '%s')", hashedPassword, username)
-	_, err := ur.sqlRepo.DB.ExecContext(ctx, query)
+// Insert creates the user and returns its id, a username or email that is already taken fails with ErrUserAlreadyExists
+func (ur *UserRepository) Insert(ctx context.Context, username string, email string, hashedPassword string) (int64, error) {
+	sql, args, err := squirrel.Insert("user").
+		Columns("username", "email", "password").
+		Values(username, email, hashedPassword).
+		ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := ur.sqlRepo.DB.ExecContext(ctx, sql, args...)
+	if err != nil {
+		if mysqlerr, ok := err.(*mysql.MySQLError); ok && mysqlerr.Number == MYSQL_KEY_EXITS {
+			return 0, ErrUserAlreadyExists
+		}
 
-	// ("select * from user where user_id = ?", 2)
+		return 0, err
+	}
 
-	return err
+	return result.LastInsertId()
 }
 
 func (ur *UserRepository) GetOneByUsername(ctx context.Context, username string) (entity.User, error) {
@@ -45,6 +63,21 @@ func (ur *UserRepository) GetOneByUsername(ctx context.Context, username string)
 	return users[0], nil
 }
 
+func (ur *UserRepository) GetOneByEmail(ctx context.Context, email string) (entity.User, error) {
+	var users []entity.User
+
+	err := ur.sqlRepo.DB.SelectContext(ctx, &users, "select * from user where email = ?", email)
+	if err != nil {
+		return entity.User{}, err
+	}
+
+	if len(users) == 0 {
+		return entity.User{}, ErrUserNotFound
+	}
+
+	return users[0], nil
+}
+
 func (ur *UserRepository) GetOneByID(ctx context.Context, userID int64) (entity.User, error) {
 	var users []entity.User
 
@@ -60,21 +93,520 @@ func (ur *UserRepository) GetOneByID(ctx context.Context, userID int64) (entity.
 	return users[0], nil
 }
 
-func (ur *UserRepository) ListAll(ctx context.Context) ([]entity.User, error) {
-	rows, err := ur.sqlRepo.DB.QueryxContext(ctx, "select * from user")
+type UserOrder string
+
+const (
+	UserOrderNew      UserOrder = "new"
+	UserOrderOld      UserOrder = "old"
+	UserOrderUsername UserOrder = "username"
+	UserOrderKarma    UserOrder = "karma"
+)
+
+type UserListQuery struct {
+	// Search lists the users whose username or email starts with it
+	Search string
+	// Suspended lists only suspended or only active users when it is set
+	Suspended *bool
+	Order     UserOrder
+	Size      uint64
+	Page      uint64
+}
+
+// userListColumns leaves the password hash out, it has no business outside of login
+var userListColumns = []string{
+	"id",
+	"username",
+	"email",
+	"full_name",
+	"role",
+	"about",
+	"karma",
+	"created_at",
+	"updated_at",
+	"suspended_at",
+}
+
+func (ur *UserRepository) List(ctx context.Context, q UserListQuery) ([]entity.User, error) {
+	var users []entity.User
+
+	query := squirrel.Select(userListColumns...).
+		From("user").
+		Limit(q.Size).
+		Offset((q.Page - 1) * q.Size)
+
+	if q.Search != "" {
+		prefix := escapeLike(q.Search) + "%"
+		query = query.Where(squirrel.Or{
+			squirrel.Like{"username": prefix},
+			squirrel.Like{"email": prefix},
+		})
+	}
+
+	if q.Suspended != nil {
+		if *q.Suspended {
+			query = query.Where(squirrel.NotEq{"suspended_at": nil})
+		} else {
+			query = query.Where(squirrel.Eq{"suspended_at": nil})
+		}
+	}
+
+	switch q.Order {
+	case UserOrderOld:
+		query = query.OrderBy("id ASC")
+	case UserOrderUsername:
+		query = query.OrderBy("username ASC")
+	case UserOrderKarma:
+		query = query.OrderBy("karma DESC", "id DESC")
+	default:
+		query = query.OrderBy("id DESC")
+	}
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return users, err
+	}
+
+	err = ur.sqlRepo.DB.SelectContext(ctx, &users, sql, args...)
+
+	return users, err
+}
+
+// escapeLike makes s match itself in a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func (ur *UserRepository) UpdateRole(ctx context.Context, userID int64, role string, audit entity.AuditLog) error {
+	sql, args, err := squirrel.Update("user").
+		Set("role", role).
+		Where("id = ?", userID).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	return ur.execAudited(ctx, sql, args, audit)
+}
+
+// deletedCommentsExpr matches the comments that go with a deleted user: theirs, the ones on their
+// posts and every reply under those
+const deletedCommentsExpr = `t.id IN (
+	WITH RECURSIVE deleted (id) AS (
+		SELECT id FROM comment WHERE user_id = ? OR post_id IN (SELECT id FROM post WHERE user_id = ?)
+		UNION SELECT comment.id FROM comment JOIN deleted ON comment.parent_id = deleted.id
+	)
+	SELECT id FROM deleted
+)`
+
+// touchedPostsQuery lists the posts of others a user upvoted, commented on or upvoted a comment of,
+// their counters and cached pages change when the user is deleted
+const touchedPostsQuery = `
+	SELECT post_id FROM user_post_upvote WHERE user_id = ?
+	UNION SELECT post_id FROM comment WHERE user_id = ?
+	UNION SELECT comment.post_id FROM user_comment_upvote
+		JOIN comment ON comment.id = user_comment_upvote.comment_id
+		WHERE user_comment_upvote.user_id = ?`
+
+// DeleteByID removes the user alongside its audit entry. Their posts, comments and upvotes go with
+// them, so does the karma others earned from the upvotes that are gone. The counters of the posts
+// of others they upvoted or commented on are counted again from the rows that are left
+func (ur *UserRepository) DeleteByID(ctx context.Context, userID int64, audit entity.AuditLog) error {
+	sql, args, err := squirrel.Delete("user").
+		Where("id = ?", userID).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	tx, err := ur.sqlRepo.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var postIDs []int64
+	err = tx.SelectContext(ctx, &postIDs, touchedPostsQuery, userID, userID, userID)
 	if err != nil {
-		return make([]entity.User, 0), err
+		return err
 	}
 
-	var users entity.Users
-	for rows.Next() {
-		var usr entity.User
-		err := rows.StructScan(&usr)
+	// the upvotes the user gave
+	for _, table := range []string{"post", "comment"} {
+		err = takeBackKarma(ctx, tx, table, squirrel.Eq{"u.user_id": userID})
 		if err != nil {
-			fmt.Println(err)
+			return err
 		}
-		users = append(users, usr)
 	}
 
-	return users, nil
+	// the upvotes others gave to the comments that go with the user
+	err = takeBackKarma(ctx, tx, "comment", squirrel.And{
+		squirrel.Expr(deletedCommentsExpr, userID, userID),
+		squirrel.NotEq{"u.user_id": userID},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = execAuditedTx(ctx, tx, sql, args, audit)
+	if err != nil {
+		return err
+	}
+
+	if len(postIDs) > 0 {
+		// assignments are evaluated left to right so hot_score sees the new upvote_count
+		usql, uargs, err := squirrel.Update("post").
+			Set("upvote_count", squirrel.Expr("(SELECT COUNT(*) FROM user_post_upvote WHERE user_post_upvote.post_id = post.id)")).
+			Set("comment_count", squirrel.Expr("(SELECT COUNT(*) FROM comment WHERE comment.post_id = post.id AND comment.deleted_at IS NULL)")).
+			Set("hot_score", squirrel.Expr(hotScoreExpr)).
+			Where(squirrel.Eq{"id": postIDs}).
+			ToSql()
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, usql, uargs...)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	invalidateFeed(ctx, ur.cache)
+	for _, postID := range postIDs {
+		invalidateCommentPages(ctx, ur.cache, postID)
+	}
+
+	return nil
+}
+
+// UpdateSuspended suspends or lifts the suspension of the user alongside its audit entry
+func (ur *UserRepository) UpdateSuspended(ctx context.Context, userID int64, suspended bool, audit entity.AuditLog) error {
+	var suspendedAt any
+	if suspended {
+		suspendedAt = squirrel.Expr("CURRENT_TIMESTAMP")
+	}
+
+	sql, args, err := squirrel.Update("user").
+		Set("suspended_at", suspendedAt).
+		Where("id = ?", userID).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	return ur.execAudited(ctx, sql, args, audit)
+}
+
+func (ur *UserRepository) UpdateAbout(ctx context.Context, userID int64, about string) error {
+	sql, args, err := squirrel.Update("user").
+		Set("about", about).
+		Where("id = ?", userID).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = ur.sqlRepo.DB.ExecContext(ctx, sql, args...)
+
+	return err
+}
+
+func (ur *UserRepository) MarkEmailVerified(ctx context.Context, userID int64) error {
+	sql, args, err := squirrel.Update("user").
+		Set("email_verified_at", squirrel.Expr("CURRENT_TIMESTAMP")).
+		Where("id = ?", userID).
+		Where(squirrel.Eq{"email_verified_at": nil}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = ur.sqlRepo.DB.ExecContext(ctx, sql, args...)
+
+	return err
+}
+
+func (ur *UserRepository) UpdatePassword(ctx context.Context, userID int64, hashedPassword string) error {
+	sql, args, err := squirrel.Update("user").
+		Set("password", hashedPassword).
+		Where("id = ?", userID).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = ur.sqlRepo.DB.ExecContext(ctx, sql, args...)
+
+	return err
+}
+
+// SetTOTPSecret stores the secret of an enrollment that is yet to be confirmed, it replaces the
+// secret of a previous unconfirmed enrollment and leaves enabled ones alone
+func (ur *UserRepository) SetTOTPSecret(ctx context.Context, userID int64, secret string) error {
+	sql, args, err := squirrel.Update("user").
+		Set("totp_secret", secret).
+		Where("id = ?", userID).
+		Where(squirrel.Eq{"totp_enabled_at": nil}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = ur.sqlRepo.DB.ExecContext(ctx, sql, args...)
+
+	return err
+}
+
+// EnableTOTP confirms the enrollment of secret and replaces the recovery codes of the user, it
+// fails with ErrTOTPNotEnrolled when secret is no longer the one waiting for confirmation
+func (ur *UserRepository) EnableTOTP(ctx context.Context, userID int64, secret string, recoveryCodeHashes []string) error {
+	sql, args, err := squirrel.Update("user").
+		Set("totp_enabled_at", squirrel.Expr("CURRENT_TIMESTAMP")).
+		Where("id = ?", userID).
+		Where(squirrel.Eq{"totp_secret": secret, "totp_enabled_at": nil}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	tx, err := ur.sqlRepo.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrTOTPNotEnrolled
+	}
+
+	err = replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DisableTOTP forgets the secret and the recovery codes of the user
+func (ur *UserRepository) DisableTOTP(ctx context.Context, userID int64) error {
+	sql, args, err := squirrel.Update("user").
+		Set("totp_secret", nil).
+		Set("totp_enabled_at", nil).
+		Where("id = ?", userID).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	tx, err := ur.sqlRepo.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+
+	err = replaceRecoveryCodes(ctx, tx, userID, nil)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ReplaceRecoveryCodes makes the codes the only recovery codes of the user
+func (ur *UserRepository) ReplaceRecoveryCodes(ctx context.Context, userID int64, recoveryCodeHashes []string) error {
+	tx, err := ur.sqlRepo.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ConsumeRecoveryCode deletes the code so it works once, unknown and already used codes fail
+// with ErrRecoveryCodeNotFound
+func (ur *UserRepository) ConsumeRecoveryCode(ctx context.Context, userID int64, recoveryCodeHash string) error {
+	sql, args, err := squirrel.Delete("user_recovery_code").
+		Where("user_id = ?", userID).
+		Where("code_hash = ?", recoveryCodeHash).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	result, err := ur.sqlRepo.DB.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecoveryCodeNotFound
+	}
+
+	return nil
+}
+
+func (ur *UserRepository) CountRecoveryCodes(ctx context.Context, userID int64) (int64, error) {
+	var count int64
+
+	err := ur.sqlRepo.DB.GetContext(ctx, &count, "select count(*) from user_recovery_code where user_id = ?", userID)
+
+	return count, err
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sqlx.Tx, userID int64, recoveryCodeHashes []string) error {
+	sql, args, err := squirrel.Delete("user_recovery_code").
+		Where("user_id = ?", userID).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+
+	if len(recoveryCodeHashes) == 0 {
+		return nil
+	}
+
+	query := squirrel.Insert("user_recovery_code").Columns("user_id", "code_hash")
+	for _, hash := range recoveryCodeHashes {
+		query = query.Values(userID, hash)
+	}
+
+	sql, args, err = query.ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, sql, args...)
+
+	return err
+}
+
+// updateAuthorKarma moves the karma of the author of the row id of table by delta, upvoting
+// your own posts and comments earns nothing
+func updateAuthorKarma(ctx context.Context, tx *sqlx.Tx, table string, id int64, voterID int64, delta int) error {
+	sql, args, err := squirrel.Update("user").
+		Set("karma", squirrel.Expr("karma + ?", delta)).
+		Where(squirrel.Expr("id = (SELECT user_id FROM `"+table+"` WHERE id = ?)", id)).
+		Where(squirrel.NotEq{"id": voterID}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, sql, args...)
+
+	return err
+}
+
+// takeBackKarma takes back from their authors the karma of the upvotes of the rows of table matched
+// by where, right before the rows are deleted and their upvotes go with them. where can filter on
+// the rows as t and on the upvotes as u. The upvotes are read with a locking read so none can be
+// given or taken back until the delete commits
+func takeBackKarma(ctx context.Context, tx *sqlx.Tx, table string, where squirrel.Sqlizer) error {
+	sql, args, err := squirrel.Select("t.user_id", "COUNT(*) AS upvotes").
+		From("user_" + table + "_upvote AS u").
+		Join("`" + table + "` AS t ON t.id = u." + table + "_id").
+		Where(where).
+		Where("u.user_id <> t.user_id").
+		GroupBy("t.user_id").
+		Suffix("FOR UPDATE").
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	var karma []struct {
+		UserID  int64 `db:"user_id"`
+		Upvotes int64 `db:"upvotes"`
+	}
+	err = tx.SelectContext(ctx, &karma, sql, args...)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range karma {
+		sql, args, err := squirrel.Update("user").
+			Set("karma", squirrel.Expr("karma - ?", k.Upvotes)).
+			Where("id = ?", k.UserID).
+			ToSql()
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, sql, args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// execAudited runs a single row change on a user alongside its audit entry
+func (ur *UserRepository) execAudited(ctx context.Context, sql string, args []any, audit entity.AuditLog) error {
+	tx, err := ur.sqlRepo.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = execAuditedTx(ctx, tx, sql, args, audit)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// execAuditedTx is execAudited within a transaction the caller commits
+func execAuditedTx(ctx context.Context, tx *sqlx.Tx, sql string, args []any, audit entity.AuditLog) error {
+	result, err := tx.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	return insertAuditLog(ctx, tx, audit)
 }
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"example.com/authorization/internal/repository/entity"
+	"example.com/authorization/internal/testutil"
+)
+
+func TestEscapeLikeMatchesWildcardsLiterally(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"bob":       "bob",
+		"50%":       `50\%`,
+		"snake_":    `snake\_`,
+		`back\lash`: `back\\lash`,
+	}
+
+	for in, want := range cases {
+		if got := escapeLike(in); got != want {
+			t.Fatalf("escapeLike(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestDeletingAUserRecountsThePostsTheyTouched(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cache, _ := testutil.NewCache(t)
+	sqlRepo := testutil.NewDB(t)
+	userRepo := NewUserRepository(sqlRepo, cache)
+	postRepo := NewPostRepository(sqlRepo, cache, time.Minute)
+	cr := NewCommentRepo(sqlRepo, cache)
+
+	authorID, postID := insertTestPost(t, sqlRepo, cache, "alice")
+	deletedID, _ := insertTestPost(t, sqlRepo, cache, "bob")
+
+	_, err := postRepo.Upvote(ctx, deletedID, postID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = cr.Insert(ctx, entity.Comment{UserID: deletedID, PostID: postID, Content: "by bob"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = cr.Insert(ctx, entity.Comment{UserID: authorID, PostID: postID, Content: "by alice"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	feed := PostListQuery{Order: PostOrderNew, Size: 10, Page: 1}
+	listPost := func() entity.Post {
+		t.Helper()
+
+		posts, err := postRepo.List(ctx, feed)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		for _, p := range posts {
+			if p.Id == postID {
+				return p
+			}
+		}
+
+		t.Fatalf("expected post %d in the feed, got %+v", postID, posts)
+		return entity.Post{}
+	}
+
+	// both pages are cached before the user goes
+	if p := listPost(); p.UpvoteCount != 1 || p.CommentCount != 2 {
+		t.Fatalf("expected 1 upvote and 2 comments, got %d and %d", p.UpvoteCount, p.CommentCount)
+	}
+	if comments := listTestComments(t, cr, postID); len(comments) != 2 {
+		t.Fatalf("expected 2 comments, got %d", len(comments))
+	}
+
+	err = userRepo.DeleteByID(ctx, deletedID, entity.AuditLog{
+		ActorID:    authorID,
+		Action:     "user.delete",
+		TargetType: "user",
+		TargetID:   deletedID,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	p := listPost()
+	if p.UpvoteCount != 0 || p.CommentCount != 1 || p.HotScore != 0 {
+		t.Errorf("expected no upvote, 1 comment and no hot score, got %d, %d and %v", p.UpvoteCount, p.CommentCount, p.HotScore)
+	}
+
+	if comments := listTestComments(t, cr, postID); len(comments) != 1 || comments[0].UserID != authorID {
+		t.Errorf("expected only the comment of alice, got %+v", comments)
+	}
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"example.com/authorization/internal/repository"
+	"example.com/authorization/pkg"
+)
+
+// VerifyEmail marks the email address the token was mailed to as verified
+func (us UserService) VerifyEmail(ctx context.Context, token string) error {
+	userID, err := us.tokenRepo.ConsumeOneTimeToken(ctx, repository.OneTimeTokenEmailVerification, hashToken(token))
+	if err != nil {
+		if errors.Is(err, repository.ErrOneTimeTokenNotFound) {
+			return errors.Join(ErrInvalidToken, err)
+		}
+
+		return err
+	}
+
+	return us.userRepo.MarkEmailVerified(ctx, userID)
+}
+
+// ResendEmailVerification mails a new verification link, the previous one stops working
+func (us UserService) ResendEmailVerification(ctx context.Context, userID int64) error {
+	eu, err := us.userRepo.GetOneByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !eu.Email.Valid {
+		return ErrInvalidEmail
+	}
+
+	if eu.EmailVerifiedAt.Valid {
+		return ErrEmailAlreadyVerified
+	}
+
+	return us.sendEmailVerification(ctx, userID, eu.Email.String)
+}
+
+// ForgotPassword mails a password reset link to the user registered with email. Nothing tells
+// the caller whether such a user exists, the mail is sent in the background for the same reason
+func (us UserService) ForgotPassword(ctx context.Context, email string) error {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return err
+	}
+
+	eu, err := us.userRepo.GetOneByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil
+		}
+
+		return err
+	}
+
+	token, err := us.issueOneTimeToken(ctx, repository.OneTimeTokenPasswordReset, eu.Id, us.passwordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	us.sendMail(ctx, pkg.Mail{
+		To:      email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nsomeone asked to reset the password of your account. Follow the link below to pick a new one:\n\n%s\n\n"+
+			"The link works for %s. If you did not ask for it you can ignore this mail, your password stays the same.\n",
+			eu.Username, us.link("/reset-password", token), us.passwordResetTTL),
+	})
+
+	return nil
+}
+
+// ResetPassword sets the password of the user the token was mailed to, every access
+// token the user holds stops working
+func (us UserService) ResetPassword(ctx context.Context, token string, password string) error {
+	hashedPassword, err := us.hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	userID, err := us.tokenRepo.ConsumeOneTimeToken(ctx, repository.OneTimeTokenPasswordReset, hashToken(token))
+	if err != nil {
+		if errors.Is(err, repository.ErrOneTimeTokenNotFound) {
+			return errors.Join(ErrInvalidToken, err)
+		}
+
+		return err
+	}
+
+	err = us.userRepo.UpdatePassword(ctx, userID, hashedPassword)
+	if err != nil {
+		return err
+	}
+
+	// the reset link proves the user controls the address as much as the verification link does
+	err = us.userRepo.MarkEmailVerified(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return us.authSrv.RevokeUserAccess(ctx, userID)
+}
+
+func (us UserService) sendEmailVerification(ctx context.Context, userID int64, email string) error {
+	token, err := us.issueOneTimeToken(ctx, repository.OneTimeTokenEmailVerification, userID, us.emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	us.sendMail(ctx, pkg.Mail{
+		To:      email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Welcome!\n\nFollow the link below to verify your email address:\n\n%s\n\nThe link works for %s.\n",
+			us.link("/verify-email", token), us.emailVerificationTTL),
+	})
+
+	return nil
+}
+
+// issueOneTimeToken returns a new single use token, only its hash is stored
+func (us UserService) issueOneTimeToken(ctx context.Context, purpose repository.OneTimeTokenPurpose, userID int64, ttl time.Duration) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = us.tokenRepo.StoreOneTimeToken(ctx, purpose, hashToken(token), userID, ttl)
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// sendMail delivers the mail in the background so a slow mail server does not hold the request
+func (us UserService) sendMail(ctx context.Context, m pkg.Mail) {
+	ctx = context.WithoutCancel(ctx)
+
+	go func() {
+		err := us.mailer.Send(ctx, m)
+		if err != nil {
+			slog.ErrorContext(ctx, "sending mail failed", "subject", m.Subject, "err", err)
+		}
+	}()
+}
+
+func (us UserService) link(path string, token string) string {
+	return us.publicURL + path + "?token=" + url.QueryEscape(token)
+}
+
+// normalizeEmail accepts a bare address only, display names and the like are refused
+func normalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", ErrInvalidEmail
+	}
+
+	return email, nil
+}
+
+// hashPassword checks the password against the policy before hashing it
+func (us UserService) hashPassword(password string) (string, error) {
+	err := us.policy.Validate(password)
+	if err != nil {
+		return "", errors.Join(ErrInvalidPassword, err)
+	}
+
+	return us.hasher.Hash(password)
+}
+
+// rehashPassword upgrades the stored hash of the password to the configured algorithm and cost,
+// the old hash keeps working when it fails
+func (us UserService) rehashPassword(ctx context.Context, userID int64, password string) {
+	hashedPassword, err := us.hasher.Hash(password)
+	if err == nil {
+		err = us.userRepo.UpdatePassword(ctx, userID, hashedPassword)
+	}
+
+	if err != nil {
+		slog.WarnContext(ctx, "upgrading the password hash failed", "userID", userID, "err", err)
+	}
+}
@@ -1,22 +1,447 @@
 package service
 
 import (
+	"cmp"
 	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"time"
 
+	"example.com/authorization/internal/domain"
 	"example.com/authorization/pkg"
+	"github.com/redis/go-redis/v9"
 )
 
+// analyticsBatchSize is the most writes sent to redis in a single pipeline
+const analyticsBatchSize = 256
+
+// every analytics key holds a single UTC day
+const (
+	// visitorsKeyPrefix holds a HyperLogLog of the client IPs
+	visitorsKeyPrefix = "analytics:visitors:"
+	// routeHitsKeyPrefix holds a hash of hit counters by route
+	routeHitsKeyPrefix = "analytics:routes:"
+	// postViewsKeyPrefix holds a sorted set of posts scored by views
+	postViewsKeyPrefix = "analytics:post_views:"
+)
+
+const (
+	// postViewCountsKey holds the all time view count of every post
+	postViewCountsKey = "post_view_counts"
+	// trendingKey holds a sorted set of posts scored by recent views and upvotes, the scores decay over time
+	trendingKey = "trending_posts"
+	// trendingDecayLockKey makes a single instance decay the trending scores per interval
+	trendingDecayLockKey = "trending_posts:decay_lock"
+	// postViewerKeyPrefix marks a viewer as counted for a post until the view window passes
+	postViewerKeyPrefix = "post_viewer:"
+	// postUpvoterKeyPrefix marks an upvote as counted for trending until the view window passes
+	postUpvoterKeyPrefix = "post_upvoter:"
+)
+
+// an upvote says more about a post than a view does
+const (
+	trendingViewWeight   = 1
+	trendingUpvoteWeight = 3
+)
+
+// trendingMinScore is the score under which decayed posts leave the trending set
+const trendingMinScore = 0.01
+
+// countPostViewScript counts a view of a post unless the viewer was already counted within the window
+//
+// KEYS: viewer marker, all time view counts, views of the day, trending
+// ARGV: window in seconds, post id, retention in seconds, trending weight
+var countPostViewScript = redis.NewScript(`
+if not redis.call('SET', KEYS[1], 1, 'NX', 'EX', ARGV[1]) then
+	return 0
+end
+redis.call('HINCRBY', KEYS[2], ARGV[2], 1)
+redis.call('ZINCRBY', KEYS[3], 1, ARGV[2])
+redis.call('EXPIRE', KEYS[3], ARGV[3])
+redis.call('ZINCRBY', KEYS[4], ARGV[4], ARGV[2])
+return 1
+`)
+
+// countPostUpvoteScript adds an upvote to the trending score unless the user was already counted within the window
+//
+// KEYS: upvoter marker, trending
+// ARGV: window in seconds, post id, trending weight
+var countPostUpvoteScript = redis.NewScript(`
+if not redis.call('SET', KEYS[1], 1, 'NX', 'EX', ARGV[1]) then
+	return 0
+end
+redis.call('ZINCRBY', KEYS[2], ARGV[3], ARGV[2])
+return 1
+`)
+
+// analyticsWrite is a queued analytics write, it is added to the pipeline of the next flush
+type analyticsWrite func(ctx context.Context, p redis.Pipeliner)
+
+// AnalyticsService records analytics without ever making a request wait on redis, writes are
+// queued and flushed in batches by Run. When the queue is full or redis is down they are dropped
 type AnalyticsService struct {
-	cache pkg.Cache
+	cache   pkg.Cache
+	writes  chan analyticsWrite
+	dropped *atomic.Int64
+	// retention is how long a day of analytics is kept
+	retention time.Duration
+	// viewWindow is how long a viewer counts as a single view of a post
+	viewWindow time.Duration
 }
 
-func NewAnalyticsService(cache pkg.Cache) AnalyticsService {
+func NewAnalyticsService(cache pkg.Cache, bufferSize int, retention time.Duration, viewWindow time.Duration) AnalyticsService {
+	if bufferSize <= 0 {
+		bufferSize = 1024
+	}
+
+	if retention <= 0 {
+		retention = 90 * 24 * time.Hour
+	}
+
+	if viewWindow < time.Second {
+		viewWindow = time.Hour
+	}
+
 	return AnalyticsService{
-		cache: cache,
+		cache:      cache,
+		writes:     make(chan analyticsWrite, bufferSize),
+		dropped:    &atomic.Int64{},
+		retention:  retention,
+		viewWindow: viewWindow,
+	}
+}
+
+// RegisterVisit counts ip as a visitor of today and a hit of route, an empty route only counts the visitor
+func (as AnalyticsService) RegisterVisit(ctx context.Context, ip string, route string) {
+	day := analyticsDay(time.Now())
+
+	as.enqueue(func(ctx context.Context, p redis.Pipeliner) {
+		p.PFAdd(ctx, visitorsKeyPrefix+day, ip)
+		p.Expire(ctx, visitorsKeyPrefix+day, as.retention)
+
+		if route != "" {
+			p.HIncrBy(ctx, routeHitsKeyPrefix+day, route, 1)
+			p.Expire(ctx, routeHitsKeyPrefix+day, as.retention)
+		}
+	})
+}
+
+// RegisterPostView counts a view of postID by viewer, a user or an IP, once per view window. Views count
+// towards the all time views of the post, the top posts of the day and trending
+func (as AnalyticsService) RegisterPostView(ctx context.Context, postID int64, viewer string) {
+	day := analyticsDay(time.Now())
+	id := strconv.FormatInt(postID, 10)
+
+	as.enqueue(func(ctx context.Context, p redis.Pipeliner) {
+		countPostViewScript.Eval(ctx, p,
+			[]string{postViewerKeyPrefix + id + ":" + viewer, postViewCountsKey, postViewsKeyPrefix + day, trendingKey},
+			int64(as.viewWindow/time.Second), id, int64(as.retention/time.Second), trendingViewWeight,
+		)
+	})
+}
+
+// RegisterPostUpvote lets an upvote of userID push postID up the trending posts, once per view window
+func (as AnalyticsService) RegisterPostUpvote(ctx context.Context, postID int64, userID int64) {
+	id := strconv.FormatInt(postID, 10)
+
+	as.enqueue(func(ctx context.Context, p redis.Pipeliner) {
+		countPostUpvoteScript.Eval(ctx, p,
+			[]string{postUpvoterKeyPrefix + id + ":" + strconv.FormatInt(userID, 10), trendingKey},
+			int64(as.viewWindow/time.Second), id, trendingUpvoteWeight,
+		)
+	})
+}
+
+// ForgetPost drops a deleted post from the view counts and trending
+func (as AnalyticsService) ForgetPost(ctx context.Context, postID int64) {
+	id := strconv.FormatInt(postID, 10)
+
+	as.enqueue(func(ctx context.Context, p redis.Pipeliner) {
+		p.HDel(ctx, postViewCountsKey, id)
+		p.ZRem(ctx, trendingKey, id)
+	})
+}
+
+// PostViews returns the all time view counts of the posts, posts nobody viewed are left out
+func (as AnalyticsService) PostViews(ctx context.Context, postIDs []int64) (map[int64]uint64, error) {
+	views := make(map[int64]uint64, len(postIDs))
+	if len(postIDs) == 0 {
+		return views, nil
+	}
+
+	fields := make([]string, len(postIDs))
+	for i, id := range postIDs {
+		fields[i] = strconv.FormatInt(id, 10)
+	}
+
+	values, err := as.cache.Client.HMGet(ctx, postViewCountsKey, fields...).Result()
+	if err != nil {
+		return views, err
+	}
+
+	for i, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return views, err
+		}
+
+		views[postIDs[i]] = n
+	}
+
+	return views, nil
+}
+
+// TrendingPostIDs returns a page of the trending posts, the most trending first
+func (as AnalyticsService) TrendingPostIDs(ctx context.Context, size uint64, page uint64) ([]int64, error) {
+	start := int64((page - 1) * size)
+	members, err := as.cache.Client.ZRevRange(ctx, trendingKey, start, start+int64(size)-1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, 0, len(members))
+	for _, m := range members {
+		id, err := strconv.ParseInt(m, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// DecayTrending halves the trending scores every halfLife so old views and upvotes fade away,
+// it blocks until ctx is done. Every instance runs it but only one decays the scores per interval
+func (as AnalyticsService) DecayTrending(ctx context.Context, interval time.Duration, halfLife time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	factor := math.Pow(0.5, float64(interval)/float64(halfLife))
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// the lock expires a little before the next tick so a late instance can not skip a round
+		locked, err := as.cache.Client.SetNX(ctx, trendingDecayLockKey, 1, interval*9/10).Result()
+		if err != nil || !locked {
+			if err != nil && !errors.Is(err, pkg.ErrCircuitOpen) {
+				slog.ErrorContext(ctx, "could not decay trending posts", "err", err)
+			}
+
+			continue
+		}
+
+		_, err = as.cache.Client.Pipelined(ctx, func(p redis.Pipeliner) error {
+			p.ZUnionStore(ctx, trendingKey, &redis.ZStore{
+				Keys:    []string{trendingKey},
+				Weights: []float64{factor},
+			})
+			p.ZRemRangeByScore(ctx, trendingKey, "-inf", "("+strconv.FormatFloat(trendingMinScore, 'f', -1, 64))
+
+			return nil
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "could not decay trending posts", "err", err)
+		}
+	}
+}
+
+// Report returns the analytics of the days from from to to, both included, with the top most viewed posts
+func (as AnalyticsService) Report(ctx context.Context, from time.Time, to time.Time, top int64) (domain.AnalyticsReport, error) {
+	from = from.UTC().Truncate(24 * time.Hour)
+	to = to.UTC().Truncate(24 * time.Hour)
+
+	days := int(to.Sub(from)/(24*time.Hour)) + 1
+	if days < 1 || time.Duration(days)*24*time.Hour > as.retention {
+		return domain.AnalyticsReport{}, ErrInvalidDateRange
+	}
+
+	report := domain.AnalyticsReport{
+		From: from,
+		To:   to,
+		Days: make([]domain.DailyVisitors, 0, days),
+	}
+
+	visitorsKeys := make([]string, 0, days)
+	routeHitsKeys := make([]string, 0, days)
+	postViewsKeys := make([]string, 0, days)
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		day := analyticsDay(d)
+		visitorsKeys = append(visitorsKeys, visitorsKeyPrefix+day)
+		routeHitsKeys = append(routeHitsKeys, routeHitsKeyPrefix+day)
+		postViewsKeys = append(postViewsKeys, postViewsKeyPrefix+day)
+	}
+
+	// the views of the range are summed into a scratch key so only the top posts leave redis
+	topKey := postViewsKeyPrefix + "report:" + strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	var dailyVisitors []*redis.IntCmd
+	var routeHits []*redis.MapStringStringCmd
+	var uniqueVisitors *redis.IntCmd
+	var topPosts *redis.ZSliceCmd
+	_, err := as.cache.Client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for i := range visitorsKeys {
+			dailyVisitors = append(dailyVisitors, p.PFCount(ctx, visitorsKeys[i]))
+			routeHits = append(routeHits, p.HGetAll(ctx, routeHitsKeys[i]))
+		}
+
+		// counting several HyperLogLogs at once counts their union
+		uniqueVisitors = p.PFCount(ctx, visitorsKeys...)
+
+		p.ZUnionStore(ctx, topKey, &redis.ZStore{
+			Keys:      postViewsKeys,
+			Aggregate: "SUM",
+		})
+		topPosts = p.ZRevRangeWithScores(ctx, topKey, 0, top-1)
+		p.Del(ctx, topKey)
+
+		return nil
+	})
+	if err != nil {
+		return domain.AnalyticsReport{}, err
+	}
+
+	report.UniqueVisitors = uniqueVisitors.Val()
+
+	hitsByRoute := map[string]int64{}
+	for i, d := 0, from; i < days; i, d = i+1, d.AddDate(0, 0, 1) {
+		report.Days = append(report.Days, domain.DailyVisitors{
+			Date:           d,
+			UniqueVisitors: dailyVisitors[i].Val(),
+		})
+
+		for route, hits := range routeHits[i].Val() {
+			n, err := strconv.ParseInt(hits, 10, 64)
+			if err != nil {
+				return domain.AnalyticsReport{}, err
+			}
+
+			hitsByRoute[route] += n
+		}
+	}
+
+	for route, hits := range hitsByRoute {
+		report.Routes = append(report.Routes, domain.RouteHits{
+			Route: route,
+			Hits:  hits,
+		})
+	}
+	slices.SortFunc(report.Routes, func(a, b domain.RouteHits) int {
+		return cmp.Or(cmp.Compare(b.Hits, a.Hits), cmp.Compare(a.Route, b.Route))
+	})
+
+	for _, z := range topPosts.Val() {
+		member, _ := z.Member.(string)
+		postID, err := strconv.ParseInt(member, 10, 64)
+		if err != nil {
+			return domain.AnalyticsReport{}, err
+		}
+
+		report.TopPosts = append(report.TopPosts, domain.PostViews{
+			PostID: postID,
+			Views:  int64(z.Score),
+		})
+	}
+
+	return report, nil
+}
+
+// Dropped returns how many analytics writes were lost so far
+func (as AnalyticsService) Dropped() int64 {
+	return as.dropped.Load()
+}
+
+// Run flushes the queued writes every interval and whenever a full batch is waiting, until ctx is done
+func (as AnalyticsService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	batch := make([]analyticsWrite, 0, analyticsBatchSize)
+	for {
+		select {
+		case <-ctx.Done():
+			as.drain(context.WithoutCancel(ctx), batch)
+			return
+		case w := <-as.writes:
+			batch = append(batch, w)
+			if len(batch) < analyticsBatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+
+		as.flush(ctx, batch)
+		batch = batch[:0]
+	}
+}
+
+func (as AnalyticsService) enqueue(w analyticsWrite) {
+	select {
+	case as.writes <- w:
+	default:
+		as.dropped.Add(1)
+	}
+}
+
+// drain flushes batch and whatever is still queued, so shutting down does not lose the last writes
+func (as AnalyticsService) drain(ctx context.Context, batch []analyticsWrite) {
+	for {
+		select {
+		case w := <-as.writes:
+			batch = append(batch, w)
+			if len(batch) < analyticsBatchSize {
+				continue
+			}
+		default:
+			as.flush(ctx, batch)
+			return
+		}
+
+		as.flush(ctx, batch)
+		batch = batch[:0]
+	}
+}
+
+func (as AnalyticsService) flush(ctx context.Context, batch []analyticsWrite) {
+	if len(batch) == 0 {
+		return
+	}
+
+	_, err := as.cache.Client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for _, w := range batch {
+			w(ctx, p)
+		}
+
+		return nil
+	})
+	if err == nil {
+		return
+	}
+
+	// retrying would only pile up writes behind a redis that is not coming back soon
+	as.dropped.Add(int64(len(batch)))
+	if !errors.Is(err, pkg.ErrCircuitOpen) {
+		slog.Warn("dropping analytics writes", "count", len(batch), "error", err)
 	}
 }
 
-func (as AnalyticsService) RegisterIP(ctx context.Context, ip string) error {
-	err := as.cache.Client.SAdd(ctx, "ip_addresses", ip).Err()
-	return err
+func analyticsDay(t time.Time) string {
+	return t.UTC().Format(domain.AnalyticsDateLayout)
 }
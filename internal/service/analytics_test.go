@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"example.com/authorization/internal/domain"
+	"example.com/authorization/internal/testutil"
+)
+
+func TestVisitorsAndRouteHitsAreCountedPerDay(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cache, _ := testutil.NewCache(t)
+	as := NewAnalyticsService(cache, 16, 7*24*time.Hour, time.Hour)
+
+	today := time.Now().UTC()
+	yesterday := today.AddDate(0, 0, -1)
+
+	// yesterday is written straight to redis, visits are only ever registered for today
+	err := cache.Client.PFAdd(ctx, visitorsKeyPrefix+analyticsDay(yesterday), "10.0.0.8", "10.0.0.9").Err()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = cache.Client.HIncrBy(ctx, routeHitsKeyPrefix+analyticsDay(yesterday), "GET /api/v1/posts", 2).Err()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		as.Run(runCtx, time.Hour)
+		close(done)
+	}()
+
+	as.RegisterVisit(ctx, "10.0.0.1", "GET /api/v1/posts")
+	as.RegisterVisit(ctx, "10.0.0.1", "GET /api/v1/posts")
+	as.RegisterVisit(ctx, "10.0.0.2", "GET /api/v1/posts/:postId")
+	as.RegisterVisit(ctx, "10.0.0.3", "")
+
+	// the queued writes are flushed once Run stops
+	cancel()
+	<-done
+
+	report, err := as.Report(ctx, yesterday, today, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(report.Days) != 2 {
+		t.Fatalf("expected 2 days, got %d", len(report.Days))
+	}
+
+	if report.Days[0].UniqueVisitors != 2 {
+		t.Errorf("expected 2 visitors yesterday, got %d", report.Days[0].UniqueVisitors)
+	}
+
+	if report.Days[1].UniqueVisitors != 3 {
+		t.Errorf("expected 3 visitors today, got %d", report.Days[1].UniqueVisitors)
+	}
+
+	// miniredis sums the counts of several HyperLogLogs instead of counting their union, so the
+	// visitors of the two days are kept apart
+	if report.UniqueVisitors != 5 {
+		t.Errorf("expected 5 visitors over the range, got %d", report.UniqueVisitors)
+	}
+
+	expectedRoutes := []domain.RouteHits{
+		{Route: "GET /api/v1/posts", Hits: 4},
+		{Route: "GET /api/v1/posts/:postId", Hits: 1},
+	}
+	if len(report.Routes) != len(expectedRoutes) {
+		t.Fatalf("expected routes %v, got %v", expectedRoutes, report.Routes)
+	}
+
+	for i := range expectedRoutes {
+		if report.Routes[i] != expectedRoutes[i] {
+			t.Errorf("expected routes %v, got %v", expectedRoutes, report.Routes)
+			break
+		}
+	}
+}
+
+func TestReportRefusesInvalidDateRanges(t *testing.T) {
+	t.Parallel()
+
+	cache, _ := testutil.NewCache(t)
+	as := NewAnalyticsService(cache, 16, 7*24*time.Hour, time.Hour)
+	to := time.Date(2024, 3, 10, 15, 4, 5, 0, time.UTC)
+
+	cases := []struct {
+		name  string
+		from  time.Time
+		valid bool
+	}{
+		{name: "single day", from: to, valid: true},
+		{name: "whole retention", from: to.AddDate(0, 0, -6), valid: true},
+		{name: "beyond the retention", from: to.AddDate(0, 0, -7)},
+		{name: "from after to", from: to.AddDate(0, 0, 1)},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := as.Report(context.Background(), tc.from, to, 10)
+			if tc.valid && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !tc.valid && !errors.Is(err, ErrInvalidDateRange) {
+				t.Fatalf("expected ErrInvalidDateRange, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package service
+
+import (
+	"context"
+
+	"example.com/authorization/internal/domain"
+	"example.com/authorization/internal/repository"
+)
+
+type AuditService struct {
+	auditRepo repository.AuditRepository
+}
+
+func NewAuditService(auditRepo repository.AuditRepository) AuditService {
+	return AuditService{
+		auditRepo: auditRepo,
+	}
+}
+
+func (as AuditService) List(ctx context.Context, size uint64, page uint64) ([]domain.AuditLog, error) {
+	logs, err := as.auditRepo.List(ctx, size, page)
+	if err != nil {
+		return make([]domain.AuditLog, 0), err
+	}
+
+	return domain.NewAuditLogsFromEntities(logs), nil
+}
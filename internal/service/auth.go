@@ -1,11 +1,20 @@
 package service
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"log/slog"
 	"strconv"
 	"time"
 
+	"example.com/authorization/internal/domain"
 	"example.com/authorization/internal/repository"
+	"example.com/authorization/pkg"
 	"github.com/golang-jwt/jwt/v5"
 )
 
@@ -16,32 +25,87 @@ func (ts TokenString) Print() {
 	fmt.Println(ts)
 }
 
+const tokenIssuer = "hacker-news-clone"
+
+type TokenPair struct {
+	AccessToken  TokenString
+	RefreshToken TokenString
+	ExpiresIn    time.Duration
+}
+
 type AuthService struct {
 	jwtSecret string
-	userRepo  repository.UserRepository
+	// keys signs tokens with RS256 or EdDSA when signing key files are configured,
+	// otherwise tokens are signed with HS256 using jwtSecret
+	keys            *KeySet
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+	userRepo        repository.UserRepository
+	tokenRepo       repository.TokenRepository
 }
 
-func NewAuthorizationService(jwtSecret string, userRepo repository.UserRepository) AuthService {
+func NewAuthorizationService(cfg pkg.Config, keys *KeySet, userRepo repository.UserRepository, tokenRepo repository.TokenRepository) AuthService {
 	return AuthService{
-		jwtSecret: jwtSecret,
-		userRepo:  userRepo,
+		jwtSecret:       cfg.JwtSecret,
+		keys:            keys,
+		accessTokenTTL:  cfg.AccessTokenTTL,
+		refreshTokenTTL: cfg.RefreshTokenTTL,
+		userRepo:        userRepo,
+		tokenRepo:       tokenRepo,
 	}
 }
 
-func (as AuthService) GenerateToken(userId int64) (TokenString, error) {
+// Claims are the access token claims, the role is the one the user had when the token was issued.
+// Changing the role revokes the tokens so it is trusted as long as the token is valid
+type Claims struct {
+	jwt.RegisteredClaims
+	Role string `json:"role,omitempty"`
+}
+
+func (as AuthService) GenerateToken(userId int64, role domain.Role) (TokenString, error) {
+	return as.generateToken(userId, role, time.Now())
+}
+
+// generateToken issues an access token stamped with issuedAt, it is only later than now for the
+// tokens issued within the second the user's tokens were revoked in
+func (as AuthService) generateToken(userId int64, role domain.Role, issuedAt time.Time) (TokenString, error) {
+	tokenID, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	var method jwt.SigningMethod = jwt.SigningMethodHS256
+	var signingKey any = []byte(as.jwtSecret)
+	var kid string
+	if as.keys != nil {
+		key, err := as.keys.signer()
+		if err != nil {
+			return "", err
+		}
+
+		method, signingKey, kid = key.method, key.private, key.kid
+	}
+
 	userIdStr := strconv.FormatInt(userId, 10)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		// A usual scenario is to set the expiration time relative to the current time
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		NotBefore: jwt.NewNumericDate(time.Now()),
-		Issuer:    "test",
-		Subject:   userIdStr,
-		ID:        "0",
-		Audience:  []string{},
+	token := jwt.NewWithClaims(method, Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			// A usual scenario is to set the expiration time relative to the current time
+			ExpiresAt: jwt.NewNumericDate(issuedAt.Add(as.accessTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+			Issuer:    tokenIssuer,
+			Subject:   userIdStr,
+			ID:        tokenID,
+			Audience:  []string{},
+		},
+		Role: string(role),
 	})
 
-	tokenString, err := token.SignedString([]byte(as.jwtSecret))
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	tokenString, err := token.SignedString(signingKey)
 	if err != nil {
 		return "", err
 	}
@@ -49,17 +113,289 @@ func (as AuthService) GenerateToken(userId int64) (TokenString, error) {
 	return TokenString(tokenString), nil
 }
 
-func (as AuthService) ValidateToken(token string) (jwt.Token, error) {
-	jwtToken, err := jwt.Parse(token, func(t *jwt.Token) (any, error) {
-		return []byte(as.jwtSecret), nil
-	})
+// PublicKeys returns the keys other services can verify tokens with, there are none when tokens are signed with a shared secret
+func (as AuthService) PublicKeys() []domain.PublicKey {
+	if as.keys == nil {
+		return make([]domain.PublicKey, 0)
+	}
+
+	return as.keys.PublicKeys()
+}
+
+// IssueTokens starts a new refresh token family for the user
+func (as AuthService) IssueTokens(ctx context.Context, userID int64) (TokenPair, error) {
+	family, err := randomToken()
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	issuedAt, err := as.issueTime(ctx, userID)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	return as.issueTokens(ctx, repository.RefreshToken{
+		UserID:   userID,
+		Family:   family,
+		IssuedAt: issuedAt,
+	}, issuedAt)
+}
+
+// RefreshTokens rotates the refresh token, the presented token can not be used again
+func (as AuthService) RefreshTokens(ctx context.Context, refreshToken string) (TokenPair, error) {
+	rt, err := as.tokenRepo.ConsumeRefreshToken(ctx, hashToken(refreshToken), as.refreshTokenTTL)
+	if err != nil {
+		if errors.Is(err, repository.ErrRefreshTokenNotFound) || errors.Is(err, repository.ErrRefreshTokenReused) {
+			return TokenPair{}, errors.Join(ErrInvalidToken, err)
+		}
+
+		return TokenPair{}, err
+	}
+
+	revoked, err := as.issuedBeforeRevocation(ctx, rt.UserID, jwt.NewNumericDate(rt.IssuedAt))
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	if revoked {
+		return TokenPair{}, ErrInvalidToken
+	}
+
+	issuedAt, err := as.issueTime(ctx, rt.UserID)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	return as.issueTokens(ctx, rt, issuedAt)
+}
+
+// Logout revokes the access token and the refresh token family it was issued with
+func (as AuthService) Logout(ctx context.Context, accessToken string, refreshToken string) error {
+	token, err := as.ValidateToken(ctx, accessToken)
+	if err != nil {
+		return err
+	}
+
+	claims, ok := token.Claims.(*Claims)
+	if !ok || claims.ExpiresAt == nil {
+		return ErrInvalidToken
+	}
+
+	err = as.tokenRepo.RevokeAccessToken(ctx, claims.ID, time.Until(claims.ExpiresAt.Time))
+	if err != nil {
+		return err
+	}
+
+	if refreshToken == "" {
+		return nil
+	}
+
+	rt, err := as.tokenRepo.ConsumeRefreshToken(ctx, hashToken(refreshToken), as.refreshTokenTTL)
 	if err != nil {
-		return jwt.Token{}, err
+		if errors.Is(err, repository.ErrRefreshTokenNotFound) || errors.Is(err, repository.ErrRefreshTokenReused) {
+			return nil
+		}
+
+		return err
+	}
+
+	return as.tokenRepo.RevokeRefreshFamily(ctx, rt.Family)
+}
+
+func (as AuthService) ValidateToken(ctx context.Context, token string) (jwt.Token, error) {
+	jwtToken, err := jwt.ParseWithClaims(token, &Claims{}, as.verificationKey, jwt.WithIssuer(tokenIssuer))
+	if err != nil {
+		return jwt.Token{}, errors.Join(ErrInvalidToken, err)
+	}
+
+	claims, ok := jwtToken.Claims.(*Claims)
+	if !ok || claims.ID == "" {
+		return jwt.Token{}, ErrInvalidToken
+	}
+
+	revoked, err := as.tokenRepo.IsAccessTokenRevoked(ctx, claims.ID)
+	if err != nil {
+		// only logged out tokens are missed, they expire soon anyway
+		slog.WarnContext(ctx, "checking the revoked access tokens failed, letting the token through", "err", err)
+	}
+
+	if revoked {
+		return jwt.Token{}, ErrInvalidToken
 	}
 
 	return *jwtToken, nil
 }
 
+// Authorize validates the access token and returns who it was issued for with the role it carries,
+// the database is left alone on the way of every request. Demotions, suspensions and deletions
+// revoke the tokens the user holds instead, and the user is only read to tell a suspension from
+// the other revocations or when the revocations can not be checked
+func (as AuthService) Authorize(ctx context.Context, token string) (domain.Actor, error) {
+	jwtToken, err := as.ValidateToken(ctx, token)
+	if err != nil {
+		return domain.Actor{}, err
+	}
+
+	claims := jwtToken.Claims.(*Claims)
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return domain.Actor{}, errors.Join(ErrInvalidToken, err)
+	}
+
+	role := domain.Role(claims.Role)
+	if !role.IsValid() {
+		role = domain.RoleUser
+	}
+
+	actor := domain.Actor{
+		UserID: userID,
+		Role:   role,
+	}
+
+	revoked, err := as.issuedBeforeRevocation(ctx, userID, claims.IssuedAt)
+	if err != nil {
+		// the suspensions are read from the database instead, only the tokens revoked by a
+		// password reset or a role change are missed until redis is back
+		slog.WarnContext(ctx, "checking the revoked user tokens failed, reading the user instead", "userID", userID, "err", err)
+	}
+
+	if err == nil && !revoked {
+		return actor, nil
+	}
+
+	user, err := as.userRepo.GetOneByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return domain.Actor{}, errors.Join(ErrInvalidToken, err)
+		}
+
+		return domain.Actor{}, err
+	}
+
+	// suspended users are told so, the tokens revoked otherwise are merely invalid
+	if user.SuspendedAt.Valid {
+		return domain.Actor{}, errors.Join(ErrInvalidToken, ErrUserSuspended)
+	}
+
+	if revoked {
+		return domain.Actor{}, ErrInvalidToken
+	}
+
+	return actor, nil
+}
+
+// RevokeUserAccess invalidates every access and refresh token the user holds, the user has to log in again
+func (as AuthService) RevokeUserAccess(ctx context.Context, userID int64) error {
+	// the mark has to outlive the longest lived token it revokes
+	return as.tokenRepo.RevokeUserTokens(ctx, userID, max(as.accessTokenTTL, as.refreshTokenTTL))
+}
+
+// issuedBeforeRevocation tells whether a token issued at issuedAt was revoked by RevokeUserAccess,
+// tokens are stamped to the second and the ones of the second the access was revoked in are
+func (as AuthService) issuedBeforeRevocation(ctx context.Context, userID int64, issuedAt *jwt.NumericDate) (bool, error) {
+	revokedAt, err := as.tokenRepo.UserTokensRevokedAt(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	if revokedAt.IsZero() {
+		return false, nil
+	}
+
+	return issuedAt == nil || !issuedAt.Time.After(revokedAt), nil
+}
+
+// issueTime is what tokens issued now are stamped with, a second after the revocation for the
+// ones issued within the second the user's tokens were revoked in, like the login right after
+// a password reset
+func (as AuthService) issueTime(ctx context.Context, userID int64) (time.Time, error) {
+	now := time.Now().Truncate(time.Second)
+
+	revokedAt, err := as.tokenRepo.UserTokensRevokedAt(ctx, userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if !now.After(revokedAt) {
+		return revokedAt.Add(time.Second), nil
+	}
+
+	return now, nil
+}
+
+// verificationKey picks the key by the kid header and makes sure the token is signed
+// with the algorithm of that key, a shared secret is only accepted when no key files are configured
+func (as AuthService) verificationKey(t *jwt.Token) (any, error) {
+	if as.keys == nil {
+		if t.Method != jwt.SigningMethodHS256 {
+			return nil, ErrInvalidToken
+		}
+
+		return []byte(as.jwtSecret), nil
+	}
+
+	kid, _ := t.Header["kid"].(string)
+	key, err := as.keys.verifier(kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.Method.Alg() != key.method.Alg() {
+		return nil, ErrInvalidToken
+	}
+
+	return key.public, nil
+}
+
+func (as AuthService) issueTokens(ctx context.Context, rt repository.RefreshToken, issuedAt time.Time) (TokenPair, error) {
+	// the role is read again on every refresh so role changes reach the next access token
+	user, err := as.userRepo.GetOneByID(ctx, rt.UserID)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	if user.SuspendedAt.Valid {
+		return TokenPair{}, ErrUserSuspended
+	}
+
+	accessToken, err := as.generateToken(rt.UserID, domain.Role(user.Role), issuedAt)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	refreshToken, err := randomToken()
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	err = as.tokenRepo.StoreRefreshToken(ctx, hashToken(refreshToken), rt, as.refreshTokenTTL)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	return TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: TokenString(refreshToken),
+		ExpiresIn:    as.accessTokenTTL,
+	}, nil
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// only the hash of a refresh token is stored so a leaked redis dump can not be replayed
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 // TODO: move this to service layer
 // hashBytes, err := bcrypt.GenerateFromPassword([]byte(password), 4)
 // if err != nil {
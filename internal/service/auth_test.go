@@ -0,0 +1,243 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"example.com/authorization/internal/domain"
+	"example.com/authorization/internal/repository"
+	"example.com/authorization/internal/repository/entity"
+	"example.com/authorization/internal/testutil"
+	"example.com/authorization/pkg"
+	"github.com/alicebob/miniredis/v2"
+)
+
+// testAuth is an AuthService alongside what it stores its state in
+type testAuth struct {
+	AuthService
+	db       pkg.SQLRepository
+	userRepo repository.UserRepository
+	redis    *miniredis.Miniredis
+}
+
+func newTestAuth(t *testing.T) testAuth {
+	t.Helper()
+
+	cache, mr := testutil.NewCache(t)
+	db := testutil.NewDB(t)
+	userRepo := repository.NewUserRepository(db, cache)
+
+	return testAuth{
+		AuthService: NewAuthorizationService(pkg.Config{
+			JwtSecret:       "secret",
+			AccessTokenTTL:  time.Minute,
+			RefreshTokenTTL: time.Hour,
+		}, nil, userRepo, repository.NewTokenRepository(cache)),
+		db:       db,
+		userRepo: userRepo,
+		redis:    mr,
+	}
+}
+
+// newUser creates a user and an access token of theirs
+func (ta testAuth) newUser(t *testing.T, username string) (int64, string) {
+	t.Helper()
+
+	userID, err := ta.userRepo.Insert(context.Background(), username, username+"@example.com", "hash")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	token, err := ta.GenerateToken(userID, domain.RoleUser)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return userID, string(token)
+}
+
+func (ta testAuth) suspend(t *testing.T, userID int64) {
+	t.Helper()
+
+	err := ta.userRepo.UpdateSuspended(context.Background(), userID, true, entity.AuditLog{
+		ActorID:    userID,
+		Action:     string(domain.AuditActionSuspendUser),
+		TargetType: string(domain.AuditTargetUser),
+		TargetID:   userID,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestRevokedTokensAreRefusedAndNewOnesAccepted(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ta := newTestAuth(t)
+	userID, token := ta.newUser(t, "alice")
+
+	err := ta.RevokeUserAccess(ctx, userID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = ta.Authorize(ctx, token)
+	if !errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrUserSuspended) {
+		t.Fatalf("expected ErrInvalidToken alone, got %v", err)
+	}
+
+	// issued within the same second, like the login right after a password reset
+	fresh, err := ta.IssueTokens(ctx, userID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	actor, err := ta.Authorize(ctx, string(fresh.AccessToken))
+	if err != nil {
+		t.Fatalf("expected the token issued after the revocation to be accepted, got %v", err)
+	}
+
+	if actor.UserID != userID {
+		t.Fatalf("expected user %d, got %d", userID, actor.UserID)
+	}
+
+	_, err = ta.RefreshTokens(ctx, string(fresh.RefreshToken))
+	if err != nil {
+		t.Fatalf("expected the refresh token issued after the revocation to be accepted, got %v", err)
+	}
+}
+
+func TestSuspendedUsersAreToldSo(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ta := newTestAuth(t)
+	userID, token := ta.newUser(t, "alice")
+
+	ta.suspend(t, userID)
+
+	err := ta.RevokeUserAccess(ctx, userID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = ta.Authorize(ctx, token)
+	if !errors.Is(err, ErrInvalidToken) || !errors.Is(err, ErrUserSuspended) {
+		t.Fatalf("expected ErrInvalidToken and ErrUserSuspended, got %v", err)
+	}
+}
+
+func TestAuthorizeChecksTheSuspensionWhenRedisIsDown(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ta := newTestAuth(t)
+	userID, token := ta.newUser(t, "alice")
+	suspendedID, suspendedToken := ta.newUser(t, "bob")
+	ta.suspend(t, suspendedID)
+
+	ta.redis.Close()
+
+	actor, err := ta.Authorize(ctx, token)
+	if err != nil {
+		t.Fatalf("expected the token to be accepted without redis, got %v", err)
+	}
+
+	if actor.UserID != userID {
+		t.Fatalf("expected user %d, got %d", userID, actor.UserID)
+	}
+
+	_, err = ta.Authorize(ctx, suspendedToken)
+	if !errors.Is(err, ErrUserSuspended) {
+		t.Fatalf("expected ErrUserSuspended without redis, got %v", err)
+	}
+}
+
+func TestAuthorizeTakesTheRoleFromTheTokenWithoutTheDatabase(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ta := newTestAuth(t)
+	userID, _ := ta.newUser(t, "alice")
+
+	token, err := ta.GenerateToken(userID, domain.RoleModerator)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ta.db.DB.Close()
+
+	actor, err := ta.Authorize(ctx, string(token))
+	if err != nil {
+		t.Fatalf("expected the token to be authorized without the database, got %v", err)
+	}
+
+	if actor.UserID != userID || actor.Role != domain.RoleModerator {
+		t.Fatalf("expected user %d as a moderator, got %+v", userID, actor)
+	}
+}
+
+func TestRoleChangesRevokeTheTokensOfTheUser(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	tu := newTestUsers(t)
+	admin := domain.Actor{UserID: 1, Role: domain.RoleAdmin}
+	userID, _ := tu.auth.newUser(t, "alice")
+
+	token, err := tu.auth.GenerateToken(userID, domain.RoleModerator)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// made a moderator, which the token was issued for, and demoted again
+	err = tu.UpdateRole(ctx, admin, userID, domain.RoleModerator)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = tu.UpdateRole(ctx, admin, userID, domain.RoleUser)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = tu.auth.Authorize(ctx, string(token))
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected the token of the previous role to be refused, got %v", err)
+	}
+
+	tokens, err := tu.auth.IssueTokens(ctx, userID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	actor, err := tu.auth.Authorize(ctx, string(tokens.AccessToken))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if actor.Role != domain.RoleUser {
+		t.Fatalf("expected the new role once logged in again, got %s", actor.Role)
+	}
+}
+
+func TestTokensOfDeletedUsersAreRefused(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	tu := newTestUsers(t)
+	userID, token := tu.auth.newUser(t, "alice")
+
+	err := tu.Delete(ctx, domain.Actor{UserID: 1, Role: domain.RoleAdmin}, userID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = tu.auth.Authorize(ctx, token)
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected ErrInvalidToken, got %v", err)
+	}
+}
@@ -2,18 +2,30 @@ package service
 
 import (
 	"context"
+	"strconv"
+	"time"
 
 	"example.com/authorization/internal/domain"
 	"example.com/authorization/internal/repository"
+	"example.com/authorization/internal/repository/entity"
+	"example.com/authorization/pkg"
+)
+
+const (
+	flatCommentsCursorSort   = "comments"
+	threadCommentsCursorSort = "thread"
 )
 
 type CommentService struct {
 	commentRepo repository.CommentRepo
+	// editWindow is how long comments can be edited after being posted, zero means forever
+	editWindow time.Duration
 }
 
-func NewCommentService(commentRepo repository.CommentRepo) CommentService {
+func NewCommentService(commentRepo repository.CommentRepo, editWindow time.Duration) CommentService {
 	return CommentService{
 		commentRepo: commentRepo,
+		editWindow:  editWindow,
 	}
 }
 
@@ -21,8 +33,39 @@ func (us CommentService) Create(ctx context.Context, comment domain.Comment) (in
 	return us.commentRepo.Insert(ctx, comment.ToEntity())
 }
 
-func (us CommentService) ListPostComments(ctx context.Context, postID int64, filters domain.CommentFilters) ([]domain.Comment, error) {
-	cs, err := us.commentRepo.List(ctx, postID, filters.Size, filters.Page)
+// ListPostComments returns a page of comments oldest first alongside the cursor of the next page,
+// hidden comments are only listed for moderators and their author
+func (us CommentService) ListPostComments(ctx context.Context, viewer domain.Actor, postID int64, filters domain.CommentFilters) ([]domain.Comment, string, error) {
+	var afterID int64
+	if filters.Cursor != "" {
+		cursor, err := pkg.DecodeCursor(filters.Cursor, flatCommentsCursorSort)
+		if err != nil {
+			return make([]domain.Comment, 0), "", err
+		}
+
+		afterID = cursor.ID
+	}
+
+	cs, err := us.commentRepo.List(ctx, postID, filters.Size, filters.Page, afterID, commentViewer(viewer))
+	if err != nil {
+		return make([]domain.Comment, 0), "", err
+	}
+
+	var nextCursor string
+	if uint64(len(cs)) == filters.Size {
+		nextCursor = pkg.Cursor{
+			Sort: flatCommentsCursorSort,
+			Key:  strconv.FormatInt(cs[len(cs)-1].Id, 10),
+			ID:   cs[len(cs)-1].Id,
+		}.Encode()
+	}
+
+	return domain.NewCommentsFromEntities(cs), nextCursor, nil
+}
+
+// ListUserComments returns the latest comments of the user that are still visible to everyone
+func (us CommentService) ListUserComments(ctx context.Context, userID int64, size uint64) ([]domain.Comment, error) {
+	cs, err := us.commentRepo.ListByUser(ctx, userID, size)
 	if err != nil {
 		return make([]domain.Comment, 0), err
 	}
@@ -30,10 +73,164 @@ func (us CommentService) ListPostComments(ctx context.Context, postID int64, fil
 	return domain.NewCommentsFromEntities(cs), nil
 }
 
-func (us CommentService) Delete(ctx context.Context, userID int64, commentID int64) error {
-	return us.commentRepo.DeleteByID(ctx, userID, commentID)
+func (us CommentService) Reply(ctx context.Context, comment domain.Comment) (int64, error) {
+	return us.commentRepo.InsertReply(ctx, comment.ToEntity())
+}
+
+// ListPostCommentTree returns a page of top level comments with their replies nested up to filters.Depth levels
+func (us CommentService) ListPostCommentTree(ctx context.Context, viewer domain.Actor, postID int64, filters domain.CommentFilters) ([]domain.Comment, string, error) {
+	return listCommentTree(ctx, us.commentRepo, viewer, postID, filters)
+}
+
+// Delete lets authors delete their comments and moderators delete anyone's, the latter is audited
+func (us CommentService) Delete(ctx context.Context, actor domain.Actor, commentID int64) error {
+	ce, err := us.commentRepo.GetByID(ctx, commentID)
+	if err != nil {
+		return err
+	}
+
+	if !actor.CanModify(ce.UserID, domain.PermissionDeleteAnyComment) {
+		return ErrPermissionDenied
+	}
+
+	var audit *entity.AuditLog
+	if actor.IsModerating(ce.UserID) {
+		al := domain.NewAuditLog(actor, domain.AuditActionDeleteComment, domain.AuditTargetComment, commentID, map[string]any{
+			"ownerId": ce.UserID,
+			"postId":  ce.PostID,
+			"content": ce.Content,
+		})
+		ale := al.ToEntity()
+		audit = &ale
+	}
+
+	return us.commentRepo.DeleteByID(ctx, commentID, audit)
+}
+
+// Edit replaces the content of a comment, only its author can edit it and only within the edit window.
+// Every edit keeps the previous content as a revision
+func (us CommentService) Edit(ctx context.Context, userID int64, commentID int64, content string) (domain.Comment, error) {
+	ce, err := us.commentRepo.GetByID(ctx, commentID)
+	if err != nil {
+		return domain.Comment{}, err
+	}
+
+	if ce.UserID != userID {
+		return domain.Comment{}, ErrPermissionDenied
+	}
+
+	if us.editWindow > 0 && time.Since(ce.CreatedAt.Time) > us.editWindow {
+		return domain.Comment{}, ErrEditWindowClosed
+	}
+
+	if content == "" {
+		return domain.Comment{}, ErrInvalidEdit
+	}
+
+	if content == ce.Content {
+		return domain.NewCommentFromEntity(ce), nil
+	}
+
+	edited := ce
+	edited.Content = content
+	err = us.commentRepo.Update(ctx, edited, userID)
+	if err != nil {
+		return domain.Comment{}, err
+	}
+
+	ce, err = us.commentRepo.GetByID(ctx, commentID)
+	if err != nil {
+		return domain.Comment{}, err
+	}
+
+	return domain.NewCommentFromEntity(ce), nil
+}
+
+// ListRevisions returns the comment alongside its previous versions, they are visible to the author and moderators
+func (us CommentService) ListRevisions(ctx context.Context, actor domain.Actor, commentID int64) (domain.Comment, []domain.CommentRevision, error) {
+	ce, err := us.commentRepo.GetByID(ctx, commentID)
+	if err != nil {
+		return domain.Comment{}, make([]domain.CommentRevision, 0), err
+	}
+
+	if !actor.CanModify(ce.UserID, domain.PermissionModerateFlags) {
+		return domain.Comment{}, make([]domain.CommentRevision, 0), ErrPermissionDenied
+	}
+
+	revisions, err := us.commentRepo.ListRevisions(ctx, commentID)
+	if err != nil {
+		return domain.Comment{}, make([]domain.CommentRevision, 0), err
+	}
+
+	return domain.NewCommentFromEntity(ce), domain.NewCommentRevisionsFromEntities(revisions), nil
 }
 
 func (us CommentService) Upvote(ctx context.Context, userID int64, commentID int64) (bool, error) {
 	return us.commentRepo.Upvote(ctx, userID, commentID)
 }
+
+// listCommentTree reads a page of the top level comments of the post, the highest scored first, with
+// their replies nested up to filters.Depth levels. The cursor holds the score and id of the last top
+// level comment of the page
+func listCommentTree(ctx context.Context, commentRepo repository.CommentRepo, viewer domain.Actor, postID int64, filters domain.CommentFilters) ([]domain.Comment, string, error) {
+	q := repository.CommentThreadQuery{
+		PostID:   postID,
+		MaxDepth: filters.Depth,
+		Size:     filters.Size,
+		Page:     filters.Page,
+		Viewer:   commentViewer(viewer),
+	}
+
+	if filters.Cursor != "" {
+		cursor, err := pkg.DecodeCursor(filters.Cursor, threadCommentsCursorSort)
+		if err != nil {
+			return make([]domain.Comment, 0), "", err
+		}
+
+		q.After = &cursor
+	}
+
+	cs, err := commentRepo.ListThread(ctx, q)
+	if err != nil {
+		return make([]domain.Comment, 0), "", err
+	}
+
+	// the rows come in no particular order, the last top level comment is the lowest scored one
+	var roots uint64
+	var last entity.Comment
+	for _, ce := range cs {
+		if ce.ParentID.Valid {
+			continue
+		}
+
+		if roots == 0 || ce.VoteCount < last.VoteCount || (ce.VoteCount == last.VoteCount && ce.Id > last.Id) {
+			last = ce
+		}
+		roots++
+	}
+
+	var nextCursor string
+	if roots == filters.Size {
+		nextCursor = pkg.Cursor{
+			Sort: threadCommentsCursorSort,
+			Key:  strconv.FormatUint(last.VoteCount, 10),
+			ID:   last.Id,
+		}.Encode()
+	}
+
+	tree := domain.NewCommentTreeFromEntities(cs)
+	if tree == nil {
+		tree = make([]domain.Comment, 0)
+	}
+
+	return tree, nextCursor, nil
+}
+
+// commentViewer is who the comments of a listing are for, hidden comments are visible to moderators
+// and to their author
+func commentViewer(viewer domain.Actor) repository.CommentViewer {
+	return repository.CommentViewer{
+		UserID:    viewer.UserID,
+		Moderator: viewer.Role.Can(domain.PermissionModerateFlags),
+	}
+}
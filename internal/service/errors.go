@@ -5,3 +5,29 @@ import "errors"
 var ErrUserAlreadyRegistered = errors.New("user already registered")
 var ErrUserNotFound = errors.New("user not found")
 var ErrWrongCredentials = errors.New("wrong credentials")
+var ErrInvalidToken = errors.New("invalid token")
+var ErrPermissionDenied = errors.New("permission denied")
+var ErrInvalidRole = errors.New("invalid role")
+var ErrInvalidFlagReason = errors.New("invalid flag reason")
+var ErrInvalidFlagResolution = errors.New("invalid flag resolution")
+var ErrEmptySearchQuery = errors.New("empty search query")
+var ErrEditWindowClosed = errors.New("edit window closed")
+var ErrInvalidEdit = errors.New("invalid edit")
+var ErrInvalidDateRange = errors.New("invalid date range")
+var ErrUserSuspended = errors.New("user suspended")
+var ErrSuspendSelf = errors.New("cannot suspend yourself")
+var ErrInvalidEmail = errors.New("invalid email")
+var ErrEmailAlreadyRegistered = errors.New("email already registered")
+var ErrEmailAlreadyVerified = errors.New("email already verified")
+var ErrInvalidPassword = errors.New("invalid password")
+var ErrTooManyLoginAttempts = errors.New("too many login attempts")
+var ErrMFAAlreadyEnabled = errors.New("two-factor authentication already enabled")
+var ErrMFANotEnabled = errors.New("two-factor authentication not enabled")
+var ErrMFANotEnrolled = errors.New("no authenticator enrollment to confirm")
+var ErrInvalidMFACode = errors.New("invalid two-factor code")
+var ErrUnknownOAuthProvider = errors.New("unknown oauth provider")
+var ErrOAuthProviderUnavailable = errors.New("oauth provider unavailable")
+var ErrInvalidOAuthState = errors.New("invalid oauth state")
+var ErrOAuthFailed = errors.New("oauth login failed")
+var ErrIdentityLinkedElsewhere = errors.New("identity linked to another user")
+var ErrAboutTooLong = errors.New("about text too long")
@@ -0,0 +1,283 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/authorization/internal/domain"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrNoSigningKey = errors.New("no signing key")
+var ErrUnknownKey = errors.New("unknown signing key")
+
+type signingKey struct {
+	kid    string
+	method jwt.SigningMethod
+	// private is an *rsa.PrivateKey or an ed25519.PrivateKey
+	private crypto.PrivateKey
+	public  crypto.PublicKey
+}
+
+// scheduleFile names the manifest of the key directory mapping kids to the time their key starts
+// signing, as in {"2025-ed25519": "2025-06-01T00:00:00Z"}
+const scheduleFile = "schedule.json"
+
+// KeySet holds the asymmetric signing keys loaded from a directory of PEM files, the file
+// name without extension is the kid. The key signing tokens is the one with the latest
+// activation time in the schedule of the directory that has passed, the others verify the
+// tokens they signed before. Rotating is done by dropping a new key file into the directory
+// with its activation time in the schedule, which publishes it in the JWKS right away and
+// switches signing to it once the time has come, and removing the old file once its tokens
+// expired. activeKid, when set, signs until a scheduled key takes over
+type KeySet struct {
+	dir       string
+	activeKid string
+	// publishLead is how long a key picked up after startup is published before it signs, so
+	// verifiers get the time to refresh their cached key sets even when it was scheduled late
+	publishLead time.Duration
+	now         func() time.Time
+
+	mu       sync.RWMutex
+	keys     map[string]signingKey
+	schedule map[string]time.Time
+	// publishedAt is when a key was first loaded, the zero time for the keys found at startup
+	// since the other replicas have been publishing them already
+	publishedAt map[string]time.Time
+}
+
+func NewKeySet(dir string, activeKid string, publishLead time.Duration) (*KeySet, error) {
+	ks := &KeySet{
+		dir:         dir,
+		activeKid:   activeKid,
+		publishLead: publishLead,
+		now:         time.Now,
+	}
+
+	err := ks.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return ks, nil
+}
+
+// Reload reads the key directory and its schedule again, keys of removed files stop verifying
+// tokens. The keys are kept as they were when none of the new ones can sign
+func (ks *KeySet) Reload() error {
+	paths, err := filepath.Glob(filepath.Join(ks.dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]signingKey, len(paths))
+	for _, path := range paths {
+		key, err := loadSigningKey(path)
+		if err != nil {
+			return fmt.Errorf("could not load signing key %s: %w", path, err)
+		}
+
+		keys[key.kid] = key
+	}
+
+	schedule, err := loadSchedule(filepath.Join(ks.dir, scheduleFile))
+	if err != nil {
+		return fmt.Errorf("could not load signing key schedule: %w", err)
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	now := ks.now()
+	publishedAt := make(map[string]time.Time, len(keys))
+	for kid := range keys {
+		at, ok := ks.publishedAt[kid]
+		if !ok && ks.keys != nil {
+			at = now
+		}
+		publishedAt[kid] = at
+	}
+
+	previous, _ := ks.active(now)
+	oldKeys, oldSchedule, oldPublishedAt := ks.keys, ks.schedule, ks.publishedAt
+	ks.keys, ks.schedule, ks.publishedAt = keys, schedule, publishedAt
+
+	key, ok := ks.active(now)
+	if !ok {
+		ks.keys, ks.schedule, ks.publishedAt = oldKeys, oldSchedule, oldPublishedAt
+		return fmt.Errorf("%w in %s: no key of the schedule is active and %q is missing", ErrNoSigningKey, ks.dir, ks.activeKid)
+	}
+
+	if previous.kid != key.kid {
+		slog.Info("signing tokens with a new key", "kid", key.kid)
+	}
+
+	return nil
+}
+
+// ReloadEvery picks up rotated key files, it blocks until ctx is done
+func (ks *KeySet) ReloadEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// a scheduled key takes over on its own, the reload only picks up new files
+			err := ks.Reload()
+			if err != nil {
+				slog.ErrorContext(ctx, "could not reload signing keys", "err", err)
+			}
+		}
+	}
+}
+
+// signer returns the active key
+func (ks *KeySet) signer() (signingKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	key, ok := ks.active(ks.now())
+	if !ok {
+		return signingKey{}, ErrNoSigningKey
+	}
+
+	return key, nil
+}
+
+// active returns the key with the latest activation time that has passed at now, activeKid
+// counts as activated since forever. A key only becomes active publishLead after it was
+// published, ks.mu has to be held
+func (ks *KeySet) active(now time.Time) (signingKey, bool) {
+	var active signingKey
+	var activatedAt time.Time
+	found := false
+
+	for kid, key := range ks.keys {
+		at, scheduled := ks.schedule[kid]
+		if !scheduled && kid != ks.activeKid {
+			continue
+		}
+
+		if now.Before(at) || now.Before(ks.publishedAt[kid].Add(ks.publishLead)) {
+			continue
+		}
+
+		if !found || at.After(activatedAt) || (at.Equal(activatedAt) && kid > active.kid) {
+			active, activatedAt, found = key, at, true
+		}
+	}
+
+	return active, found
+}
+
+func (ks *KeySet) verifier(kid string) (signingKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	key, ok := ks.keys[kid]
+	if !ok {
+		return signingKey{}, ErrUnknownKey
+	}
+
+	return key, nil
+}
+
+// PublicKeys returns every key that can verify tokens, ordered by kid
+func (ks *KeySet) PublicKeys() []domain.PublicKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	pks := make([]domain.PublicKey, 0, len(ks.keys))
+	for _, key := range ks.keys {
+		pks = append(pks, domain.PublicKey{
+			Kid:       key.kid,
+			Algorithm: key.method.Alg(),
+			Key:       key.public,
+		})
+	}
+
+	sort.Slice(pks, func(i, j int) bool {
+		return pks[i].Kid < pks[j].Kid
+	})
+
+	return pks
+}
+
+// loadSchedule reads the activation times of the keys, a directory without a schedule has none
+func loadSchedule(path string) (map[string]time.Time, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var schedule map[string]time.Time
+	err = json.Unmarshal(b, &schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	return schedule, nil
+}
+
+func loadSigningKey(path string) (signingKey, error) {
+	pemBytes, err := os.ReadFile(path)
+	if err != nil {
+		return signingKey{}, err
+	}
+
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return signingKey{}, errors.New("no PEM data found")
+	}
+
+	var private any
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		err = fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return signingKey{}, err
+	}
+
+	key := signingKey{
+		kid:     strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+		private: private,
+	}
+
+	switch pk := private.(type) {
+	case *rsa.PrivateKey:
+		key.method = jwt.SigningMethodRS256
+		key.public = &pk.PublicKey
+	case ed25519.PrivateKey:
+		key.method = jwt.SigningMethodEdDSA
+		key.public = pk.Public()
+	default:
+		return signingKey{}, fmt.Errorf("unsupported key type %T", private)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,377 @@
+package service
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"example.com/authorization/internal/domain"
+	"example.com/authorization/internal/repository"
+	"example.com/authorization/internal/testutil"
+	"example.com/authorization/pkg"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func writeRSAKey(t *testing.T, dir string, kid string) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	writeKeyFile(t, dir, kid, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+func writeEd25519Key(t *testing.T, dir string, kid string) {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	writeKeyFile(t, dir, kid, &pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func writeKeyFile(t *testing.T, dir string, kid string, block *pem.Block) {
+	t.Helper()
+
+	err := os.WriteFile(filepath.Join(dir, kid+".pem"), pem.EncodeToMemory(block), 0o600)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func newTestAuthService(t *testing.T, keys *KeySet) AuthService {
+	t.Helper()
+
+	cache, _ := testutil.NewCache(t)
+
+	// signing and validating tokens never reads the users
+	return NewAuthorizationService(pkg.Config{
+		JwtSecret:       "secret",
+		AccessTokenTTL:  time.Minute,
+		RefreshTokenTTL: time.Hour,
+	}, keys, repository.NewUserRepository(pkg.SQLRepository{}, cache), repository.NewTokenRepository(cache))
+}
+
+func TestKeySetLoadsEveryKeyFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeRSAKey(t, dir, "2024-rsa")
+	writeEd25519Key(t, dir, "2025-ed25519")
+
+	// not a key, it is left alone
+	err := os.WriteFile(filepath.Join(dir, "README"), []byte("keys"), 0o600)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ks, err := NewKeySet(dir, "2025-ed25519", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	pks := ks.PublicKeys()
+	if len(pks) != 2 {
+		t.Fatalf("expected 2 public keys, got %d", len(pks))
+	}
+
+	if pks[0].Kid != "2024-rsa" || pks[0].Algorithm != "RS256" || pks[1].Kid != "2025-ed25519" || pks[1].Algorithm != "EdDSA" {
+		t.Fatalf("unexpected public keys %+v", pks)
+	}
+}
+
+func TestKeySetRefusesAMissingActiveKey(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeRSAKey(t, dir, "2024-rsa")
+
+	_, err := NewKeySet(dir, "2025-rsa", 0)
+	if !errors.Is(err, ErrNoSigningKey) {
+		t.Fatalf("expected ErrNoSigningKey, got %v", err)
+	}
+
+	_, err = NewKeySet(t.TempDir(), "2024-rsa", 0)
+	if !errors.Is(err, ErrNoSigningKey) {
+		t.Fatalf("expected ErrNoSigningKey for an empty directory, got %v", err)
+	}
+}
+
+func TestKeySetSignsWithTheConfiguredKeyOnly(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeRSAKey(t, dir, "2024-rsa")
+	writeEd25519Key(t, dir, "2025-ed25519")
+
+	// the newest file, which must not matter
+	future := time.Now().Add(time.Hour)
+	err := os.Chtimes(filepath.Join(dir, "2025-ed25519.pem"), future, future)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ks, err := NewKeySet(dir, "2024-rsa", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	token, err := newTestAuthService(t, ks).GenerateToken(1, domain.RoleUser)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(string(token), &Claims{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if parsed.Header["kid"] != "2024-rsa" || parsed.Method.Alg() != "RS256" {
+		t.Fatalf("expected the token to be signed with 2024-rsa, got kid %v alg %s", parsed.Header["kid"], parsed.Method.Alg())
+	}
+}
+
+func TestTokensOfRetiredKeysVerifyUntilTheKeyFileIsRemoved(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeRSAKey(t, dir, "2024-rsa")
+	writeEd25519Key(t, dir, "2025-ed25519")
+
+	before, err := NewKeySet(dir, "2024-rsa", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	token, err := newTestAuthService(t, before).GenerateToken(1, domain.RoleUser)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the deployment switched to the new key
+	after, err := NewKeySet(dir, "2025-ed25519", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	as := newTestAuthService(t, after)
+
+	_, err = as.ValidateToken(ctx, string(token))
+	if err != nil {
+		t.Fatalf("expected a token of the retired key to verify, got %v", err)
+	}
+
+	err = os.Remove(filepath.Join(dir, "2024-rsa.pem"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = after.Reload()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = as.ValidateToken(ctx, string(token))
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected ErrInvalidToken once the key file is gone, got %v", err)
+	}
+}
+
+func TestKeySetReloadKeepsTheKeysWithoutTheActiveOne(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeRSAKey(t, dir, "2024-rsa")
+
+	ks, err := NewKeySet(dir, "2024-rsa", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = os.Remove(filepath.Join(dir, "2024-rsa.pem"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = ks.Reload()
+	if !errors.Is(err, ErrNoSigningKey) {
+		t.Fatalf("expected ErrNoSigningKey, got %v", err)
+	}
+
+	_, err = ks.signer()
+	if err != nil {
+		t.Fatalf("expected the loaded keys to be kept, got %v", err)
+	}
+}
+
+func writeSchedule(t *testing.T, dir string, schedule map[string]time.Time) {
+	t.Helper()
+
+	b, err := json.Marshal(schedule)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, "schedule.json"), b, 0o600)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func signingKid(t *testing.T, ks *KeySet) string {
+	t.Helper()
+
+	token, err := newTestAuthService(t, ks).GenerateToken(1, domain.RoleUser)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(string(token), &Claims{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	kid, _ := parsed.Header["kid"].(string)
+
+	return kid
+}
+
+func TestKeySetSwitchesSigningKeyOnSchedule(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	dir := t.TempDir()
+	writeRSAKey(t, dir, "2024-rsa")
+	writeEd25519Key(t, dir, "2025-ed25519")
+	writeSchedule(t, dir, map[string]time.Time{
+		"2024-rsa":     now.Add(-24 * time.Hour),
+		"2025-ed25519": now.Add(time.Hour),
+	})
+
+	ks, err := NewKeySet(dir, "", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ks.now = func() time.Time { return now }
+
+	if kid := signingKid(t, ks); kid != "2024-rsa" {
+		t.Fatalf("expected 2024-rsa to sign before the switch, got %q", kid)
+	}
+
+	// the upcoming key is published ahead of signing
+	if pks := ks.PublicKeys(); len(pks) != 2 {
+		t.Fatalf("expected both keys in the JWKS, got %+v", pks)
+	}
+
+	// no reload is needed for the switch
+	now = now.Add(time.Hour)
+
+	if kid := signingKid(t, ks); kid != "2025-ed25519" {
+		t.Fatalf("expected 2025-ed25519 to sign once its time came, got %q", kid)
+	}
+}
+
+func TestKeySetScheduleTakesOverFromTheConfiguredKey(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	dir := t.TempDir()
+	writeRSAKey(t, dir, "2024-rsa")
+	writeEd25519Key(t, dir, "2025-ed25519")
+	writeSchedule(t, dir, map[string]time.Time{
+		"2025-ed25519": now.Add(time.Hour),
+	})
+
+	ks, err := NewKeySet(dir, "2024-rsa", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ks.now = func() time.Time { return now }
+
+	if kid := signingKid(t, ks); kid != "2024-rsa" {
+		t.Fatalf("expected the configured key to sign, got %q", kid)
+	}
+
+	now = now.Add(2 * time.Hour)
+
+	if kid := signingKid(t, ks); kid != "2025-ed25519" {
+		t.Fatalf("expected the scheduled key to take over, got %q", kid)
+	}
+}
+
+func TestKeySetPublishesKeysAddedLaterBeforeSigningWithThem(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	dir := t.TempDir()
+	writeRSAKey(t, dir, "2024-rsa")
+	writeSchedule(t, dir, map[string]time.Time{
+		"2024-rsa": now.Add(-24 * time.Hour),
+	})
+
+	ks, err := NewKeySet(dir, "", 10*time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ks.now = func() time.Time { return now }
+
+	// the keys found at startup are already published
+	if kid := signingKid(t, ks); kid != "2024-rsa" {
+		t.Fatalf("expected 2024-rsa to sign, got %q", kid)
+	}
+
+	// scheduled late, its time has already passed when the file shows up
+	writeEd25519Key(t, dir, "2025-ed25519")
+	writeSchedule(t, dir, map[string]time.Time{
+		"2024-rsa":     now.Add(-24 * time.Hour),
+		"2025-ed25519": now.Add(-time.Minute),
+	})
+
+	err = ks.Reload()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if kid := signingKid(t, ks); kid != "2024-rsa" {
+		t.Fatalf("expected the new key to wait until it was published long enough, got %q", kid)
+	}
+
+	now = now.Add(10 * time.Minute)
+
+	if kid := signingKid(t, ks); kid != "2025-ed25519" {
+		t.Fatalf("expected 2025-ed25519 to sign after the publish lead, got %q", kid)
+	}
+}
+
+func TestKeySetRefusesAScheduleWithoutAnActiveKey(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeRSAKey(t, dir, "2025-rsa")
+	writeSchedule(t, dir, map[string]time.Time{
+		"2025-rsa": time.Now().Add(time.Hour),
+	})
+
+	_, err := NewKeySet(dir, "", 0)
+	if !errors.Is(err, ErrNoSigningKey) {
+		t.Fatalf("expected ErrNoSigningKey, got %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"example.com/authorization/internal/repository"
+	"example.com/authorization/pkg"
+)
+
+// LoginLockedError is returned instead of checking the credentials while the account or the client IP is locked out
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e LoginLockedError) Error() string {
+	return "too many failed logins, retry after " + e.RetryAfter.String()
+}
+
+func (e LoginLockedError) Is(target error) bool {
+	return target == ErrTooManyLoginAttempts
+}
+
+type LoginGuardStats struct {
+	AccountLockouts int64 `json:"accountLockouts"`
+	IPLockouts      int64 `json:"ipLockouts"`
+	// Rejected counts the logins refused during a lockout
+	Rejected int64 `json:"rejected"`
+}
+
+// LoginGuard counts failed logins per account and per client IP and locks them out with an
+// exponential backoff. Failures are counted for unknown usernames too so they can not be told
+// apart from existing ones. Redis being unavailable lets every login through
+type LoginGuard struct {
+	loginAttemptRepo repository.LoginAttemptRepository
+	accountPolicy    repository.LockoutPolicy
+	ipPolicy         repository.LockoutPolicy
+
+	accountLockouts *atomic.Int64
+	ipLockouts      *atomic.Int64
+	rejected        *atomic.Int64
+}
+
+func NewLoginGuard(cfg pkg.Config, loginAttemptRepo repository.LoginAttemptRepository) LoginGuard {
+	return LoginGuard{
+		loginAttemptRepo: loginAttemptRepo,
+		accountPolicy: repository.LockoutPolicy{
+			MaxFailures: cfg.LoginMaxAccountFailures,
+			Window:      cfg.LoginFailureWindow,
+			BaseLockout: cfg.LoginLockoutBase,
+			MaxLockout:  cfg.LoginLockoutMax,
+		},
+		ipPolicy: repository.LockoutPolicy{
+			MaxFailures: cfg.LoginMaxIPFailures,
+			Window:      cfg.LoginFailureWindow,
+			BaseLockout: cfg.LoginLockoutBase,
+			MaxLockout:  cfg.LoginLockoutMax,
+		},
+		accountLockouts: &atomic.Int64{},
+		ipLockouts:      &atomic.Int64{},
+		rejected:        &atomic.Int64{},
+	}
+}
+
+func (lg LoginGuard) Stats() LoginGuardStats {
+	return LoginGuardStats{
+		AccountLockouts: lg.accountLockouts.Load(),
+		IPLockouts:      lg.ipLockouts.Load(),
+		Rejected:        lg.rejected.Load(),
+	}
+}
+
+// Check returns a LoginLockedError while the account or the IP is locked out
+func (lg LoginGuard) Check(ctx context.Context, username string, ip string) error {
+	lockedFor, err := lg.loginAttemptRepo.LockedFor(ctx, accountAttemptKey(username), ipAttemptKey(ip))
+	if err != nil {
+		slog.WarnContext(ctx, "checking login lockouts failed, letting the login through", "err", err)
+		return nil
+	}
+
+	if lockedFor <= 0 {
+		return nil
+	}
+
+	lg.rejected.Add(1)
+
+	return LoginLockedError{RetryAfter: lockedFor}
+}
+
+// RegisterFailure counts the failed login, it returns a LoginLockedError when the failure
+// locked the account or the IP out
+func (lg LoginGuard) RegisterFailure(ctx context.Context, username string, ip string) error {
+	var retryAfter time.Duration
+
+	for _, attempt := range []struct {
+		key      repository.LoginAttemptKey
+		policy   repository.LockoutPolicy
+		lockouts *atomic.Int64
+	}{
+		{accountAttemptKey(username), lg.accountPolicy, lg.accountLockouts},
+		{ipAttemptKey(ip), lg.ipPolicy, lg.ipLockouts},
+	} {
+		failures, lockout, err := lg.loginAttemptRepo.RegisterFailure(ctx, attempt.key, attempt.policy)
+		if err != nil {
+			slog.WarnContext(ctx, "counting a failed login failed", "scope", attempt.key.Scope, "err", err)
+			continue
+		}
+
+		if lockout <= 0 {
+			continue
+		}
+
+		attempt.lockouts.Add(1)
+		slog.WarnContext(ctx, "login locked out", "scope", attempt.key.Scope, "username", username, "ip", ip, "failures", failures, "lockout", lockout)
+
+		retryAfter = max(retryAfter, lockout)
+	}
+
+	if retryAfter <= 0 {
+		return nil
+	}
+
+	return LoginLockedError{RetryAfter: retryAfter}
+}
+
+// RegisterSuccess forgets the failures of the account, the ones of the IP are kept so
+// logging into an account of their own does not let an attacker carry on guessing others
+func (lg LoginGuard) RegisterSuccess(ctx context.Context, username string) {
+	err := lg.loginAttemptRepo.Reset(ctx, accountAttemptKey(username))
+	if err != nil {
+		slog.WarnContext(ctx, "resetting the failed logins failed", "err", err)
+	}
+}
+
+// usernames are compared case insensitively by the database and can be anything a client
+// sends, the key holds a hash of the lowercased one
+func accountAttemptKey(username string) repository.LoginAttemptKey {
+	sum := sha256.Sum256([]byte(strings.ToLower(username)))
+
+	return repository.LoginAttemptKey{
+		Scope: repository.LoginAttemptAccount,
+		ID:    hex.EncodeToString(sum[:]),
+	}
+}
+
+func ipAttemptKey(ip string) repository.LoginAttemptKey {
+	return repository.LoginAttemptKey{
+		Scope: repository.LoginAttemptIP,
+		ID:    ip,
+	}
+}
@@ -0,0 +1,314 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"example.com/authorization/internal/repository"
+	"example.com/authorization/internal/repository/entity"
+	"example.com/authorization/pkg"
+)
+
+const (
+	recoveryCodeCount = 10
+	// 80 bits, they are written as four groups of four base32 characters
+	recoveryCodeBytes = 10
+)
+
+// TOTPEnrollment is what the user loads into their authenticator app, URI is the payload of the QR code
+type TOTPEnrollment struct {
+	Secret string
+	URI    string
+}
+
+type MFAStatus struct {
+	Enabled bool
+	// Enrolling is set while an enrollment waits to be confirmed with a code
+	Enrolling         bool
+	RecoveryCodesLeft int64
+}
+
+func (us UserService) MFAStatus(ctx context.Context, userID int64) (MFAStatus, error) {
+	eu, err := us.userRepo.GetOneByID(ctx, userID)
+	if err != nil {
+		return MFAStatus{}, err
+	}
+
+	if !eu.TOTPEnabledAt.Valid {
+		return MFAStatus{Enrolling: eu.TOTPSecret.Valid}, nil
+	}
+
+	left, err := us.userRepo.CountRecoveryCodes(ctx, userID)
+	if err != nil {
+		return MFAStatus{}, err
+	}
+
+	return MFAStatus{
+		Enabled:           true,
+		RecoveryCodesLeft: left,
+	}, nil
+}
+
+// EnrollTOTP provisions a new secret for the user, logins only ask for a code once one
+// generated from it was confirmed with EnableTOTP
+func (us UserService) EnrollTOTP(ctx context.Context, userID int64) (TOTPEnrollment, error) {
+	eu, err := us.userRepo.GetOneByID(ctx, userID)
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+
+	if eu.TOTPEnabledAt.Valid {
+		return TOTPEnrollment{}, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := pkg.NewTOTPSecret()
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+
+	err = us.userRepo.SetTOTPSecret(ctx, userID, secret)
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+
+	return TOTPEnrollment{
+		Secret: secret,
+		URI:    pkg.TOTPURI(us.totpIssuer, eu.Username, secret),
+	}, nil
+}
+
+// EnableTOTP confirms the enrollment with a code from the authenticator app and returns the
+// recovery codes, they are shown this once and only their hashes are stored
+func (us UserService) EnableTOTP(ctx context.Context, userID int64, code string) ([]string, error) {
+	eu, err := us.userRepo.GetOneByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if eu.TOTPEnabledAt.Valid {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	if !eu.TOTPSecret.Valid {
+		return nil, ErrMFANotEnrolled
+	}
+
+	err = us.verifyTOTPCode(ctx, userID, eu.TOTPSecret.String, code)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	err = us.userRepo.EnableTOTP(ctx, userID, eu.TOTPSecret.String, hashes)
+	if err != nil {
+		if errors.Is(err, repository.ErrTOTPNotEnrolled) {
+			// enrolled again since the secret was read
+			return nil, errors.Join(ErrMFANotEnrolled, err)
+		}
+
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// DisableTOTP turns the second factor off, it takes a code or a recovery code so a stolen
+// access token is not enough
+func (us UserService) DisableTOTP(ctx context.Context, userID int64, code string, ip string) error {
+	eu, err := us.userRepo.GetOneByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = us.checkSecondFactor(ctx, eu, code, ip)
+	if err != nil {
+		return err
+	}
+
+	return us.userRepo.DisableTOTP(ctx, userID)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user, the previous ones stop working
+func (us UserService) RegenerateRecoveryCodes(ctx context.Context, userID int64, code string, ip string) ([]string, error) {
+	eu, err := us.userRepo.GetOneByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = us.checkSecondFactor(ctx, eu, code, ip)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	err = us.userRepo.ReplaceRecoveryCodes(ctx, userID, hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// CompleteMFALogin finishes the login that handed out mfaToken with a code from the
+// authenticator app or a recovery code
+func (us UserService) CompleteMFALogin(ctx context.Context, mfaToken string, code string, ip string) (TokenPair, error) {
+	tokenHash := hashToken(mfaToken)
+
+	userID, err := us.tokenRepo.LookupOneTimeToken(ctx, repository.OneTimeTokenMFAChallenge, tokenHash)
+	if err != nil {
+		if errors.Is(err, repository.ErrOneTimeTokenNotFound) {
+			return TokenPair{}, errors.Join(ErrInvalidToken, err)
+		}
+
+		return TokenPair{}, err
+	}
+
+	eu, err := us.userRepo.GetOneByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return TokenPair{}, errors.Join(ErrInvalidToken, err)
+		}
+
+		return TokenPair{}, err
+	}
+
+	// the challenge already proved the password, a suspended account must not use up a
+	// recovery code or clear its failed logins before being refused
+	if eu.SuspendedAt.Valid {
+		return TokenPair{}, ErrUserSuspended
+	}
+
+	err = us.checkSecondFactor(ctx, eu, code, ip)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	// the challenge is kept through wrong codes but finishes a single login
+	_, err = us.tokenRepo.ConsumeOneTimeToken(ctx, repository.OneTimeTokenMFAChallenge, tokenHash)
+	if err != nil {
+		if errors.Is(err, repository.ErrOneTimeTokenNotFound) {
+			return TokenPair{}, errors.Join(ErrInvalidToken, err)
+		}
+
+		return TokenPair{}, err
+	}
+
+	us.loginGuard.RegisterSuccess(ctx, eu.Username)
+
+	return us.authSrv.IssueTokens(ctx, userID)
+}
+
+func (us UserService) issueMFAChallenge(ctx context.Context, userID int64) (LoginResult, error) {
+	token, err := us.issueOneTimeToken(ctx, repository.OneTimeTokenMFAChallenge, userID, us.mfaChallengeTTL)
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	return LoginResult{
+		MFAToken:          token,
+		MFATokenExpiresIn: us.mfaChallengeTTL,
+	}, nil
+}
+
+// checkSecondFactor is verifySecondFactor behind the login guard, wrong codes count as failed
+// logins of the account so they can not be guessed
+func (us UserService) checkSecondFactor(ctx context.Context, eu entity.User, code string, ip string) error {
+	err := us.loginGuard.Check(ctx, eu.Username, ip)
+	if err != nil {
+		return err
+	}
+
+	err = us.verifySecondFactor(ctx, eu, code)
+	if errors.Is(err, ErrInvalidMFACode) {
+		lerr := us.loginGuard.RegisterFailure(ctx, eu.Username, ip)
+		return errors.Join(err, lerr)
+	}
+
+	return err
+}
+
+// verifySecondFactor accepts a code from the authenticator app or an unused recovery code,
+// the recovery code is used up
+func (us UserService) verifySecondFactor(ctx context.Context, eu entity.User, code string) error {
+	if !eu.TOTPEnabledAt.Valid {
+		return ErrMFANotEnabled
+	}
+
+	code = strings.TrimSpace(code)
+
+	// recovery codes are longer than any code of the authenticator app
+	normalized := normalizeRecoveryCode(code)
+	if len(normalized) != base32.StdEncoding.EncodedLen(recoveryCodeBytes) {
+		return us.verifyTOTPCode(ctx, eu.Id, eu.TOTPSecret.String, code)
+	}
+
+	err := us.userRepo.ConsumeRecoveryCode(ctx, eu.Id, hashToken(normalized))
+	if errors.Is(err, repository.ErrRecoveryCodeNotFound) {
+		return errors.Join(ErrInvalidMFACode, err)
+	}
+
+	return err
+}
+
+func (us UserService) verifyTOTPCode(ctx context.Context, userID int64, secret string, code string) error {
+	step, err := pkg.VerifyTOTP(secret, code, time.Now())
+	if errors.Is(err, pkg.ErrInvalidTOTPCode) {
+		return errors.Join(ErrInvalidMFACode, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	// a code is accepted for three periods at most, someone looking over the shoulder
+	// must not be able to use it again within them
+	fresh, err := us.tokenRepo.MarkTOTPStepUsed(ctx, userID, step, 3*pkg.TOTPPeriod)
+	if err != nil {
+		return err
+	}
+
+	if !fresh {
+		return ErrInvalidMFACode
+	}
+
+	return nil
+}
+
+// newRecoveryCodes returns the codes to show the user and the hashes to store of them
+func newRecoveryCodes() (codes []string, hashes []string, err error) {
+	for range recoveryCodeCount {
+		b := make([]byte, recoveryCodeBytes)
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+
+		var groups []string
+		for idx := 0; idx < len(code); idx += 4 {
+			groups = append(groups, code[idx:idx+4])
+		}
+
+		codes = append(codes, strings.Join(groups, "-"))
+		hashes = append(hashes, hashToken(code))
+	}
+
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode lets the user type the code without dashes and in any case
+func normalizeRecoveryCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+}
@@ -0,0 +1,255 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/authorization/internal/repository"
+	"example.com/authorization/internal/testutil"
+	"example.com/authorization/pkg"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testPassword = "correct horse battery staple"
+
+// testUsers is a UserService alongside the auth service it issues the tokens with
+type testUsers struct {
+	UserService
+	auth testAuth
+}
+
+func newTestUsers(t *testing.T) testUsers {
+	t.Helper()
+
+	cfg := pkg.Config{
+		MailDir:                 t.TempDir(),
+		BcryptCost:              bcrypt.MinCost,
+		LoginMaxAccountFailures: 3,
+		LoginMaxIPFailures:      100,
+		LoginFailureWindow:      time.Hour,
+		LoginLockoutBase:        time.Minute,
+		LoginLockoutMax:         time.Hour,
+		MFAChallengeTTL:         time.Minute,
+	}
+
+	policy, err := pkg.LoadPasswordPolicy(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ta := newTestAuth(t)
+	cache, _ := testutil.NewCache(t)
+	loginGuard := NewLoginGuard(cfg, repository.NewLoginAttemptRepository(cache))
+
+	return testUsers{
+		UserService: NewUserService(cfg, ta.userRepo, repository.NewTokenRepository(cache), ta.AuthService, pkg.NewMailer(cfg), policy, loginGuard),
+		auth:        ta,
+	}
+}
+
+// newMFAUser creates a user with a second factor and returns their id, TOTP secret and recovery codes
+func (tu testUsers) newMFAUser(t *testing.T, username string) (int64, string, []string) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	hash, err := tu.hasher.Hash(testPassword)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	userID, err := tu.userRepo.Insert(ctx, username, username+"@example.com", hash)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	secret, err := pkg.NewTOTPSecret()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = tu.userRepo.SetTOTPSecret(ctx, userID, secret)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = tu.userRepo.EnableTOTP(ctx, userID, secret, hashes)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return userID, secret, codes
+}
+
+// challenge logs in with the password and returns the token to finish the login with
+func (tu testUsers) challenge(t *testing.T, username string) string {
+	t.Helper()
+
+	result, err := tu.Login(context.Background(), username, testPassword, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !result.MFARequired() {
+		t.Fatalf("expected the login to ask for the second factor, got %+v", result)
+	}
+
+	return result.MFAToken
+}
+
+func totpCode(t *testing.T, secret string) string {
+	t.Helper()
+
+	code, err := pkg.TOTPCode(secret, time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return code
+}
+
+// wrongTOTPCode returns a code none of the periods around now accept
+func wrongTOTPCode(t *testing.T, secret string) string {
+	t.Helper()
+
+	for n := 0; ; n++ {
+		code := fmt.Sprintf("%06d", n)
+		_, err := pkg.VerifyTOTP(secret, code, time.Now())
+		if errors.Is(err, pkg.ErrInvalidTOTPCode) {
+			return code
+		}
+	}
+}
+
+func TestMFAChallengeIsKeptThroughWrongCodes(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	tu := newTestUsers(t)
+	userID, secret, _ := tu.newMFAUser(t, "alice")
+	mfaToken := tu.challenge(t, "alice")
+
+	_, err := tu.CompleteMFALogin(ctx, mfaToken, wrongTOTPCode(t, secret), "127.0.0.1")
+	if !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("expected ErrInvalidMFACode, got %v", err)
+	}
+
+	tokens, err := tu.CompleteMFALogin(ctx, mfaToken, totpCode(t, secret), "127.0.0.1")
+	if err != nil {
+		t.Fatalf("expected the right code to finish the login, got %v", err)
+	}
+
+	actor, err := tu.auth.Authorize(ctx, string(tokens.AccessToken))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if actor.UserID != userID {
+		t.Fatalf("expected user %d, got %d", userID, actor.UserID)
+	}
+}
+
+func TestMFAChallengeFinishesASingleLogin(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	tu := newTestUsers(t)
+	_, secret, codes := tu.newMFAUser(t, "alice")
+	mfaToken := tu.challenge(t, "alice")
+
+	_, err := tu.CompleteMFALogin(ctx, mfaToken, totpCode(t, secret), "127.0.0.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = tu.CompleteMFALogin(ctx, mfaToken, codes[0], "127.0.0.1")
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected ErrInvalidToken for a used challenge, got %v", err)
+	}
+}
+
+func TestRecoveryCodesWorkOnce(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	tu := newTestUsers(t)
+	_, _, codes := tu.newMFAUser(t, "alice")
+
+	_, err := tu.CompleteMFALogin(ctx, tu.challenge(t, "alice"), codes[0], "127.0.0.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = tu.CompleteMFALogin(ctx, tu.challenge(t, "alice"), codes[0], "127.0.0.1")
+	if !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("expected ErrInvalidMFACode for a used recovery code, got %v", err)
+	}
+
+	// typed without dashes and in upper case
+	_, err = tu.CompleteMFALogin(ctx, tu.challenge(t, "alice"), strings.ToUpper(strings.ReplaceAll(codes[1], "-", "")), "127.0.0.1")
+	if err != nil {
+		t.Fatalf("expected another recovery code to work, got %v", err)
+	}
+}
+
+func TestGuessingMFACodesLocksTheAccountOut(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	tu := newTestUsers(t)
+	_, secret, codes := tu.newMFAUser(t, "alice")
+	mfaToken := tu.challenge(t, "alice")
+
+	for range 3 {
+		_, err := tu.CompleteMFALogin(ctx, mfaToken, wrongTOTPCode(t, secret), "127.0.0.1")
+		if !errors.Is(err, ErrInvalidMFACode) {
+			t.Fatalf("expected ErrInvalidMFACode, got %v", err)
+		}
+	}
+
+	_, err := tu.CompleteMFALogin(ctx, mfaToken, codes[0], "127.0.0.1")
+	if !errors.Is(err, ErrTooManyLoginAttempts) {
+		t.Fatalf("expected ErrTooManyLoginAttempts once locked out, got %v", err)
+	}
+
+	// locked out from another IP too, the failures count against the account
+	_, err = tu.CompleteMFALogin(ctx, mfaToken, codes[0], "192.0.2.1")
+	if !errors.Is(err, ErrTooManyLoginAttempts) {
+		t.Fatalf("expected ErrTooManyLoginAttempts from another IP, got %v", err)
+	}
+}
+
+func TestMFALoginOfSuspendedUsersFails(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	tu := newTestUsers(t)
+	userID, _, codes := tu.newMFAUser(t, "alice")
+	mfaToken := tu.challenge(t, "alice")
+
+	// suspended between the two steps
+	tu.auth.suspend(t, userID)
+
+	_, err := tu.CompleteMFALogin(ctx, mfaToken, codes[0], "127.0.0.1")
+	if !errors.Is(err, ErrUserSuspended) {
+		t.Fatalf("expected ErrUserSuspended, got %v", err)
+	}
+
+	left, err := tu.userRepo.CountRecoveryCodes(ctx, userID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if left != recoveryCodeCount {
+		t.Fatalf("expected the recovery code to be kept, %d of %d are left", left, recoveryCodeCount)
+	}
+}
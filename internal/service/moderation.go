@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+
+	"example.com/authorization/internal/domain"
+	"example.com/authorization/internal/repository"
+)
+
+type ModerationService struct {
+	flagRepo repository.FlagRepository
+	// hideThreshold is the number of distinct users flagging an item before it is hidden
+	hideThreshold uint64
+}
+
+func NewModerationService(flagRepo repository.FlagRepository, hideThreshold uint64) ModerationService {
+	return ModerationService{
+		flagRepo:      flagRepo,
+		hideThreshold: hideThreshold,
+	}
+}
+
+func (ms ModerationService) FlagPost(ctx context.Context, userID int64, postID int64, reason domain.FlagReason) error {
+	return ms.flag(ctx, domain.Flag{
+		UserID:     userID,
+		TargetType: domain.FlagTargetPost,
+		TargetID:   postID,
+		Reason:     reason,
+	})
+}
+
+func (ms ModerationService) FlagComment(ctx context.Context, userID int64, commentID int64, reason domain.FlagReason) error {
+	return ms.flag(ctx, domain.Flag{
+		UserID:     userID,
+		TargetType: domain.FlagTargetComment,
+		TargetID:   commentID,
+		Reason:     reason,
+	})
+}
+
+func (ms ModerationService) flag(ctx context.Context, flag domain.Flag) error {
+	if !flag.Reason.IsValid() {
+		return ErrInvalidFlagReason
+	}
+
+	return ms.flagRepo.Insert(ctx, flag.ToEntity(), ms.hideThreshold)
+}
+
+// ListQueue returns the flagged items waiting for a moderator
+func (ms ModerationService) ListQueue(ctx context.Context, size uint64, page uint64) ([]domain.FlaggedItem, error) {
+	items, err := ms.flagRepo.ListOpen(ctx, size, page)
+	if err != nil {
+		return make([]domain.FlaggedItem, 0), err
+	}
+
+	return domain.NewFlaggedItemsFromEntities(items), nil
+}
+
+// Resolve closes the open flags of an item, the decision is audited
+func (ms ModerationService) Resolve(ctx context.Context, actor domain.Actor, targetType string, targetID int64, resolution domain.FlagResolution) error {
+	if !actor.Role.Can(domain.PermissionModerateFlags) {
+		return ErrPermissionDenied
+	}
+
+	if !resolution.IsValid() {
+		return ErrInvalidFlagResolution
+	}
+
+	if targetType != domain.FlagTargetPost && targetType != domain.FlagTargetComment {
+		return repository.ErrFlagNotFound
+	}
+
+	al := domain.NewAuditLog(actor, domain.AuditActionResolveFlags, targetType, targetID, map[string]any{
+		"resolution": resolution,
+	})
+
+	return ms.flagRepo.Resolve(ctx, targetType, targetID, string(resolution), resolution == domain.FlagResolutionHide, al.ToEntity())
+}
@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/authorization/internal/repository"
+	"example.com/authorization/pkg"
+)
+
+const (
+	// usernames made up from an identity are tried again with a random suffix while taken
+	maxUsernameAttempts = 5
+	maxUsernameLength   = 32
+)
+
+var usernameDisallowed = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// OAuthService logs users in with the authorization code flow of OpenID Connect providers
+type OAuthService struct {
+	providers    map[string]*pkg.OIDCProvider
+	identityRepo repository.IdentityRepository
+	userRepo     repository.UserRepository
+	tokenRepo    repository.TokenRepository
+	authSrv      AuthService
+	userSrv      UserService
+	stateTTL     time.Duration
+}
+
+func NewOAuthService(cfg pkg.Config, identityRepo repository.IdentityRepository, userRepo repository.UserRepository, tokenRepo repository.TokenRepository, authSrv AuthService, userSrv UserService) OAuthService {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	providers := make(map[string]*pkg.OIDCProvider, len(cfg.OIDCProviders))
+	for _, pc := range cfg.OIDCProviders {
+		providers[pc.Name] = pkg.NewOIDCProvider(pc, cfg.PublicURL+"/api/v1/oauth/"+pc.Name+"/callback", client)
+	}
+
+	return OAuthService{
+		providers:    providers,
+		identityRepo: identityRepo,
+		userRepo:     userRepo,
+		tokenRepo:    tokenRepo,
+		authSrv:      authSrv,
+		userSrv:      userSrv,
+		stateTTL:     cfg.OAuthStateTTL,
+	}
+}
+
+// OAuthStart is where to send the user to log in at the provider, State has to come back
+// from the same browser
+type OAuthStart struct {
+	URL       string
+	State     string
+	ExpiresIn time.Duration
+}
+
+// OAuthResult is the login the provider vouched for, nobody is logged in when the flow linked
+// an identity instead
+type OAuthResult struct {
+	LoginResult
+	Linked bool
+}
+
+// Start begins a login at the provider, or the linking of an identity to linkUserID when it is set
+func (oas OAuthService) Start(ctx context.Context, providerName string, linkUserID int64) (OAuthStart, error) {
+	provider, ok := oas.providers[providerName]
+	if !ok {
+		return OAuthStart{}, ErrUnknownOAuthProvider
+	}
+
+	state, err := randomToken()
+	if err != nil {
+		return OAuthStart{}, err
+	}
+
+	nonce, err := randomToken()
+	if err != nil {
+		return OAuthStart{}, err
+	}
+
+	codeVerifier, err := randomToken()
+	if err != nil {
+		return OAuthStart{}, err
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, codeVerifier)
+	if err != nil {
+		return OAuthStart{}, errors.Join(ErrOAuthProviderUnavailable, err)
+	}
+
+	err = oas.tokenRepo.StoreOAuthState(ctx, hashToken(state), repository.OAuthState{
+		Provider:     providerName,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		LinkUserID:   linkUserID,
+	}, oas.stateTTL)
+	if err != nil {
+		return OAuthStart{}, err
+	}
+
+	return OAuthStart{
+		URL:       authURL,
+		State:     state,
+		ExpiresIn: oas.stateTTL,
+	}, nil
+}
+
+// Callback finishes the flow the provider redirected back from with code. The user is logged
+// in the same way as with a password, a second factor is still asked for
+func (oas OAuthService) Callback(ctx context.Context, providerName string, state string, code string) (OAuthResult, error) {
+	provider, ok := oas.providers[providerName]
+	if !ok {
+		return OAuthResult{}, ErrUnknownOAuthProvider
+	}
+
+	started, err := oas.tokenRepo.ConsumeOAuthState(ctx, hashToken(state))
+	if err != nil {
+		if errors.Is(err, repository.ErrOAuthStateNotFound) {
+			return OAuthResult{}, errors.Join(ErrInvalidOAuthState, err)
+		}
+
+		return OAuthResult{}, err
+	}
+
+	if started.Provider != providerName {
+		return OAuthResult{}, ErrInvalidOAuthState
+	}
+
+	identity, err := provider.Exchange(ctx, code, started.CodeVerifier, started.Nonce)
+	if err != nil {
+		return OAuthResult{}, errors.Join(ErrOAuthFailed, err)
+	}
+
+	if started.LinkUserID != 0 {
+		return OAuthResult{Linked: true}, oas.link(ctx, started.LinkUserID, providerName, identity)
+	}
+
+	userID, err := oas.userForIdentity(ctx, providerName, identity)
+	if err != nil {
+		return OAuthResult{}, err
+	}
+
+	eu, err := oas.userRepo.GetOneByID(ctx, userID)
+	if err != nil {
+		return OAuthResult{}, err
+	}
+
+	if eu.SuspendedAt.Valid {
+		return OAuthResult{}, ErrUserSuspended
+	}
+
+	// the provider stands in for the password only
+	if eu.TOTPEnabledAt.Valid {
+		result, err := oas.userSrv.issueMFAChallenge(ctx, userID)
+		return OAuthResult{LoginResult: result}, err
+	}
+
+	tokens, err := oas.authSrv.IssueTokens(ctx, userID)
+	if err != nil {
+		return OAuthResult{}, err
+	}
+
+	return OAuthResult{LoginResult: LoginResult{Tokens: tokens}}, nil
+}
+
+func (oas OAuthService) link(ctx context.Context, userID int64, providerName string, identity pkg.OIDCIdentity) error {
+	err := oas.identityRepo.Link(ctx, userID, providerName, identity.Subject, identity.Email)
+	if errors.Is(err, repository.ErrIdentityAlreadyLinked) {
+		linkedTo, lerr := oas.identityRepo.GetUserID(ctx, providerName, identity.Subject)
+		if lerr == nil && linkedTo == userID {
+			return nil
+		}
+
+		return errors.Join(ErrIdentityLinkedElsewhere, err)
+	}
+
+	return err
+}
+
+// userForIdentity returns the user the identity is linked to. An identity seen for the first
+// time is linked to the user with the same email when both sides verified it, or gets a new user
+func (oas OAuthService) userForIdentity(ctx context.Context, providerName string, identity pkg.OIDCIdentity) (int64, error) {
+	userID, err := oas.identityRepo.GetUserID(ctx, providerName, identity.Subject)
+	if err == nil {
+		return userID, nil
+	}
+	if !errors.Is(err, repository.ErrIdentityNotFound) {
+		return 0, err
+	}
+
+	// an address that can not be used here is left out rather than refusing the login
+	email, err := normalizeEmail(identity.Email)
+	if err != nil {
+		email = ""
+	}
+
+	if email != "" {
+		eu, err := oas.userRepo.GetOneByEmail(ctx, email)
+		if err == nil {
+			// whoever controls an unverified address could otherwise take the account over
+			if !identity.EmailVerified || !eu.EmailVerifiedAt.Valid {
+				return 0, ErrEmailAlreadyRegistered
+			}
+
+			return eu.Id, oas.identityRepo.Link(ctx, eu.Id, providerName, identity.Subject, email)
+		}
+		if !errors.Is(err, repository.ErrUserNotFound) {
+			return 0, err
+		}
+	}
+
+	// a random password nobody is told, hashed like any other so guessing it takes as long as for
+	// every other account. The user logs in through the provider until they pick one with a
+	// password reset
+	password, err := randomToken()
+	if err != nil {
+		return 0, err
+	}
+
+	hashedPassword, err := oas.userSrv.hasher.Hash(password)
+	if err != nil {
+		return 0, err
+	}
+
+	base := usernameFromIdentity(identity)
+	username := base
+	for range maxUsernameAttempts {
+		userID, err := oas.identityRepo.CreateUser(ctx, repository.IdentityUser{
+			Username:       username,
+			Email:          email,
+			EmailVerified:  email != "" && identity.EmailVerified,
+			HashedPassword: hashedPassword,
+		}, providerName, identity.Subject)
+		if errors.Is(err, repository.ErrUserAlreadyExists) {
+			username = base + strconv.Itoa(1000+rand.IntN(9000))
+			continue
+		}
+		if errors.Is(err, repository.ErrEmailAlreadyExists) {
+			// registered meanwhile, linking it is up to the owner of the account
+			return 0, errors.Join(ErrEmailAlreadyRegistered, err)
+		}
+		if errors.Is(err, repository.ErrIdentityAlreadyLinked) {
+			// another callback of the same identity was faster
+			return oas.identityRepo.GetUserID(ctx, providerName, identity.Subject)
+		}
+
+		return userID, err
+	}
+
+	return 0, ErrUserAlreadyRegistered
+}
+
+// usernameFromIdentity picks the username a new user is created with, the one the provider
+// knows the user by when it is usable
+func usernameFromIdentity(identity pkg.OIDCIdentity) string {
+	localPart, _, _ := strings.Cut(identity.Email, "@")
+
+	for _, candidate := range []string{identity.PreferredUsername, localPart, identity.Name} {
+		username := usernameDisallowed.ReplaceAllString(candidate, "")
+		if len(username) > maxUsernameLength {
+			username = username[:maxUsernameLength]
+		}
+
+		if username != "" {
+			return username
+		}
+	}
+
+	return "user"
+}
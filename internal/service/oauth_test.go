@@ -0,0 +1,321 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"example.com/authorization/internal/repository"
+	"example.com/authorization/internal/testutil"
+	"example.com/authorization/pkg"
+)
+
+// testOAuth is an OAuthService logging in at a stub provider named stub
+type testOAuth struct {
+	OAuthService
+	users    testUsers
+	provider *testutil.OIDCProvider
+}
+
+func newTestOAuth(t *testing.T) testOAuth {
+	t.Helper()
+
+	tu := newTestUsers(t)
+	provider := testutil.NewOIDCProvider(t)
+
+	cfg := pkg.Config{
+		PublicURL:     "http://localhost:3030",
+		OIDCProviders: []pkg.OIDCProviderConfig{provider.Config("stub")},
+		OAuthStateTTL: time.Minute,
+	}
+
+	return testOAuth{
+		OAuthService: NewOAuthService(cfg, repository.NewIdentityRepository(tu.auth.db), tu.userRepo, tu.tokenRepo, tu.authSrv, tu.UserService),
+		users:        tu,
+		provider:     provider,
+	}
+}
+
+// login runs the whole flow as identity, linking it to linkUserID when it is set
+func (to testOAuth) login(t *testing.T, identity pkg.OIDCIdentity, linkUserID int64) (OAuthResult, error) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	start, err := to.Start(ctx, "stub", linkUserID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return to.Callback(ctx, "stub", start.State, to.provider.Authorize(t, start.URL, identity))
+}
+
+// loggedInAs checks the result logged a user in and returns who
+func (to testOAuth) loggedInAs(t *testing.T, result OAuthResult) int64 {
+	t.Helper()
+
+	if result.Linked || result.MFARequired() {
+		t.Fatalf("expected tokens, got %+v", result)
+	}
+
+	actor, err := to.users.auth.Authorize(context.Background(), string(result.Tokens.AccessToken))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return actor.UserID
+}
+
+// newVerifiedUser creates a user with a password whose email is verified
+func (to testOAuth) newVerifiedUser(t *testing.T, username string) int64 {
+	t.Helper()
+
+	ctx := context.Background()
+
+	hash, err := to.users.hasher.Hash(testPassword)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	userID, err := to.userRepo.Insert(ctx, username, username+"@example.com", hash)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = to.userRepo.MarkEmailVerified(ctx, userID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return userID
+}
+
+func TestOAuthLoginCreatesTheUserOnce(t *testing.T) {
+	t.Parallel()
+
+	to := newTestOAuth(t)
+	identity := pkg.OIDCIdentity{Subject: "1", Email: "alice@example.com", EmailVerified: true, PreferredUsername: "alice"}
+
+	result, err := to.login(t, identity, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	userID := to.loggedInAs(t, result)
+
+	eu, err := to.userRepo.GetOneByID(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if eu.Username != "alice" || eu.Email.String != "alice@example.com" || !eu.EmailVerifiedAt.Valid {
+		t.Fatalf("unexpected user %+v", eu)
+	}
+
+	result, err = to.login(t, identity, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if again := to.loggedInAs(t, result); again != userID {
+		t.Fatalf("expected the second login to be user %d, got %d", userID, again)
+	}
+}
+
+func TestOAuthLinksAnIdentityToTheUser(t *testing.T) {
+	t.Parallel()
+
+	to := newTestOAuth(t)
+	userID := to.newVerifiedUser(t, "alice")
+	otherID := to.newVerifiedUser(t, "bob")
+	// the email of the provider does not matter when the user links the identity themselves
+	identity := pkg.OIDCIdentity{Subject: "1", Email: "alice@example.org"}
+
+	result, err := to.login(t, identity, userID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !result.Linked || result.Tokens.AccessToken != "" {
+		t.Fatalf("expected the identity to be linked without logging in, got %+v", result)
+	}
+
+	// linking it again is fine
+	_, err = to.login(t, identity, userID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = to.login(t, identity, otherID)
+	if !errors.Is(err, ErrIdentityLinkedElsewhere) {
+		t.Fatalf("expected ErrIdentityLinkedElsewhere, got %v", err)
+	}
+
+	result, err = to.login(t, identity, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if loggedIn := to.loggedInAs(t, result); loggedIn != userID {
+		t.Fatalf("expected the login to be user %d, got %d", userID, loggedIn)
+	}
+}
+
+func TestOAuthLinksTheUserWithTheSameVerifiedEmail(t *testing.T) {
+	t.Parallel()
+
+	to := newTestOAuth(t)
+	userID := to.newVerifiedUser(t, "alice")
+
+	result, err := to.login(t, pkg.OIDCIdentity{Subject: "1", Email: "Alice@Example.com", EmailVerified: true}, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if loggedIn := to.loggedInAs(t, result); loggedIn != userID {
+		t.Fatalf("expected the login to be user %d, got %d", userID, loggedIn)
+	}
+}
+
+func TestOAuthRefusesEmailsNotVerifiedOnBothSides(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	to := newTestOAuth(t)
+	to.newVerifiedUser(t, "alice")
+
+	_, err := to.userRepo.Insert(ctx, "bob", "bob@example.com", "hash")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		identity pkg.OIDCIdentity
+	}{
+		{"not verified by the provider", pkg.OIDCIdentity{Subject: "1", Email: "alice@example.com"}},
+		{"not verified by the user", pkg.OIDCIdentity{Subject: "2", Email: "bob@example.com", EmailVerified: true}},
+	}
+
+	for _, tt := range tests {
+		_, err := to.login(t, tt.identity, 0)
+		if !errors.Is(err, ErrEmailAlreadyRegistered) {
+			t.Errorf("%s: expected ErrEmailAlreadyRegistered, got %v", tt.name, err)
+		}
+
+		_, err = to.identityRepo.GetUserID(ctx, "stub", tt.identity.Subject)
+		if !errors.Is(err, repository.ErrIdentityNotFound) {
+			t.Errorf("%s: expected the identity not to be linked, got %v", tt.name, err)
+		}
+	}
+}
+
+func TestOAuthAsksForTheSecondFactor(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	to := newTestOAuth(t)
+	userID, secret, _ := to.users.newMFAUser(t, "alice")
+	identity := pkg.OIDCIdentity{Subject: "1"}
+
+	_, err := to.login(t, identity, userID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	result, err := to.login(t, identity, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !result.MFARequired() || result.Tokens.AccessToken != "" {
+		t.Fatalf("expected the login to ask for the second factor, got %+v", result)
+	}
+
+	tokens, err := to.users.CompleteMFALogin(ctx, result.MFAToken, totpCode(t, secret), "127.0.0.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	actor, err := to.users.auth.Authorize(ctx, string(tokens.AccessToken))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if actor.UserID != userID {
+		t.Fatalf("expected user %d, got %d", userID, actor.UserID)
+	}
+}
+
+func TestOAuthLoginOfSuspendedUsersFails(t *testing.T) {
+	t.Parallel()
+
+	to := newTestOAuth(t)
+	userID := to.newVerifiedUser(t, "alice")
+	identity := pkg.OIDCIdentity{Subject: "1"}
+
+	_, err := to.login(t, identity, userID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	to.users.auth.suspend(t, userID)
+
+	_, err = to.login(t, identity, 0)
+	if !errors.Is(err, ErrUserSuspended) {
+		t.Fatalf("expected ErrUserSuspended, got %v", err)
+	}
+}
+
+func TestOAuthStatesWorkOnce(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	to := newTestOAuth(t)
+
+	_, err := to.Callback(ctx, "stub", "made up", "code")
+	if !errors.Is(err, ErrInvalidOAuthState) {
+		t.Fatalf("expected ErrInvalidOAuthState, got %v", err)
+	}
+
+	start, err := to.Start(ctx, "stub", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = to.Callback(ctx, "stub", start.State, to.provider.Authorize(t, start.URL, pkg.OIDCIdentity{Subject: "1"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = to.Callback(ctx, "stub", start.State, to.provider.Authorize(t, start.URL, pkg.OIDCIdentity{Subject: "1"}))
+	if !errors.Is(err, ErrInvalidOAuthState) {
+		t.Fatalf("expected ErrInvalidOAuthState for a used state, got %v", err)
+	}
+
+	_, err = to.Start(ctx, "other", 0)
+	if !errors.Is(err, ErrUnknownOAuthProvider) {
+		t.Fatalf("expected ErrUnknownOAuthProvider, got %v", err)
+	}
+}
+
+func TestUsersOfAnIdentityHaveARealPasswordHash(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	to := newTestOAuth(t)
+
+	_, err := to.userForIdentity(ctx, "example", pkg.OIDCIdentity{Subject: "1", PreferredUsername: "alice"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// a hash that fails to parse would be refused before bcrypt ran, telling such users apart by the timing
+	for _, password := range []string{"!", testPassword} {
+		_, err = to.users.Login(ctx, "alice", password, "127.0.0.1")
+		if !errors.Is(err, ErrWrongCredentials) || !errors.Is(err, pkg.ErrPasswordMismatch) {
+			t.Errorf("%q: expected ErrWrongCredentials and pkg.ErrPasswordMismatch, got %v", password, err)
+		}
+	}
+}
@@ -2,19 +2,32 @@ package service
 
 import (
 	"context"
+	"log/slog"
+	"time"
 
 	"example.com/authorization/internal/domain"
 	"example.com/authorization/internal/repository"
 	"example.com/authorization/internal/repository/entity"
+	"example.com/authorization/pkg"
 )
 
+// scores of posts older than this are small enough to not be refreshed anymore
+const hotScoreRefreshWindow = 7 * 24 * time.Hour
+
 type PostService struct {
-	postRepo repository.PostRepository
+	postRepo     repository.PostRepository
+	commentRepo  repository.CommentRepo
+	analyticsSrv AnalyticsService
+	// editWindow is how long posts can be edited after being submitted, zero means forever
+	editWindow time.Duration
 }
 
-func NewPostService(postRepo repository.PostRepository) PostService {
+func NewPostService(postRepo repository.PostRepository, commentRepo repository.CommentRepo, analyticsSrv AnalyticsService, editWindow time.Duration) PostService {
 	return PostService{
-		postRepo: postRepo,
+		postRepo:     postRepo,
+		commentRepo:  commentRepo,
+		analyticsSrv: analyticsSrv,
+		editWindow:   editWindow,
 	}
 }
 
@@ -26,24 +39,297 @@ func (us PostService) CreateProfilePost(ctx context.Context, post domain.Post) (
 	})
 }
 
-func (us PostService) ListProfilePosts(ctx context.Context, userID int64, filters domain.PostFilters) ([]domain.Post, error) {
-	ps, err := us.postRepo.List(ctx, &userID, filters.Size, filters.Page)
+func (us PostService) ListProfilePosts(ctx context.Context, userID int64, filters domain.PostFilters) ([]domain.Post, string, error) {
+	return us.listPosts(ctx, &userID, filters)
+}
+
+// ListUserPosts returns the latest posts of the user as anyone else sees them, hidden posts are left out
+func (us PostService) ListUserPosts(ctx context.Context, userID int64, size uint64) ([]domain.Post, error) {
+	ps, err := us.postRepo.List(ctx, repository.PostListQuery{
+		UserID: &userID,
+		Order:  repository.PostOrderNew,
+		Size:   size,
+		Page:   1,
+	})
 	if err != nil {
 		return make([]domain.Post, 0), err
 	}
 
-	return domain.NewPostsFromEntities(ps), nil
+	return us.withViews(ctx, domain.NewPostsFromEntities(ps)), nil
 }
 
-func (us PostService) ListPosts(ctx context.Context, filters domain.PostFilters) ([]domain.Post, error) {
-	ps, err := us.postRepo.List(ctx, nil, filters.Size, filters.Page)
+func (us PostService) ListPosts(ctx context.Context, filters domain.PostFilters) ([]domain.Post, string, error) {
+	return us.listPosts(ctx, nil, filters)
+}
+
+// listPosts returns a page of posts alongside the cursor of the next page,
+// the cursor is empty when there are no more posts
+func (us PostService) listPosts(ctx context.Context, userID *int64, filters domain.PostFilters) ([]domain.Post, string, error) {
+	q, err := newPostListQuery(userID, filters)
+	if err != nil {
+		return make([]domain.Post, 0), "", err
+	}
+
+	ps, err := us.postRepo.List(ctx, q)
+	if err != nil {
+		return make([]domain.Post, 0), "", err
+	}
+
+	var nextCursor string
+	if uint64(len(ps)) == q.Size {
+		nextCursor = repository.NewPostCursor(q.Order, ps[len(ps)-1]).Encode()
+	}
+
+	return us.withViews(ctx, domain.NewPostsFromEntities(ps)), nextCursor, nil
+}
+
+// ListTrendingPosts returns a page of the posts with the most recent views and upvotes, the hot
+// feed is served instead while the trending scores are unavailable
+func (us PostService) ListTrendingPosts(ctx context.Context, size uint64, page uint64) ([]domain.Post, error) {
+	ids, err := us.analyticsSrv.TrendingPostIDs(ctx, size, page)
+	if err != nil {
+		slog.WarnContext(ctx, "trending posts are unavailable, serving hot posts", "err", err)
+
+		posts, _, err := us.listPosts(ctx, nil, domain.PostFilters{
+			Page: page,
+			Size: size,
+			Sort: domain.PostSortHot,
+		})
+
+		return posts, err
+	}
+
+	ps, err := us.postRepo.ListByIDs(ctx, ids)
 	if err != nil {
 		return make([]domain.Post, 0), err
 	}
 
-	return domain.NewPostsFromEntities(ps), nil
+	byID := make(map[int64]entity.Post, len(ps))
+	for _, p := range ps {
+		byID[p.Id] = p
+	}
+
+	// deleted and hidden posts are not in byID, they simply leave a shorter page
+	ordered := make([]entity.Post, 0, len(ps))
+	for _, id := range ids {
+		if p, ok := byID[id]; ok {
+			ordered = append(ordered, p)
+		}
+	}
+
+	return us.withViews(ctx, domain.NewPostsFromEntities(ordered)), nil
+}
+
+// withViews fills in the view counts of the posts, they show no views while the counts are unavailable
+func (us PostService) withViews(ctx context.Context, posts []domain.Post) []domain.Post {
+	ids := make([]int64, len(posts))
+	for i, p := range posts {
+		ids[i] = p.Id
+	}
+
+	views, err := us.analyticsSrv.PostViews(ctx, ids)
+	if err != nil {
+		slog.WarnContext(ctx, "could not read post views", "err", err)
+		return posts
+	}
+
+	for i := range posts {
+		posts[i].Views = views[posts[i].Id]
+	}
+
+	return posts
+}
+
+// GetPost returns the post with the first page of its comment tree, it always
+// runs two queries no matter how many comments the post has. Hidden posts are
+// only returned to their owner and moderators. The post is counted as viewed by
+// viewerKey, a user or an IP
+func (us PostService) GetPost(ctx context.Context, viewer domain.Actor, viewerKey string, postID int64, commentFilters domain.CommentFilters) (domain.Post, error) {
+	pe, err := us.postRepo.GetByID(ctx, postID)
+	if err != nil {
+		return domain.Post{}, err
+	}
+
+	if pe.HiddenAt.Valid && !viewer.CanModify(pe.UserID, domain.PermissionModerateFlags) {
+		return domain.Post{}, repository.ErrPostNotFound
+	}
+
+	us.analyticsSrv.RegisterPostView(ctx, postID, viewerKey)
+
+	post := us.withViews(ctx, []domain.Post{domain.NewPostFromEntity(pe)})[0]
+	if post.CommentsCount == 0 {
+		return post, nil
+	}
+
+	post.Comments, _, err = listCommentTree(ctx, us.commentRepo, viewer, postID, commentFilters)
+	if err != nil {
+		return domain.Post{}, err
+	}
+
+	return post, nil
+}
+
+// DeletePost lets owners delete their posts and moderators delete anyone's, the latter is audited
+func (us PostService) DeletePost(ctx context.Context, actor domain.Actor, postID int64) error {
+	pe, err := us.postRepo.GetByID(ctx, postID)
+	if err != nil {
+		return err
+	}
+
+	if !actor.CanModify(pe.UserID, domain.PermissionDeleteAnyPost) {
+		return ErrPermissionDenied
+	}
+
+	var audit *entity.AuditLog
+	if actor.IsModerating(pe.UserID) {
+		al := domain.NewAuditLog(actor, domain.AuditActionDeletePost, domain.AuditTargetPost, postID, map[string]any{
+			"ownerId": pe.UserID,
+			"url":     pe.URL,
+		})
+		ale := al.ToEntity()
+		audit = &ale
+	}
+
+	err = us.postRepo.DeleteByID(ctx, postID, audit)
+	if err != nil {
+		return err
+	}
+
+	us.analyticsSrv.ForgetPost(ctx, postID)
+
+	return nil
 }
 
-func (us PostService) DeletePost(ctx context.Context, userID int64, postID int64) error {
-	return us.postRepo.DeleteByID(ctx, userID, postID)
+// EditPost replaces the description and URL of the post with the ones that are set, only the owner
+// can edit a post and only within the edit window. Every edit keeps the previous content as a revision
+func (us PostService) EditPost(ctx context.Context, userID int64, postID int64, description *string, url *string) (domain.Post, error) {
+	pe, err := us.postRepo.GetByID(ctx, postID)
+	if err != nil {
+		return domain.Post{}, err
+	}
+
+	if pe.UserID != userID {
+		return domain.Post{}, ErrPermissionDenied
+	}
+
+	if us.editWindow > 0 && time.Since(pe.CreatedAt.Time) > us.editWindow {
+		return domain.Post{}, ErrEditWindowClosed
+	}
+
+	if description == nil && url == nil {
+		return domain.Post{}, ErrInvalidEdit
+	}
+
+	edited := pe
+	if description != nil {
+		edited.Description = *description
+	}
+
+	if url != nil {
+		edited.URL = *url
+	}
+
+	if edited.URL == "" {
+		return domain.Post{}, ErrInvalidEdit
+	}
+
+	if edited.Description == pe.Description && edited.URL == pe.URL {
+		return domain.NewPostFromEntity(pe), nil
+	}
+
+	err = us.postRepo.Update(ctx, edited, userID)
+	if err != nil {
+		return domain.Post{}, err
+	}
+
+	pe, err = us.postRepo.GetByID(ctx, postID)
+	if err != nil {
+		return domain.Post{}, err
+	}
+
+	return domain.NewPostFromEntity(pe), nil
+}
+
+// ListPostRevisions returns the post alongside its previous versions, they are visible to the owner and moderators
+func (us PostService) ListPostRevisions(ctx context.Context, actor domain.Actor, postID int64) (domain.Post, []domain.PostRevision, error) {
+	pe, err := us.postRepo.GetByID(ctx, postID)
+	if err != nil {
+		return domain.Post{}, make([]domain.PostRevision, 0), err
+	}
+
+	if !actor.CanModify(pe.UserID, domain.PermissionModerateFlags) {
+		return domain.Post{}, make([]domain.PostRevision, 0), ErrPermissionDenied
+	}
+
+	revisions, err := us.postRepo.ListRevisions(ctx, postID)
+	if err != nil {
+		return domain.Post{}, make([]domain.PostRevision, 0), err
+	}
+
+	return domain.NewPostFromEntity(pe), domain.NewPostRevisionsFromEntities(revisions), nil
+}
+
+func (us PostService) Upvote(ctx context.Context, userID int64, postID int64) (bool, error) {
+	upvoted, err := us.postRepo.Upvote(ctx, userID, postID)
+	if err != nil {
+		return upvoted, err
+	}
+
+	if upvoted {
+		us.analyticsSrv.RegisterPostUpvote(ctx, postID, userID)
+	}
+
+	return upvoted, nil
+}
+
+// RefreshHotScores keeps the hot ranking decaying while nobody votes, it blocks until ctx is done
+func (us PostService) RefreshHotScores(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := us.postRepo.RefreshHotScores(ctx, time.Now().Add(-hotScoreRefreshWindow))
+		if err != nil {
+			slog.ErrorContext(ctx, "could not refresh hot scores", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func newPostListQuery(userID *int64, filters domain.PostFilters) (repository.PostListQuery, error) {
+	q := repository.PostListQuery{
+		UserID: userID,
+		Order:  repository.PostOrderNew,
+		Size:   filters.Size,
+		Page:   filters.Page,
+		// profile listings belong to the owner, who still sees their hidden posts
+		IncludeHidden: userID != nil,
+	}
+
+	switch filters.Sort {
+	case domain.PostSortTop:
+		q.Order = repository.PostOrderTop
+		q.Since = filters.Since
+	case domain.PostSortBest:
+		q.Order = repository.PostOrderTop
+		q.Since = time.Now().Add(-domain.BestPostsWindow)
+	case domain.PostSortHot:
+		q.Order = repository.PostOrderHot
+	}
+
+	if filters.Cursor != "" {
+		cursor, err := pkg.DecodeCursor(filters.Cursor, string(q.Order))
+		if err != nil {
+			return repository.PostListQuery{}, err
+		}
+
+		q.After = &cursor
+	}
+
+	return q, nil
 }
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"context"
+
+	"example.com/authorization/internal/domain"
+	"example.com/authorization/internal/repository"
+)
+
+type SearchService struct {
+	searchRepo repository.SearchRepository
+}
+
+func NewSearchService(searchRepo repository.SearchRepository) SearchService {
+	return SearchService{
+		searchRepo: searchRepo,
+	}
+}
+
+// Search returns a page of posts and comments ordered by relevance, the next page is zero on the last page
+func (ss SearchService) Search(ctx context.Context, query string, filters domain.SearchFilters) ([]domain.SearchResult, uint64, error) {
+	if query == "" {
+		return make([]domain.SearchResult, 0), 0, ErrEmptySearchQuery
+	}
+
+	srs, err := ss.searchRepo.Search(ctx, repository.SearchQuery{
+		Text:  query,
+		Types: filters.Types,
+		Size:  filters.Size,
+		Page:  filters.Page,
+	})
+	if err != nil {
+		return make([]domain.SearchResult, 0), 0, err
+	}
+
+	var nextPage uint64
+	if uint64(len(srs)) == filters.Size {
+		nextPage = filters.Page + 1
+	}
+
+	return domain.NewSearchResultsFromEntities(query, srs), nextPage, nil
+}
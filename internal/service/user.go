@@ -3,21 +3,54 @@ package service
 import (
 	"context"
 	"errors"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"example.com/authorization/internal/domain"
 	"example.com/authorization/internal/repository"
-	"golang.org/x/crypto/bcrypt"
+	"example.com/authorization/pkg"
 )
 
 type UserService struct {
-	userRepo repository.UserRepository
-	authSrv  AuthService
+	userRepo  repository.UserRepository
+	tokenRepo repository.TokenRepository
+	authSrv   AuthService
+	mailer    pkg.Mailer
+	hasher    pkg.PasswordHasher
+	policy    pkg.PasswordPolicy
+	// dummyHash is verified for unknown usernames so they take as long as wrong passwords, and
+	// after wrong passwords of accounts whose hash is weaker than it
+	dummyHash  string
+	loginGuard LoginGuard
+	// publicURL is prefixed to the links sent by mail
+	publicURL            string
+	emailVerificationTTL time.Duration
+	passwordResetTTL     time.Duration
+	totpIssuer           string
+	mfaChallengeTTL      time.Duration
 }
 
-func NewUserService(userRepo repository.UserRepository, authSrv AuthService) UserService {
+func NewUserService(cfg pkg.Config, userRepo repository.UserRepository, tokenRepo repository.TokenRepository, authSrv AuthService, mailer pkg.Mailer, policy pkg.PasswordPolicy, loginGuard LoginGuard) UserService {
+	hasher := pkg.NewPasswordHasher(cfg)
+	// Hash only fails when the system runs out of randomness, an empty hash then fails verification right away
+	dummyHash, _ := hasher.Hash("dummy password")
+
 	return UserService{
-		userRepo: userRepo,
-		authSrv:  authSrv,
+		userRepo:             userRepo,
+		tokenRepo:            tokenRepo,
+		authSrv:              authSrv,
+		mailer:               mailer,
+		hasher:               hasher,
+		policy:               policy,
+		dummyHash:            dummyHash,
+		loginGuard:           loginGuard,
+		publicURL:            cfg.PublicURL,
+		emailVerificationTTL: cfg.EmailVerificationTTL,
+		passwordResetTTL:     cfg.PasswordResetTTL,
+		totpIssuer:           cfg.TOTPIssuer,
+		mfaChallengeTTL:      cfg.MFAChallengeTTL,
 	}
 }
 
@@ -39,25 +72,96 @@ func (us UserService) GetUserByID(ctx context.Context, UserID int64) (domain.Use
 	return domain.NewUserFromEntity(eu), nil
 }
 
-func (us UserService) Login(ctx context.Context, username string, password string) (TokenString, error) {
-	user, err := us.userRepo.GetOneByUsername(ctx, username)
+func (us UserService) UpdateAbout(ctx context.Context, userID int64, about string) error {
+	about = strings.TrimSpace(about)
+	if utf8.RuneCountInString(about) > domain.MaxAboutLength {
+		return ErrAboutTooLong
+	}
+
+	return us.userRepo.UpdateAbout(ctx, userID, about)
+}
+
+// LoginResult holds the tokens of a login, or the MFAToken to finish it with when the user
+// enabled a second factor
+type LoginResult struct {
+	Tokens   TokenPair
+	MFAToken string
+	// MFATokenExpiresIn is how long the second factor can be entered for
+	MFATokenExpiresIn time.Duration
+}
+
+func (lr LoginResult) MFARequired() bool {
+	return lr.MFAToken != ""
+}
+
+// Login checks the credentials of the user logging in from ip. Unknown usernames fail the same
+// way wrong passwords do and take as long, a hash is verified either way
+func (us UserService) Login(ctx context.Context, username string, password string, ip string) (LoginResult, error) {
+	err := us.loginGuard.Check(ctx, username, ip)
 	if err != nil {
-		if errors.Is(err, repository.ErrUserNotFound) {
-			return "", errors.Join(repository.ErrUserNotFound, ErrUserNotFound)
-		}
-		return "", err
+		return LoginResult{}, err
 	}
 
-	cerr := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+	user, err := us.userRepo.GetOneByUsername(ctx, username)
+	if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+		return LoginResult{}, err
+	}
+
+	hash := user.Password
+	if !user.IsValid() {
+		hash = us.dummyHash
+	}
+
+	needsRehash, cerr := us.hasher.Verify(hash, password)
+	if cerr == nil && !user.IsValid() {
+		cerr = pkg.ErrPasswordMismatch
+	}
 
 	if cerr != nil {
-		return "", errors.Join(ErrWrongCredentials, cerr)
+		// a hash weaker than the dummy fails sooner than an unknown username does, verifying the
+		// dummy on top keeps accounts that still have one from being told apart
+		if user.IsValid() && us.hasher.Weaker(hash) {
+			_, _ = us.hasher.Verify(us.dummyHash, password)
+		}
+
+		lerr := us.loginGuard.RegisterFailure(ctx, username, ip)
+		return LoginResult{}, errors.Join(ErrWrongCredentials, cerr, lerr)
+	}
+
+	// only told once the password is right, so suspended accounts can not be found by guessing
+	if user.SuspendedAt.Valid {
+		return LoginResult{}, ErrUserSuspended
+	}
+
+	// the password is only known right now, it is the one chance to upgrade its hash
+	if needsRehash {
+		us.rehashPassword(ctx, user.Id, password)
+	}
+
+	// the failures of the account are only forgotten once the second factor is right too, or
+	// knowing the password would allow guessing codes without ever being locked out
+	if user.TOTPEnabledAt.Valid {
+		return us.issueMFAChallenge(ctx, user.Id)
+	}
+
+	us.loginGuard.RegisterSuccess(ctx, username)
+
+	tokens, err := us.authSrv.IssueTokens(ctx, user.Id)
+	if err != nil {
+		return LoginResult{}, err
 	}
 
-	return us.authSrv.GenerateToken(user.Id)
+	return LoginResult{Tokens: tokens}, nil
 }
 
-func (us UserService) Register(ctx context.Context, username string, password string) error {
+// Register creates the user and mails a link to verify their email address, a failing mail
+// does not fail the registration since the link can be sent again
+func (us UserService) Register(ctx context.Context, username string, email string, password string) error {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return err
+	}
+
 	user, err := us.userRepo.GetOneByUsername(ctx, username)
 	if err != nil && !errors.Is(repository.ErrUserNotFound, err) {
 		return err
@@ -67,18 +171,51 @@ func (us UserService) Register(ctx context.Context, username string, password st
 		return ErrUserAlreadyRegistered
 	}
 
-	hashedPasswordBytes, err := bcrypt.GenerateFromPassword([]byte(password), 4)
+	_, err = us.userRepo.GetOneByEmail(ctx, email)
+	if err == nil {
+		return ErrEmailAlreadyRegistered
+	}
+	if !errors.Is(err, repository.ErrUserNotFound) {
+		return err
+	}
+
+	hashedPassword, err := us.hashPassword(password)
 	if err != nil {
 		return err
 	}
 
-	return us.authSrv.userRepo.Insert(ctx, username, string(hashedPasswordBytes))
+	userID, err := us.userRepo.Insert(ctx, username, email, hashedPassword)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserAlreadyExists) {
+			return errors.Join(ErrUserAlreadyRegistered, err)
+		}
+
+		return err
+	}
+
+	err = us.sendEmailVerification(ctx, userID, email)
+	if err != nil {
+		slog.WarnContext(ctx, "sending the email verification failed", "userID", userID, "err", err)
+	}
+
+	return nil
 }
 
-func (us UserService) List(ctx context.Context) ([]domain.User, error) {
-	eusers, err := us.userRepo.ListAll(ctx)
+// List is the admin listing of users, it is paginated and never loads the password hashes
+func (us UserService) List(ctx context.Context, actor domain.Actor, filters domain.UserFilters) ([]domain.User, error) {
+	if !actor.Role.Can(domain.PermissionManageUsers) {
+		return make([]domain.User, 0), ErrPermissionDenied
+	}
+
+	eusers, err := us.userRepo.List(ctx, repository.UserListQuery{
+		Search:    strings.TrimSpace(filters.Search),
+		Suspended: filters.Suspended,
+		Order:     repository.UserOrder(filters.Sort),
+		Size:      filters.Size,
+		Page:      filters.Page,
+	})
 	if err != nil {
-		return []domain.User{}, err
+		return make([]domain.User, 0), err
 	}
 
 	dusers := make([]domain.User, len(eusers))
@@ -88,3 +225,118 @@ func (us UserService) List(ctx context.Context) ([]domain.User, error) {
 
 	return dusers, nil
 }
+
+// UpdateRole is an audited admin action, the access tokens carry the role so the ones the user
+// already holds are revoked and the new role applies once they log in again
+func (us UserService) UpdateRole(ctx context.Context, actor domain.Actor, userID int64, role domain.Role) error {
+	if !actor.Role.Can(domain.PermissionManageUsers) {
+		return ErrPermissionDenied
+	}
+
+	if !role.IsValid() {
+		return ErrInvalidRole
+	}
+
+	eu, err := us.userRepo.GetOneByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if domain.Role(eu.Role) == role {
+		return nil
+	}
+
+	al := domain.NewAuditLog(actor, domain.AuditActionUpdateUserRole, domain.AuditTargetUser, userID, map[string]any{
+		"from": eu.Role,
+		"to":   role,
+	})
+
+	err = us.userRepo.UpdateRole(ctx, userID, string(role), al.ToEntity())
+	if err != nil {
+		return err
+	}
+
+	// the previous role is kept by the tokens until they expire when this fails
+	err = us.authSrv.RevokeUserAccess(ctx, userID)
+	if err != nil {
+		slog.WarnContext(ctx, "revoking the tokens of the user whose role changed failed", "userID", userID, "err", err)
+	}
+
+	return nil
+}
+
+func (us UserService) Delete(ctx context.Context, actor domain.Actor, userID int64) error {
+	if !actor.Role.Can(domain.PermissionManageUsers) {
+		return ErrPermissionDenied
+	}
+
+	eu, err := us.userRepo.GetOneByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	al := domain.NewAuditLog(actor, domain.AuditActionDeleteUser, domain.AuditTargetUser, userID, map[string]any{
+		"username": eu.Username,
+	})
+
+	err = us.userRepo.DeleteByID(ctx, userID, al.ToEntity())
+	if err != nil {
+		return err
+	}
+
+	// Authorize only reads the user back for revoked tokens
+	err = us.authSrv.RevokeUserAccess(ctx, userID)
+	if err != nil {
+		slog.WarnContext(ctx, "revoking the tokens of the deleted user failed", "userID", userID, "err", err)
+	}
+
+	return nil
+}
+
+// SetSuspended suspends or lifts the suspension of the user, suspending also revokes the tokens
+// the user already holds so they have to log in again once the suspension is lifted
+func (us UserService) SetSuspended(ctx context.Context, actor domain.Actor, userID int64, suspended bool) error {
+	if !actor.Role.Can(domain.PermissionManageUsers) {
+		return ErrPermissionDenied
+	}
+
+	if suspended && actor.UserID == userID {
+		return ErrSuspendSelf
+	}
+
+	eu, err := us.userRepo.GetOneByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if eu.SuspendedAt.Valid == suspended {
+		return nil
+	}
+
+	action := domain.AuditActionUnsuspendUser
+	if suspended {
+		action = domain.AuditActionSuspendUser
+	}
+
+	al := domain.NewAuditLog(actor, action, domain.AuditTargetUser, userID, map[string]any{
+		"username": eu.Username,
+	})
+
+	err = us.userRepo.UpdateSuspended(ctx, userID, suspended, al.ToEntity())
+	if err != nil {
+		return err
+	}
+
+	if !suspended {
+		return nil
+	}
+
+	// Authorize reads the suspension for the revoked tokens, it is checked on every request only
+	// while redis is down
+	err = us.authSrv.RevokeUserAccess(ctx, userID)
+	if err != nil {
+		slog.WarnContext(ctx, "revoking the tokens of the suspended user failed", "userID", userID, "err", err)
+	}
+
+	return nil
+}
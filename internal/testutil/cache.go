@@ -0,0 +1,24 @@
+// Package testutil holds the fixtures the tests of the other packages share, it is not
+// meant to be imported outside of tests
+package testutil
+
+import (
+	"testing"
+
+	"example.com/authorization/pkg"
+	"github.com/alicebob/miniredis/v2"
+)
+
+// NewCache returns a cache backed by an in-memory redis that goes away with the test, the
+// server is returned too for tests that have to fast forward time or take it down
+func NewCache(t testing.TB) (pkg.Cache, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	cache := pkg.NewCache(mr.Addr(), pkg.CacheOptions{})
+	t.Cleanup(func() {
+		cache.Client.Close()
+	})
+
+	return cache, mr
+}
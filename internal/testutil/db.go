@@ -0,0 +1,84 @@
+package testutil
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"testing"
+
+	"example.com/authorization/migration"
+	"example.com/authorization/pkg"
+	"github.com/go-sql-driver/mysql"
+)
+
+// mysqlURIEnv names the MySQL server the tests run against, in the form of MYSQL_CONNECTION_URI.
+// The tests needing a database are skipped without it
+const mysqlURIEnv = "TEST_MYSQL_CONNECTION_URI"
+
+// NewDB returns a database of its own on the MySQL server of TEST_MYSQL_CONNECTION_URI, migrated
+// with the migrations the application ships and dropped with the test
+func NewDB(t testing.TB) pkg.SQLRepository {
+	t.Helper()
+
+	uri := os.Getenv(mysqlURIEnv)
+	if uri == "" {
+		t.Skip(mysqlURIEnv + " is not set")
+	}
+
+	cfg, err := mysql.ParseDSN(uri)
+	if err != nil {
+		t.Fatalf("invalid %s: %v", mysqlURIEnv, err)
+	}
+
+	b := make([]byte, 8)
+	rand.Read(b)
+	cfg.DBName = "test_" + hex.EncodeToString(b)
+	// the entities scan timestamps into sql.NullTime
+	cfg.ParseTime = true
+
+	server, err := pkg.NewSQLRepository(uri)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer server.DB.Close()
+
+	ctx := context.Background()
+	_, err = server.DB.ExecContext(ctx, "CREATE DATABASE `"+cfg.DBName+"` CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sqlRepo, err := pkg.NewSQLRepository(cfg.FormatDSN())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	t.Cleanup(func() {
+		sqlRepo.DB.Close()
+
+		server, err := pkg.NewSQLRepository(uri)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			return
+		}
+		defer server.DB.Close()
+
+		_, err = server.DB.ExecContext(context.Background(), "DROP DATABASE `"+cfg.DBName+"`")
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	migrator, err := pkg.NewMigrator(sqlRepo, migration.FS)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = migrator.Up(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return sqlRepo
+}
@@ -0,0 +1,241 @@
+package testutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/authorization/pkg"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	OIDCClientID     = "news"
+	OIDCClientSecret = "s3cret"
+)
+
+type oidcAuthorization struct {
+	challenge   string
+	nonce       string
+	redirectURL string
+	identity    pkg.OIDCIdentity
+}
+
+// OIDCProvider is an OpenID Connect provider just good enough for the authorization code flow
+// with PKCE, it signs ID tokens with ES256
+type OIDCProvider struct {
+	Server *httptest.Server
+	key    *ecdsa.PrivateKey
+
+	mu             sync.Mutex
+	authorizations map[string]oidcAuthorization
+	requests       map[string]int
+	// overrides of the next ID tokens, for the tests of tokens that must be refused
+	audience   string
+	nonce      string
+	signingKey *ecdsa.PrivateKey
+}
+
+func NewOIDCProvider(t testing.TB) *OIDCProvider {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	p := &OIDCProvider{
+		key:            key,
+		authorizations: make(map[string]oidcAuthorization),
+		requests:       make(map[string]int),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{
+			"issuer":                 p.Server.URL,
+			"authorization_endpoint": p.Server.URL + "/authorize",
+			"token_endpoint":         p.Server.URL + "/token",
+			"jwks_uri":               p.Server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		point, err := key.PublicKey.Bytes()
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, nil)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"keys": []map[string]string{{
+				"kty": "EC",
+				"kid": "stub",
+				"use": "sig",
+				"crv": "P-256",
+				"x":   base64.RawURLEncoding.EncodeToString(point[1:33]),
+				"y":   base64.RawURLEncoding.EncodeToString(point[33:]),
+			}},
+		})
+	})
+	mux.HandleFunc("POST /token", p.handleToken)
+
+	p.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		p.requests[r.URL.Path]++
+		p.mu.Unlock()
+
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(p.Server.Close)
+
+	return p
+}
+
+// Config is the configuration of a client of the provider named name
+func (p *OIDCProvider) Config(name string) pkg.OIDCProviderConfig {
+	return pkg.OIDCProviderConfig{
+		Name:         name,
+		IssuerURL:    p.Server.URL,
+		ClientID:     OIDCClientID,
+		ClientSecret: OIDCClientSecret,
+		Scopes:       []string{"openid", "email"},
+	}
+}
+
+// Authorize plays the user logging in as identity at the URL the client sent them to and
+// returns the code they are redirected back with
+func (p *OIDCProvider) Authorize(t testing.TB, authURL string, identity pkg.OIDCIdentity) string {
+	t.Helper()
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	query := u.Query()
+	if u.Path != "/authorize" || query.Get("response_type") != "code" || query.Get("client_id") != OIDCClientID || query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected authorization url %s", authURL)
+	}
+
+	code := rand.Text()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.authorizations[code] = oidcAuthorization{
+		challenge:   query.Get("code_challenge"),
+		nonce:       query.Get("nonce"),
+		redirectURL: query.Get("redirect_uri"),
+		identity:    identity,
+	}
+
+	return code
+}
+
+// Requests is how many requests the provider got for path
+func (p *OIDCProvider) Requests(path string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.requests[path]
+}
+
+// SetAudience makes the next ID tokens issued to audience instead of the client
+func (p *OIDCProvider) SetAudience(audience string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.audience = audience
+}
+
+// SetNonce makes the next ID tokens carry nonce instead of the one the login was started with
+func (p *OIDCProvider) SetNonce(nonce string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.nonce = nonce
+}
+
+// SetSigningKey makes the next ID tokens signed with key instead of the published one
+func (p *OIDCProvider) SetSigningKey(key *ecdsa.PrivateKey) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.signingKey = key
+}
+
+func (p *OIDCProvider) handleToken(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok || clientID != OIDCClientID || clientSecret != OIDCClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	code := r.PostFormValue("code")
+	authorization, ok := p.authorizations[code]
+	delete(p.authorizations, code)
+
+	challenge := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("redirect_uri") != authorization.redirectURL ||
+		base64.RawURLEncoding.EncodeToString(challenge[:]) != authorization.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	audience, nonce, signingKey := OIDCClientID, authorization.nonce, p.key
+	if p.audience != "" {
+		audience = p.audience
+	}
+	if p.nonce != "" {
+		nonce = p.nonce
+	}
+	if p.signingKey != nil {
+		signingKey = p.signingKey
+	}
+
+	identity := authorization.identity
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss":                p.Server.URL,
+		"sub":                identity.Subject,
+		"aud":                audience,
+		"exp":                time.Now().Add(5 * time.Minute).Unix(),
+		"iat":                time.Now().Unix(),
+		"nonce":              nonce,
+		"email":              identity.Email,
+		"email_verified":     identity.EmailVerified,
+		"preferred_username": identity.PreferredUsername,
+		"name":               identity.Name,
+	})
+	token.Header["kid"] = "stub"
+
+	idToken, err := token.SignedString(signingKey)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, nil)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,4 @@
+ALTER TABLE `comment` DROP INDEX `idx_post_id_parent_id`;
+ALTER TABLE `comment` DROP FOREIGN KEY FK_CommentParentID;
+ALTER TABLE `comment` DROP COLUMN `deleted_at`;
+ALTER TABLE `comment` DROP COLUMN `parent_id`;
@@ -0,0 +1,6 @@
+ALTER TABLE `comment` ADD `parent_id` INT NULL;
+ALTER TABLE `comment` ADD `deleted_at` TIMESTAMP NULL;
+ALTER TABLE `comment`
+ADD CONSTRAINT FK_CommentParentID
+FOREIGN KEY (`parent_id`) REFERENCES `comment`(`id`) ON DELETE CASCADE;
+CREATE INDEX `idx_post_id_parent_id` ON `comment` (`post_id`, `parent_id`);
@@ -0,0 +1,5 @@
+ALTER TABLE `post` DROP INDEX `idx_upvote_count`;
+ALTER TABLE `post` DROP INDEX `idx_hot_score`;
+ALTER TABLE `post` DROP COLUMN `hot_score`;
+ALTER TABLE `post` DROP COLUMN `comment_count`;
+ALTER TABLE `post` DROP COLUMN `upvote_count`;
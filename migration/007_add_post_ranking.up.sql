@@ -0,0 +1,10 @@
+ALTER TABLE `post` ADD `upvote_count` INT NOT NULL DEFAULT 0;
+ALTER TABLE `post` ADD `comment_count` INT NOT NULL DEFAULT 0;
+ALTER TABLE `post` ADD `hot_score` DOUBLE NOT NULL DEFAULT 0;
+
+UPDATE `post` SET
+    `upvote_count` = (SELECT COUNT(*) FROM `user_post_upvote` WHERE `user_post_upvote`.`post_id` = `post`.`id`),
+    `comment_count` = (SELECT COUNT(*) FROM `comment` WHERE `comment`.`post_id` = `post`.`id` AND `comment`.`deleted_at` IS NULL);
+
+CREATE INDEX `idx_hot_score` ON `post` (`hot_score`, `id`);
+CREATE INDEX `idx_upvote_count` ON `post` (`upvote_count`, `id`);
@@ -0,0 +1,14 @@
+ALTER TABLE `user` ADD `role` VARCHAR(32) NOT NULL DEFAULT 'user';
+
+CREATE TABLE IF NOT EXISTS `audit_log` (
+    `id` INT AUTO_INCREMENT PRIMARY KEY,
+    `actor_id` INT NOT NULL,
+    `action` VARCHAR(64) NOT NULL,
+    `target_type` VARCHAR(32) NOT NULL,
+    `target_id` INT NOT NULL,
+    `details` TEXT NULL,
+    `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX `idx_actor_id` (`actor_id`),
+    INDEX `idx_target` (`target_type`, `target_id`),
+    INDEX `idx_created_at` (`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
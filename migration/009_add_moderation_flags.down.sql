@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS `flag`;
+ALTER TABLE `comment` DROP COLUMN `hidden_at`;
+ALTER TABLE `comment` DROP COLUMN `flag_count`;
+ALTER TABLE `post` DROP COLUMN `hidden_at`;
+ALTER TABLE `post` DROP COLUMN `flag_count`;
@@ -0,0 +1,19 @@
+ALTER TABLE `post` ADD `flag_count` INT NOT NULL DEFAULT 0;
+ALTER TABLE `post` ADD `hidden_at` TIMESTAMP NULL DEFAULT NULL;
+ALTER TABLE `comment` ADD `flag_count` INT NOT NULL DEFAULT 0;
+ALTER TABLE `comment` ADD `hidden_at` TIMESTAMP NULL DEFAULT NULL;
+
+CREATE TABLE IF NOT EXISTS `flag` (
+    `id` INT AUTO_INCREMENT PRIMARY KEY,
+    `user_id` INT NOT NULL,
+    `target_type` VARCHAR(32) NOT NULL,
+    `target_id` INT NOT NULL,
+    `reason` VARCHAR(32) NOT NULL,
+    `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    `resolved_at` TIMESTAMP NULL DEFAULT NULL,
+    `resolved_by` INT NULL,
+    `resolution` VARCHAR(32) NULL,
+    FOREIGN KEY (`user_id`) REFERENCES `user`(`id`) ON DELETE CASCADE,
+    UNIQUE INDEX `idx_user_target` (`user_id`, `target_type`, `target_id`),
+    INDEX `idx_target_resolved_at` (`target_type`, `target_id`, `resolved_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
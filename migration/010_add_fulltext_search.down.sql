@@ -0,0 +1,2 @@
+ALTER TABLE `comment` DROP INDEX `ft_comment_content`;
+ALTER TABLE `post` DROP INDEX `ft_post_description_url`;
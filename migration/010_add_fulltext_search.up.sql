@@ -0,0 +1,2 @@
+CREATE FULLTEXT INDEX `ft_post_description_url` ON `post` (`description`, `url`);
+CREATE FULLTEXT INDEX `ft_comment_content` ON `comment` (`content`);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS `post_revision`;
+ALTER TABLE `post` DROP COLUMN `edited_at`;
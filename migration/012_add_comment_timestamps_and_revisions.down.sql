@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS `comment_revision`;
+ALTER TABLE `comment` DROP COLUMN `edited_at`;
+ALTER TABLE `comment` DROP COLUMN `updated_at`;
+ALTER TABLE `comment` DROP COLUMN `created_at`;
@@ -0,0 +1,16 @@
+ALTER TABLE `comment` ADD `created_at` TIMESTAMP NULL DEFAULT NULL;
+UPDATE `comment` JOIN `post` ON `post`.`id` = `comment`.`post_id` SET `comment`.`created_at` = COALESCE(`post`.`created_at`, '1970-01-01 00:00:01');
+ALTER TABLE `comment` MODIFY `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE `comment` ADD `updated_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP;
+ALTER TABLE `comment` ADD `edited_at` TIMESTAMP NULL DEFAULT NULL;
+
+CREATE TABLE IF NOT EXISTS `comment_revision` (
+    `id` INT AUTO_INCREMENT PRIMARY KEY,
+    `comment_id` INT NOT NULL,
+    `user_id` INT NOT NULL,
+    `content` TEXT NOT NULL,
+    `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (`comment_id`) REFERENCES `comment`(`id`) ON DELETE CASCADE,
+    FOREIGN KEY (`user_id`) REFERENCES `user`(`id`) ON DELETE CASCADE,
+    INDEX `idx_comment_id` (`comment_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
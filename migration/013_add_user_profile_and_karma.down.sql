@@ -0,0 +1,2 @@
+ALTER TABLE `user` DROP COLUMN `karma`;
+ALTER TABLE `user` DROP COLUMN `about`;
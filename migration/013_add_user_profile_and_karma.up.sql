@@ -0,0 +1,13 @@
+ALTER TABLE `user` ADD `about` TEXT NULL;
+ALTER TABLE `user` ADD `karma` INT NOT NULL DEFAULT 0;
+
+UPDATE `user` SET
+    `karma` = (
+        SELECT COUNT(*) FROM `user_post_upvote`
+        JOIN `post` ON `post`.`id` = `user_post_upvote`.`post_id`
+        WHERE `post`.`user_id` = `user`.`id` AND `user_post_upvote`.`user_id` <> `user`.`id`
+    ) + (
+        SELECT COUNT(*) FROM `user_comment_upvote`
+        JOIN `comment` ON `comment`.`id` = `user_comment_upvote`.`comment_id`
+        WHERE `comment`.`user_id` = `user`.`id` AND `user_comment_upvote`.`user_id` <> `user`.`id`
+    );
@@ -0,0 +1,2 @@
+ALTER TABLE `user` DROP INDEX `idx_karma`;
+ALTER TABLE `user` DROP COLUMN `suspended_at`;
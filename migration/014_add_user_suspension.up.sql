@@ -0,0 +1,3 @@
+ALTER TABLE `user` ADD `suspended_at` TIMESTAMP NULL DEFAULT NULL;
+
+CREATE INDEX `idx_karma` ON `user` (`karma`, `id`);
@@ -0,0 +1,4 @@
+ALTER TABLE `user` DROP INDEX `idx_email`;
+CREATE INDEX `idx_email` ON `user` (`email`);
+
+ALTER TABLE `user` DROP COLUMN `email_verified_at`;
@@ -0,0 +1,4 @@
+ALTER TABLE `user` ADD `email_verified_at` TIMESTAMP NULL DEFAULT NULL;
+
+ALTER TABLE `user` DROP INDEX `idx_email`;
+CREATE UNIQUE INDEX `idx_email` ON `user` (`email`);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS `user_recovery_code`;
+ALTER TABLE `user` DROP COLUMN `totp_enabled_at`;
+ALTER TABLE `user` DROP COLUMN `totp_secret`;
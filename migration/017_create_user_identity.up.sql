@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS `user_identity` (
+    `id` INT AUTO_INCREMENT PRIMARY KEY,
+    `user_id` INT NOT NULL,
+    `provider` VARCHAR(64) NOT NULL,
+    `subject` VARCHAR(255) NOT NULL,
+    `email` VARCHAR(255) NULL,
+    `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (`user_id`) REFERENCES `user`(`id`) ON DELETE CASCADE,
+    UNIQUE INDEX `idx_provider_subject` (`provider`, `subject`),
+    INDEX `idx_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,7 @@
+// Package migration embeds the SQL migrations so the binary can apply them with `migrate`
+package migration
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
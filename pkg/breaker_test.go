@@ -0,0 +1,98 @@
+package pkg_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"example.com/authorization/pkg"
+)
+
+func TestBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	t.Parallel()
+
+	breaker := pkg.NewCircuitBreaker(3, time.Minute, nil)
+
+	for i := range 3 {
+		if err := breaker.Allow(); err != nil {
+			t.Fatalf("expected call %d to be allowed, got %v", i, err)
+		}
+		breaker.Record(true)
+	}
+
+	if err := breaker.Allow(); !errors.Is(err, pkg.ErrCircuitOpen) {
+		t.Fatalf("expected the breaker to be open, got %v", err)
+	}
+}
+
+func TestBreakerSuccessResetsFailures(t *testing.T) {
+	t.Parallel()
+
+	breaker := pkg.NewCircuitBreaker(2, time.Minute, nil)
+
+	breaker.Allow()
+	breaker.Record(true)
+	breaker.Allow()
+	breaker.Record(false)
+	breaker.Allow()
+	breaker.Record(true)
+
+	if state := breaker.State(); state != pkg.BreakerClosed {
+		t.Fatalf("expected failures separated by a success to keep the breaker closed, got %s", state)
+	}
+}
+
+func TestBreakerProbesAfterCooldown(t *testing.T) {
+	t.Parallel()
+
+	var transitions []pkg.BreakerState
+	breaker := pkg.NewCircuitBreaker(1, 10*time.Millisecond, func(s pkg.BreakerState) {
+		transitions = append(transitions, s)
+	})
+
+	breaker.Allow()
+	breaker.Record(true)
+
+	time.Sleep(20 * time.Millisecond)
+
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("expected a probe after the cooldown, got %v", err)
+	}
+	if err := breaker.Allow(); !errors.Is(err, pkg.ErrCircuitOpen) {
+		t.Fatalf("expected a single probe at a time, got %v", err)
+	}
+
+	breaker.Record(false)
+
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("expected a successful probe to close the breaker, got %v", err)
+	}
+
+	want := []pkg.BreakerState{pkg.BreakerOpen, pkg.BreakerHalfOpen, pkg.BreakerClosed}
+	if len(transitions) != len(want) {
+		t.Fatalf("expected transitions %v, got %v", want, transitions)
+	}
+	for i := range want {
+		if transitions[i] != want[i] {
+			t.Fatalf("expected transitions %v, got %v", want, transitions)
+		}
+	}
+}
+
+func TestBreakerFailedProbeReopens(t *testing.T) {
+	t.Parallel()
+
+	breaker := pkg.NewCircuitBreaker(1, 10*time.Millisecond, nil)
+
+	breaker.Allow()
+	breaker.Record(true)
+
+	time.Sleep(20 * time.Millisecond)
+
+	breaker.Allow()
+	breaker.Record(true)
+
+	if err := breaker.Allow(); !errors.Is(err, pkg.ErrCircuitOpen) {
+		t.Fatalf("expected a failed probe to reopen the breaker, got %v", err)
+	}
+}
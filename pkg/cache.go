@@ -1,19 +1,384 @@
 package pkg
 
-import "github.com/redis/go-redis/v9"
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
+)
+
+// generationKeyPrefix namespaces the generation counters of the cache tags
+const generationKeyPrefix = "gen:"
+
+// fetchBeta weighs the early refresh of Fetch, above one entries are refreshed earlier
+const fetchBeta = 1.0
+
+// fetchHeaderSize is the size of the recompute time and expiry stored ahead of a Fetch value
+const fetchHeaderSize = 16
 
 type Cache struct {
 	Client *redis.Client
+	// flight coalesces the concurrent loads of the same key done by Fetch
+	flight  *singleflight.Group
+	breaker *CircuitBreaker
+	metrics *cacheMetrics
+	// random draws the early refreshes of Fetch, rand.Float64 when nil
+	random func() float64
+}
+
+// CacheOptions bounds how much a slow or unreachable redis can cost a request, zero values
+// fall back to the defaults
+type CacheOptions struct {
+	// Timeout caps dialing, reading and writing a single command
+	Timeout time.Duration
+	// BreakerThreshold is how many consecutive failures open the circuit breaker
+	BreakerThreshold int
+	// BreakerCooldown is how long the breaker stays open before probing redis again
+	BreakerCooldown time.Duration
+	// Random returns the numbers in [0, 1) the early refreshes of Fetch are drawn with, the
+	// closer to one the earlier the refresh. Tests use it to decide whether entries are refreshed
+	Random func() float64
+}
+
+// CacheStats are the counters of a Cache, they are exported with expvar
+type CacheStats struct {
+	Commands     int64  `json:"commands"`
+	Failures     int64  `json:"failures"`
+	Rejected     int64  `json:"rejected"`
+	Hits         int64  `json:"hits"`
+	Misses       int64  `json:"misses"`
+	BreakerOpens int64  `json:"breakerOpens"`
+	Breaker      string `json:"breaker"`
+}
+
+type cacheMetrics struct {
+	commands     atomic.Int64
+	failures     atomic.Int64
+	rejected     atomic.Int64
+	hits         atomic.Int64
+	misses       atomic.Int64
+	breakerOpens atomic.Int64
 }
 
-func NewCache(addr string) Cache {
+// NewCache connects to redis behind a circuit breaker, while it is open commands fail right away
+// with ErrCircuitOpen instead of waiting on a dead connection. Every read of the cache has to
+// fall back to the source of truth and every write has to be safe to lose
+func NewCache(addr string, opts CacheOptions) Cache {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 100 * time.Millisecond
+	}
+	if opts.BreakerThreshold <= 0 {
+		opts.BreakerThreshold = 5
+	}
+	if opts.BreakerCooldown <= 0 {
+		opts.BreakerCooldown = 10 * time.Second
+	}
+
 	rdb := redis.NewClient(&redis.Options{
-		Addr:     addr,
-		Password: "", // no password set
-		DB:       0,  // use default DB
+		Addr:                  addr,
+		Password:              "", // no password set
+		DB:                    0,  // use default DB
+		DialTimeout:           opts.Timeout,
+		ReadTimeout:           opts.Timeout,
+		WriteTimeout:          opts.Timeout,
+		PoolTimeout:           opts.Timeout,
+		ContextTimeoutEnabled: true,
+		// a retry doubles the time lost on a dead redis, the breaker takes over from there
+		MaxRetries: 1,
+	})
+
+	metrics := &cacheMetrics{}
+	breaker := NewCircuitBreaker(opts.BreakerThreshold, opts.BreakerCooldown, func(state BreakerState) {
+		switch state {
+		case BreakerOpen:
+			metrics.breakerOpens.Add(1)
+			slog.Warn("cache circuit breaker opened", "addr", addr)
+		case BreakerClosed:
+			slog.Info("cache circuit breaker closed", "addr", addr)
+		default:
+			slog.Debug("cache circuit breaker probing", "addr", addr)
+		}
+	})
+
+	rdb.AddHook(breakerHook{
+		breaker: breaker,
+		metrics: metrics,
 	})
 
 	return Cache{
-		Client: rdb,
+		Client:  rdb,
+		flight:  &singleflight.Group{},
+		breaker: breaker,
+		metrics: metrics,
+		random:  opts.Random,
+	}
+}
+
+// Stats returns a snapshot of the cache counters
+func (c Cache) Stats() CacheStats {
+	if c.metrics == nil {
+		return CacheStats{Breaker: BreakerClosed.String()}
+	}
+
+	return CacheStats{
+		Commands:     c.metrics.commands.Load(),
+		Failures:     c.metrics.failures.Load(),
+		Rejected:     c.metrics.rejected.Load(),
+		Hits:         c.metrics.hits.Load(),
+		Misses:       c.metrics.misses.Load(),
+		BreakerOpens: c.metrics.breakerOpens.Load(),
+		Breaker:      c.breaker.State().String(),
+	}
+}
+
+// breakerHook runs every redis command and pipeline through the circuit breaker
+type breakerHook struct {
+	breaker *CircuitBreaker
+	metrics *cacheMetrics
+}
+
+func (h breakerHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h breakerHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if err := h.allow(); err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+
+		err := next(ctx, cmd)
+		h.record(err)
+
+		return err
+	}
+}
+
+func (h breakerHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if err := h.allow(); err != nil {
+			for _, cmd := range cmds {
+				cmd.SetErr(err)
+			}
+			return err
+		}
+
+		err := next(ctx, cmds)
+		h.record(err)
+
+		return err
+	}
+}
+
+func (h breakerHook) allow() error {
+	err := h.breaker.Allow()
+	if err != nil {
+		h.metrics.rejected.Add(1)
+	}
+
+	return err
+}
+
+func (h breakerHook) record(err error) {
+	h.metrics.commands.Add(1)
+
+	failed := isCacheFailure(err)
+	if failed {
+		h.metrics.failures.Add(1)
+	}
+
+	h.breaker.Record(failed)
+}
+
+// isCacheFailure tells apart redis being unreachable or slow from a missing key, an error
+// reply to a command or the caller giving up, only the first says anything about redis health
+func isCacheFailure(err error) bool {
+	if err == nil || errors.Is(err, redis.Nil) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var rerr redis.Error
+	return !errors.As(err, &rerr)
+}
+
+// Fetch reads key through the cache, load is called on a miss and its result is kept for ttl.
+// Concurrent misses of the same key share a single load, and entries are refreshed a little
+// before they expire with a probability growing as the expiry gets closer and with the time
+// load took the last time (XFetch), so a popular key expiring does not send every reader to
+// the database at once. A failing cache never fails the read, load is called instead
+func (c Cache) Fetch(ctx context.Context, key string, ttl time.Duration, load func(context.Context) ([]byte, error)) ([]byte, error) {
+	// a failed read is a miss, the breaker hook already accounts for it
+	raw, err := c.Client.Get(ctx, key).Bytes()
+	if err == nil && len(raw) >= fetchHeaderSize {
+		delta := time.Duration(binary.BigEndian.Uint64(raw[:8]))
+		expiry := time.UnixMilli(int64(binary.BigEndian.Uint64(raw[8:fetchHeaderSize])))
+
+		if !c.shouldRefreshEarly(time.Now(), delta, expiry) {
+			c.count(func(m *cacheMetrics) { m.hits.Add(1) })
+			return raw[fetchHeaderSize:], nil
+		}
 	}
+
+	c.count(func(m *cacheMetrics) { m.misses.Add(1) })
+
+	if c.flight == nil {
+		return c.load(ctx, key, ttl, load)
+	}
+
+	v, err, _ := c.flight.Do(key, func() (any, error) {
+		// the load outlives the first caller if it goes away, the others still wait for it
+		return c.load(context.WithoutCancel(ctx), key, ttl, load)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.([]byte), nil
+}
+
+// load calls load and stores its result alongside the time it took and the entry expiry
+func (c Cache) load(ctx context.Context, key string, ttl time.Duration, load func(context.Context) ([]byte, error)) ([]byte, error) {
+	start := time.Now()
+	value, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	delta := time.Since(start)
+
+	raw := make([]byte, fetchHeaderSize, fetchHeaderSize+len(value))
+	binary.BigEndian.PutUint64(raw[:8], uint64(delta))
+	binary.BigEndian.PutUint64(raw[8:], uint64(start.Add(ttl).UnixMilli()))
+	raw = append(raw, value...)
+
+	err = c.Client.Set(ctx, key, raw, ttl).Err()
+	if err != nil && !errors.Is(err, ErrCircuitOpen) {
+		slog.WarnContext(ctx, "storing the cache entry failed", "key", key, "err", err)
+	}
+
+	return value, nil
+}
+
+func (c Cache) count(f func(m *cacheMetrics)) {
+	if c.metrics != nil {
+		f(c.metrics)
+	}
+}
+
+// shouldRefreshEarly decides whether an entry that took delta to compute is refreshed now,
+// see "Optimal Probabilistic Cache Stampede Prevention" by Vattani et al.
+func (c Cache) shouldRefreshEarly(now time.Time, delta time.Duration, expiry time.Time) bool {
+	random := c.random
+	if random == nil {
+		random = rand.Float64
+	}
+
+	// 1 - random() is in (0, 1] so the log is never infinite
+	gap := -float64(delta) * fetchBeta * math.Log(1-random())
+
+	return !now.Add(time.Duration(gap)).Before(expiry)
+}
+
+// VersionedKey appends the current generation of every tag to key. Invalidating a tag bumps its
+// generation so every key built with it before is never read again and simply expires, there is no
+// need to know or scan the keys belonging to a tag
+func (c Cache) VersionedKey(ctx context.Context, key string, tags ...string) (string, error) {
+	if len(tags) == 0 {
+		return key, nil
+	}
+
+	generations, err := c.Generations(ctx, tags...)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(key)
+	for i, tag := range tags {
+		sb.WriteString("@")
+		sb.WriteString(tag)
+		sb.WriteString("=")
+		sb.WriteString(strconv.FormatInt(generations[i], 10))
+	}
+
+	return sb.String(), nil
+}
+
+// Generations returns the current generation of each tag
+func (c Cache) Generations(ctx context.Context, tags ...string) ([]int64, error) {
+	keys := generationKeys(tags)
+
+	values, err := c.Client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	generations := make([]int64, len(tags))
+	for i, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			// the counter was never set or got evicted, it is seeded instead of starting over
+			// at zero so keys built with an earlier generation can not come back to life
+			generations[i], err = c.seedGeneration(ctx, keys[i])
+			if err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		generations[i], err = strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return generations, nil
+}
+
+// Invalidate bumps the generation of every tag
+func (c Cache) Invalidate(ctx context.Context, tags ...string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	seed := time.Now().UnixNano()
+	_, err := c.Client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for _, key := range generationKeys(tags) {
+			p.SetNX(ctx, key, seed, 0)
+			p.Incr(ctx, key)
+		}
+
+		return nil
+	})
+
+	return err
+}
+
+func (c Cache) seedGeneration(ctx context.Context, key string) (int64, error) {
+	_, err := c.Client.SetNX(ctx, key, time.Now().UnixNano(), 0).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	// somebody else may have seeded or bumped it in the meantime
+	return c.Client.Get(ctx, key).Int64()
+}
+
+func generationKeys(tags []string) []string {
+	keys := make([]string, len(tags))
+	for i, tag := range tags {
+		keys[i] = generationKeyPrefix + tag
+	}
+
+	return keys
 }
@@ -0,0 +1,443 @@
+package pkg_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"example.com/authorization/internal/testutil"
+	"example.com/authorization/pkg"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestVersionedKeyIsStableUntilInvalidated(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cache, _ := testutil.NewCache(t)
+
+	first, err := cache.VersionedKey(ctx, "comments:_1", "post:1")
+	if err != nil {
+		t.Fatalf("versioned key: %v", err)
+	}
+
+	second, err := cache.VersionedKey(ctx, "comments:_1", "post:1")
+	if err != nil {
+		t.Fatalf("versioned key: %v", err)
+	}
+	if first != second {
+		t.Fatalf("expected the same key without an invalidation, got %q and %q", first, second)
+	}
+
+	if err := cache.Invalidate(ctx, "post:1"); err != nil {
+		t.Fatalf("invalidate: %v", err)
+	}
+
+	third, err := cache.VersionedKey(ctx, "comments:_1", "post:1")
+	if err != nil {
+		t.Fatalf("versioned key: %v", err)
+	}
+	if third == first {
+		t.Fatalf("expected a new key after invalidating the tag, got %q again", third)
+	}
+}
+
+func TestInvalidateOnlyAffectsItsTag(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cache, _ := testutil.NewCache(t)
+
+	before, err := cache.VersionedKey(ctx, "comments:_2", "post:2")
+	if err != nil {
+		t.Fatalf("versioned key: %v", err)
+	}
+
+	if err := cache.Invalidate(ctx, "post:1"); err != nil {
+		t.Fatalf("invalidate: %v", err)
+	}
+
+	after, err := cache.VersionedKey(ctx, "comments:_2", "post:2")
+	if err != nil {
+		t.Fatalf("versioned key: %v", err)
+	}
+	if before != after {
+		t.Fatalf("expected post:2 keys to survive invalidating post:1, got %q and %q", before, after)
+	}
+}
+
+func TestVersionedKeyChangesWhenAnyTagIsInvalidated(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cache, _ := testutil.NewCache(t)
+
+	before, err := cache.VersionedKey(ctx, "feed", "posts", "post:3")
+	if err != nil {
+		t.Fatalf("versioned key: %v", err)
+	}
+
+	if err := cache.Invalidate(ctx, "post:3"); err != nil {
+		t.Fatalf("invalidate: %v", err)
+	}
+
+	after, err := cache.VersionedKey(ctx, "feed", "posts", "post:3")
+	if err != nil {
+		t.Fatalf("versioned key: %v", err)
+	}
+	if before == after {
+		t.Fatalf("expected a new key after invalidating one of its tags, got %q again", after)
+	}
+}
+
+func TestInvalidatedEntriesAreNotServed(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cache, _ := testutil.NewCache(t)
+
+	key, err := cache.VersionedKey(ctx, "comments:_4", "post:4")
+	if err != nil {
+		t.Fatalf("versioned key: %v", err)
+	}
+
+	if err := cache.Client.Set(ctx, key, "stale page", 0).Err(); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+
+	if err := cache.Invalidate(ctx, "post:4"); err != nil {
+		t.Fatalf("invalidate: %v", err)
+	}
+
+	key, err = cache.VersionedKey(ctx, "comments:_4", "post:4")
+	if err != nil {
+		t.Fatalf("versioned key: %v", err)
+	}
+
+	if exists, _ := cache.Client.Exists(ctx, key).Result(); exists != 0 {
+		t.Fatalf("expected no entry under the new key %q", key)
+	}
+}
+
+func TestEvictedGenerationDoesNotRevivePreviousKeys(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cache, mr := testutil.NewCache(t)
+
+	var seen []string
+	for range 3 {
+		key, err := cache.VersionedKey(ctx, "comments:_5", "post:5")
+		if err != nil {
+			t.Fatalf("versioned key: %v", err)
+		}
+		seen = append(seen, key)
+
+		if err := cache.Invalidate(ctx, "post:5"); err != nil {
+			t.Fatalf("invalidate: %v", err)
+		}
+	}
+
+	// losing the counter, as with an eviction, must not hand out an earlier generation again
+	mr.Del("gen:post:5")
+
+	key, err := cache.VersionedKey(ctx, "comments:_5", "post:5")
+	if err != nil {
+		t.Fatalf("versioned key: %v", err)
+	}
+
+	for _, s := range seen {
+		if key == s {
+			t.Fatalf("expected a fresh key after the generation was lost, got the earlier %q", key)
+		}
+	}
+}
+
+func TestVersionedKeyWithoutTags(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cache, _ := testutil.NewCache(t)
+
+	key, err := cache.VersionedKey(ctx, "plain")
+	if err != nil {
+		t.Fatalf("versioned key: %v", err)
+	}
+	if key != "plain" {
+		t.Fatalf("expected the key untouched, got %q", key)
+	}
+}
+
+func TestFetchLoadsOnceAndServesFromTheCache(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cache, _ := testutil.NewCache(t)
+
+	var loads atomic.Int64
+	load := func(context.Context) ([]byte, error) {
+		loads.Add(1)
+		return []byte("page"), nil
+	}
+
+	for range 3 {
+		value, err := cache.Fetch(ctx, "feed:1", time.Minute, load)
+		if err != nil {
+			t.Fatalf("fetch: %v", err)
+		}
+		if string(value) != "page" {
+			t.Fatalf("expected %q, got %q", "page", value)
+		}
+	}
+
+	if n := loads.Load(); n != 1 {
+		t.Fatalf("expected a single load, got %d", n)
+	}
+}
+
+func TestFetchCoalescesConcurrentMisses(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cache, _ := testutil.NewCache(t)
+
+	var loads atomic.Int64
+	release := make(chan struct{})
+	load := func(context.Context) ([]byte, error) {
+		loads.Add(1)
+		<-release
+		return []byte("page"), nil
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for range 50 {
+		wg.Go(func() {
+			value, err := cache.Fetch(ctx, "feed:2", time.Minute, load)
+			if err == nil && string(value) != "page" {
+				err = errors.New("unexpected value " + string(value))
+			}
+			errs <- err
+		})
+	}
+
+	// give the readers time to pile up on the miss
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("fetch: %v", err)
+		}
+	}
+
+	if n := loads.Load(); n != 1 {
+		t.Fatalf("expected the concurrent misses to share one load, got %d", n)
+	}
+}
+
+func TestFetchDoesNotCacheFailedLoads(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cache, _ := testutil.NewCache(t)
+
+	errLoad := errors.New("database is down")
+	_, err := cache.Fetch(ctx, "feed:3", time.Minute, func(context.Context) ([]byte, error) {
+		return nil, errLoad
+	})
+	if !errors.Is(err, errLoad) {
+		t.Fatalf("expected the load error, got %v", err)
+	}
+
+	value, err := cache.Fetch(ctx, "feed:3", time.Minute, func(context.Context) ([]byte, error) {
+		return []byte("page"), nil
+	})
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if string(value) != "page" {
+		t.Fatalf("expected the failed load to be retried, got %q", value)
+	}
+}
+
+func TestFetchRefreshesEntriesPastTheirExpiry(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cache, _ := testutil.NewCache(t)
+
+	// the entry is still in redis, miniredis only expires keys when told to, but its
+	// logical expiry has passed so it is always refreshed
+	_, err := cache.Fetch(ctx, "feed:4", 30*time.Millisecond, func(context.Context) ([]byte, error) {
+		time.Sleep(20 * time.Millisecond)
+		return []byte("old"), nil
+	})
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	value, err := cache.Fetch(ctx, "feed:4", time.Minute, func(context.Context) ([]byte, error) {
+		return []byte("new"), nil
+	})
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if string(value) != "new" {
+		t.Fatalf("expected the entry to be refreshed, got %q", value)
+	}
+}
+
+func TestFetchRefreshesBeforeTheEntryExpires(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+
+	// zero never refreshes early, the closer to one the earlier the refresh
+	var draw float64
+	cache := pkg.NewCache(mr.Addr(), pkg.CacheOptions{
+		Random: func() float64 {
+			return draw
+		},
+	})
+	t.Cleanup(func() {
+		cache.Client.Close()
+	})
+
+	// the gap an entry is refreshed ahead of its expiry grows with the time the load took
+	start := time.Now()
+	_, err := cache.Fetch(ctx, "feed:5", time.Second, func(context.Context) ([]byte, error) {
+		time.Sleep(50 * time.Millisecond)
+		return []byte("old"), nil
+	})
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+
+	load := func(context.Context) ([]byte, error) {
+		return []byte("new"), nil
+	}
+
+	value, err := cache.Fetch(ctx, "feed:5", time.Second, load)
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if string(value) != "old" {
+		t.Fatalf("expected the cached entry, got %q", value)
+	}
+
+	// the largest draw moves the refresh about 37 times the 50ms load, close to 2s, ahead of
+	// the expiry so the one second long entry is refreshed right away
+	draw = math.Nextafter(1, 0)
+
+	value, err = cache.Fetch(ctx, "feed:5", time.Second, load)
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if time.Since(start) >= time.Second {
+		t.Fatalf("the entry expired, the refresh was not early")
+	}
+	if string(value) != "new" {
+		t.Fatalf("expected the entry to be refreshed before it expires, got %q", value)
+	}
+}
+
+func TestCacheFailsOpenWhenRedisIsDown(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	cache := pkg.NewCache(mr.Addr(), pkg.CacheOptions{
+		Timeout:          50 * time.Millisecond,
+		BreakerThreshold: 2,
+		BreakerCooldown:  time.Minute,
+	})
+	t.Cleanup(func() {
+		cache.Client.Close()
+	})
+
+	mr.Close()
+
+	var loads atomic.Int64
+	load := func(context.Context) ([]byte, error) {
+		loads.Add(1)
+		return []byte("page"), nil
+	}
+
+	for range 10 {
+		value, err := cache.Fetch(ctx, "feed:5", time.Minute, load)
+		if err != nil {
+			t.Fatalf("fetch: %v", err)
+		}
+		if string(value) != "page" {
+			t.Fatalf("expected %q, got %q", "page", value)
+		}
+	}
+
+	if n := loads.Load(); n != 10 {
+		t.Fatalf("expected every read to go to the source, got %d loads", n)
+	}
+
+	stats := cache.Stats()
+	if stats.Breaker != "open" {
+		t.Fatalf("expected the breaker to be open, got %s", stats.Breaker)
+	}
+	if stats.Rejected == 0 {
+		t.Fatalf("expected commands to be rejected while the breaker is open")
+	}
+
+	// once open, the cache answers without touching the network. The hook added last runs
+	// inside the breaker, it only sees what gets past it
+	var reached countingHook
+	cache.Client.AddHook(&reached)
+
+	if _, err := cache.VersionedKey(ctx, "comments:_5", "post:5"); !errors.Is(err, pkg.ErrCircuitOpen) {
+		t.Fatalf("expected %v, got %v", pkg.ErrCircuitOpen, err)
+	}
+
+	if dials, commands := reached.dials.Load(), reached.commands.Load(); dials != 0 || commands != 0 {
+		t.Fatalf("expected an open breaker to fail fast, got %d dials and %d commands", dials, commands)
+	}
+
+	if after := cache.Stats(); after.Commands != stats.Commands || after.Rejected <= stats.Rejected {
+		t.Fatalf("expected the command to be rejected without being sent, got %+v after %+v", after, stats)
+	}
+}
+
+// countingHook counts the dials and commands that reach it
+type countingHook struct {
+	dials    atomic.Int64
+	commands atomic.Int64
+}
+
+func (h *countingHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		h.dials.Add(1)
+		return next(ctx, network, addr)
+	}
+}
+
+func (h *countingHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		h.commands.Add(1)
+		return next(ctx, cmd)
+	}
+}
+
+func (h *countingHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		h.commands.Add(int64(len(cmds)))
+		return next(ctx, cmds)
+	}
+}
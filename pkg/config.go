@@ -5,17 +5,100 @@ import (
 	"log/slog"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type Config struct {
-	DBConnectionURI    string
-	JwtSecret          string
-	RedisAddr          string
-	LogLevel           slog.Level
-	CorsAllowedOrigins string
-	GrpcAddr           string
+	DBConnectionURI         string
+	JwtSecret               string
+	RedisAddr               string
+	LogLevel                slog.Level
+	CorsAllowedOrigins      string
+	GrpcAddr                string
+	HotScoreRefreshInterval time.Duration
+	AccessTokenTTL          time.Duration
+	RefreshTokenTTL         time.Duration
+	JwtSigningKeysDir       string
+	// JwtActiveKeyID is the kid of the key file signing new tokens until a key of the schedule of
+	// the key directory takes over, it can be left empty when the schedule has an active key
+	JwtActiveKeyID       string
+	JwtKeyReloadInterval time.Duration
+	// JwtKeyPublishLead is how long a key file added while running is in the JWKS before it can
+	// sign, zero lets it sign as soon as its scheduled time has come
+	JwtKeyPublishLead time.Duration
+	// FlagHideThreshold is how many distinct users have to flag a post or comment before it is hidden, zero disables hiding
+	FlagHideThreshold uint64
+	// AutoMigrate applies pending migrations on boot, otherwise they are applied with the migrate subcommand
+	AutoMigrate bool
+	// PostEditWindow is how long after submitting a post its owner can still edit it, zero means forever
+	PostEditWindow time.Duration
+	// CommentEditWindow is how long after posting a comment its author can still edit it, zero means forever
+	CommentEditWindow time.Duration
+	// FeedCacheTTL is how long a page of the public posts feed is cached, zero disables the cache
+	FeedCacheTTL time.Duration
+	// CacheTimeout caps every redis command, a slow redis is treated like an unavailable one
+	CacheTimeout time.Duration
+	// CacheBreakerThreshold is how many consecutive redis failures stop sending commands to it
+	CacheBreakerThreshold int
+	// CacheBreakerCooldown is how long redis is left alone before it is tried again
+	CacheBreakerCooldown time.Duration
+	// AnalyticsBufferSize is how many analytics writes wait to be flushed, more are dropped
+	AnalyticsBufferSize int
+	// AnalyticsRetention is how long the daily analytics are kept in redis
+	AnalyticsRetention time.Duration
+	// PostViewWindow is how long repeated views of a post by the same viewer count as one
+	PostViewWindow time.Duration
+	// TrendingHalfLife is how long it takes for a view or upvote to weigh half as much on trending
+	TrendingHalfLife time.Duration
+	// TrendingDecayInterval is how often the trending scores are decayed
+	TrendingDecayInterval time.Duration
+	// TrustedProxies are the reverse proxies allowed to set X-Forwarded-For, it is ignored when empty
+	TrustedProxies TrustedProxies
+	// PublicURL is where users reach the app, links in mails point to it
+	PublicURL string
+	// SMTPAddr is the host:port of the SMTP server, mails are written to MailDir when it is empty
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+	// SMTPTimeout caps a whole SMTP conversation, from dialing the server to the mail being accepted
+	SMTPTimeout time.Duration
+	// SMTPMaxConcurrentSends is how many mails are sent at once, the others wait for their turn
+	SMTPMaxConcurrentSends int
+	MailFrom               string
+	// MailDir is where mails are written when no SMTP server is configured, they are only logged when it is empty
+	MailDir string
+	// EmailVerificationTTL is how long the link sent to verify an email address works
+	EmailVerificationTTL time.Duration
+	// PasswordResetTTL is how long the link sent to reset a password works
+	PasswordResetTTL time.Duration
+	// PasswordMinLength is the fewest characters a new password can have
+	PasswordMinLength int
+	// PasswordDenylistFile lists breached passwords, one per line, that can not be picked
+	PasswordDenylistFile string
+	// PasswordHashAlgorithm is bcrypt or argon2id, hashes of the other algorithm keep working
+	PasswordHashAlgorithm string
+	BcryptCost            int
+	Argon2                Argon2Params
+	// LoginMaxAccountFailures is how many logins into an account can fail within LoginFailureWindow before it is locked out
+	LoginMaxAccountFailures int
+	// LoginMaxIPFailures is how many logins from a client IP can fail within LoginFailureWindow before it is locked out
+	LoginMaxIPFailures int
+	LoginFailureWindow time.Duration
+	// LoginLockoutBase is the first lockout, it doubles with every further failure up to LoginLockoutMax
+	LoginLockoutBase time.Duration
+	LoginLockoutMax  time.Duration
+	// TOTPIssuer is the name authenticator apps show the account under
+	TOTPIssuer string
+	// MFAChallengeTTL is how long a user has to enter their second factor after the password
+	MFAChallengeTTL time.Duration
+	// OIDCProviders are the OpenID Connect providers users can log in with
+	OIDCProviders []OIDCProviderConfig
+	// OAuthStateTTL is how long a login at an OIDC provider can take
+	OAuthStateTTL time.Duration
 }
 
 func LoadConfig() (Config, error) {
@@ -26,8 +109,10 @@ func LoadConfig() (Config, error) {
 		return Config{}, err
 	}
 
+	// the shared secret is only needed when tokens are not signed with key files
+	jwtSigningKeysDir := os.Getenv("JWT_SIGNING_KEYS_DIR")
 	jwtSecret, err := requireEnv("JWT_SECRET")
-	if err != nil {
+	if err != nil && jwtSigningKeysDir == "" {
 		return Config{}, err
 	}
 
@@ -55,13 +140,305 @@ func LoadConfig() (Config, error) {
 		grpcAddr = "0.0.0.0:4040"
 	}
 
+	hotScoreRefreshInterval, err := durationEnv("HOT_SCORE_REFRESH_INTERVAL", time.Minute)
+	if err != nil {
+		return Config{}, err
+	}
+
+	accessTokenTTL, err := durationEnv("ACCESS_TOKEN_TTL", 15*time.Minute)
+	if err != nil {
+		return Config{}, err
+	}
+
+	refreshTokenTTL, err := durationEnv("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+	if err != nil {
+		return Config{}, err
+	}
+
+	jwtKeyReloadInterval, err := durationEnv("JWT_KEY_RELOAD_INTERVAL", 5*time.Minute)
+	if err != nil {
+		return Config{}, err
+	}
+
+	// picked explicitly or through the schedule.json of the key directory, anything read off the
+	// key files themselves changes with a copy or a restore
+	jwtActiveKeyID := os.Getenv("JWT_ACTIVE_KEY_ID")
+
+	jwtKeyPublishLead, err := optionalDurationEnv("JWT_KEY_PUBLISH_LEAD", 10*time.Minute)
+	if err != nil {
+		return Config{}, err
+	}
+
+	flagHideThreshold := uint64(3)
+	if fht := os.Getenv("FLAG_HIDE_THRESHOLD"); fht != "" {
+		flagHideThreshold, err = strconv.ParseUint(fht, 10, 64)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid FLAG_HIDE_THRESHOLD %q: %w", fht, err)
+		}
+	}
+
+	postEditWindow, err := optionalDurationEnv("POST_EDIT_WINDOW", 2*time.Hour)
+	if err != nil {
+		return Config{}, err
+	}
+
+	commentEditWindow, err := optionalDurationEnv("COMMENT_EDIT_WINDOW", 2*time.Hour)
+	if err != nil {
+		return Config{}, err
+	}
+
+	feedCacheTTL, err := optionalDurationEnv("FEED_CACHE_TTL", 30*time.Second)
+	if err != nil {
+		return Config{}, err
+	}
+
+	cacheTimeout, err := durationEnv("CACHE_TIMEOUT", 100*time.Millisecond)
+	if err != nil {
+		return Config{}, err
+	}
+
+	cacheBreakerThreshold := 5
+	if cbt := os.Getenv("CACHE_BREAKER_THRESHOLD"); cbt != "" {
+		cacheBreakerThreshold, err = strconv.Atoi(cbt)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid CACHE_BREAKER_THRESHOLD %q: %w", cbt, err)
+		}
+	}
+
+	cacheBreakerCooldown, err := durationEnv("CACHE_BREAKER_COOLDOWN", 10*time.Second)
+	if err != nil {
+		return Config{}, err
+	}
+
+	analyticsBufferSize := 1024
+	if abs := os.Getenv("ANALYTICS_BUFFER_SIZE"); abs != "" {
+		analyticsBufferSize, err = strconv.Atoi(abs)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid ANALYTICS_BUFFER_SIZE %q: %w", abs, err)
+		}
+	}
+
+	analyticsRetention, err := durationEnv("ANALYTICS_RETENTION", 90*24*time.Hour)
+	if err != nil {
+		return Config{}, err
+	}
+
+	postViewWindow, err := durationEnv("POST_VIEW_WINDOW", time.Hour)
+	if err != nil {
+		return Config{}, err
+	}
+
+	trendingHalfLife, err := durationEnv("TRENDING_HALF_LIFE", 6*time.Hour)
+	if err != nil {
+		return Config{}, err
+	}
+
+	trendingDecayInterval, err := durationEnv("TRENDING_DECAY_INTERVAL", 10*time.Minute)
+	if err != nil {
+		return Config{}, err
+	}
+
+	trustedProxies, err := ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		return Config{}, err
+	}
+
+	publicURL := os.Getenv("PUBLIC_URL")
+	if publicURL == "" {
+		publicURL = "http://localhost:3030"
+	}
+
+	mailFrom := os.Getenv("MAIL_FROM")
+	if mailFrom == "" {
+		mailFrom = "no-reply@localhost"
+	}
+
+	smtpTimeout, err := durationEnv("SMTP_TIMEOUT", 10*time.Second)
+	if err != nil {
+		return Config{}, err
+	}
+
+	smtpMaxConcurrentSends := 4
+	if smcs := os.Getenv("SMTP_MAX_CONCURRENT_SENDS"); smcs != "" {
+		smtpMaxConcurrentSends, err = strconv.Atoi(smcs)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid SMTP_MAX_CONCURRENT_SENDS %q: %w", smcs, err)
+		}
+	}
+
+	emailVerificationTTL, err := durationEnv("EMAIL_VERIFICATION_TTL", 48*time.Hour)
+	if err != nil {
+		return Config{}, err
+	}
+
+	passwordResetTTL, err := durationEnv("PASSWORD_RESET_TTL", time.Hour)
+	if err != nil {
+		return Config{}, err
+	}
+
+	passwordMinLength := 8
+	if pml := os.Getenv("PASSWORD_MIN_LENGTH"); pml != "" {
+		passwordMinLength, err = strconv.Atoi(pml)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid PASSWORD_MIN_LENGTH %q: %w", pml, err)
+		}
+	}
+
+	passwordHashAlgorithm := PasswordHashBcrypt
+	if pha := os.Getenv("PASSWORD_HASH_ALGORITHM"); pha != "" {
+		if pha != PasswordHashBcrypt && pha != PasswordHashArgon2id {
+			return Config{}, fmt.Errorf("invalid PASSWORD_HASH_ALGORITHM %q: must be %s or %s", pha, PasswordHashBcrypt, PasswordHashArgon2id)
+		}
+		passwordHashAlgorithm = pha
+	}
+
+	bcryptCost := bcrypt.DefaultCost
+	if bc := os.Getenv("BCRYPT_COST"); bc != "" {
+		bcryptCost, err = strconv.Atoi(bc)
+		if err != nil || bcryptCost < bcrypt.MinCost || bcryptCost > bcrypt.MaxCost {
+			return Config{}, fmt.Errorf("invalid BCRYPT_COST %q: must be between %d and %d", bc, bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	}
+
+	// OWASP's recommended minimum, 19 MiB of memory and two passes
+	argon2Params := Argon2Params{
+		Memory:  19 * 1024,
+		Time:    2,
+		Threads: 1,
+	}
+	if am := os.Getenv("ARGON2_MEMORY"); am != "" {
+		memory, err := strconv.ParseUint(am, 10, 32)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid ARGON2_MEMORY %q: %w", am, err)
+		}
+		argon2Params.Memory = uint32(memory)
+	}
+	if at := os.Getenv("ARGON2_TIME"); at != "" {
+		passes, err := strconv.ParseUint(at, 10, 32)
+		if err != nil || passes == 0 {
+			return Config{}, fmt.Errorf("invalid ARGON2_TIME %q", at)
+		}
+		argon2Params.Time = uint32(passes)
+	}
+	if at := os.Getenv("ARGON2_THREADS"); at != "" {
+		threads, err := strconv.ParseUint(at, 10, 8)
+		if err != nil || threads == 0 {
+			return Config{}, fmt.Errorf("invalid ARGON2_THREADS %q", at)
+		}
+		argon2Params.Threads = uint8(threads)
+	}
+
+	loginMaxAccountFailures := 5
+	if lmaf := os.Getenv("LOGIN_MAX_ACCOUNT_FAILURES"); lmaf != "" {
+		loginMaxAccountFailures, err = strconv.Atoi(lmaf)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid LOGIN_MAX_ACCOUNT_FAILURES %q: %w", lmaf, err)
+		}
+	}
+
+	loginMaxIPFailures := 20
+	if lmif := os.Getenv("LOGIN_MAX_IP_FAILURES"); lmif != "" {
+		loginMaxIPFailures, err = strconv.Atoi(lmif)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid LOGIN_MAX_IP_FAILURES %q: %w", lmif, err)
+		}
+	}
+
+	loginFailureWindow, err := durationEnv("LOGIN_FAILURE_WINDOW", 15*time.Minute)
+	if err != nil {
+		return Config{}, err
+	}
+
+	loginLockoutBase, err := durationEnv("LOGIN_LOCKOUT_BASE", 30*time.Second)
+	if err != nil {
+		return Config{}, err
+	}
+
+	loginLockoutMax, err := durationEnv("LOGIN_LOCKOUT_MAX", time.Hour)
+	if err != nil {
+		return Config{}, err
+	}
+
+	totpIssuer := os.Getenv("TOTP_ISSUER")
+	if totpIssuer == "" {
+		totpIssuer = "authorization"
+	}
+
+	mfaChallengeTTL, err := durationEnv("MFA_CHALLENGE_TTL", 5*time.Minute)
+	if err != nil {
+		return Config{}, err
+	}
+
+	oidcProviders, err := LoadOIDCProviders(os.Getenv("OIDC_PROVIDERS"))
+	if err != nil {
+		return Config{}, err
+	}
+
+	oauthStateTTL, err := durationEnv("OAUTH_STATE_TTL", 10*time.Minute)
+	if err != nil {
+		return Config{}, err
+	}
+
+	autoMigrate := false
+	if am := os.Getenv("AUTO_MIGRATE"); am != "" {
+		autoMigrate, err = strconv.ParseBool(am)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid AUTO_MIGRATE %q: %w", am, err)
+		}
+	}
+
 	return Config{
-		DBConnectionURI:    dbConnectionURI,
-		JwtSecret:          jwtSecret,
-		RedisAddr:          redisAddress,
-		LogLevel:           logLevel,
-		CorsAllowedOrigins: corsAllowedOrigins,
-		GrpcAddr:           grpcAddr,
+		DBConnectionURI:         dbConnectionURI,
+		JwtSecret:               jwtSecret,
+		RedisAddr:               redisAddress,
+		LogLevel:                logLevel,
+		CorsAllowedOrigins:      corsAllowedOrigins,
+		GrpcAddr:                grpcAddr,
+		HotScoreRefreshInterval: hotScoreRefreshInterval,
+		AccessTokenTTL:          accessTokenTTL,
+		RefreshTokenTTL:         refreshTokenTTL,
+		JwtSigningKeysDir:       jwtSigningKeysDir,
+		JwtKeyReloadInterval:    jwtKeyReloadInterval,
+		JwtActiveKeyID:          jwtActiveKeyID,
+		JwtKeyPublishLead:       jwtKeyPublishLead,
+		FlagHideThreshold:       flagHideThreshold,
+		AutoMigrate:             autoMigrate,
+		PostEditWindow:          postEditWindow,
+		CommentEditWindow:       commentEditWindow,
+		FeedCacheTTL:            feedCacheTTL,
+		CacheTimeout:            cacheTimeout,
+		CacheBreakerThreshold:   cacheBreakerThreshold,
+		CacheBreakerCooldown:    cacheBreakerCooldown,
+		AnalyticsBufferSize:     analyticsBufferSize,
+		AnalyticsRetention:      analyticsRetention,
+		PostViewWindow:          postViewWindow,
+		TrendingHalfLife:        trendingHalfLife,
+		TrendingDecayInterval:   trendingDecayInterval,
+		TrustedProxies:          trustedProxies,
+		PublicURL:               strings.TrimSuffix(publicURL, "/"),
+		SMTPAddr:                os.Getenv("SMTP_ADDR"),
+		SMTPUsername:            os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:            os.Getenv("SMTP_PASSWORD"),
+		SMTPTimeout:             smtpTimeout,
+		SMTPMaxConcurrentSends:  smtpMaxConcurrentSends,
+		MailFrom:                mailFrom,
+		MailDir:                 os.Getenv("MAIL_DIR"),
+		EmailVerificationTTL:    emailVerificationTTL,
+		PasswordResetTTL:        passwordResetTTL,
+		PasswordMinLength:       passwordMinLength,
+		PasswordDenylistFile:    os.Getenv("PASSWORD_DENYLIST_FILE"),
+		PasswordHashAlgorithm:   passwordHashAlgorithm,
+		BcryptCost:              bcryptCost,
+		Argon2:                  argon2Params,
+		LoginMaxAccountFailures: loginMaxAccountFailures,
+		LoginMaxIPFailures:      loginMaxIPFailures,
+		LoginFailureWindow:      loginFailureWindow,
+		LoginLockoutBase:        loginLockoutBase,
+		LoginLockoutMax:         loginLockoutMax,
+		TOTPIssuer:              totpIssuer,
+		MFAChallengeTTL:         mfaChallengeTTL,
+		OIDCProviders:           oidcProviders,
+		OAuthStateTTL:           oauthStateTTL,
 	}, nil
 }
 
@@ -73,3 +450,37 @@ func requireEnv(key string) (string, error) {
 
 	return value, nil
 }
+
+// durationEnv reads a duration that has to be positive, the intervals end up in tickers which
+// panic on anything else
+func durationEnv(key string, fallback time.Duration) (time.Duration, error) {
+	d, err := optionalDurationEnv(key, fallback)
+	if err != nil {
+		return 0, err
+	}
+
+	if d == 0 {
+		return 0, fmt.Errorf("invalid %s %q: must be positive", key, os.Getenv(key))
+	}
+
+	return d, nil
+}
+
+// optionalDurationEnv reads a duration of a setting that zero turns off
+func optionalDurationEnv(key string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, value, err)
+	}
+
+	if d < 0 {
+		return 0, fmt.Errorf("invalid %s %q: must not be negative", key, value)
+	}
+
+	return d, nil
+}
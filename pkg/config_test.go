@@ -0,0 +1,61 @@
+package pkg_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/authorization/pkg"
+)
+
+// setRequiredEnv sets what LoadConfig can not do without, the tests using it can not run in
+// parallel since the environment is shared
+func setRequiredEnv(t *testing.T) {
+	t.Helper()
+
+	t.Setenv("MYSQL_CONNECTION_URI", "user:password@tcp(localhost:3306)/db")
+	t.Setenv("JWT_SECRET", "secret")
+	t.Setenv("REDIS_ADDR", "localhost:6379")
+}
+
+func TestLoadConfigRefusesDurationsThatAreNotPositive(t *testing.T) {
+	for _, key := range []string{"HOT_SCORE_REFRESH_INTERVAL", "ACCESS_TOKEN_TTL", "REFRESH_TOKEN_TTL", "JWT_KEY_RELOAD_INTERVAL", "TRENDING_HALF_LIFE", "TRENDING_DECAY_INTERVAL"} {
+		for _, value := range []string{"0", "0s", "-1m"} {
+			setRequiredEnv(t)
+			t.Setenv(key, value)
+
+			_, err := pkg.LoadConfig()
+			if err == nil || !strings.Contains(err.Error(), key) {
+				t.Errorf("%s=%s: expected an error naming the variable, got %v", key, value, err)
+			}
+
+			t.Setenv(key, "")
+		}
+	}
+}
+
+func TestLoadConfigLetsZeroTurnSettingsOff(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv("POST_EDIT_WINDOW", "0")
+	t.Setenv("FEED_CACHE_TTL", "0s")
+
+	cfg, err := pkg.LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.PostEditWindow != 0 || cfg.FeedCacheTTL != 0 {
+		t.Fatalf("expected zero durations, got %s and %s", cfg.PostEditWindow, cfg.FeedCacheTTL)
+	}
+
+	if cfg.HotScoreRefreshInterval != time.Minute {
+		t.Fatalf("expected the default hot score refresh interval, got %s", cfg.HotScoreRefreshInterval)
+	}
+
+	t.Setenv("COMMENT_EDIT_WINDOW", "-1h")
+
+	_, err = pkg.LoadConfig()
+	if err == nil || !strings.Contains(err.Error(), "COMMENT_EDIT_WINDOW") {
+		t.Fatalf("expected a negative duration to be refused, got %v", err)
+	}
+}
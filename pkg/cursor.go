@@ -0,0 +1,40 @@
+package pkg
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor points right after the last row of a page in a keyset paginated listing,
+// Sort names the ordering it was issued for and Key holds the sort key of that row
+type Cursor struct {
+	Sort string `json:"s"`
+	Key  string `json:"k"`
+	ID   int64  `json:"i"`
+}
+
+// Encode returns the opaque token handed out to clients
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor parses a token returned by Encode and checks it was issued for sort
+func DecodeCursor(token string, sort string) (Cursor, error) {
+	var c Cursor
+
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	err = json.Unmarshal(b, &c)
+	if err != nil || c.Sort != sort || c.ID <= 0 {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	return c, nil
+}
@@ -0,0 +1,5 @@
+package pkg
+
+// the migration internals are tested from pkg_test like the rest of the package
+var SplitStatements = splitStatements
+var ReadMigrations = readMigrations
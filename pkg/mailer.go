@@ -0,0 +1,238 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrInvalidMailHeader = errors.New("invalid mail header")
+
+type Mail struct {
+	To      string
+	Subject string
+	// Body is sent as plain text
+	Body string
+}
+
+// Mailer delivers mails, implementations are picked by the configuration
+type Mailer interface {
+	Send(ctx context.Context, mail Mail) error
+}
+
+// NewMailer returns an SMTPMailer when an SMTP server is configured and a FileMailer otherwise
+func NewMailer(cfg Config) Mailer {
+	if cfg.SMTPAddr != "" {
+		return NewSMTPMailer(cfg.SMTPAddr, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom, cfg.SMTPTimeout, cfg.SMTPMaxConcurrentSends)
+	}
+
+	return NewFileMailer(cfg.MailDir, cfg.MailFrom)
+}
+
+type SMTPMailer struct {
+	addr    string
+	host    string
+	from    string
+	auth    smtp.Auth
+	timeout time.Duration
+	// sends holds a slot per mail being sent, a slow server keeps the others waiting instead of
+	// piling up connections
+	sends chan struct{}
+}
+
+// NewSMTPMailer sends mails through the server at addr, PLAIN authentication is only used when
+// a username is given and net/smtp refuses it over an unencrypted connection to a remote host.
+// Zero values of timeout and maxConcurrentSends fall back to the defaults
+func NewSMTPMailer(addr string, username string, password string, from string, timeout time.Duration, maxConcurrentSends int) SMTPMailer {
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	if maxConcurrentSends <= 0 {
+		maxConcurrentSends = 4
+	}
+
+	host, _, _ := net.SplitHostPort(addr)
+
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return SMTPMailer{
+		addr:    addr,
+		host:    host,
+		from:    from,
+		auth:    auth,
+		timeout: timeout,
+		sends:   make(chan struct{}, maxConcurrentSends),
+	}
+}
+
+// Send waits for its turn as long as ctx allows, the conversation with the server is then cut
+// short when ctx is done or the timeout passes, whichever comes first
+func (sm SMTPMailer) Send(ctx context.Context, mail Mail) error {
+	msg, err := formatMail(sm.from, mail)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case sm.sends <- struct{}{}:
+		defer func() { <-sm.sends }()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sm.timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", sm.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// net/smtp knows nothing about contexts, the connection is closed under it once the timeout
+	// passes or ctx is done
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	err = sm.send(conn, mail.To, msg)
+	if err != nil && ctx.Err() != nil {
+		return errors.Join(ctx.Err(), err)
+	}
+
+	return err
+}
+
+// send is smtp.SendMail over a connection that is already open
+func (sm SMTPMailer) send(conn net.Conn, to string, msg []byte) error {
+	c, err := smtp.NewClient(conn, sm.host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		err = c.StartTLS(&tls.Config{ServerName: sm.host})
+		if err != nil {
+			return err
+		}
+	}
+
+	if sm.auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+
+		err = c.Auth(sm.auth)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = c.Mail(sm.from)
+	if err != nil {
+		return err
+	}
+
+	err = c.Rcpt(to)
+	if err != nil {
+		return err
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(msg)
+	if err != nil {
+		return err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// FileMailer writes every mail to its own file in dir so local setups and tests can read them,
+// mails are only logged when dir is empty
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir string, from string) FileMailer {
+	return FileMailer{
+		dir:  dir,
+		from: from,
+	}
+}
+
+func (fm FileMailer) Send(ctx context.Context, mail Mail) error {
+	msg, err := formatMail(fm.from, mail)
+	if err != nil {
+		return err
+	}
+
+	if fm.dir == "" {
+		slog.InfoContext(ctx, "mail not sent, no mail directory is configured", "to", mail.To, "subject", mail.Subject, "body", mail.Body)
+		return nil
+	}
+
+	err = os.MkdirAll(fm.dir, 0o700)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), strings.NewReplacer("/", "_", "\\", "_").Replace(mail.To))
+	path := filepath.Join(fm.dir, name)
+
+	err = os.WriteFile(path, msg, 0o600)
+	if err != nil {
+		return err
+	}
+
+	slog.DebugContext(ctx, "mail written", "to", mail.To, "subject", mail.Subject, "path", path)
+
+	return nil
+}
+
+// formatMail renders the mail as an RFC 5322 message, headers can not carry line breaks
+// or the recipient could slip in headers of their own
+func formatMail(from string, mail Mail) ([]byte, error) {
+	for _, header := range []string{from, mail.To, mail.Subject} {
+		if strings.ContainsAny(header, "\r\n") {
+			return nil, ErrInvalidMailHeader
+		}
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", mail.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", mail.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(mail.Body, "\r\n", "\n"), "\n", "\r\n"))
+
+	return b.Bytes(), nil
+}
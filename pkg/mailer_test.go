@@ -0,0 +1,236 @@
+package pkg_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"example.com/authorization/pkg"
+)
+
+func TestFileMailerWritesOneFilePerMail(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	mailer := pkg.NewFileMailer(dir, "no-reply@example.com")
+
+	err := mailer.Send(context.Background(), pkg.Mail{
+		To:      "bob@example.com",
+		Subject: "Verify your email address",
+		Body:    "first line\nsecond line\n",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("expected one mail file, got %d", len(files))
+	}
+
+	b, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	msg := string(b)
+	for _, want := range []string{"From: no-reply@example.com\r\n", "To: bob@example.com\r\n", "Subject: Verify your email address\r\n", "\r\n\r\nfirst line\r\nsecond line\r\n"} {
+		if !strings.Contains(msg, want) {
+			t.Fatalf("mail is missing %q:\n%s", want, msg)
+		}
+	}
+}
+
+func TestMailerRefusesHeaderInjection(t *testing.T) {
+	t.Parallel()
+
+	mailer := pkg.NewFileMailer(t.TempDir(), "no-reply@example.com")
+
+	err := mailer.Send(context.Background(), pkg.Mail{
+		To:      "bob@example.com\r\nBcc: eve@example.com",
+		Subject: "hello",
+	})
+	if !errors.Is(err, pkg.ErrInvalidMailHeader) {
+		t.Fatalf("expected ErrInvalidMailHeader, got %v", err)
+	}
+}
+
+// smtpServer accepts connections on a local port, it speaks just enough SMTP to take a mail
+// and hands every message it receives to messages. A stalled server never says a word
+func smtpServer(t *testing.T, stalled bool) (string, *atomic.Int64, chan string) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() {
+		ln.Close()
+	})
+
+	var accepted atomic.Int64
+	messages := make(chan string, 1)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+
+			go func() {
+				defer conn.Close()
+
+				if stalled {
+					// wait for the client to hang up
+					conn.Read(make([]byte, 1))
+					return
+				}
+
+				serveSMTP(conn, messages)
+			}()
+		}
+	}()
+
+	return ln.Addr().String(), &accepted, messages
+}
+
+func serveSMTP(conn net.Conn, messages chan string) {
+	r := bufio.NewReader(conn)
+	reply := func(line string) {
+		conn.Write([]byte(line + "\r\n"))
+	}
+
+	reply("220 localhost ESMTP")
+
+	var data strings.Builder
+	inData := false
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		if inData {
+			if line == ".\r\n" {
+				inData = false
+				messages <- data.String()
+				reply("250 OK")
+				continue
+			}
+
+			data.WriteString(line)
+			continue
+		}
+
+		switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case cmd == "DATA":
+			inData = true
+			reply("354 go ahead")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestSMTPMailerDeliversTheMail(t *testing.T) {
+	t.Parallel()
+
+	addr, _, messages := smtpServer(t, false)
+	mailer := pkg.NewSMTPMailer(addr, "", "", "no-reply@example.com", time.Second, 1)
+
+	err := mailer.Send(context.Background(), pkg.Mail{
+		To:      "bob@example.com",
+		Subject: "Reset your password",
+		Body:    "hello",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	msg := <-messages
+	for _, want := range []string{"To: bob@example.com\r\n", "Subject: Reset your password\r\n", "\r\n\r\nhello"} {
+		if !strings.Contains(msg, want) {
+			t.Fatalf("mail is missing %q:\n%s", want, msg)
+		}
+	}
+}
+
+func TestSMTPMailerGivesUpOnAStalledServer(t *testing.T) {
+	t.Parallel()
+
+	addr, _, _ := smtpServer(t, true)
+	mailer := pkg.NewSMTPMailer(addr, "", "", "no-reply@example.com", 100*time.Millisecond, 1)
+
+	start := time.Now()
+	err := mailer.Send(context.Background(), pkg.Mail{To: "bob@example.com", Subject: "hello"})
+	if err == nil {
+		t.Fatalf("expected the send to fail")
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("expected the send to give up after the timeout, it took %v", elapsed)
+	}
+}
+
+func TestSMTPMailerStopsWhenTheContextIsDone(t *testing.T) {
+	t.Parallel()
+
+	addr, _, _ := smtpServer(t, true)
+	mailer := pkg.NewSMTPMailer(addr, "", "", "no-reply@example.com", time.Minute, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := mailer.Send(ctx, pkg.Mail{To: "bob@example.com", Subject: "hello"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestSMTPMailerCapsConcurrentSends(t *testing.T) {
+	t.Parallel()
+
+	addr, accepted, _ := smtpServer(t, true)
+	mailer := pkg.NewSMTPMailer(addr, "", "", "no-reply@example.com", time.Minute, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errs := make(chan error, 3)
+	for range 3 {
+		go func() {
+			errs <- mailer.Send(ctx, pkg.Mail{To: "bob@example.com", Subject: "hello"})
+		}()
+	}
+
+	// the first send holds the only slot talking to the stalled server
+	time.Sleep(200 * time.Millisecond)
+	if n := accepted.Load(); n != 1 {
+		t.Fatalf("expected a single connection, got %d", n)
+	}
+
+	cancel()
+	for range 3 {
+		err := <-errs
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,517 @@
+package pkg
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	migrationsTable = "schema_migrations"
+	// migrationLockName prefixes the name of the MySQL advisory lock held while migrating,
+	// replicas booting at the same time wait for each other instead of racing
+	migrationLockName    = "schema_migrations:"
+	migrationLockTimeout = time.Minute
+)
+
+var ErrMigrationLocked = errors.New("another process is migrating the database")
+var ErrDirtyMigration = errors.New("a migration failed half way, fix the schema by hand and run migrate force")
+var ErrMigrationChecksum = errors.New("an applied migration was changed")
+var ErrUnknownMigration = errors.New("migration does not exist")
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+	// Checksum is the sha256 of the up script, applied migrations are not supposed to change
+	Checksum string
+}
+
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+	Dirty     bool
+	// Changed is set when the up script differs from the one that was applied
+	Changed bool
+}
+
+type appliedMigration struct {
+	Version   int64        `db:"version"`
+	Name      string       `db:"name"`
+	Checksum  string       `db:"checksum"`
+	Dirty     bool         `db:"dirty"`
+	AppliedAt sql.NullTime `db:"applied_at"`
+}
+
+type Migrator struct {
+	db         *sqlx.DB
+	migrations []Migration
+}
+
+// NewMigrator reads the NNN_name.up.sql and NNN_name.down.sql pairs of fsys
+func NewMigrator(sqlRepo SQLRepository, fsys fs.FS) (Migrator, error) {
+	migrations, err := readMigrations(fsys)
+	if err != nil {
+		return Migrator{}, err
+	}
+
+	return Migrator{
+		db:         sqlRepo.DB,
+		migrations: migrations,
+	}, nil
+}
+
+func readMigrations(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, file := range files {
+		base := path.Base(file)
+
+		var direction string
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(base, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migration %s has to end with .up.sql or .down.sql", base)
+		}
+
+		name := strings.TrimSuffix(base, "."+direction+".sql")
+		versionStr, _, _ := strings.Cut(name, "_")
+		version, err := strconv.ParseInt(versionStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s has to start with its version: %w", base, err)
+		}
+
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+
+		if m.Name != name {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", m.Name, name, version)
+		}
+
+		if direction == "up" {
+			m.Up = string(content)
+			sum := sha256.Sum256(content)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Checksum == "" {
+			return nil, fmt.Errorf("migration %s has no up script", m.Name)
+		}
+
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Latest is the version of the newest migration, zero when there are none
+func (m Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up applies every pending migration
+func (m Migrator) Up(ctx context.Context) error {
+	return m.To(ctx, m.Latest())
+}
+
+// Down reverts the last steps applied migrations
+func (m Migrator) Down(ctx context.Context, steps int) error {
+	return m.withLock(ctx, func(conn *sqlx.Conn, applied map[int64]appliedMigration) error {
+		versions := make([]int64, 0, len(applied))
+		for v := range applied {
+			versions = append(versions, v)
+		}
+
+		sort.Slice(versions, func(i, j int) bool {
+			return versions[i] > versions[j]
+		})
+
+		for _, v := range versions[:min(steps, len(versions))] {
+			err := m.revert(ctx, conn, m.find(v))
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// To migrates up or down until every migration up to version and none after it is applied
+func (m Migrator) To(ctx context.Context, version int64) error {
+	if version != 0 && m.find(version) == nil {
+		return fmt.Errorf("%w: %d", ErrUnknownMigration, version)
+	}
+
+	return m.withLock(ctx, func(conn *sqlx.Conn, applied map[int64]appliedMigration) error {
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; !ok || mig.Version <= version {
+				continue
+			}
+
+			err := m.revert(ctx, conn, &mig)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok || mig.Version > version {
+				continue
+			}
+
+			err := m.apply(ctx, conn, mig)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Force records every migration up to version as applied and the rest as pending without running
+// any SQL, it is the way out of a dirty migration and the way to adopt a database migrated by hand
+func (m Migrator) Force(ctx context.Context, version int64) error {
+	if version != 0 && m.find(version) == nil {
+		return fmt.Errorf("%w: %d", ErrUnknownMigration, version)
+	}
+
+	return m.lock(ctx, func(conn *sqlx.Conn) error {
+		_, err := conn.ExecContext(ctx, "DELETE FROM `"+migrationsTable+"`")
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			if mig.Version > version {
+				break
+			}
+
+			_, err := conn.ExecContext(ctx, "INSERT INTO `"+migrationsTable+"` (`version`, `name`, `checksum`, `dirty`) VALUES (?, ?, ?, FALSE)", mig.Version, mig.Name, mig.Checksum)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Status lists every known migration alongside whether and when it was applied
+func (m Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+
+	err := m.lock(ctx, func(conn *sqlx.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			am, ok := applied[mig.Version]
+			statuses = append(statuses, MigrationStatus{
+				Migration: mig,
+				Applied:   ok,
+				AppliedAt: am.AppliedAt.Time,
+				Dirty:     am.Dirty,
+				Changed:   ok && am.Checksum != mig.Checksum,
+			})
+			delete(applied, mig.Version)
+		}
+
+		// applied migrations that are no longer shipped with the binary
+		for _, am := range applied {
+			statuses = append(statuses, MigrationStatus{
+				Migration: Migration{Version: am.Version, Name: am.Name, Checksum: am.Checksum},
+				Applied:   true,
+				AppliedAt: am.AppliedAt.Time,
+				Dirty:     am.Dirty,
+			})
+		}
+
+		return nil
+	})
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+
+	return statuses, err
+}
+
+func (m Migrator) find(version int64) *Migration {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i]
+		}
+	}
+
+	return nil
+}
+
+// withLock runs fn under the migration lock once the applied migrations are known to be
+// clean and unchanged, fn can not fix what a failed migration left behind
+func (m Migrator) withLock(ctx context.Context, fn func(conn *sqlx.Conn, applied map[int64]appliedMigration) error) error {
+	return m.lock(ctx, func(conn *sqlx.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, am := range applied {
+			if am.Dirty {
+				return fmt.Errorf("%w: %s", ErrDirtyMigration, am.Name)
+			}
+
+			mig := m.find(am.Version)
+			if mig == nil {
+				return fmt.Errorf("%w: %s is applied", ErrUnknownMigration, am.Name)
+			}
+
+			if mig.Checksum != am.Checksum {
+				return fmt.Errorf("%w: %s", ErrMigrationChecksum, am.Name)
+			}
+		}
+
+		return fn(conn, applied)
+	})
+}
+
+// lock holds a MySQL advisory lock for the duration of fn, advisory locks belong to a
+// connection so everything runs on the connection that acquired it
+func (m Migrator) lock(ctx context.Context, fn func(conn *sqlx.Conn) error) error {
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// advisory locks are server wide, the lock is one per database so databases sharing a server
+	// are migrated independently. Lock names are capped at 64 characters, hence the hash
+	var lockName string
+	err = conn.QueryRowxContext(ctx, "SELECT CONCAT(?, MD5(DATABASE()))", migrationLockName).Scan(&lockName)
+	if err != nil {
+		return err
+	}
+
+	// GET_LOCK returns 1 once the lock is held, 0 on timeout and NULL on errors
+	var acquired sql.NullInt64
+	err = conn.QueryRowxContext(ctx, "SELECT GET_LOCK(?, ?)", lockName, migrationLockTimeout.Seconds()).Scan(&acquired)
+	if err != nil {
+		return err
+	}
+
+	if acquired.Int64 != 1 {
+		return ErrMigrationLocked
+	}
+
+	defer func() {
+		// the lock is released with the connection anyway, this only makes it happen sooner
+		_, err := conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", lockName)
+		if err != nil {
+			slog.Error("could not release the migration lock", "err", err)
+		}
+	}()
+
+	_, err = conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS `"+migrationsTable+"` ("+
+		"`version` BIGINT PRIMARY KEY,"+
+		"`name` VARCHAR(255) NOT NULL,"+
+		"`checksum` CHAR(64) NOT NULL,"+
+		"`dirty` BOOLEAN NOT NULL DEFAULT FALSE,"+
+		"`applied_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP"+
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci")
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func (m Migrator) applied(ctx context.Context, conn *sqlx.Conn) (map[int64]appliedMigration, error) {
+	var rows []appliedMigration
+	err := conn.SelectContext(ctx, &rows, "SELECT `version`, `name`, `checksum`, `dirty`, `applied_at` FROM `"+migrationsTable+"`")
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int64]appliedMigration, len(rows))
+	for _, am := range rows {
+		applied[am.Version] = am
+	}
+
+	return applied, nil
+}
+
+// apply runs the up script, MySQL commits DDL statements implicitly so the migration is marked
+// dirty until every statement went through instead of being wrapped in a transaction
+func (m Migrator) apply(ctx context.Context, conn *sqlx.Conn, mig Migration) error {
+	slog.InfoContext(ctx, "applying migration", "version", mig.Version, "name", mig.Name)
+
+	_, err := conn.ExecContext(ctx, "INSERT INTO `"+migrationsTable+"` (`version`, `name`, `checksum`, `dirty`) VALUES (?, ?, ?, TRUE)", mig.Version, mig.Name, mig.Checksum)
+	if err != nil {
+		return err
+	}
+
+	err = execScript(ctx, conn, mig.Up)
+	if err != nil {
+		return fmt.Errorf("migration %s failed: %w", mig.Name, err)
+	}
+
+	_, err = conn.ExecContext(ctx, "UPDATE `"+migrationsTable+"` SET `dirty` = FALSE WHERE `version` = ?", mig.Version)
+
+	return err
+}
+
+func (m Migrator) revert(ctx context.Context, conn *sqlx.Conn, mig *Migration) error {
+	slog.InfoContext(ctx, "reverting migration", "version", mig.Version, "name", mig.Name)
+
+	_, err := conn.ExecContext(ctx, "UPDATE `"+migrationsTable+"` SET `dirty` = TRUE WHERE `version` = ?", mig.Version)
+	if err != nil {
+		return err
+	}
+
+	err = execScript(ctx, conn, mig.Down)
+	if err != nil {
+		return fmt.Errorf("reverting migration %s failed: %w", mig.Name, err)
+	}
+
+	_, err = conn.ExecContext(ctx, "DELETE FROM `"+migrationsTable+"` WHERE `version` = ?", mig.Version)
+
+	return err
+}
+
+func execScript(ctx context.Context, conn *sqlx.Conn, script string) error {
+	for _, stmt := range splitStatements(script) {
+		_, err := conn.ExecContext(ctx, stmt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// splitStatements splits a script on the semicolons outside of quotes and comments,
+// the driver runs a single statement per call unless multiStatements is enabled.
+// Comments are dropped except the /*! */ and /*+ */ ones MySQL reads as part of the statement,
+// a backslash escapes the next character inside of strings like it does in MySQL
+func splitStatements(script string) []string {
+	var statements []string
+	var sb strings.Builder
+	var quote rune
+	lineComment := false
+	blockComment := false
+	keepComment := false
+
+	runes := []rune(script)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		next := rune(0)
+		if i+1 < len(runes) {
+			next = runes[i+1]
+		}
+
+		switch {
+		case lineComment:
+			if r == '\n' {
+				lineComment = false
+				sb.WriteRune(r)
+			}
+			continue
+		case blockComment:
+			if r == '*' && next == '/' {
+				blockComment = false
+				if keepComment {
+					sb.WriteString("*/")
+				} else {
+					// like MySQL, a comment separates what is around it
+					sb.WriteRune(' ')
+				}
+				i++
+			} else if keepComment {
+				sb.WriteRune(r)
+			}
+			continue
+		case quote != 0:
+			switch {
+			case r == '\\' && quote != '`' && next != 0:
+				sb.WriteRune(r)
+				r = next
+				i++
+			case r == quote:
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '#' || (r == '-' && next == '-'):
+			lineComment = true
+			continue
+		case r == '/' && next == '*':
+			blockComment = true
+			keepComment = i+2 < len(runes) && (runes[i+2] == '!' || runes[i+2] == '+')
+			if keepComment {
+				sb.WriteString("/*")
+			}
+			i++
+			continue
+		case r == ';':
+			if stmt := strings.TrimSpace(sb.String()); stmt != "" {
+				statements = append(statements, stmt)
+			}
+			sb.Reset()
+			continue
+		}
+
+		sb.WriteRune(r)
+	}
+
+	if stmt := strings.TrimSpace(sb.String()); stmt != "" {
+		statements = append(statements, stmt)
+	}
+
+	return statements
+}
@@ -0,0 +1,235 @@
+package pkg_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"example.com/authorization/migration"
+	"example.com/authorization/pkg"
+)
+
+func TestSplitStatements(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{
+			name:   "statements",
+			script: "CREATE TABLE a (id INT);\nCREATE TABLE b (id INT);\n",
+			want:   []string{"CREATE TABLE a (id INT)", "CREATE TABLE b (id INT)"},
+		},
+		{
+			name:   "no trailing semicolon",
+			script: "SELECT 1;\nSELECT 2",
+			want:   []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name:   "empty statements",
+			script: ";;\n  ;SELECT 1;;",
+			want:   []string{"SELECT 1"},
+		},
+		{
+			name:   "semicolons in quotes",
+			script: "INSERT INTO a VALUES ('x;y', \"z;\");SELECT `a;b` FROM c;",
+			want:   []string{"INSERT INTO a VALUES ('x;y', \"z;\")", "SELECT `a;b` FROM c"},
+		},
+		{
+			name:   "doubled quotes",
+			script: "SELECT 'it''s; fine';SELECT 2;",
+			want:   []string{"SELECT 'it''s; fine'", "SELECT 2"},
+		},
+		{
+			name:   "backslash escaped quotes",
+			script: `SELECT 'it\'s; fine', "say \"hi;\"";SELECT '\\';SELECT 3;`,
+			want:   []string{`SELECT 'it\'s; fine', "say \"hi;\""`, `SELECT '\\'`, "SELECT 3"},
+		},
+		{
+			name:   "backslashes in identifiers escape nothing",
+			script: "SELECT `a\\`;SELECT 2;",
+			want:   []string{"SELECT `a\\`", "SELECT 2"},
+		},
+		{
+			name:   "line comments",
+			script: "-- first; not a statement\nSELECT 1; # second; neither\nSELECT 2;",
+			want:   []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name:   "block comments",
+			script: "/* a header;\n spanning lines; */\nSELECT/* inline; */1;\nSELECT 2 /* trailing */;",
+			want:   []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name:   "comment markers in quotes",
+			script: "SELECT '/* not; a comment */', '-- nor; this';SELECT 2;",
+			want:   []string{"SELECT '/* not; a comment */', '-- nor; this'", "SELECT 2"},
+		},
+		{
+			name:   "quotes in comments",
+			script: "/* it's */SELECT 1; -- it's\nSELECT 2;",
+			want:   []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name:   "executable comments are kept",
+			script: "/*!40101 SET NAMES utf8mb4; */;SELECT /*+ MAX_EXECUTION_TIME(1000) */ 1;",
+			want:   []string{"/*!40101 SET NAMES utf8mb4; */", "SELECT /*+ MAX_EXECUTION_TIME(1000) */ 1"},
+		},
+		{
+			name:   "only comments",
+			script: "-- nothing\n/* to run */\n",
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		got := pkg.SplitStatements(tt.script)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestReadMigrations(t *testing.T) {
+	t.Parallel()
+
+	file := func(content string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(content)}
+	}
+
+	tests := []struct {
+		name     string
+		fsys     fstest.MapFS
+		versions []int64
+		downs    []string
+		err      string
+	}{
+		{
+			name: "ordered by version",
+			fsys: fstest.MapFS{
+				"010_c.up.sql":   file("SELECT 10"),
+				"010_c.down.sql": file("SELECT -10"),
+				"002_b.up.sql":   file("SELECT 2"),
+				"002_b.down.sql": file("SELECT -2"),
+				"001_a.up.sql":   file("SELECT 1"),
+				"001_a.down.sql": file("SELECT -1"),
+			},
+			versions: []int64{1, 2, 10},
+			downs:    []string{"SELECT -1", "SELECT -2", "SELECT -10"},
+		},
+		{
+			name: "gaps are allowed",
+			fsys: fstest.MapFS{
+				"001_a.up.sql": file("SELECT 1"),
+				"005_b.up.sql": file("SELECT 5"),
+			},
+			versions: []int64{1, 5},
+			downs:    []string{"", ""},
+		},
+		{
+			name: "no down script",
+			fsys: fstest.MapFS{
+				"001_a.up.sql":   file("SELECT 1"),
+				"001_a.down.sql": file("SELECT -1"),
+				"002_b.up.sql":   file("SELECT 2"),
+			},
+			versions: []int64{1, 2},
+			downs:    []string{"SELECT -1", ""},
+		},
+		{
+			name:     "no migrations",
+			fsys:     fstest.MapFS{},
+			versions: []int64{},
+		},
+		{
+			name: "no up script",
+			fsys: fstest.MapFS{
+				"001_a.up.sql":   file("SELECT 1"),
+				"002_b.down.sql": file("SELECT -2"),
+			},
+			err: "has no up script",
+		},
+		{
+			name: "duplicate versions",
+			fsys: fstest.MapFS{
+				"001_a.up.sql": file("SELECT 1"),
+				"001_b.up.sql": file("SELECT 1"),
+			},
+			err: "share version 1",
+		},
+		{
+			name: "duplicate versions written differently",
+			fsys: fstest.MapFS{
+				"1_a.up.sql":   file("SELECT 1"),
+				"001_a.up.sql": file("SELECT 1"),
+			},
+			err: "share version 1",
+		},
+		{
+			name: "no direction",
+			fsys: fstest.MapFS{
+				"001_a.sql": file("SELECT 1"),
+			},
+			err: "has to end with .up.sql or .down.sql",
+		},
+		{
+			name: "no version",
+			fsys: fstest.MapFS{
+				"a.up.sql": file("SELECT 1"),
+			},
+			err: "has to start with its version",
+		},
+	}
+
+	for _, tt := range tests {
+		migrations, err := pkg.ReadMigrations(tt.fsys)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.err, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+
+		versions := make([]int64, 0, len(migrations))
+		downs := make([]string, 0, len(migrations))
+		for _, m := range migrations {
+			versions = append(versions, m.Version)
+			downs = append(downs, m.Down)
+		}
+
+		if !slices.Equal(versions, tt.versions) {
+			t.Errorf("%s: expected versions %v, got %v", tt.name, tt.versions, versions)
+		}
+
+		if tt.downs != nil && !slices.Equal(downs, tt.downs) {
+			t.Errorf("%s: expected down scripts %q, got %q", tt.name, tt.downs, downs)
+		}
+	}
+}
+
+func TestShippedMigrationsAreComplete(t *testing.T) {
+	t.Parallel()
+
+	migrations, err := pkg.ReadMigrations(migration.FS)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i, m := range migrations {
+		if m.Version != int64(i+1) {
+			t.Errorf("expected migration %s to have version %d", m.Name, i+1)
+		}
+
+		if len(pkg.SplitStatements(m.Up)) == 0 || len(pkg.SplitStatements(m.Down)) == 0 {
+			t.Errorf("expected migration %s to have statements both ways", m.Name)
+		}
+	}
+}
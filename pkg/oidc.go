@@ -0,0 +1,468 @@
+package pkg
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// oidcKeysRefetchInterval keeps ID tokens with made up key IDs from hammering the provider
+	oidcKeysRefetchInterval = time.Minute
+	// oidcMaxResponseBytes caps what is read of a response of the provider
+	oidcMaxResponseBytes = 1 << 20
+)
+
+var ErrOIDCExchangeFailed = errors.New("oidc code exchange failed")
+var ErrInvalidIDToken = errors.New("invalid id token")
+
+var oidcProviderName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// OIDCProviderConfig is an OpenID Connect provider users can log in with, Name is the one in
+// the login URLs
+type OIDCProviderConfig struct {
+	Name      string
+	IssuerURL string
+	ClientID  string
+	// ClientSecret is empty for public clients, PKCE protects the code exchange either way
+	ClientSecret string
+	Scopes       []string
+}
+
+// LoadOIDCProviders reads the settings of every provider in the comma separated list of
+// names, a provider named gitlab is set up with OIDC_GITLAB_ISSUER, OIDC_GITLAB_CLIENT_ID,
+// OIDC_GITLAB_CLIENT_SECRET and OIDC_GITLAB_SCOPES
+func LoadOIDCProviders(list string) ([]OIDCProviderConfig, error) {
+	var providers []OIDCProviderConfig
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		if !oidcProviderName.MatchString(name) {
+			return nil, fmt.Errorf("invalid oidc provider name %q", name)
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+
+		issuer, err := requireEnv(prefix + "ISSUER")
+		if err != nil {
+			return nil, err
+		}
+
+		clientID, err := requireEnv(prefix + "CLIENT_ID")
+		if err != nil {
+			return nil, err
+		}
+
+		scopes := strings.Fields(os.Getenv(prefix + "SCOPES"))
+		if len(scopes) == 0 {
+			scopes = []string{"openid", "email", "profile"}
+		}
+
+		providers = append(providers, OIDCProviderConfig{
+			Name:         name,
+			IssuerURL:    issuer,
+			ClientID:     clientID,
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			Scopes:       scopes,
+		})
+	}
+
+	return providers, nil
+}
+
+// OIDCIdentity is who the provider says logged in, Subject is the only part that never changes
+type OIDCIdentity struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	Name              string
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce             string `json:"nonce"`
+	AuthorizedParty   string `json:"azp"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+	Name              string `json:"name"`
+}
+
+// OIDCProvider runs the authorization code flow with PKCE against an OpenID Connect provider.
+// Its endpoints are discovered on first use and its signing keys are fetched again when an
+// ID token is signed with one that is not known yet
+type OIDCProvider struct {
+	cfg         OIDCProviderConfig
+	redirectURL string
+	client      *http.Client
+
+	// mu guards what was fetched, the requests run outside of it and flight keeps them from
+	// being sent more than once at a time
+	mu            sync.Mutex
+	flight        singleflight.Group
+	discovery     *oidcDiscovery
+	keys          map[string]any
+	keysFetchedAt time.Time
+}
+
+func NewOIDCProvider(cfg OIDCProviderConfig, redirectURL string, client *http.Client) *OIDCProvider {
+	return &OIDCProvider{
+		cfg:         cfg,
+		redirectURL: redirectURL,
+		client:      client,
+		keys:        make(map[string]any),
+	}
+}
+
+func (p *OIDCProvider) Name() string {
+	return p.cfg.Name
+}
+
+// AuthCodeURL is where the user is sent to log in at the provider, only the S256 challenge
+// of codeVerifier leaves this side
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state string, nonce string, codeVerifier string) (string, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(d.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(codeVerifier))
+
+	query := u.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.cfg.ClientID)
+	query.Set("redirect_uri", p.redirectURL)
+	query.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// Exchange trades the code the provider redirected back with for the identity in its ID
+// token, the token has to carry the nonce the login was started with
+func (p *OIDCProvider) Exchange(ctx context.Context, code string, codeVerifier string, nonce string) (OIDCIdentity, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.redirectURL)
+	form.Set("code_verifier", codeVerifier)
+	form.Set("client_id", p.cfg.ClientID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		// RFC 6749 2.3.1 wants both form encoded before they go into the header
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+
+	err = p.do(req, &tokens)
+	if err != nil {
+		return OIDCIdentity{}, errors.Join(ErrOIDCExchangeFailed, err)
+	}
+
+	if tokens.IDToken == "" {
+		return OIDCIdentity{}, fmt.Errorf("%w: no id token in the token response", ErrInvalidIDToken)
+	}
+
+	return p.verifyIDToken(ctx, d, tokens.IDToken, nonce)
+}
+
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, d oidcDiscovery, rawIDToken string, nonce string) (OIDCIdentity, error) {
+	var claims idTokenClaims
+
+	_, err := jwt.ParseWithClaims(rawIDToken, &claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, d, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithIssuer(d.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return OIDCIdentity{}, errors.Join(ErrInvalidIDToken, err)
+	}
+
+	// a token issued to several clients names the one it was meant for
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.cfg.ClientID {
+		return OIDCIdentity{}, fmt.Errorf("%w: issued to %q", ErrInvalidIDToken, claims.AuthorizedParty)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return OIDCIdentity{}, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+
+	if claims.Subject == "" {
+		return OIDCIdentity{}, fmt.Errorf("%w: no subject", ErrInvalidIDToken)
+	}
+
+	return OIDCIdentity{
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		EmailVerified:     claims.EmailVerified,
+		PreferredUsername: claims.PreferredUsername,
+		Name:              claims.Name,
+	}, nil
+}
+
+// discover loads the endpoints of the provider from its discovery document, once. Concurrent
+// first uses share a single request
+func (p *OIDCProvider) discover(ctx context.Context) (oidcDiscovery, error) {
+	p.mu.Lock()
+	discovery := p.discovery
+	p.mu.Unlock()
+
+	if discovery != nil {
+		return *discovery, nil
+	}
+
+	v, err, _ := p.flight.Do("discovery", func() (any, error) {
+		// the request outlives the first caller if it goes away, the others still wait for it
+		return p.fetchDiscovery(context.WithoutCancel(ctx))
+	})
+	if err != nil {
+		return oidcDiscovery{}, err
+	}
+
+	return v.(oidcDiscovery), nil
+}
+
+func (p *OIDCProvider) fetchDiscovery(ctx context.Context) (oidcDiscovery, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.cfg.IssuerURL, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return oidcDiscovery{}, err
+	}
+
+	var d oidcDiscovery
+	err = p.do(req, &d)
+	if err != nil {
+		return oidcDiscovery{}, fmt.Errorf("oidc discovery of %s failed: %w", p.cfg.Name, err)
+	}
+
+	// OpenID Connect Discovery 4.3, a document about another issuer must not be trusted
+	if d.Issuer != p.cfg.IssuerURL {
+		return oidcDiscovery{}, fmt.Errorf("oidc discovery of %s returned issuer %q", p.cfg.Name, d.Issuer)
+	}
+
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return oidcDiscovery{}, fmt.Errorf("oidc discovery of %s is missing endpoints", p.cfg.Name)
+	}
+
+	p.mu.Lock()
+	p.discovery = &d
+	p.mu.Unlock()
+
+	return d, nil
+}
+
+// key returns the signing key named kid, the keys are fetched again when it is unknown.
+// Concurrent lookups of unknown keys share a single fetch
+func (p *OIDCProvider) key(ctx context.Context, d oidcDiscovery, kid string) (any, error) {
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	fetchedAt := p.keysFetchedAt
+	p.mu.Unlock()
+
+	if ok {
+		return key, nil
+	}
+
+	if time.Since(fetchedAt) < oidcKeysRefetchInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	v, err, _ := p.flight.Do("keys", func() (any, error) {
+		return p.fetchKeys(context.WithoutCancel(ctx), d)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok = v.(map[string]any)[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	return key, nil
+}
+
+// fetchKeys replaces the signing keys with the ones the provider publishes now
+func (p *OIDCProvider) fetchKeys(ctx context.Context, d oidcDiscovery) (map[string]any, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+
+	err = p.do(req, &set)
+	if err != nil {
+		return nil, fmt.Errorf("fetching the signing keys of %s failed: %w", p.cfg.Name, err)
+	}
+
+	keys := make(map[string]any, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			// one key of a kind not supported here must not keep the others from working
+			continue
+		}
+
+		keys[jwk.Kid] = key
+	}
+
+	p.mu.Lock()
+	p.keys, p.keysFetchedAt = keys, time.Now()
+	p.mu.Unlock()
+
+	return keys, nil
+}
+
+// do sends the request and decodes the JSON response into v
+func (p *OIDCProvider) do(req *http.Request, v any) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body := io.LimitReader(resp.Body, oidcMaxResponseBytes)
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(body, 512))
+		return fmt.Errorf("%s answered %s: %s", req.URL.Redacted(), resp.Status, b)
+	}
+
+	return json.NewDecoder(body).Decode(v)
+}
+
+// jsonWebKey is a public key of RFC 7517 as providers publish them
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid rsa exponent %q", k.E)
+		}
+
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		// the uncompressed point, it is checked to be on the curve
+		return ecdsa.ParseUncompressedPublicKey(curve, append(append([]byte{4}, x...), y...))
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		if k.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
@@ -0,0 +1,189 @@
+package pkg_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"net/url"
+	"sync"
+	"testing"
+
+	"example.com/authorization/internal/testutil"
+	"example.com/authorization/pkg"
+)
+
+const stubRedirectURL = "http://localhost:3030/api/v1/oauth/stub/callback"
+
+var alice = pkg.OIDCIdentity{
+	Subject:           "alice",
+	Email:             "alice@example.com",
+	EmailVerified:     true,
+	PreferredUsername: "alice",
+}
+
+func newTestOIDCProvider(stub *testutil.OIDCProvider) *pkg.OIDCProvider {
+	return pkg.NewOIDCProvider(stub.Config("stub"), stubRedirectURL, stub.Server.Client())
+}
+
+func TestOIDCProviderAuthorizationCodeFlow(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stub := testutil.NewOIDCProvider(t)
+	provider := newTestOIDCProvider(stub)
+
+	authURL, err := provider.AuthCodeURL(ctx, "state", "nonce", "verifier")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	query := mustParseURL(t, authURL).Query()
+	if query.Get("state") != "state" || query.Get("nonce") != "nonce" || query.Get("redirect_uri") != stubRedirectURL || query.Get("scope") != "openid email" {
+		t.Fatalf("unexpected authorization url %s", authURL)
+	}
+	if query.Get("code_challenge") == "verifier" {
+		t.Fatalf("the code verifier was sent in the clear")
+	}
+
+	code := stub.Authorize(t, authURL, alice)
+
+	identity, err := provider.Exchange(ctx, code, "verifier", "nonce")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if identity != alice {
+		t.Fatalf("got identity %+v, want %+v", identity, alice)
+	}
+
+	_, err = provider.Exchange(ctx, code, "verifier", "nonce")
+	if !errors.Is(err, pkg.ErrOIDCExchangeFailed) {
+		t.Fatalf("expected ErrOIDCExchangeFailed for a used code, got %v", err)
+	}
+}
+
+func TestOIDCProviderRefusesWrongVerifier(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stub := testutil.NewOIDCProvider(t)
+	provider := newTestOIDCProvider(stub)
+
+	authURL, err := provider.AuthCodeURL(ctx, "state", "nonce", "verifier")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	code := stub.Authorize(t, authURL, alice)
+
+	_, err = provider.Exchange(ctx, code, "another verifier", "nonce")
+	if !errors.Is(err, pkg.ErrOIDCExchangeFailed) {
+		t.Fatalf("expected ErrOIDCExchangeFailed, got %v", err)
+	}
+}
+
+func TestOIDCProviderRefusesForeignIDTokens(t *testing.T) {
+	t.Parallel()
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for name, tamper := range map[string]func(*testutil.OIDCProvider){
+		"nonce":       func(s *testutil.OIDCProvider) { s.SetNonce("replayed") },
+		"audience":    func(s *testutil.OIDCProvider) { s.SetAudience("another-client") },
+		"signing key": func(s *testutil.OIDCProvider) { s.SetSigningKey(otherKey) },
+	} {
+		ctx := context.Background()
+		stub := testutil.NewOIDCProvider(t)
+		provider := newTestOIDCProvider(stub)
+		tamper(stub)
+
+		authURL, err := provider.AuthCodeURL(ctx, "state", "nonce", "verifier")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+
+		code := stub.Authorize(t, authURL, alice)
+
+		_, err = provider.Exchange(ctx, code, "verifier", "nonce")
+		if !errors.Is(err, pkg.ErrInvalidIDToken) {
+			t.Fatalf("%s: expected ErrInvalidIDToken, got %v", name, err)
+		}
+	}
+}
+
+func TestOIDCProviderRefusesDiscoveryOfAnotherIssuer(t *testing.T) {
+	t.Parallel()
+
+	stub := testutil.NewOIDCProvider(t)
+	cfg := stub.Config("stub")
+	cfg.IssuerURL += "/tenant"
+	provider := pkg.NewOIDCProvider(cfg, stubRedirectURL, stub.Server.Client())
+
+	_, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "verifier")
+	if err == nil {
+		t.Fatalf("expected the discovery to fail")
+	}
+}
+
+func TestOIDCProviderDiscoversOnceForConcurrentLogins(t *testing.T) {
+	t.Parallel()
+
+	stub := testutil.NewOIDCProvider(t)
+	provider := newTestOIDCProvider(stub)
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			_, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "verifier")
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	requests := stub.Requests("/.well-known/openid-configuration")
+	if requests != 1 {
+		t.Fatalf("expected a single discovery, got %d", requests)
+	}
+}
+
+func TestLoadOIDCProviders(t *testing.T) {
+	t.Setenv("OIDC_MY_IDP_ISSUER", "https://idp.example.com")
+	t.Setenv("OIDC_MY_IDP_CLIENT_ID", "news")
+
+	providers, err := pkg.LoadOIDCProviders(" My-IdP ,")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(providers) != 1 || providers[0].Name != "my-idp" || providers[0].IssuerURL != "https://idp.example.com" || len(providers[0].Scopes) != 3 {
+		t.Fatalf("unexpected providers %+v", providers)
+	}
+
+	_, err = pkg.LoadOIDCProviders("other")
+	if err == nil {
+		t.Fatalf("expected an error for a provider without settings")
+	}
+
+	_, err = pkg.LoadOIDCProviders("../etc")
+	if err == nil {
+		t.Fatalf("expected an error for an invalid provider name")
+	}
+}
+
+func mustParseURL(t *testing.T, raw string) *url.URL {
+	t.Helper()
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return u
+}
@@ -0,0 +1,163 @@
+package pkg
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	PasswordHashBcrypt   = "bcrypt"
+	PasswordHashArgon2id = "argon2id"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+var ErrPasswordMismatch = errors.New("password does not match")
+var ErrUnknownPasswordHash = errors.New("unknown password hash")
+
+// Argon2Params are the argon2id cost parameters, Memory is in KiB
+type Argon2Params struct {
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+}
+
+// PasswordHasher hashes new passwords with the configured algorithm and verifies hashes of
+// both algorithms, so switching algorithm or cost does not lock anybody out
+type PasswordHasher struct {
+	algorithm  string
+	bcryptCost int
+	argon2     Argon2Params
+}
+
+func NewPasswordHasher(cfg Config) PasswordHasher {
+	return PasswordHasher{
+		algorithm:  cfg.PasswordHashAlgorithm,
+		bcryptCost: cfg.BcryptCost,
+		argon2:     cfg.Argon2,
+	}
+}
+
+func (ph PasswordHasher) Hash(password string) (string, error) {
+	if ph.algorithm == PasswordHashArgon2id {
+		salt := make([]byte, argon2SaltLength)
+		_, err := rand.Read(salt)
+		if err != nil {
+			return "", err
+		}
+
+		return encodeArgon2id(ph.argon2, salt, argon2.IDKey([]byte(password), salt, ph.argon2.Time, ph.argon2.Memory, ph.argon2.Threads, argon2KeyLength)), nil
+	}
+
+	b, err := bcrypt.GenerateFromPassword([]byte(password), ph.bcryptCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// Verify checks password against hash, it returns ErrPasswordMismatch when they do not match.
+// needsRehash is set when the hash is weaker than what Hash would produce now, an argon2id
+// hash is never downgraded to bcrypt
+func (ph PasswordHasher) Verify(hash string, password string) (needsRehash bool, err error) {
+	if strings.HasPrefix(hash, "$"+PasswordHashArgon2id+"$") {
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false, err
+		}
+
+		other := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+		if subtle.ConstantTimeCompare(key, other) != 1 {
+			return false, ErrPasswordMismatch
+		}
+
+		return ph.Weaker(hash), nil
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, ErrPasswordMismatch
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return ph.Weaker(hash), nil
+}
+
+// Weaker tells whether hash is weaker than what Hash would produce now, going by its parameters
+// alone. Such a hash also verifies faster, a malformed hash is never weaker
+func (ph PasswordHasher) Weaker(hash string) bool {
+	if strings.HasPrefix(hash, "$"+PasswordHashArgon2id+"$") {
+		params, _, _, err := decodeArgon2id(hash)
+		if err != nil {
+			return false
+		}
+
+		weaker := params.Memory < ph.argon2.Memory || params.Time < ph.argon2.Time || params.Threads < ph.argon2.Threads
+		return ph.algorithm == PasswordHashArgon2id && weaker
+	}
+
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return false
+	}
+
+	return ph.algorithm == PasswordHashArgon2id || cost < ph.bcryptCost
+}
+
+// encodeArgon2id uses the PHC string format, the same other argon2 implementations read
+func encodeArgon2id(params Argon2Params, salt []byte, key []byte) string {
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		PasswordHashArgon2id,
+		argon2.Version,
+		params.Memory,
+		params.Time,
+		params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+func decodeArgon2id(hash string) (Argon2Params, []byte, []byte, error) {
+	// "", algorithm, version, parameters, salt and key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return Argon2Params{}, nil, nil, ErrUnknownPasswordHash
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return Argon2Params{}, nil, nil, ErrUnknownPasswordHash
+	}
+
+	var params Argon2Params
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads)
+	if err != nil {
+		return Argon2Params{}, nil, nil, ErrUnknownPasswordHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2Params{}, nil, nil, ErrUnknownPasswordHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return Argon2Params{}, nil, nil, ErrUnknownPasswordHash
+	}
+
+	return params, salt, key, nil
+}
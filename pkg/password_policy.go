@@ -0,0 +1,77 @@
+package pkg
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// bcrypt refuses longer passwords, they are capped for argon2id too so switching algorithm can not lock anybody out
+const maxPasswordBytes = 72
+
+var ErrPasswordTooShort = errors.New("password too short")
+var ErrPasswordTooLong = errors.New("password too long")
+var ErrPasswordBreached = errors.New("password is known to be breached")
+
+// PasswordPolicy is what a new password has to pass
+type PasswordPolicy struct {
+	minLength int
+	// denylist holds the lowercased passwords known from breaches
+	denylist map[string]struct{}
+}
+
+// LoadPasswordPolicy reads the denylist file, one password per line, when one is configured
+func LoadPasswordPolicy(cfg Config) (PasswordPolicy, error) {
+	policy := PasswordPolicy{
+		// an empty password is never fine
+		minLength: max(cfg.PasswordMinLength, 1),
+		denylist:  make(map[string]struct{}),
+	}
+
+	if cfg.PasswordDenylistFile == "" {
+		return policy, nil
+	}
+
+	f, err := os.Open(cfg.PasswordDenylistFile)
+	if err != nil {
+		return PasswordPolicy{}, fmt.Errorf("opening the password denylist failed: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		password := strings.TrimSpace(scanner.Text())
+		if password == "" {
+			continue
+		}
+
+		policy.denylist[strings.ToLower(password)] = struct{}{}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return PasswordPolicy{}, fmt.Errorf("reading the password denylist failed: %w", err)
+	}
+
+	return policy, nil
+}
+
+// Validate returns why password can not be used, length is counted in characters
+func (pp PasswordPolicy) Validate(password string) error {
+	if utf8.RuneCountInString(password) < pp.minLength {
+		return ErrPasswordTooShort
+	}
+
+	if len(password) > maxPasswordBytes {
+		return ErrPasswordTooLong
+	}
+
+	if _, ok := pp.denylist[strings.ToLower(password)]; ok {
+		return ErrPasswordBreached
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package pkg_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"example.com/authorization/pkg"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testArgon2 = pkg.Argon2Params{
+	Memory:  64,
+	Time:    1,
+	Threads: 1,
+}
+
+func TestPasswordHasherVerifiesBothAlgorithms(t *testing.T) {
+	t.Parallel()
+
+	for _, algorithm := range []string{pkg.PasswordHashBcrypt, pkg.PasswordHashArgon2id} {
+		hasher := pkg.NewPasswordHasher(pkg.Config{
+			PasswordHashAlgorithm: algorithm,
+			BcryptCost:            bcrypt.MinCost,
+			Argon2:                testArgon2,
+		})
+
+		hash, err := hasher.Hash("correct horse")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", algorithm, err)
+		}
+
+		if !strings.HasPrefix(hash, "$2") && !strings.HasPrefix(hash, "$argon2id$") {
+			t.Fatalf("%s: unexpected hash format %q", algorithm, hash)
+		}
+
+		needsRehash, err := hasher.Verify(hash, "correct horse")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", algorithm, err)
+		}
+		if needsRehash {
+			t.Fatalf("%s: a fresh hash needs no rehash", algorithm)
+		}
+
+		_, err = hasher.Verify(hash, "battery staple")
+		if !errors.Is(err, pkg.ErrPasswordMismatch) {
+			t.Fatalf("%s: expected ErrPasswordMismatch, got %v", algorithm, err)
+		}
+	}
+}
+
+func TestPasswordHasherAsksForRehashOfWeakerHashesOnly(t *testing.T) {
+	t.Parallel()
+
+	weakBcrypt := pkg.NewPasswordHasher(pkg.Config{PasswordHashAlgorithm: pkg.PasswordHashBcrypt, BcryptCost: bcrypt.MinCost})
+	strongBcrypt := pkg.NewPasswordHasher(pkg.Config{PasswordHashAlgorithm: pkg.PasswordHashBcrypt, BcryptCost: bcrypt.MinCost + 1})
+	argon := pkg.NewPasswordHasher(pkg.Config{PasswordHashAlgorithm: pkg.PasswordHashArgon2id, Argon2: testArgon2})
+	strongerArgon := pkg.NewPasswordHasher(pkg.Config{PasswordHashAlgorithm: pkg.PasswordHashArgon2id, Argon2: pkg.Argon2Params{Memory: 128, Time: 1, Threads: 1}})
+
+	weakHash, err := weakBcrypt.Hash("correct horse")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	argonHash, err := argon.Hash("correct horse")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cases := []struct {
+		name   string
+		hasher pkg.PasswordHasher
+		hash   string
+		want   bool
+	}{
+		{"bcrypt below the configured cost", strongBcrypt, weakHash, true},
+		{"bcrypt when argon2id is configured", argon, weakHash, true},
+		{"argon2id when bcrypt is configured", strongBcrypt, argonHash, false},
+		{"argon2id below the configured memory", strongerArgon, argonHash, true},
+	}
+
+	for _, tc := range cases {
+		needsRehash, err := tc.hasher.Verify(tc.hash, "correct horse")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if needsRehash != tc.want {
+			t.Fatalf("%s: needsRehash = %v, want %v", tc.name, needsRehash, tc.want)
+		}
+
+		// logins tell weaker hashes apart before knowing whether the password matches
+		if weaker := tc.hasher.Weaker(tc.hash); weaker != tc.want {
+			t.Fatalf("%s: Weaker = %v, want %v", tc.name, weaker, tc.want)
+		}
+	}
+
+	if argon.Weaker("not a hash") || argon.Weaker("$argon2id$garbage") {
+		t.Fatal("a malformed hash is never weaker")
+	}
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	t.Parallel()
+
+	denylist := filepath.Join(t.TempDir(), "denylist.txt")
+	err := os.WriteFile(denylist, []byte("password123\n\nLetMeIn2024\n"), 0o600)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	policy, err := pkg.LoadPasswordPolicy(pkg.Config{
+		PasswordMinLength:    8,
+		PasswordDenylistFile: denylist,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cases := map[string]error{
+		"short":                 pkg.ErrPasswordTooShort,
+		"password123":           pkg.ErrPasswordBreached,
+		"letmein2024":           pkg.ErrPasswordBreached,
+		strings.Repeat("a", 73): pkg.ErrPasswordTooLong,
+		"correct horse battery": nil,
+		"ünïcödé1":              nil,
+	}
+
+	for password, want := range cases {
+		if err := policy.Validate(password); !errors.Is(err, want) {
+			t.Fatalf("Validate(%q) = %v, want %v", password, err, want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package pkg
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// TrustedProxies are the reverse proxies whose X-Forwarded-For header is believed
+type TrustedProxies []netip.Prefix
+
+// ParseTrustedProxies parses a comma separated list of IP addresses and CIDR ranges
+func ParseTrustedProxies(list string) (TrustedProxies, error) {
+	var proxies TrustedProxies
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+			}
+
+			proxies = append(proxies, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+
+		addr = addr.Unmap()
+		proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+
+	return proxies, nil
+}
+
+func (tp TrustedProxies) Contains(ip string) bool {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return false
+	}
+
+	addr = addr.Unmap()
+	for _, prefix := range tp {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ClientIP returns the address of the client behind remoteIP. X-Forwarded-For is only read when the request
+// comes from a trusted proxy, and then from the right since every proxy appends the address it got the
+// request from: the first untrusted hop is the client, anything left of it may have been made up by the client
+func (tp TrustedProxies) ClientIP(remoteIP string, forwardedFor string) string {
+	if forwardedFor == "" || !tp.Contains(remoteIP) {
+		return remoteIP
+	}
+
+	hops := strings.Split(forwardedFor, ",")
+	client := remoteIP
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if _, err := netip.ParseAddr(hop); err != nil {
+			// a malformed hop can not be trusted nor skipped, the last good one is the best we know
+			return client
+		}
+
+		client = hop
+		if !tp.Contains(hop) {
+			return client
+		}
+	}
+
+	return client
+}
@@ -0,0 +1,63 @@
+package pkg_test
+
+import (
+	"testing"
+
+	"example.com/authorization/pkg"
+)
+
+func TestClientIP(t *testing.T) {
+	t.Parallel()
+
+	proxies, err := pkg.ParseTrustedProxies("10.0.0.1, 192.168.0.0/16")
+	if err != nil {
+		t.Fatalf("parse trusted proxies: %v", err)
+	}
+
+	cases := []struct {
+		name         string
+		remoteIP     string
+		forwardedFor string
+		want         string
+	}{
+		{"direct request", "203.0.113.7", "", "203.0.113.7"},
+		{"untrusted remote is not believed", "203.0.113.7", "198.51.100.1", "203.0.113.7"},
+		{"trusted proxy", "10.0.0.1", "198.51.100.1", "198.51.100.1"},
+		{"spoofed hop left of the client", "10.0.0.1", "1.2.3.4, 198.51.100.1", "198.51.100.1"},
+		{"chain of trusted proxies", "10.0.0.1", "198.51.100.1, 192.168.1.20", "198.51.100.1"},
+		{"only trusted hops", "10.0.0.1", "192.168.1.20", "192.168.1.20"},
+		{"malformed hop", "10.0.0.1", "garbage, 198.51.100.1", "198.51.100.1"},
+		{"malformed last hop", "10.0.0.1", "198.51.100.1, garbage", "10.0.0.1"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := proxies.ClientIP(tc.remoteIP, tc.forwardedFor); got != tc.want {
+				t.Fatalf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxiesRejectsGarbage(t *testing.T) {
+	t.Parallel()
+
+	if _, err := pkg.ParseTrustedProxies("10.0.0.1,not-an-ip"); err == nil {
+		t.Fatalf("expected an error for an invalid entry")
+	}
+}
+
+func TestNoTrustedProxies(t *testing.T) {
+	t.Parallel()
+
+	proxies, err := pkg.ParseTrustedProxies("")
+	if err != nil {
+		t.Fatalf("parse trusted proxies: %v", err)
+	}
+
+	if got := proxies.ClientIP("127.0.0.1", "198.51.100.1"); got != "127.0.0.1" {
+		t.Fatalf("expected X-Forwarded-For to be ignored, got %q", got)
+	}
+}
@@ -0,0 +1,94 @@
+package pkg_test
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"example.com/authorization/pkg"
+)
+
+// the SHA1 secret of the RFC 6238 test vectors, "12345678901234567890" in base32
+const rfcTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeMatchesRFC6238(t *testing.T) {
+	t.Parallel()
+
+	// the RFC lists 8 digit codes, these are their last 6
+	for unix, want := range map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	} {
+		code, err := pkg.TOTPCode(rfcTOTPSecret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if code != want {
+			t.Fatalf("code at %d is %s, want %s", unix, code, want)
+		}
+	}
+}
+
+func TestVerifyTOTPAllowsOnePeriodOfSkew(t *testing.T) {
+	t.Parallel()
+
+	secret, err := pkg.NewTOTPSecret()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	now := time.Unix(1_700_000_000, 0)
+	code, err := pkg.TOTPCode(secret, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, at := range []time.Time{now.Add(-pkg.TOTPPeriod), now, now.Add(pkg.TOTPPeriod)} {
+		step, err := pkg.VerifyTOTP(secret, code, at)
+		if err != nil {
+			t.Fatalf("code refused at %v: %v", at, err)
+		}
+		if step != now.Unix()/30 {
+			t.Fatalf("matched step %d, want %d", step, now.Unix()/30)
+		}
+	}
+
+	for _, at := range []time.Time{now.Add(-2 * pkg.TOTPPeriod), now.Add(2 * pkg.TOTPPeriod)} {
+		_, err := pkg.VerifyTOTP(secret, code, at)
+		if !errors.Is(err, pkg.ErrInvalidTOTPCode) {
+			t.Fatalf("expected ErrInvalidTOTPCode at %v, got %v", at, err)
+		}
+	}
+
+	_, err = pkg.VerifyTOTP(secret, "12345", now)
+	if !errors.Is(err, pkg.ErrInvalidTOTPCode) {
+		t.Fatalf("expected ErrInvalidTOTPCode for a short code, got %v", err)
+	}
+
+	_, err = pkg.VerifyTOTP("not base32!", code, now)
+	if !errors.Is(err, pkg.ErrInvalidTOTPSecret) {
+		t.Fatalf("expected ErrInvalidTOTPSecret, got %v", err)
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	t.Parallel()
+
+	uri, err := url.Parse(pkg.TOTPURI("Example News", "bob", rfcTOTPSecret))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Example News:bob" {
+		t.Fatalf("unexpected uri %s", uri)
+	}
+
+	query := uri.Query()
+	if query.Get("secret") != rfcTOTPSecret || query.Get("issuer") != "Example News" || query.Get("digits") != "6" || query.Get("period") != "30" {
+		t.Fatalf("unexpected query %v", query)
+	}
+}
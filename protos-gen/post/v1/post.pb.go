@@ -22,10 +22,134 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+type PostSort int32
+
+const (
+	// defaults to POST_SORT_HOT
+	PostSort_POST_SORT_UNSPECIFIED PostSort = 0
+	PostSort_POST_SORT_HOT         PostSort = 1
+	PostSort_POST_SORT_NEW         PostSort = 2
+	PostSort_POST_SORT_TOP         PostSort = 3
+	// top posts of the last week
+	PostSort_POST_SORT_BEST PostSort = 4
+)
+
+// Enum value maps for PostSort.
+var (
+	PostSort_name = map[int32]string{
+		0: "POST_SORT_UNSPECIFIED",
+		1: "POST_SORT_HOT",
+		2: "POST_SORT_NEW",
+		3: "POST_SORT_TOP",
+		4: "POST_SORT_BEST",
+	}
+	PostSort_value = map[string]int32{
+		"POST_SORT_UNSPECIFIED": 0,
+		"POST_SORT_HOT":         1,
+		"POST_SORT_NEW":         2,
+		"POST_SORT_TOP":         3,
+		"POST_SORT_BEST":        4,
+	}
+)
+
+func (x PostSort) Enum() *PostSort {
+	p := new(PostSort)
+	*p = x
+	return p
+}
+
+func (x PostSort) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (PostSort) Descriptor() protoreflect.EnumDescriptor {
+	return file_post_v1_post_proto_enumTypes[0].Descriptor()
+}
+
+func (PostSort) Type() protoreflect.EnumType {
+	return &file_post_v1_post_proto_enumTypes[0]
+}
+
+func (x PostSort) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use PostSort.Descriptor instead.
+func (PostSort) EnumDescriptor() ([]byte, []int) {
+	return file_post_v1_post_proto_rawDescGZIP(), []int{0}
+}
+
+type TopWindow int32
+
+const (
+	// defaults to TOP_WINDOW_DAY
+	TopWindow_TOP_WINDOW_UNSPECIFIED TopWindow = 0
+	TopWindow_TOP_WINDOW_DAY         TopWindow = 1
+	TopWindow_TOP_WINDOW_WEEK        TopWindow = 2
+	TopWindow_TOP_WINDOW_MONTH       TopWindow = 3
+	TopWindow_TOP_WINDOW_YEAR        TopWindow = 4
+	TopWindow_TOP_WINDOW_ALL         TopWindow = 5
+)
+
+// Enum value maps for TopWindow.
+var (
+	TopWindow_name = map[int32]string{
+		0: "TOP_WINDOW_UNSPECIFIED",
+		1: "TOP_WINDOW_DAY",
+		2: "TOP_WINDOW_WEEK",
+		3: "TOP_WINDOW_MONTH",
+		4: "TOP_WINDOW_YEAR",
+		5: "TOP_WINDOW_ALL",
+	}
+	TopWindow_value = map[string]int32{
+		"TOP_WINDOW_UNSPECIFIED": 0,
+		"TOP_WINDOW_DAY":         1,
+		"TOP_WINDOW_WEEK":        2,
+		"TOP_WINDOW_MONTH":       3,
+		"TOP_WINDOW_YEAR":        4,
+		"TOP_WINDOW_ALL":         5,
+	}
+)
+
+func (x TopWindow) Enum() *TopWindow {
+	p := new(TopWindow)
+	*p = x
+	return p
+}
+
+func (x TopWindow) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (TopWindow) Descriptor() protoreflect.EnumDescriptor {
+	return file_post_v1_post_proto_enumTypes[1].Descriptor()
+}
+
+func (TopWindow) Type() protoreflect.EnumType {
+	return &file_post_v1_post_proto_enumTypes[1]
+}
+
+func (x TopWindow) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use TopWindow.Descriptor instead.
+func (TopWindow) EnumDescriptor() ([]byte, []int) {
+	return file_post_v1_post_proto_rawDescGZIP(), []int{1}
+}
+
 type ListPostsRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Page          uint64                 `protobuf:"varint,1,opt,name=page,proto3" json:"page,omitempty"`
-	Size          uint64                 `protobuf:"varint,2,opt,name=size,proto3" json:"size,omitempty"`
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// use cursor instead, page numbers shift while people post
+	//
+	// Deprecated: Marked as deprecated in post/v1/post.proto.
+	Page uint64   `protobuf:"varint,1,opt,name=page,proto3" json:"page,omitempty"`
+	Size uint64   `protobuf:"varint,2,opt,name=size,proto3" json:"size,omitempty"`
+	Sort PostSort `protobuf:"varint,3,opt,name=sort,proto3,enum=post.v1.PostSort" json:"sort,omitempty"`
+	// only used by POST_SORT_TOP
+	Window TopWindow `protobuf:"varint,4,opt,name=window,proto3,enum=post.v1.TopWindow" json:"window,omitempty"`
+	// next_cursor of the previous page, page is ignored when it is set
+	Cursor        string `protobuf:"bytes,5,opt,name=cursor,proto3" json:"cursor,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -60,6 +184,7 @@ func (*ListPostsRequest) Descriptor() ([]byte, []int) {
 	return file_post_v1_post_proto_rawDescGZIP(), []int{0}
 }
 
+// Deprecated: Marked as deprecated in post/v1/post.proto.
 func (x *ListPostsRequest) GetPage() uint64 {
 	if x != nil {
 		return x.Page
@@ -74,6 +199,27 @@ func (x *ListPostsRequest) GetSize() uint64 {
 	return 0
 }
 
+func (x *ListPostsRequest) GetSort() PostSort {
+	if x != nil {
+		return x.Sort
+	}
+	return PostSort_POST_SORT_UNSPECIFIED
+}
+
+func (x *ListPostsRequest) GetWindow() TopWindow {
+	if x != nil {
+		return x.Window
+	}
+	return TopWindow_TOP_WINDOW_UNSPECIFIED
+}
+
+func (x *ListPostsRequest) GetCursor() string {
+	if x != nil {
+		return x.Cursor
+	}
+	return ""
+}
+
 type Post struct {
 	state            protoimpl.MessageState `protogen:"open.v1"`
 	Id               int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
@@ -83,8 +229,11 @@ type Post struct {
 	Description      string                 `protobuf:"bytes,5,opt,name=description,proto3" json:"description,omitempty"`
 	NumberOfComments uint64                 `protobuf:"varint,6,opt,name=number_of_comments,json=numberOfComments,proto3" json:"number_of_comments,omitempty"`
 	NumberOfUpvotes  uint64                 `protobuf:"varint,7,opt,name=number_of_upvotes,json=numberOfUpvotes,proto3" json:"number_of_upvotes,omitempty"`
-	unknownFields    protoimpl.UnknownFields
-	sizeCache        protoimpl.SizeCache
+	Author           string                 `protobuf:"bytes,8,opt,name=author,proto3" json:"author,omitempty"`
+	// views are counted once per viewer per window
+	NumberOfViews uint64 `protobuf:"varint,9,opt,name=number_of_views,json=numberOfViews,proto3" json:"number_of_views,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *Post) Reset() {
@@ -166,16 +315,149 @@ func (x *Post) GetNumberOfUpvotes() uint64 {
 	return 0
 }
 
+func (x *Post) GetAuthor() string {
+	if x != nil {
+		return x.Author
+	}
+	return ""
+}
+
+func (x *Post) GetNumberOfViews() uint64 {
+	if x != nil {
+		return x.NumberOfViews
+	}
+	return 0
+}
+
+type Comment struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Id              int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	UserId          int64                  `protobuf:"varint,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	PostId          int64                  `protobuf:"varint,3,opt,name=post_id,json=postId,proto3" json:"post_id,omitempty"`
+	Content         string                 `protobuf:"bytes,4,opt,name=content,proto3" json:"content,omitempty"`
+	NumberOfUpvotes uint64                 `protobuf:"varint,5,opt,name=number_of_upvotes,json=numberOfUpvotes,proto3" json:"number_of_upvotes,omitempty"`
+	CreatedAt       *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	UpdatedAt       *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	ParentId        *int64                 `protobuf:"varint,8,opt,name=parent_id,json=parentId,proto3,oneof" json:"parent_id,omitempty"`
+	// deleted comments are kept as tombstones while they still have replies
+	Deleted       bool       `protobuf:"varint,9,opt,name=deleted,proto3" json:"deleted,omitempty"`
+	Replies       []*Comment `protobuf:"bytes,10,rep,name=replies,proto3" json:"replies,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Comment) Reset() {
+	*x = Comment{}
+	mi := &file_post_v1_post_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Comment) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Comment) ProtoMessage() {}
+
+func (x *Comment) ProtoReflect() protoreflect.Message {
+	mi := &file_post_v1_post_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Comment.ProtoReflect.Descriptor instead.
+func (*Comment) Descriptor() ([]byte, []int) {
+	return file_post_v1_post_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Comment) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Comment) GetUserId() int64 {
+	if x != nil {
+		return x.UserId
+	}
+	return 0
+}
+
+func (x *Comment) GetPostId() int64 {
+	if x != nil {
+		return x.PostId
+	}
+	return 0
+}
+
+func (x *Comment) GetContent() string {
+	if x != nil {
+		return x.Content
+	}
+	return ""
+}
+
+func (x *Comment) GetNumberOfUpvotes() uint64 {
+	if x != nil {
+		return x.NumberOfUpvotes
+	}
+	return 0
+}
+
+func (x *Comment) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *Comment) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+func (x *Comment) GetParentId() int64 {
+	if x != nil && x.ParentId != nil {
+		return *x.ParentId
+	}
+	return 0
+}
+
+func (x *Comment) GetDeleted() bool {
+	if x != nil {
+		return x.Deleted
+	}
+	return false
+}
+
+func (x *Comment) GetReplies() []*Comment {
+	if x != nil {
+		return x.Replies
+	}
+	return nil
+}
+
 type ListPostsResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Posts         []*Post                `protobuf:"bytes,1,rep,name=posts,proto3" json:"posts,omitempty"`
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Posts []*Post                `protobuf:"bytes,1,rep,name=posts,proto3" json:"posts,omitempty"`
+	// empty when there are no more posts
+	NextCursor    string `protobuf:"bytes,2,opt,name=next_cursor,json=nextCursor,proto3" json:"next_cursor,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *ListPostsResponse) Reset() {
 	*x = ListPostsResponse{}
-	mi := &file_post_v1_post_proto_msgTypes[2]
+	mi := &file_post_v1_post_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -187,7 +469,7 @@ func (x *ListPostsResponse) String() string {
 func (*ListPostsResponse) ProtoMessage() {}
 
 func (x *ListPostsResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_post_v1_post_proto_msgTypes[2]
+	mi := &file_post_v1_post_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -200,7 +482,7 @@ func (x *ListPostsResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ListPostsResponse.ProtoReflect.Descriptor instead.
 func (*ListPostsResponse) Descriptor() ([]byte, []int) {
-	return file_post_v1_post_proto_rawDescGZIP(), []int{2}
+	return file_post_v1_post_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *ListPostsResponse) GetPosts() []*Post {
@@ -210,14 +492,227 @@ func (x *ListPostsResponse) GetPosts() []*Post {
 	return nil
 }
 
+func (x *ListPostsResponse) GetNextCursor() string {
+	if x != nil {
+		return x.NextCursor
+	}
+	return ""
+}
+
+type GetPostRequest struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	PostId int64                  `protobuf:"varint,1,opt,name=post_id,json=postId,proto3" json:"post_id,omitempty"`
+	// number of top level comments embedded in the response, defaults to 10
+	CommentsSize uint64 `protobuf:"varint,2,opt,name=comments_size,json=commentsSize,proto3" json:"comments_size,omitempty"`
+	// how deep the embedded comment tree goes, defaults to 5
+	CommentsDepth uint64 `protobuf:"varint,3,opt,name=comments_depth,json=commentsDepth,proto3" json:"comments_depth,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetPostRequest) Reset() {
+	*x = GetPostRequest{}
+	mi := &file_post_v1_post_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetPostRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetPostRequest) ProtoMessage() {}
+
+func (x *GetPostRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_post_v1_post_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetPostRequest.ProtoReflect.Descriptor instead.
+func (*GetPostRequest) Descriptor() ([]byte, []int) {
+	return file_post_v1_post_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *GetPostRequest) GetPostId() int64 {
+	if x != nil {
+		return x.PostId
+	}
+	return 0
+}
+
+func (x *GetPostRequest) GetCommentsSize() uint64 {
+	if x != nil {
+		return x.CommentsSize
+	}
+	return 0
+}
+
+func (x *GetPostRequest) GetCommentsDepth() uint64 {
+	if x != nil {
+		return x.CommentsDepth
+	}
+	return 0
+}
+
+type GetPostResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Post          *Post                  `protobuf:"bytes,1,opt,name=post,proto3" json:"post,omitempty"`
+	Comments      []*Comment             `protobuf:"bytes,2,rep,name=comments,proto3" json:"comments,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetPostResponse) Reset() {
+	*x = GetPostResponse{}
+	mi := &file_post_v1_post_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetPostResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetPostResponse) ProtoMessage() {}
+
+func (x *GetPostResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_post_v1_post_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetPostResponse.ProtoReflect.Descriptor instead.
+func (*GetPostResponse) Descriptor() ([]byte, []int) {
+	return file_post_v1_post_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *GetPostResponse) GetPost() *Post {
+	if x != nil {
+		return x.Post
+	}
+	return nil
+}
+
+func (x *GetPostResponse) GetComments() []*Comment {
+	if x != nil {
+		return x.Comments
+	}
+	return nil
+}
+
+type UpvotePostRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	PostId        int64                  `protobuf:"varint,1,opt,name=post_id,json=postId,proto3" json:"post_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpvotePostRequest) Reset() {
+	*x = UpvotePostRequest{}
+	mi := &file_post_v1_post_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpvotePostRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpvotePostRequest) ProtoMessage() {}
+
+func (x *UpvotePostRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_post_v1_post_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpvotePostRequest.ProtoReflect.Descriptor instead.
+func (*UpvotePostRequest) Descriptor() ([]byte, []int) {
+	return file_post_v1_post_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *UpvotePostRequest) GetPostId() int64 {
+	if x != nil {
+		return x.PostId
+	}
+	return 0
+}
+
+type UpvotePostResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// true when the upvote is registered, false when it is taken back
+	Upvoted       bool `protobuf:"varint,1,opt,name=upvoted,proto3" json:"upvoted,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpvotePostResponse) Reset() {
+	*x = UpvotePostResponse{}
+	mi := &file_post_v1_post_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpvotePostResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpvotePostResponse) ProtoMessage() {}
+
+func (x *UpvotePostResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_post_v1_post_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpvotePostResponse.ProtoReflect.Descriptor instead.
+func (*UpvotePostResponse) Descriptor() ([]byte, []int) {
+	return file_post_v1_post_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *UpvotePostResponse) GetUpvoted() bool {
+	if x != nil {
+		return x.Upvoted
+	}
+	return false
+}
+
 var File_post_v1_post_proto protoreflect.FileDescriptor
 
 const file_post_v1_post_proto_rawDesc = "" +
 	"\n" +
-	"\x12post/v1/post.proto\x12\apost.v1\x1a\x1fgoogle/protobuf/timestamp.proto\":\n" +
-	"\x10ListPostsRequest\x12\x12\n" +
-	"\x04page\x18\x01 \x01(\x04R\x04page\x12\x12\n" +
-	"\x04size\x18\x02 \x01(\x04R\x04size\"\x9a\x02\n" +
+	"\x12post/v1/post.proto\x12\apost.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xa9\x01\n" +
+	"\x10ListPostsRequest\x12\x16\n" +
+	"\x04page\x18\x01 \x01(\x04B\x02\x18\x01R\x04page\x12\x12\n" +
+	"\x04size\x18\x02 \x01(\x04R\x04size\x12%\n" +
+	"\x04sort\x18\x03 \x01(\x0e2\x11.post.v1.PostSortR\x04sort\x12*\n" +
+	"\x06window\x18\x04 \x01(\x0e2\x12.post.v1.TopWindowR\x06window\x12\x16\n" +
+	"\x06cursor\x18\x05 \x01(\tR\x06cursor\"\xda\x02\n" +
 	"\x04Post\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\x03R\x02id\x129\n" +
 	"\n" +
@@ -227,11 +722,58 @@ const file_post_v1_post_proto_rawDesc = "" +
 	"\x03url\x18\x04 \x01(\tR\x03url\x12 \n" +
 	"\vdescription\x18\x05 \x01(\tR\vdescription\x12,\n" +
 	"\x12number_of_comments\x18\x06 \x01(\x04R\x10numberOfComments\x12*\n" +
-	"\x11number_of_upvotes\x18\a \x01(\x04R\x0fnumberOfUpvotes\"8\n" +
+	"\x11number_of_upvotes\x18\a \x01(\x04R\x0fnumberOfUpvotes\x12\x16\n" +
+	"\x06author\x18\b \x01(\tR\x06author\x12&\n" +
+	"\x0fnumber_of_views\x18\t \x01(\x04R\rnumberOfViews\"\xfd\x02\n" +
+	"\aComment\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\x03R\x06userId\x12\x17\n" +
+	"\apost_id\x18\x03 \x01(\x03R\x06postId\x12\x18\n" +
+	"\acontent\x18\x04 \x01(\tR\acontent\x12*\n" +
+	"\x11number_of_upvotes\x18\x05 \x01(\x04R\x0fnumberOfUpvotes\x129\n" +
+	"\n" +
+	"created_at\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x129\n" +
+	"\n" +
+	"updated_at\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt\x12 \n" +
+	"\tparent_id\x18\b \x01(\x03H\x00R\bparentId\x88\x01\x01\x12\x18\n" +
+	"\adeleted\x18\t \x01(\bR\adeleted\x12*\n" +
+	"\areplies\x18\n" +
+	" \x03(\v2\x10.post.v1.CommentR\arepliesB\f\n" +
+	"\n" +
+	"_parent_id\"Y\n" +
 	"\x11ListPostsResponse\x12#\n" +
-	"\x05posts\x18\x01 \x03(\v2\r.post.v1.PostR\x05posts2Q\n" +
+	"\x05posts\x18\x01 \x03(\v2\r.post.v1.PostR\x05posts\x12\x1f\n" +
+	"\vnext_cursor\x18\x02 \x01(\tR\n" +
+	"nextCursor\"u\n" +
+	"\x0eGetPostRequest\x12\x17\n" +
+	"\apost_id\x18\x01 \x01(\x03R\x06postId\x12#\n" +
+	"\rcomments_size\x18\x02 \x01(\x04R\fcommentsSize\x12%\n" +
+	"\x0ecomments_depth\x18\x03 \x01(\x04R\rcommentsDepth\"b\n" +
+	"\x0fGetPostResponse\x12!\n" +
+	"\x04post\x18\x01 \x01(\v2\r.post.v1.PostR\x04post\x12,\n" +
+	"\bcomments\x18\x02 \x03(\v2\x10.post.v1.CommentR\bcomments\",\n" +
+	"\x11UpvotePostRequest\x12\x17\n" +
+	"\apost_id\x18\x01 \x01(\x03R\x06postId\".\n" +
+	"\x12UpvotePostResponse\x12\x18\n" +
+	"\aupvoted\x18\x01 \x01(\bR\aupvoted*r\n" +
+	"\bPostSort\x12\x19\n" +
+	"\x15POST_SORT_UNSPECIFIED\x10\x00\x12\x11\n" +
+	"\rPOST_SORT_HOT\x10\x01\x12\x11\n" +
+	"\rPOST_SORT_NEW\x10\x02\x12\x11\n" +
+	"\rPOST_SORT_TOP\x10\x03\x12\x12\n" +
+	"\x0ePOST_SORT_BEST\x10\x04*\x8f\x01\n" +
+	"\tTopWindow\x12\x1a\n" +
+	"\x16TOP_WINDOW_UNSPECIFIED\x10\x00\x12\x12\n" +
+	"\x0eTOP_WINDOW_DAY\x10\x01\x12\x13\n" +
+	"\x0fTOP_WINDOW_WEEK\x10\x02\x12\x14\n" +
+	"\x10TOP_WINDOW_MONTH\x10\x03\x12\x13\n" +
+	"\x0fTOP_WINDOW_YEAR\x10\x04\x12\x12\n" +
+	"\x0eTOP_WINDOW_ALL\x10\x052\xd6\x01\n" +
 	"\vPostService\x12B\n" +
-	"\tListPosts\x12\x19.post.v1.ListPostsRequest\x1a\x1a.post.v1.ListPostsResponseB1Z/example.com/authorization/protos/post/v1;postv1b\x06proto3"
+	"\tListPosts\x12\x19.post.v1.ListPostsRequest\x1a\x1a.post.v1.ListPostsResponse\x12<\n" +
+	"\aGetPost\x12\x17.post.v1.GetPostRequest\x1a\x18.post.v1.GetPostResponse\x12E\n" +
+	"\n" +
+	"UpvotePost\x12\x1a.post.v1.UpvotePostRequest\x1a\x1b.post.v1.UpvotePostResponseB1Z/example.com/authorization/protos/post/v1;postv1b\x06proto3"
 
 var (
 	file_post_v1_post_proto_rawDescOnce sync.Once
@@ -245,24 +787,43 @@ func file_post_v1_post_proto_rawDescGZIP() []byte {
 	return file_post_v1_post_proto_rawDescData
 }
 
-var file_post_v1_post_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_post_v1_post_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
+var file_post_v1_post_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
 var file_post_v1_post_proto_goTypes = []any{
-	(*ListPostsRequest)(nil),      // 0: post.v1.ListPostsRequest
-	(*Post)(nil),                  // 1: post.v1.Post
-	(*ListPostsResponse)(nil),     // 2: post.v1.ListPostsResponse
-	(*timestamppb.Timestamp)(nil), // 3: google.protobuf.Timestamp
+	(PostSort)(0),                 // 0: post.v1.PostSort
+	(TopWindow)(0),                // 1: post.v1.TopWindow
+	(*ListPostsRequest)(nil),      // 2: post.v1.ListPostsRequest
+	(*Post)(nil),                  // 3: post.v1.Post
+	(*Comment)(nil),               // 4: post.v1.Comment
+	(*ListPostsResponse)(nil),     // 5: post.v1.ListPostsResponse
+	(*GetPostRequest)(nil),        // 6: post.v1.GetPostRequest
+	(*GetPostResponse)(nil),       // 7: post.v1.GetPostResponse
+	(*UpvotePostRequest)(nil),     // 8: post.v1.UpvotePostRequest
+	(*UpvotePostResponse)(nil),    // 9: post.v1.UpvotePostResponse
+	(*timestamppb.Timestamp)(nil), // 10: google.protobuf.Timestamp
 }
 var file_post_v1_post_proto_depIdxs = []int32{
-	3, // 0: post.v1.Post.created_at:type_name -> google.protobuf.Timestamp
-	3, // 1: post.v1.Post.updated_at:type_name -> google.protobuf.Timestamp
-	1, // 2: post.v1.ListPostsResponse.posts:type_name -> post.v1.Post
-	0, // 3: post.v1.PostService.ListPosts:input_type -> post.v1.ListPostsRequest
-	2, // 4: post.v1.PostService.ListPosts:output_type -> post.v1.ListPostsResponse
-	4, // [4:5] is the sub-list for method output_type
-	3, // [3:4] is the sub-list for method input_type
-	3, // [3:3] is the sub-list for extension type_name
-	3, // [3:3] is the sub-list for extension extendee
-	0, // [0:3] is the sub-list for field type_name
+	0,  // 0: post.v1.ListPostsRequest.sort:type_name -> post.v1.PostSort
+	1,  // 1: post.v1.ListPostsRequest.window:type_name -> post.v1.TopWindow
+	10, // 2: post.v1.Post.created_at:type_name -> google.protobuf.Timestamp
+	10, // 3: post.v1.Post.updated_at:type_name -> google.protobuf.Timestamp
+	10, // 4: post.v1.Comment.created_at:type_name -> google.protobuf.Timestamp
+	10, // 5: post.v1.Comment.updated_at:type_name -> google.protobuf.Timestamp
+	4,  // 6: post.v1.Comment.replies:type_name -> post.v1.Comment
+	3,  // 7: post.v1.ListPostsResponse.posts:type_name -> post.v1.Post
+	3,  // 8: post.v1.GetPostResponse.post:type_name -> post.v1.Post
+	4,  // 9: post.v1.GetPostResponse.comments:type_name -> post.v1.Comment
+	2,  // 10: post.v1.PostService.ListPosts:input_type -> post.v1.ListPostsRequest
+	6,  // 11: post.v1.PostService.GetPost:input_type -> post.v1.GetPostRequest
+	8,  // 12: post.v1.PostService.UpvotePost:input_type -> post.v1.UpvotePostRequest
+	5,  // 13: post.v1.PostService.ListPosts:output_type -> post.v1.ListPostsResponse
+	7,  // 14: post.v1.PostService.GetPost:output_type -> post.v1.GetPostResponse
+	9,  // 15: post.v1.PostService.UpvotePost:output_type -> post.v1.UpvotePostResponse
+	13, // [13:16] is the sub-list for method output_type
+	10, // [10:13] is the sub-list for method input_type
+	10, // [10:10] is the sub-list for extension type_name
+	10, // [10:10] is the sub-list for extension extendee
+	0,  // [0:10] is the sub-list for field type_name
 }
 
 func init() { file_post_v1_post_proto_init() }
@@ -270,18 +831,20 @@ func file_post_v1_post_proto_init() {
 	if File_post_v1_post_proto != nil {
 		return
 	}
+	file_post_v1_post_proto_msgTypes[2].OneofWrappers = []any{}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_post_v1_post_proto_rawDesc), len(file_post_v1_post_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   3,
+			NumEnums:      2,
+			NumMessages:   8,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_post_v1_post_proto_goTypes,
 		DependencyIndexes: file_post_v1_post_proto_depIdxs,
+		EnumInfos:         file_post_v1_post_proto_enumTypes,
 		MessageInfos:      file_post_v1_post_proto_msgTypes,
 	}.Build()
 	File_post_v1_post_proto = out.File
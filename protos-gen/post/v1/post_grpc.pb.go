@@ -19,7 +19,9 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	PostService_ListPosts_FullMethodName = "/post.v1.PostService/ListPosts"
+	PostService_ListPosts_FullMethodName  = "/post.v1.PostService/ListPosts"
+	PostService_GetPost_FullMethodName    = "/post.v1.PostService/GetPost"
+	PostService_UpvotePost_FullMethodName = "/post.v1.PostService/UpvotePost"
 )
 
 // PostServiceClient is the client API for PostService service.
@@ -28,6 +30,10 @@ const (
 type PostServiceClient interface {
 	// this method lists posts using ListPostsRequest and returns hackernews like posts
 	ListPosts(ctx context.Context, in *ListPostsRequest, opts ...grpc.CallOption) (*ListPostsResponse, error)
+	// this method returns a single post with the first page of its comments
+	GetPost(ctx context.Context, in *GetPostRequest, opts ...grpc.CallOption) (*GetPostResponse, error)
+	// this method toggles the upvote of the authorized user on a post
+	UpvotePost(ctx context.Context, in *UpvotePostRequest, opts ...grpc.CallOption) (*UpvotePostResponse, error)
 }
 
 type postServiceClient struct {
@@ -48,12 +54,36 @@ func (c *postServiceClient) ListPosts(ctx context.Context, in *ListPostsRequest,
 	return out, nil
 }
 
+func (c *postServiceClient) GetPost(ctx context.Context, in *GetPostRequest, opts ...grpc.CallOption) (*GetPostResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetPostResponse)
+	err := c.cc.Invoke(ctx, PostService_GetPost_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *postServiceClient) UpvotePost(ctx context.Context, in *UpvotePostRequest, opts ...grpc.CallOption) (*UpvotePostResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UpvotePostResponse)
+	err := c.cc.Invoke(ctx, PostService_UpvotePost_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // PostServiceServer is the server API for PostService service.
 // All implementations must embed UnimplementedPostServiceServer
 // for forward compatibility.
 type PostServiceServer interface {
 	// this method lists posts using ListPostsRequest and returns hackernews like posts
 	ListPosts(context.Context, *ListPostsRequest) (*ListPostsResponse, error)
+	// this method returns a single post with the first page of its comments
+	GetPost(context.Context, *GetPostRequest) (*GetPostResponse, error)
+	// this method toggles the upvote of the authorized user on a post
+	UpvotePost(context.Context, *UpvotePostRequest) (*UpvotePostResponse, error)
 	mustEmbedUnimplementedPostServiceServer()
 }
 
@@ -67,6 +97,12 @@ type UnimplementedPostServiceServer struct{}
 func (UnimplementedPostServiceServer) ListPosts(context.Context, *ListPostsRequest) (*ListPostsResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "method ListPosts not implemented")
 }
+func (UnimplementedPostServiceServer) GetPost(context.Context, *GetPostRequest) (*GetPostResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetPost not implemented")
+}
+func (UnimplementedPostServiceServer) UpvotePost(context.Context, *UpvotePostRequest) (*UpvotePostResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method UpvotePost not implemented")
+}
 func (UnimplementedPostServiceServer) mustEmbedUnimplementedPostServiceServer() {}
 func (UnimplementedPostServiceServer) testEmbeddedByValue()                     {}
 
@@ -106,6 +142,42 @@ func _PostService_ListPosts_Handler(srv interface{}, ctx context.Context, dec fu
 	return interceptor(ctx, in, info, handler)
 }
 
+func _PostService_GetPost_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPostRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PostServiceServer).GetPost(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PostService_GetPost_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PostServiceServer).GetPost(ctx, req.(*GetPostRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PostService_UpvotePost_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpvotePostRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PostServiceServer).UpvotePost(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PostService_UpvotePost_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PostServiceServer).UpvotePost(ctx, req.(*UpvotePostRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // PostService_ServiceDesc is the grpc.ServiceDesc for PostService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -117,6 +189,14 @@ var PostService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "ListPosts",
 			Handler:    _PostService_ListPosts_Handler,
 		},
+		{
+			MethodName: "GetPost",
+			Handler:    _PostService_GetPost_Handler,
+		},
+		{
+			MethodName: "UpvotePost",
+			Handler:    _PostService_UpvotePost_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "post/v1/post.proto",